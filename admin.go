@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Settings that can be changed through /rekt set, for the target of the channel it is run in.
+var filterSettings = map[string]func(f *Filter, value string) error{
+	"min_usd": func(f *Filter, value string) error {
+		usd, err := strconv.ParseFloat(strings.TrimPrefix(strings.Replace(value, ",", "", -1), "$"), 64)
+		if err != nil || usd < 0 {
+			return fmt.Errorf("invalid amount %q", value)
+		}
+		f.MinUSD = usd
+		return nil
+	},
+	"min": func(f *Filter, value string) error {
+		threshold, err := ParseThreshold(value)
+		if err != nil {
+			return err
+		}
+		f.Min = threshold
+		return nil
+	},
+	"symbols": func(f *Filter, value string) error {
+		f.Symbols = nil
+		for _, symbol := range splitList(value) {
+			f.Symbols = append(f.Symbols, Symbol(strings.ToUpper(symbol)))
+		}
+		return nil
+	},
+	"assets": func(f *Filter, value string) error {
+		f.Assets = nil
+		for _, asset := range splitList(value) {
+			f.Assets = append(f.Assets, strings.ToUpper(asset))
+		}
+		return nil
+	},
+	"perpetuals": func(f *Filter, value string) error {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected true or false", value)
+		}
+		f.Perpetuals = on
+		return nil
+	},
+	"auto_rate": func(f *Filter, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 {
+			return fmt.Errorf("invalid rate %q, expected messages per hour", value)
+		}
+		f.AutoRate = rate
+		return nil
+	},
+	"sides": func(f *Filter, value string) error {
+		sides := splitList(value)
+		for _, side := range sides {
+			if side != "long" && side != "short" {
+				return fmt.Errorf("invalid side %q, expected long or short", side)
+			}
+		}
+		f.Sides = sides
+		return nil
+	},
+	"tiers": func(f *Filter, value string) error {
+		names := splitList(value)
+		for _, name := range names {
+			found := false
+			for _, tier := range currentTiers().Names() {
+				found = found || strings.EqualFold(name, tier)
+			}
+			if !found {
+				return fmt.Errorf("unknown tier %q, expected one of %v", name, strings.Join(currentTiers().Names(), ", "))
+			}
+		}
+		f.Tiers = names
+		return nil
+	},
+}
+
+// rektCommand is /rekt, the bot's runtime settings and their audit log.
+func rektCommand(targets func() []*TargetSink, settings *Settings, audit *AuditLog) *SlashCommand {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, name := range []string{"min_usd", "min", "symbols", "perpetuals", "assets", "sides", "tiers", "auto_rate"} {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+	}
+	minCount := 1.0
+	levels := []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "admin", Value: string(PermissionAdmin)},
+		{Name: "member", Value: string(PermissionMember)},
+	}
+	roleOptions := []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "Role", Required: true},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "level", Description: "Permission", Required: true, Choices: levels},
+	}
+
+	return &SlashCommand{
+		Permission: PermissionAdmin,
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "rekt",
+			Description: "Bot settings",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "show", Description: "Show the filter of this channel"},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "set", Description: "Change the filter of this channel", Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "setting", Description: "Setting to change", Required: true, Choices: choices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "value", Description: "New value, lists are comma separated, empty to clear", Required: true},
+				}},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "audit", Description: "Recent setting changes", Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionInteger, Name: "count", Description: "Number of changes, 10 by default", MinValue: &minCount, MaxValue: 50},
+				}},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "grant", Description: "Let a role use the commands of a permission", Options: roleOptions},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "revoke", Description: "Take a permission back from a role", Options: roleOptions},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "pause", Description: "Stop posting the liquidations in this channel, they are summed up on resume", Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "duration", Description: "How long for, such as 2h, until resumed by default"},
+				}},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "resume", Description: "Post the liquidations in this channel again"},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "pin", Description: "Pin the largest liquidation of the day", Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether to pin it in this server", Required: true},
+				}},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "timezone", Description: "Post the recaps after midnight in this timezone", Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "zone", Description: "Such as Europe/Paris or America/New_York, UTC by default", Required: true},
+				}},
+			},
+		},
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			switch req.Subcommand {
+			case "audit":
+				return &discordgo.InteractionResponseData{
+					Content:         auditText(audit.Recent(req.Interaction.GuildID, int(req.Int("count", 10)))),
+					AllowedMentions: &discordgo.MessageAllowedMentions{},
+				}, nil
+			case "grant", "revoke":
+				return changeRoles(req, settings, audit)
+			case "pin":
+				return changePinning(req, settings, audit)
+			case "timezone":
+				return changeTimezone(req, settings, audit)
+			}
+
+			var target *TargetSink
+			for _, t := range targets() {
+				if t.Channel == req.Interaction.ChannelID {
+					target = t
+				}
+			}
+			if target == nil {
+				return nil, fmt.Errorf("the bot doesn't post in this channel")
+			}
+
+			switch req.Subcommand {
+			case "show":
+				return &discordgo.InteractionResponseData{Content: filterText(target.Filter())}, nil
+			case "pause", "resume":
+				return changePause(req, target, settings, audit)
+			}
+
+			setting, value := req.String("setting", ""), strings.TrimSpace(req.String("value", ""))
+			apply, ok := filterSettings[setting]
+			if !ok {
+				return nil, fmt.Errorf("unknown setting %q", setting)
+			}
+
+			old := target.Filter()
+			filter := old
+			if err := apply(&filter, value); err != nil {
+				return nil, err
+			}
+
+			if err := settings.SetFilter(target.Channel, filter); err != nil {
+				return nil, err
+			}
+			target.SetFilter(filter)
+
+			entry := auditEntry(req, setting, filterValue(old, setting), filterValue(filter, setting))
+			if err := audit.Record(entry); err != nil {
+				return nil, err
+			}
+
+			return &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Changed %v from %v to %v", setting, entry.Old, entry.New),
+			}, nil
+		},
+	}
+}
+
+// changeRoles grants or revokes a permission of a role in the guild the command is run in.
+func changeRoles(req *CommandRequest, settings *Settings, audit *AuditLog) (*discordgo.InteractionResponseData, error) {
+	guild := req.Interaction.GuildID
+	if guild == "" {
+		return nil, fmt.Errorf("roles only exist in servers")
+	}
+
+	role := req.Options["role"].RoleValue(nil, guild).ID
+	level := Permission(req.String("level", string(PermissionMember)))
+
+	old := settings.Roles(guild, level)
+	var roles []string
+	for _, r := range old {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	if req.Subcommand == "grant" {
+		roles = append(roles, role)
+	}
+
+	if err := settings.SetRoles(guild, level, roles); err != nil {
+		return nil, err
+	}
+
+	entry := auditEntry(req, string(level)+" roles", rolesText(old, level), rolesText(roles, level))
+	if err := audit.Record(entry); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.InteractionResponseData{
+		Content:         fmt.Sprintf("The %v commands are now for %v", level, entry.New),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}, nil
+}
+
+// changePause pauses or resumes the target of the channel the command is run in, keeping the
+// pause in the settings.
+func changePause(req *CommandRequest, target *TargetSink, settings *Settings, audit *AuditLog) (*discordgo.InteractionResponseData, error) {
+	old := pauseText(target)
+
+	if req.Subcommand == "resume" {
+		if !target.Resume() {
+			return nil, fmt.Errorf("the channel isn't paused")
+		}
+		if err := settings.ClearPause(target.Channel); err != nil {
+			return nil, err
+		}
+	} else {
+		var d time.Duration
+		if text := strings.TrimSpace(req.String("duration", "")); text != "" {
+			var err error
+			if d, err = parsePeriod(text); err != nil {
+				return nil, err
+			}
+		}
+		if err := settings.SetPause(target.Channel, target.Pause(d)); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := auditEntry(req, "pause", old, pauseText(target))
+	if err := audit.Record(entry); err != nil {
+		return nil, err
+	}
+
+	if req.Subcommand == "resume" {
+		return &discordgo.InteractionResponseData{Content: "Resumed"}, nil
+	}
+	return &discordgo.InteractionResponseData{Content: "Paused " + entry.New + ", the liquidations in between will be summed up on resume"}, nil
+}
+
+// pauseText describes whether the target is paused: "until <t:1714554000:f>", which Discord shows
+// in the reader's timezone, "until resumed" or "off".
+func pauseText(target *TargetSink) string {
+	until, paused := target.Paused()
+	switch {
+	case !paused:
+		return "off"
+	case until.IsZero():
+		return "until resumed"
+	default:
+		return fmt.Sprintf("until <t:%v:f>", until.Unix())
+	}
+}
+
+// changePinning turns the daily record pin on or off in the guild the command is run in.
+func changePinning(req *CommandRequest, settings *Settings, audit *AuditLog) (*discordgo.InteractionResponseData, error) {
+	guild := req.Interaction.GuildID
+	if guild == "" {
+		return nil, fmt.Errorf("pins are set per server")
+	}
+
+	pin := req.Options["enabled"].BoolValue()
+	old := settings.Pinning(guild, false)
+	if err := settings.SetPinning(guild, pin); err != nil {
+		return nil, err
+	}
+
+	entry := auditEntry(req, "pin", strconv.FormatBool(old), strconv.FormatBool(pin))
+	if err := audit.Record(entry); err != nil {
+		return nil, err
+	}
+
+	if pin {
+		return &discordgo.InteractionResponseData{Content: "The largest liquidation of the day will be pinned"}, nil
+	}
+	return &discordgo.InteractionResponseData{Content: "The daily record won't be pinned anymore"}, nil
+}
+
+// changeTimezone sets the timezone of the recaps of the guild the command is run in.
+func changeTimezone(req *CommandRequest, settings *Settings, audit *AuditLog) (*discordgo.InteractionResponseData, error) {
+	guild := req.Interaction.GuildID
+	if guild == "" {
+		return nil, fmt.Errorf("timezones are set per server")
+	}
+
+	name := strings.TrimSpace(req.String("zone", ""))
+	old := settings.Timezone(guild)
+	if err := settings.SetTimezone(guild, name); err != nil {
+		return nil, fmt.Errorf("unknown timezone %q, use a name such as Europe/Paris", name)
+	}
+	zone := settings.Timezone(guild)
+
+	entry := auditEntry(req, "timezone", old.String(), zone.String())
+	if err := audit.Record(entry); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.InteractionResponseData{Content: fmt.Sprintf("The recaps will follow midnight in %v", zone)}, nil
+}
+
+func auditEntry(req *CommandRequest, setting, old, new string) AuditEntry {
+	user := req.User()
+	return AuditEntry{
+		Time:    time.Now(),
+		UserID:  user.ID,
+		User:    user.String(),
+		Guild:   req.Interaction.GuildID,
+		Channel: req.Interaction.ChannelID,
+		Setting: setting,
+		Old:     old,
+		New:     new,
+	}
+}
+
+// filterValue writes a single setting of the filter.
+func filterValue(f Filter, setting string) string {
+	switch setting {
+	case "min_usd":
+		return DefaultFormat.Short(int64(f.MinUSD)) // In dollars, whatever the currency shown
+	case "min":
+		if f.Min.Amount == 0 {
+			return "none"
+		}
+		return f.Min.String()
+	case "symbols":
+		if len(f.Symbols) == 0 {
+			return "all"
+		}
+		symbols := make([]string, len(f.Symbols))
+		for i, symbol := range f.Symbols {
+			symbols[i] = string(symbol)
+		}
+		return strings.Join(symbols, ", ")
+	case "perpetuals":
+		return strconv.FormatBool(f.Perpetuals)
+	case "assets":
+		if len(f.Assets) == 0 {
+			return "all"
+		}
+		return strings.Join(f.Assets, ", ")
+	case "sides":
+		if len(f.Sides) == 0 {
+			return "both"
+		}
+		return strings.Join(f.Sides, ", ")
+	case "tiers":
+		if len(f.Tiers) == 0 {
+			return "all"
+		}
+		return strings.Join(f.Tiers, ", ")
+	case "auto_rate":
+		if f.AutoRate == 0 {
+			return "off"
+		}
+		return strconv.FormatFloat(f.AutoRate, 'f', -1, 64) + " per hour"
+	}
+	return ""
+}
+
+func filterText(f Filter) string {
+	return fmt.Sprintf("min_usd: %v\nmin: %v\nsymbols: %v\nperpetuals: %v\nassets: %v\nsides: %v\ntiers: %v\nauto_rate: %v",
+		filterValue(f, "min_usd"), filterValue(f, "min"), filterValue(f, "symbols"), filterValue(f, "perpetuals"), filterValue(f, "assets"), filterValue(f, "sides"), filterValue(f, "tiers"), filterValue(f, "auto_rate"))
+}
+
+func auditText(entries []AuditEntry) string {
+	if len(entries) == 0 {
+		return "No changes yet"
+	}
+
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = fmt.Sprintf("<t:%v:f> <@%v> set %v in <#%v>: %v → %v",
+			e.Time.Unix(), e.UserID, e.Setting, e.Channel, e.Old, e.New)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitList splits a comma separated list, dropping the empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(strings.ToLower(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
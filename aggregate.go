@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Aggregator replaces the individual messages by a rolling bar posted every Interval, for servers
+// that want the signal without the firehose.
+type Aggregator struct {
+	Interval time.Duration
+	Format   NumberFormat // Of the amounts of the bars
+
+	mu         sync.Mutex
+	orders     int
+	longsUSD   int64
+	shortsUSD  int64
+	underlying map[string]int64
+	emoji      map[string]string    // By underlying
+	streak     DecoratedLiquidation // Longest notable side streak of the bar
+	stop       chan struct{}        // Closed by Stop
+}
+
+// Add counts the liquidation towards the current bar.
+func (a *Aggregator) Add(dl DecoratedLiquidation) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	l := dl.Liquidation
+	if dl.SideStreakText() != "" && dl.SideStreak > a.streak.SideStreak {
+		a.streak = dl
+	}
+
+	if a.underlying == nil {
+		a.underlying = make(map[string]int64)
+	}
+	if l.Underlying != "" {
+		a.underlying[l.Underlying] += l.USDValue()
+	}
+	if l.Emoji != "" {
+		if a.emoji == nil {
+			a.emoji = make(map[string]string)
+		}
+		a.emoji[l.Underlying] = l.Emoji
+	}
+
+	a.orders++
+	if l.Side == "Buy" {
+		a.shortsUSD += l.USDValue()
+	} else {
+		a.longsUSD += l.USDValue()
+	}
+}
+
+// Run announces a bar every interval, skipping the ones where nothing happened, until Stop.
+func (a *Aggregator) Run(announce func(text string)) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	stop := a.stopped()
+	for {
+		select {
+		case <-ticker.C:
+			if text := a.flush(); text != "" {
+				announce(text)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Stop ends Run, dropping the current bar.
+func (a *Aggregator) Stop() {
+	stop := a.stopped()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+}
+
+func (a *Aggregator) stopped() chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stop == nil {
+		a.stop = make(chan struct{})
+	}
+	return a.stop
+}
+
+// flush returns the text of the current bar and starts a new one.
+func (a *Aggregator) flush() string {
+	a.mu.Lock()
+	orders, longsUSD, shortsUSD, underlying, emoji, streak := a.orders, a.longsUSD, a.shortsUSD, a.underlying, a.emoji, a.streak
+	a.orders, a.longsUSD, a.shortsUSD, a.underlying, a.emoji, a.streak = 0, 0, 0, nil, nil, DecoratedLiquidation{}
+	a.mu.Unlock()
+
+	if orders == 0 {
+		return ""
+	}
+
+	orderText := "orders"
+	if orders == 1 {
+		orderText = "order"
+	}
+
+	text := fmt.Sprintf("Last %v: %v longs / %v shorts rekt across %v %v",
+		durationText(a.Interval), a.Format.Short(longsUSD), a.Format.Short(shortsUSD), orders, orderText)
+
+	// Break it down when several assets were hit, related contracts counting together
+	if len(underlying) > 1 {
+		assets := make([]string, 0, len(underlying))
+		for asset := range underlying {
+			assets = append(assets, asset)
+		}
+		sort.Slice(assets, func(i, j int) bool { return underlying[assets[i]] > underlying[assets[j]] })
+
+		parts := make([]string, len(assets))
+		for i, asset := range assets {
+			parts[i] = asset + " " + a.Format.Short(underlying[asset])
+			if e, ok := emoji[asset]; ok {
+				parts[i] = e + " " + parts[i]
+			}
+		}
+		text += " (" + strings.Join(parts, ", ") + ")"
+	}
+
+	if side := streak.SideStreakText(); side != "" {
+		text += ". " + side
+	}
+
+	return text
+}
+
+// durationText writes round durations the way people do: "5 min", "1 h".
+func durationText(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%v h", int64(d/time.Hour))
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%v min", int64(d/time.Minute))
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// AlertSink DMs the liquidations to the users who asked for them with the buttons under the whale messages.
+type AlertSink struct {
+	Session  *discordgo.Session
+	Settings *Settings
+	Format   NumberFormat
+
+	mu       sync.Mutex
+	channels map[string]string // DM channel by user ID
+}
+
+// Publish implements Sink.
+func (s *AlertSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	users := s.Settings.Alerted(float64(dl.Liquidation.USDValue()))
+	if len(users) == 0 || dl.Liquidation.Historical {
+		return nil
+	}
+
+	text := dl.Format(s.Format)
+	for _, user := range users {
+		channel, err := s.channel(user)
+		if err == nil {
+			_, err = s.Session.ChannelMessageSend(channel, text, discordgo.WithContext(ctx))
+		}
+		if err != nil {
+			log.Printf("Failed to DM the alert to %v: %v\n", user, err)
+		}
+	}
+
+	return nil
+}
+
+// Announce implements Sink, only liquidations are DMed.
+func (s *AlertSink) Announce(ctx context.Context, text string) error {
+	return nil
+}
+
+func (s *AlertSink) channel(user string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if channel, ok := s.channels[user]; ok {
+		return channel, nil
+	}
+
+	dm, err := s.Session.UserChannelCreate(user)
+	if err != nil {
+		return "", err
+	}
+	if s.channels == nil {
+		s.channels = make(map[string]string)
+	}
+	s.channels[user] = dm.ID
+
+	return dm.ID, nil
+}
+
+// alertButtons are put under the whale messages: one to be DMed liquidations of at least minUSD, one to stop.
+func alertButtons(minUSD float64, f NumberFormat) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    fmt.Sprintf("\U0001F514 Alert me on %v+", f.Short(int64(minUSD))),
+				Style:    discordgo.PrimaryButton,
+				CustomID: "alert:" + strconv.FormatFloat(minUSD, 'f', -1, 64),
+			},
+			discordgo.Button{Label: "\U0001F515 Stop alerts", Style: discordgo.SecondaryButton, CustomID: "alert:off"},
+		}},
+	}
+}
+
+// alertButton answers the alert buttons, "alert:<min USD>" or "alert:off", only to the user who clicked.
+func alertButton(settings *Settings, f NumberFormat) ComponentHandler {
+	return func(req *CommandRequest, args []string) (*discordgo.InteractionResponseData, error) {
+		if len(args) != 1 {
+			return nil, errors.New("bad alert button")
+		}
+
+		var minUSD float64
+		content := "You won't be DMed liquidations anymore"
+		if args[0] != "off" {
+			var err error
+			if minUSD, err = strconv.ParseFloat(args[0], 64); err != nil || minUSD <= 0 {
+				return nil, errors.New("bad alert button")
+			}
+			content = fmt.Sprintf("You will be DMed the liquidations of %v and more", f.Short(int64(minUSD)))
+		}
+
+		if err := settings.SetAlert(req.User().ID, minUSD); err != nil {
+			return nil, err
+		}
+
+		return &discordgo.InteractionResponseData{Content: content, Flags: discordgo.MessageFlagsEphemeral}, nil
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAlertButton(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	settings, err := LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	click := func(user, id string) *discordgo.InteractionResponseData {
+		req := &CommandRequest{Interaction: &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+			Member: &discordgo.Member{User: &discordgo.User{ID: user}},
+		}}}
+		resp, err := alertButton(settings, DefaultFormat)(req, []string{id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Flags&discordgo.MessageFlagsEphemeral == 0 {
+			t.Error("expected the answer to be ephemeral")
+		}
+		return resp
+	}
+
+	buttons := alertButtons(10000000, DefaultFormat)[0].(discordgo.ActionsRow).Components
+	if label := buttons[0].(discordgo.Button).Label; label != "\U0001F514 Alert me on $10.0M+" {
+		t.Errorf("unexpected label %q", label)
+	}
+
+	click("alice", "10000000")
+	click("bob", "50000000")
+	if users := settings.Alerted(20000000); !reflect.DeepEqual(users, []string{"alice"}) {
+		t.Errorf("expected only alice to be alerted about $20M, got %v", users)
+	}
+
+	// Kept across restarts
+	click("alice", "off")
+	settings, err = LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users := settings.Alerted(100000000); !reflect.DeepEqual(users, []string{"bob"}) {
+		t.Errorf("expected only bob to be left, got %v", users)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// AuditEntry is a single change of the runtime settings.
+	AuditEntry struct {
+		Time    time.Time `json:"time"`
+		UserID  string    `json:"user_id"`
+		User    string    `json:"user"`
+		Guild   string    `json:"guild"`
+		Channel string    `json:"channel"`
+		Setting string    `json:"setting"`
+		Old     string    `json:"old"`
+		New     string    `json:"new"`
+	}
+
+	// AuditLog records who changed what, so servers with several admins can tell. It is a JSON lines file.
+	AuditLog struct {
+		mu      sync.Mutex
+		entries []AuditEntry
+		file    *os.File
+		enc     *json.Encoder
+	}
+)
+
+// OpenAuditLog loads the audit log at path and appends to it.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	a := &AuditLog{}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+				a.entries = append(a.entries, entry)
+			}
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	a.file, a.enc = f, json.NewEncoder(f)
+
+	return a, nil
+}
+
+// Record appends the entry.
+func (a *AuditLog) Record(entry AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, entry)
+	return a.enc.Encode(entry)
+}
+
+// Recent returns the last n entries of the guild, newest first, those of every guild when it is empty.
+func (a *AuditLog) Recent(guild string, n int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var recent []AuditEntry
+	for i := len(a.entries) - 1; i >= 0 && len(recent) < n; i-- {
+		if guild == "" || a.entries[i].Guild == guild {
+			recent = append(recent, a.entries[i])
+		}
+	}
+	return recent
+}
+
+// Close closes the audit log.
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AutoThreshold works out, for each symbol, the size a liquidation must reach for the filters with
+// an auto rate to post about as many of them per hour as they ask for. It is computed from the
+// sizes in the history over Window, so it rises when a symbol gets busy and falls when it calms
+// down. The sizes are only read once a filter asks for a threshold, leaving the history alone
+// while none has an auto rate.
+type AutoThreshold struct {
+	History  *History
+	Window   time.Duration
+	Interval time.Duration // How often the sizes are read again from the history, never when zero
+
+	started sync.Once
+	mu      sync.Mutex
+	sizes   map[Symbol][]float64 // Largest first, nil until the first refresh
+}
+
+// How often the thresholds are worked out again
+const autoThresholdInterval = 5 * time.Minute
+
+// autoThresholds are the thresholds the filters with an auto rate use, none until the history is read.
+var autoThresholds = &AutoThreshold{}
+
+// Run reads the sizes right away and then every interval.
+func (a *AutoThreshold) Run() {
+	for ; ; time.Sleep(a.Interval) {
+		a.refresh(time.Now())
+	}
+}
+
+// refresh reads the sizes of each symbol over the window from the history.
+func (a *AutoThreshold) refresh(now time.Time) {
+	sizes := make(map[Symbol][]float64)
+	for _, l := range a.History.Since(now.Add(-a.Window), nil) {
+		sizes[l.Symbol] = append(sizes[l.Symbol], float64(l.USDValue()))
+	}
+	for _, s := range sizes {
+		sort.Sort(sort.Reverse(sort.Float64Slice(s)))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sizes = sizes
+}
+
+// Threshold returns the smallest size of the symbol that would have kept it to perHour postings
+// over the window, 0 when it had fewer liquidations than that or nothing is known yet.
+func (a *AutoThreshold) Threshold(symbol Symbol, perHour float64) float64 {
+	if a.History != nil && a.Interval > 0 {
+		a.started.Do(func() { go a.Run() })
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sizes := a.sizes[symbol]
+	allowed := int(math.Floor(perHour * a.Window.Hours()))
+	if allowed < 1 {
+		allowed = 1
+	}
+	if len(sizes) <= allowed {
+		return 0
+	}
+	return sizes[allowed-1]
+}
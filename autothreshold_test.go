@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAutoThreshold(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	for i, usd := range []float64{9000000, 3000000, 1000000, 5000000, 2000000, 4000000} {
+		l := Liquidation{Symbol: "XBTUSD", USD: usd, Received: now.Add(time.Duration(i-6) * time.Minute)}
+		if i == 0 {
+			l.Received = now.Add(-2 * time.Hour) // Past the window
+		}
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &AutoThreshold{History: h, Window: time.Hour}
+	if threshold := a.Threshold("XBTUSD", 2); threshold != 0 {
+		t.Errorf("expected no threshold before the first refresh, got %v", threshold)
+	}
+
+	a.refresh(now)
+	if threshold := a.Threshold("XBTUSD", 2); threshold != 4000000 {
+		t.Errorf("expected the 2nd largest in the hour, got %v", threshold)
+	}
+	if threshold := a.Threshold("XBTUSD", 10); threshold != 0 {
+		t.Errorf("expected no threshold with fewer liquidations than the rate, got %v", threshold)
+	}
+
+	previous := autoThresholds
+	defer func() { autoThresholds = previous }()
+	autoThresholds = a
+
+	f := Filter{AutoRate: 2}
+	if !f.Match(Liquidation{Symbol: "XBTUSD", USD: 4000000}, nil) || f.Match(Liquidation{Symbol: "XBTUSD", USD: 3000000}, nil) {
+		t.Error("expected only the liquidations above the threshold to match")
+	}
+	if !f.Match(Liquidation{Symbol: "ETHUSD", USD: 1000}, nil) {
+		t.Error("expected the symbols without history to match")
+	}
+
+	// The sizes are read once a filter asks for a threshold
+	lazy := &AutoThreshold{History: h, Window: time.Hour, Interval: time.Hour}
+	lazy.Threshold("XBTUSD", 2)
+	for deadline := time.Now().Add(time.Second); lazy.Threshold("XBTUSD", 2) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the sizes to be read on asking for a threshold")
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/klauspost/compress/zstd"
+)
+
+// backupFile is a state file, named in the backup the same whatever the config of the host.
+type backupFile struct {
+	Name string // In the archive
+	Path string // On this host
+}
+
+// backupFiles returns the state files worth moving to another host: the high scores, the
+// settings, the tenants, the audit log and the history.
+func backupFiles(cfg BotConfig) []backupFile {
+	files := []backupFile{{highScoresFile, statePath(highScoresFile)}}
+	for _, file := range []backupFile{
+		{"settings.json", cfg.SettingsFile},
+		{"tenants.json", cfg.TenantsFile},
+		{"audit.jsonl", cfg.AuditFile},
+		{"history.jsonl", cfg.HistoryFile},
+	} {
+		if file.Path != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// backupName returns the default name of a backup taken at the time.
+func backupName(now time.Time) string {
+	return "rekt-backup-" + now.UTC().Format("20060102T150405Z") + ".tar.zst"
+}
+
+// writeBackup writes the files as a zstd compressed tarball, skipping those that don't exist yet.
+// The bot may be running: the high scores are replaced whole, and the files appended to are
+// copied up to the size they had when they were reached.
+func writeBackup(w io.Writer, files []backupFile) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	for _, file := range files {
+		if err := addBackupFile(tw, file); err != nil {
+			zw.Close()
+			return errwrap.Wrapf("could not back up "+file.Path+": {{err}}", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+func addBackupFile(tw *tar.Writer, file backupFile) error {
+	f, err := os.Open(file.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{Name: file.Name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// restoreBackup writes the files of the backup over to where this host keeps them, returning
+// their paths. Unless forced, it refuses to overwrite any state file that already exists.
+func restoreBackup(r io.Reader, files []backupFile, force bool) ([]string, error) {
+	paths := make(map[string]string)
+	for _, file := range files {
+		paths[file.Name] = file.Path
+		if _, err := os.Stat(file.Path); err == nil && !force {
+			return nil, fmt.Errorf("%v already exists, use --force to overwrite it", file.Path)
+		}
+	}
+
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	var restored []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return restored, nil
+		} else if err != nil {
+			return restored, errwrap.Wrapf("bad backup: {{err}}", err)
+		}
+
+		path, ok := paths[header.Name]
+		if !ok {
+			log.Println("Skipping", header.Name, "from the backup, it isn't a state file this host keeps")
+			continue
+		}
+		if err := restoreFile(tr, path); err != nil {
+			return restored, errwrap.Wrapf("could not restore "+path+": {{err}}", err)
+		}
+		restored = append(restored, path)
+	}
+}
+
+// restoreFile writes the file next to its path before moving it there, so a failure doesn't
+// leave half of it behind.
+func restoreFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// backupCommand backs up the state files: rekt backup [--out backup.tar.zst]
+func backupCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", backupName(time.Now()), "file to write the backup to")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return errwrap.Wrapf("unable to load config: {{err}}", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := writeBackup(f, backupFiles(cfg)); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println("Backed up the state to", *out)
+	return nil
+}
+
+// restoreCommand restores the state files of a backup, with the bot stopped: rekt restore backup.tar.zst [--force]
+func restoreCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := fs.Bool("force", false, "overwrite the state files already there")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("usage: rekt restore <backup.tar.zst> [--force]")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return errwrap.Wrapf("unable to load config: {{err}}", err)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	restored, err := restoreBackup(f, backupFiles(cfg), *force)
+	for _, path := range restored {
+		fmt.Println("Restored", path)
+	}
+	return err
+}
+
+// BackupScheduler uploads a backup of the state files to S3 every Interval.
+type BackupScheduler struct {
+	Target   string // s3://bucket/prefix, or the URL of a bucket on an S3 compatible store, e.g. https://minio.local/bucket/prefix
+	Interval time.Duration
+	Files    []backupFile
+	Client   *http.Client
+}
+
+// Run uploads the backups until the context is done.
+func (b *BackupScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := b.upload(ctx, now); err != nil {
+				metrics.Counter("rekt_backups_total", "result", "error").Inc()
+				ops.Alert("backup", "Failed to upload the backup of the state: %v", err)
+				continue
+			}
+			metrics.Counter("rekt_backups_total", "result", "ok").Inc()
+		}
+	}
+}
+
+// upload puts a backup in the bucket, named after the time.
+func (b *BackupScheduler) upload(ctx context.Context, now time.Time) error {
+	region := awsRegion()
+	if region == "" || os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		return fmt.Errorf("AWS_REGION and AWS_ACCESS_KEY_ID must be set to upload to %v", b.Target)
+	}
+
+	target, err := backupURL(b.Target, region, backupName(now))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := writeBackup(&buf, b.Files); err != nil {
+		return err
+	}
+	payload := buf.Bytes()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(payload)
+	req.Header.Set("Content-Type", "application/zstd")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	signAWS(req, payload, region, "s3", now)
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	log.Println("Uploaded the backup of the state to", target)
+	return nil
+}
+
+// backupURL returns where to put the object named name: s3:// targets go to the virtual-hosted
+// bucket of the region, other URLs are taken as the path-style bucket of an S3 compatible store.
+func backupURL(target, region, name string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", errwrap.Wrapf("invalid backup_s3: {{err}}", err)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		u.Scheme, u.Host = "https", u.Host+".s3."+region+".amazonaws.com"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("invalid backup_s3 %q: expected s3://bucket/prefix or the URL of a bucket", target)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	return u.String(), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	files := func(dir string) []backupFile {
+		return []backupFile{
+			{highScoresFile, filepath.Join(dir, highScoresFile)},
+			{"settings.json", filepath.Join(dir, "settings.json")},
+			{"history.jsonl", filepath.Join(dir, "history", "history.jsonl")},
+		}
+	}
+
+	// The settings were never changed, so there are none to back up
+	ioutil.WriteFile(filepath.Join(from, highScoresFile), []byte(`{"scores":{}}`), 0644)
+	os.MkdirAll(filepath.Join(from, "history"), 0755)
+	ioutil.WriteFile(filepath.Join(from, "history", "history.jsonl"), []byte("{}\n{}\n"), 0644)
+
+	var buf bytes.Buffer
+	if err := writeBackup(&buf, files(from)); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := restoreBackup(bytes.NewReader(buf.Bytes()), files(to), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("expected the high scores and the history to be restored, got %v", restored)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(to, "history", "history.jsonl")); string(data) != "{}\n{}\n" {
+		t.Errorf("expected the history to be restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(to, "settings.json")); !os.IsNotExist(err) {
+		t.Error("expected no settings to be restored")
+	}
+
+	// What is there is left alone unless forced
+	if _, err := restoreBackup(bytes.NewReader(buf.Bytes()), files(to), false); err == nil {
+		t.Error("expected restoring over the state to be refused")
+	}
+	if _, err := restoreBackup(bytes.NewReader(buf.Bytes()), files(to), true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackupUpload(t *testing.T) {
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	var path, auth string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, highScoresFile), []byte(`{"scores":{}}`), 0644)
+	b := &BackupScheduler{
+		Target: server.URL + "/bucket/rekt/",
+		Files:  []backupFile{{highScoresFile, filepath.Join(dir, highScoresFile)}},
+		Client: server.Client(),
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := b.upload(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bucket/rekt/rekt-backup-20240601T120000Z.tar.zst" {
+		t.Errorf("unexpected object %v", path)
+	}
+	if !strings.Contains(auth, "/eu-west-1/s3/aws4_request") || !strings.Contains(auth, "x-amz-content-sha256") {
+		t.Errorf("expected the upload to be signed for S3, got %q", auth)
+	}
+
+	restored, err := restoreBackup(bytes.NewReader(body), []backupFile{{highScoresFile, filepath.Join(t.TempDir(), highScoresFile)}}, false)
+	if err != nil || len(restored) != 1 {
+		t.Errorf("expected the uploaded backup to restore, got %v, %v", restored, err)
+	}
+}
+
+func TestBackupURL(t *testing.T) {
+	u, err := backupURL("s3://rekt-backups/prod", "us-east-1", "b.tar.zst")
+	if err != nil || u != "https://rekt-backups.s3.us-east-1.amazonaws.com/prod/b.tar.zst" {
+		t.Errorf("unexpected URL %v, %v", u, err)
+	}
+	if _, err := backupURL("ftp://host/bucket", "us-east-1", "b.tar.zst"); err == nil {
+		t.Error("expected an unknown scheme to be refused")
+	}
+}
@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/errwrap"
+)
+
+// Constants for Websocket
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+
+	// Time allowed for the subscriptions to be acknowledged after connecting.
+	subscribeWait = 30 * time.Second
+
+	// Check the subscriptions are still alive with this period. BitMex has no sequence numbers and a
+	// quiet liquidation table is normal, so subscribing again is the only way to tell one was dropped:
+	// a live subscription is rejected as a duplicate.
+	probePeriod = 5 * time.Minute
+)
+
+// Liquidations smaller than this many contracts are not worth posting.
+const minLeavesQty = 5000
+
+// Orders are tracked for this long after their delete, for re-inserts, and no more than this many
+// of them, a cascade touching a few thousand at most.
+const (
+	deleteWindow     = 10 * time.Second
+	maxTrackedOrders = 100000
+)
+
+// BitMexClient streams liquidations from BitMex into the pipeline.
+type BitMexClient struct {
+	Name     string
+	URL      string // The realtime endpoint, the subscriptions are added to the query
+	Dialer   *websocket.Dialer
+	Pipeline *Pipeline // nil when only recording
+	Tables   []string  // Subscribed through the URL, in the order they were added
+
+	// API credentials, only needed for the private tables.
+	APIKey    string
+	APISecret string
+
+	// Compression negotiates permessage-deflate, which BitMex may or may not accept.
+	Compression bool
+
+	// Recorder captures every raw frame when set.
+	Recorder *Recorder
+
+	// Quarantine keeps the frames that couldn't be processed, they are only logged when nil.
+	Quarantine *Quarantine
+
+	// CatchUp sums up the open liquidations found on connecting in a single message, as they
+	// came in while the bot was away. Either way they are published as historical.
+	CatchUp bool
+
+	// Historical marks every liquidation as historical, for replays.
+	Historical bool
+
+	// Gaps records the times the feed was down and what was recovered of them, when set.
+	Gaps *Gaps
+
+	// Now is the clock used for the dedup window, replays use the recorded time instead.
+	Now func() time.Time
+
+	// The BitMex may "insert" / "delete / "insert" the order when it is able to liquidate at a better price
+	// "insert" is sent when the order is submitted
+	// "delete" is sent when the order is executed
+	// It may also "update" the order when the it is amended or partially filled
+	// The following sequence is possible: insert ..... update ..... delete/insert ..... update ..... delete/insert ..... delete
+	// ..... indicated a posssible time delay
+
+	// Thus we need to keep track of when the order was last deleted and purge it as neccessary
+	lastDelete *TTLCache
+
+	// Liquidations published for each order, so an amendment can be told apart and followed
+	orders *TTLCache // bitmexOrder by order ID
+
+	// Orders too small to mention, followed until their quantity adds up to minLeavesQty
+	small *TTLCache
+
+	// What /debug/state reports, updated as the feed goes
+	mu     sync.Mutex
+	status clientStatus
+
+	// Subscription state of each table, reset on every connection
+	subscriptions map[string]*subscription
+
+	// Where the frames of each table go
+	handlers map[string][]TableHandler
+
+	// Subscribed to the liquidation table, decoded into structs rather than maps as it is most
+	// of the traffic in a cascade
+	liquidations bool
+}
+
+// TableHandler processes the rows of a table frame.
+type TableHandler func(action string, rows []interface{}, received time.Time)
+
+type (
+	// bitmexFrame is a frame of the realtime API: the rows of a table, still encoded, the answer
+	// to a subscription or an error.
+	bitmexFrame struct {
+		Table     string          `json:"table"`
+		Action    string          `json:"action"`
+		Data      json.RawMessage `json:"data"`
+		Request   *bitmexRequest  `json:"request"`
+		Subscribe string          `json:"subscribe"`
+		Error     interface{}     `json:"error"`
+	}
+
+	// bitmexRequest is the request a subscription answer is about.
+	bitmexRequest struct {
+		Op   string      `json:"op"`
+		Args interface{} `json:"args"` // A table or a list of them
+	}
+
+	// bitmexLiquidation is a row of the liquidation table, the fields an update leaves out being nil.
+	bitmexLiquidation struct {
+		OrderID   string   `json:"orderID"`
+		Symbol    Symbol   `json:"symbol"`
+		Side      string   `json:"side"`
+		Price     *float64 `json:"price"`
+		LeavesQty *float64 `json:"leavesQty"`
+	}
+)
+
+// bitmexOrder is a liquidation order being followed: the liquidation, its quantity the total the
+// order ever had, and the quantity it still has to execute.
+type bitmexOrder struct {
+	Liquidation Liquidation
+	Leaves      int64
+}
+
+// subscription tracks whether a table's subscription was confirmed.
+type subscription struct {
+	acked   bool
+	partial bool
+	probing bool // A duplicate subscription was sent to check on it
+}
+
+// clientStatus is the connection status and dedup map size of a client.
+type clientStatus struct {
+	Connected      bool      `json:"connected"`
+	Since          time.Time `json:"since"` // When the connection was established or lost
+	LastFrame      time.Time `json:"last_frame"`
+	LastPong       time.Time `json:"last_pong"`
+	Frames         int64     `json:"frames"`
+	Compressed     bool      `json:"compressed"`    // Whether permessage-deflate was negotiated
+	WireBytes      int64     `json:"wire_bytes"`    // Read from the network, TLS included
+	PayloadBytes   int64     `json:"payload_bytes"` // Of the frames once decompressed
+	DedupOrders    int       `json:"dedup_orders"`
+	Reconnects     int64     `json:"reconnects"`
+	LastDisconnect string    `json:"last_disconnect,omitempty"`
+}
+
+// NewBitMexClient returns a client subscribed to the liquidation feed of the configured host.
+func NewBitMexClient(cfg BotConfig, pipeline *Pipeline) *BitMexClient {
+	c := &BitMexClient{
+		Name:        "BitMex",
+		URL:         bitmexURL(cfg.BitMexHost),
+		Compression: cfg.WebsocketCompression,
+		Dialer:      websocket.DefaultDialer,
+		Pipeline:    pipeline,
+		CatchUp:     cfg.CatchUpSummary,
+		Now:         time.Now,
+	}
+	c.trackOrders()
+
+	// Subscribe to the liquidation feed.
+	// https://www.bitmex.com/app/wsAPI
+	c.Tables = append(c.Tables, "liquidation")
+	c.liquidations = true
+
+	return c
+}
+
+// NewPrivateBitMexClient returns a client authenticated with the configured API key and
+// subscribed to the account's positions and margin.
+func NewPrivateBitMexClient(cfg BotConfig, positions *PositionWatcher) *BitMexClient {
+	c := &BitMexClient{
+		Name:        "BitMex private stream",
+		URL:         bitmexURL(cfg.BitMexHost),
+		Compression: cfg.WebsocketCompression,
+		Dialer:      websocket.DefaultDialer,
+		APIKey:      cfg.BitMexAPIKey,
+		APISecret:   cfg.BitMexAPISecret,
+		Now:         time.Now,
+	}
+	c.trackOrders()
+
+	for _, table := range []string{"position", "margin"} {
+		table := table
+		c.Subscribe(table, func(action string, rows []interface{}, received time.Time) {
+			positions.Handle(table, action, rows)
+		})
+	}
+
+	return c
+}
+
+// trackOrders sets up the caches of the orders seen, named after the client.
+func (c *BitMexClient) trackOrders() {
+	c.lastDelete = NewTTLCache(c.Name+" deleted orders", deleteWindow, maxTrackedOrders)
+	c.orders = NewTTLCache(c.Name+" orders", amendWindow, maxTrackedOrders)
+	c.small = NewTTLCache(c.Name+" small orders", amendWindow, maxTrackedOrders)
+}
+
+func bitmexURL(host string) string {
+	var u url.URL
+	u.Scheme = "wss"
+	u.Host = host
+	u.Path = "realtime"
+
+	return u.String()
+}
+
+// Subscribe adds a table to the subscriptions, routing its frames to handler along with the
+// other handlers of the table. It takes effect on the next connection, so it is meant to be called before Run.
+func (c *BitMexClient) Subscribe(table string, handler TableHandler) {
+	if c.handlers == nil {
+		c.handlers = make(map[string][]TableHandler)
+	}
+	if !c.subscribed(table) {
+		c.Tables = append(c.Tables, table)
+	}
+	c.handlers[table] = append(c.handlers[table], handler)
+}
+
+func (c *BitMexClient) subscribed(table string) bool {
+	for _, t := range c.Tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribeURL returns the endpoint with the subscriptions in the query.
+func (c *BitMexClient) subscribeURL() (string, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", errwrap.Wrapf("invalid BitMex URL: {{err}}", err)
+	}
+
+	query := u.Query()
+	query.Set("subscribe", strings.Join(c.Tables, ","))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// authHeader signs the websocket handshake with the API key.
+// https://www.bitmex.com/app/apiKeysUsage
+func authHeader(key, secret string, expires int64) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "GET/realtime%d", expires)
+
+	header := http.Header{}
+	header.Set("api-expires", strconv.FormatInt(expires, 10))
+	header.Set("api-key", key)
+	header.Set("api-signature", hex.EncodeToString(mac.Sum(nil)))
+
+	return header
+}
+
+// DebugState reports the connection status for /debug/state.
+func (c *BitMexClient) DebugState() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.status
+}
+
+// Health reports the connection for /status.
+func (c *BitMexClient) Health() ConnectionHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ConnectionHealth{
+		Name:        c.Name,
+		Connected:   c.status.Connected,
+		Since:       c.status.Since,
+		LastMessage: c.status.LastFrame,
+		LastPong:    c.status.LastPong,
+		Reconnects:  c.status.Reconnects,
+	}
+}
+
+// RunForever runs the client, reconnecting after delay whenever the connection is lost, until
+// the context is done.
+func (c *BitMexClient) RunForever(ctx context.Context, delay time.Duration) {
+	for {
+		err := c.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.mu.Lock()
+		c.status.Connected, c.status.Since, c.status.LastDisconnect = false, time.Now(), fmt.Sprint(err)
+		c.status.Reconnects++
+		c.mu.Unlock()
+		if c.Gaps != nil {
+			c.Gaps.Open(c.Name, time.Now())
+		}
+
+		metrics.Counter("rekt_reconnects_total").Inc()
+		ops.Alert(c.Name, "Disconnected from %v, reconnecting in %v: %v", c.Name, delay, err)
+
+		if !sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+// sleep waits for the delay, returning false instead if the context is done first.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run connects to BitMex and processes the feed until the connection fails or the context is done.
+func (c *BitMexClient) Run(ctx context.Context) error {
+	header := http.Header{}
+	if c.APIKey != "" {
+		header = authHeader(c.APIKey, c.APISecret, time.Now().Add(time.Minute).Unix())
+	}
+
+	// Connect the websocket, counting the bytes on the wire against the payload to see what compression saves
+	wire := metrics.Counter("rekt_ws_wire_bytes_total", "feed", c.Name)
+	payload := metrics.Counter("rekt_ws_payload_bytes_total", "feed", c.Name)
+
+	dialer := countingDialer(c.Dialer, wire)
+	dialer.EnableCompression = c.Compression
+
+	endpoint, err := c.subscribeURL()
+	if err != nil {
+		return err
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		return errwrap.Wrapf("could not connect to BitMex: {{err}}", err)
+	}
+	defer conn.Close()
+
+	compressed := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	c.mu.Lock()
+	c.status.Compressed = compressed
+	c.mu.Unlock()
+
+	log.Printf("Connected to %v: %v\n", c.Name, endpoint)
+
+	c.mu.Lock()
+	if !c.status.Connected && !c.status.Since.IsZero() {
+		ops.Alert("gap_"+c.Name, "%v was down for %v, liquidations in between were missed",
+			c.Name, time.Since(c.status.Since).Round(time.Second))
+	}
+	c.status.Connected, c.status.Since = true, time.Now()
+	if c.Gaps != nil {
+		c.Gaps.Close(c.Name, c.status.Since)
+	}
+	c.subscriptions = make(map[string]*subscription)
+	for _, table := range c.Tables {
+		c.subscriptions[table] = &subscription{}
+	}
+	c.mu.Unlock()
+
+	// Handle the pings and subscription checks, the only writes to the connection
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		probes := time.NewTicker(probePeriod)
+		confirm := time.NewTimer(subscribeWait)
+		defer func() {
+			ticker.Stop()
+			probes.Stop()
+			confirm.Stop()
+			conn.Close()
+		}()
+
+		for {
+			var err error
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// Closing the connection ends the read below
+				return
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				err = conn.WriteMessage(websocket.PingMessage, []byte{})
+			case <-confirm.C:
+				err = c.resubscribeUnconfirmed(conn)
+			case <-probes.C:
+				err = c.probeSubscriptions(conn)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Handle the websocket read
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.mu.Lock()
+		c.status.LastPong = time.Now()
+		c.mu.Unlock()
+		return nil
+	})
+
+	// Every frame is read into the same buffer, nothing holds on to it past handleMessage
+	var buf bytes.Buffer
+	for {
+		_, r, err := conn.NextReader()
+		if err == nil {
+			buf.Reset()
+			_, err = buf.ReadFrom(r)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+
+		msg := buf.Bytes()
+		received := time.Now()
+
+		payload.Add(int64(len(msg)))
+		c.mu.Lock()
+		c.status.LastFrame = received
+		c.status.Frames++
+		c.status.WireBytes, c.status.PayloadBytes = wire.Value(), payload.Value()
+		c.mu.Unlock()
+
+		if c.Recorder != nil {
+			if err := c.Recorder.Record(received, msg); err != nil {
+				log.Println("Failed to record frame:", err)
+			}
+		}
+
+		var malformed *malformedFrame
+		if err := c.handleMessage(msg, received); errors.As(err, &malformed) {
+			c.Quarantine.Save(c.Name, received, msg, err)
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// handleMessage processes a single frame received from BitMex. A frame that doesn't have the
+// expected schema returns a malformedFrame error.
+func (c *BitMexClient) handleMessage(msg []byte, received time.Time) (err error) {
+	defer recoverMalformed(&err)
+
+	var frame bitmexFrame
+	if err := json.Unmarshal(msg, &frame); err != nil {
+		return &malformedFrame{Reason: err}
+	}
+
+	if frame.Request != nil && frame.Request.Op == "subscribe" {
+		return c.handleSubscribe(frame)
+	}
+
+	if frame.Error != nil {
+		return fmt.Errorf("error in API response: %v", frame.Error)
+	}
+
+	rawLog.Printf("%s\n", msg)
+
+	if frame.Table != "" && frame.Action == "partial" {
+		c.mu.Lock()
+		if s := c.subscriptions[frame.Table]; s != nil {
+			s.partial = true
+		}
+		c.mu.Unlock()
+	}
+
+	if frame.Table == "liquidation" && c.liquidations {
+		// A field of the wrong type is left out of its row, which is quarantined on its own
+		var rows []bitmexLiquidation
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(frame.Data, &rows); err != nil && !errors.As(err, &typeErr) {
+			return &malformedFrame{Reason: err}
+		}
+		c.handleLiquidations(frame.Action, rows, received)
+	}
+
+	if handlers := c.handlers[frame.Table]; len(handlers) > 0 {
+		var rows []interface{}
+		if err := json.Unmarshal(frame.Data, &rows); err != nil {
+			return &malformedFrame{Reason: err}
+		}
+		for _, handler := range handlers {
+			handler(frame.Action, rows, received)
+		}
+	}
+
+	c.mu.Lock()
+	c.status.DedupOrders = c.lastDelete.Len()
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *BitMexClient) handleLiquidations(action string, rows []bitmexLiquidation, received time.Time) {
+	switch action {
+	case "partial":
+		// The orders still open when connecting, those not yet posted were missed
+		var missed []Liquidation
+		c.eachRow("liquidation", rows, received, func(row bitmexLiquidation) {
+			l, ok := parseLiquidation(row, received)
+			if _, posted := c.orders.Get(row.OrderID, c.Now()); posted {
+				return
+			}
+			if !ok {
+				c.track(row, received)
+				return
+			}
+			c.remember(l)
+			missed = append(missed, l)
+		})
+
+		if len(missed) > 0 && c.Pipeline != nil {
+			if c.Gaps != nil {
+				c.Gaps.Recover(c.Name, len(missed), c.Pipeline.Worth(missed))
+			}
+			c.Pipeline.Backfill(missed, c.CatchUp)
+		}
+
+	case "delete":
+		c.eachRow("liquidation", rows, received, func(row bitmexLiquidation) {
+			c.lastDelete.Set(row.OrderID, true, c.Now())
+			c.small.Delete(row.OrderID)
+		})
+
+	case "update":
+		// The liquidation may amended by bitmex (position may be reduced or price changed), the
+		// small ones adding up to enough to mention
+		c.eachRow("liquidation", rows, received, func(row bitmexLiquidation) {
+			if !c.grow(row, received) {
+				c.follow(row)
+			}
+		})
+
+	case "insert":
+		c.eachRow("liquidation", rows, received, func(row bitmexLiquidation) {
+			// Check if this is an insert after a delete
+			if _, ok := c.lastDelete.Get(row.OrderID, c.Now()); ok {
+				return
+			}
+
+			l, ok := parseLiquidation(row, received)
+			if !ok {
+				c.track(row, received)
+				return
+			}
+			c.publish(l)
+		})
+	}
+}
+
+// publish posts the liquidation of a new order and follows it.
+func (c *BitMexClient) publish(l Liquidation) {
+	c.remember(l)
+	l.Historical = c.Historical
+
+	if c.Pipeline != nil {
+		c.Pipeline.Publish(l)
+	}
+}
+
+// eachRow handles every row of a table frame, quarantining the rows without an order or that it
+// panics on, such as one missing its price, so the others still get handled.
+func (c *BitMexClient) eachRow(table string, rows []bitmexLiquidation, received time.Time, handle func(row bitmexLiquidation)) {
+	for _, row := range rows {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					data, _ := json.Marshal(row)
+					c.Quarantine.Save(c.Name+" "+table, received, data, &malformedFrame{Reason: r})
+				}
+			}()
+
+			if row.OrderID == "" {
+				panic("no orderID")
+			}
+			handle(row)
+		}()
+	}
+}
+
+// remember keeps the liquidation of the order to follow its amendments.
+func (c *BitMexClient) remember(l Liquidation) {
+	c.orders.Set(l.OrderID, bitmexOrder{Liquidation: l, Leaves: l.Quantity}, c.Now())
+}
+
+// track keeps an order too small to mention, to post it once its updates add up to enough.
+func (c *BitMexClient) track(row bitmexLiquidation, received time.Time) {
+	l := readLiquidation(row, received)
+	c.small.Set(row.OrderID, bitmexOrder{Liquidation: l, Leaves: l.Quantity}, c.Now())
+}
+
+// follow applies an update to an order already posted, amending it to its new price and to the
+// total quantity its updates added up to.
+func (c *BitMexClient) follow(row bitmexLiquidation) {
+	cached, ok := c.orders.Get(row.OrderID, c.Now())
+	if !ok {
+		return
+	}
+	order := cached.(bitmexOrder)
+
+	amended := order.apply(row)
+	c.orders.Set(row.OrderID, order, c.Now())
+
+	if amended && c.Pipeline != nil {
+		c.Pipeline.Amend(order.Liquidation)
+	}
+}
+
+// grow applies an update to an order too small to mention, posting it once its total quantity
+// reaches minLeavesQty. It tells whether the order was one of those.
+func (c *BitMexClient) grow(row bitmexLiquidation, received time.Time) bool {
+	cached, ok := c.small.Get(row.OrderID, c.Now())
+	if !ok {
+		return false
+	}
+	order := cached.(bitmexOrder)
+
+	order.apply(row)
+	if order.Liquidation.Quantity < minLeavesQty {
+		c.small.Set(row.OrderID, order, c.Now())
+		return true
+	}
+	c.small.Delete(row.OrderID)
+
+	l := order.Liquidation
+	l.Received = received
+	c.publish(l)
+	c.orders.Set(row.OrderID, bitmexOrder{Liquidation: l, Leaves: order.Leaves}, c.Now())
+	return true
+}
+
+// apply takes the price of an update and its leavesQty, telling whether the liquidation changed.
+// The leavesQty shrinking is the order filling, the fills being part of its quantity already; it
+// growing is quantity added to the order, added to its total.
+func (o *bitmexOrder) apply(row bitmexLiquidation) bool {
+	changed := false
+	if row.Price != nil && *row.Price != o.Liquidation.Price {
+		o.Liquidation.Price, changed = *row.Price, true
+	}
+	if row.LeavesQty != nil {
+		leaves := int64(*row.LeavesQty)
+		if leaves > o.Leaves {
+			o.Liquidation.Quantity, changed = o.Liquidation.Quantity+leaves-o.Leaves, true
+		}
+		o.Leaves = leaves
+	}
+	return changed
+}
+
+// parseLiquidation reads a row of the liquidation table, skipping the orders too small to mention.
+// It panics on a row missing its price or quantity.
+func parseLiquidation(row bitmexLiquidation, received time.Time) (Liquidation, bool) {
+	l := readLiquidation(row, received)
+	if l.Quantity < minLeavesQty {
+		return Liquidation{}, false
+	}
+	return l, true
+}
+
+// readLiquidation reads a row of the liquidation table, whatever its size.
+func readLiquidation(row bitmexLiquidation, received time.Time) Liquidation {
+	price := *row.Price
+	leavesQty := int64(*row.LeavesQty) // Cast to int64 because this is always int
+
+	return Liquidation{
+		Price:    price,
+		Quantity: leavesQty,
+		Symbol:   row.Symbol,
+		Side:     row.Side,
+		Exchange: "BitMex",
+		OrderID:  row.OrderID,
+		Received: received,
+	}
+}
+
+// handleSubscribe tracks the answers to subscriptions, flagging the tables that turn out to have been dropped.
+func (c *BitMexClient) handleSubscribe(frame bitmexFrame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err, ok := frame.Error.(string); ok {
+		if !strings.Contains(err, "already subscribed") {
+			return fmt.Errorf("error in API response: %v", err)
+		}
+
+		// The probe found the subscription alive
+		for _, table := range subscribeArgs(frame.Request.Args) {
+			if s := c.subscriptions[table]; s != nil {
+				s.probing = false
+			}
+		}
+		return nil
+	}
+
+	table := frame.Subscribe
+	s := c.subscriptions[table]
+	if s == nil {
+		return nil
+	}
+	if s.probing {
+		// The probe subscribed for real, so the table had silently stopped
+		metrics.Counter("rekt_feed_gaps_total", "table", table).Inc()
+		ops.Alert("gap_"+c.Name, "The %v subscription of %v was silently dropped and has been renewed, liquidations may have been missed",
+			table, c.Name)
+	}
+	s.acked, s.probing = true, false
+
+	return nil
+}
+
+// resubscribeUnconfirmed subscribes again to the tables that weren't confirmed in time after connecting.
+func (c *BitMexClient) resubscribeUnconfirmed(conn *websocket.Conn) error {
+	c.mu.Lock()
+	var missing []string
+	for table, s := range c.subscriptions {
+		if !s.acked || !s.partial {
+			missing = append(missing, table)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	metrics.Counter("rekt_feed_gaps_total", "table", strings.Join(missing, ",")).Inc()
+	ops.Alert("gap_"+c.Name, "%v didn't confirm the %v subscription, subscribing again", c.Name, strings.Join(missing, ", "))
+	return c.subscribe(conn, missing)
+}
+
+// probeSubscriptions sends a duplicate subscription for every table, see probePeriod.
+func (c *BitMexClient) probeSubscriptions(conn *websocket.Conn) error {
+	c.mu.Lock()
+	tables := make([]string, 0, len(c.subscriptions))
+	for table, s := range c.subscriptions {
+		s.probing = true
+		tables = append(tables, table)
+	}
+	c.mu.Unlock()
+
+	return c.subscribe(conn, tables)
+}
+
+func (c *BitMexClient) subscribe(conn *websocket.Conn, tables []string) error {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteJSON(map[string]interface{}{"op": "subscribe", "args": tables})
+}
+
+// subscribeArgs returns the tables of a subscribe request, which BitMex echoes as a string or a list.
+func subscribeArgs(args interface{}) []string {
+	switch args := args.(type) {
+	case string:
+		return []string{args}
+	case []interface{}:
+		tables := make([]string, 0, len(args))
+		for _, arg := range args {
+			if table, ok := arg.(string); ok {
+				tables = append(tables, table)
+			}
+		}
+		return tables
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type recordingSink struct {
+	published []DecoratedLiquidation
+	announced []string
+	amended   []Liquidation
+	posted    []Post
+}
+
+func (s *recordingSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	s.published = append(s.published, dl)
+	return nil
+}
+
+func (s *recordingSink) Announce(ctx context.Context, text string) error {
+	s.announced = append(s.announced, text)
+	return nil
+}
+
+func (s *recordingSink) Amend(ctx context.Context, l Liquidation) error {
+	s.amended = append(s.amended, l)
+	return nil
+}
+
+func (s *recordingSink) Post(ctx context.Context, post Post) error {
+	s.posted = append(s.posted, post)
+	return nil
+}
+
+func newTestClient(t *testing.T) (*BitMexClient, *recordingSink) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &recordingSink{}
+	client := NewBitMexClient(BotConfig{}, &Pipeline{State: state, Sinks: []Sink{sink}})
+	return client, sink
+}
+
+func TestBitMexClientLifecycle(t *testing.T) {
+	m := newMockBitMex(t,
+		liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000.5, 20000)),
+		liquidationFrame("insert", liquidationRow("small", "XBTUSD", "Sell", 9000, 100)),
+		liquidationFrame("update", liquidationRow("a", "XBTUSD", "Sell", 8999.5, 15000)),
+		liquidationFrame("delete", liquidationRow("a", "XBTUSD", "Sell", 8999.5, 15000)),
+		// BitMex re-inserts the same order when it liquidates at a better price
+		liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 8999, 15000)),
+		liquidationFrame("insert",
+			liquidationRow("b", "XBTZ16", "Buy", 780, 130170),
+			liquidationRow("c", "XBJ24H", "Buy", 81000, 6000),
+		),
+	)
+
+	client, sink := newTestClient(t)
+	client.URL = m.URL()
+
+	err := client.Run(context.Background())
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatal("expected a normal close, got:", err)
+	}
+
+	expected := []Liquidation{
+		{Price: 9000.5, Quantity: 20000, Symbol: "XBTUSD", Side: "Sell", Exchange: "BitMex", OrderID: "a"},
+		{Price: 780, Quantity: 130170, Symbol: "XBTZ16", Side: "Buy", Exchange: "BitMex", OrderID: "b"},
+		{Price: 81000, Quantity: 6000, Symbol: "XBJ24H", Side: "Buy", Exchange: "BitMex", OrderID: "c"},
+	}
+
+	if len(sink.published) != len(expected) {
+		t.Fatalf("expected %d liquidations, got %d: %v", len(expected), len(sink.published), sink.published)
+	}
+
+	for i, dl := range sink.published {
+		if dl.Liquidation.Received.IsZero() {
+			t.Error("liquidation was not timestamped")
+		}
+		dl.Liquidation.Received = time.Time{}
+
+		if dl.Liquidation != expected[i] {
+			t.Errorf("liquidation %d: expected %v, got %v", i, expected[i], dl.Liquidation)
+		}
+		verify(dl.String(), t)
+	}
+
+	// The update amends the first one, the partial fill leaving its total as it is
+	if len(sink.amended) != 1 {
+		t.Fatalf("expected 1 amendment, got %v", sink.amended)
+	}
+	if l := sink.amended[0]; l.OrderID != "a" || l.Price != 8999.5 || l.Quantity != 20000 {
+		t.Errorf("expected the amended price and the total quantity, got %v", l)
+	}
+}
+
+func TestBitMexClientAccumulates(t *testing.T) {
+	client, sink := newTestClient(t)
+	handle := func(frame map[string]interface{}) {
+		if err := client.handleMessage(frameJSON(t, frame), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The fills leave the total liquidated as it is, the quantity added to the order adds to it:
+	// 20000 filled down to 12000, 18000 added, then filled down to 5000 is 38000 in all
+	handle(liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000)))
+	handle(liquidationFrame("update", liquidationRow("a", "XBTUSD", "Sell", 9000, 12000)))
+	handle(liquidationFrame("update", liquidationRow("a", "XBTUSD", "Sell", 9000, 30000)))
+	handle(liquidationFrame("update", liquidationRow("a", "XBTUSD", "Sell", 9000, 30000)))
+	handle(liquidationFrame("update", liquidationRow("a", "XBTUSD", "Sell", 9000, 5000)))
+
+	var quantities []int64
+	for _, l := range sink.amended {
+		quantities = append(quantities, l.Quantity)
+	}
+	if want := []int64{38000}; !reflect.DeepEqual(quantities, want) {
+		t.Errorf("expected the total liquidated %v, got %v", want, quantities)
+	}
+
+	// The small orders are posted once they add up to enough, then followed
+	sink.amended = nil
+	handle(liquidationFrame("insert", liquidationRow("s", "XBTUSD", "Buy", 9000, 1000)))
+	handle(liquidationFrame("update", liquidationRow("s", "XBTUSD", "Buy", 9000, 3000)))
+	if len(sink.published) != 1 {
+		t.Fatalf("expected the small order to wait, got %v", sink.published)
+	}
+	handle(liquidationFrame("update", liquidationRow("s", "XBTUSD", "Buy", 9010, 6000)))
+	if len(sink.published) != 2 || sink.published[1].Liquidation.Quantity != 6000 || sink.published[1].Liquidation.Price != 9010 || len(sink.amended) != 0 {
+		t.Fatalf("expected the order to be posted with its total, got %v and %v", sink.published, sink.amended)
+	}
+	handle(liquidationFrame("update", liquidationRow("s", "XBTUSD", "Buy", 9010, 8000)))
+	if len(sink.amended) != 1 || sink.amended[0].Quantity != 8000 {
+		t.Errorf("expected the order to be amended, got %v", sink.amended)
+	}
+
+	// Those deleted are forgotten
+	handle(liquidationFrame("insert", liquidationRow("d", "XBTUSD", "Buy", 9000, 1000)))
+	handle(liquidationFrame("delete", liquidationRow("d", "XBTUSD", "Buy", 9000, 1000)))
+	handle(liquidationFrame("update", liquidationRow("d", "XBTUSD", "Buy", 9000, 9000)))
+	if len(sink.published) != 2 {
+		t.Errorf("expected the deleted order to be forgotten, got %v", sink.published)
+	}
+}
+
+func TestBitMexClientCatchUp(t *testing.T) {
+	client, sink := newTestClient(t)
+	client.CatchUp = true
+	handle := func(frame map[string]interface{}) {
+		if err := client.handleMessage(frameJSON(t, frame), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handle(liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000)))
+
+	// On reconnecting, the order already posted is left out and the others are summed up
+	handle(liquidationFrame("partial",
+		liquidationRow("a", "XBTUSD", "Sell", 9000, 20000),
+		liquidationRow("b", "XBTUSD", "Buy", 9100, 50000),
+		liquidationRow("c", "XBTUSD", "Sell", 8900, 30000),
+		liquidationRow("small", "XBTUSD", "Sell", 8900, 100),
+	))
+
+	if len(sink.published) != 3 || sink.published[0].Liquidation.Historical {
+		t.Fatalf("expected the missed liquidations to follow the live one, got %v", sink.published)
+	}
+	for _, dl := range sink.published[1:] {
+		if !dl.Liquidation.Historical {
+			t.Errorf("expected the missed liquidations to be historical, got %v", dl)
+		}
+	}
+	if want := "Still open on reconnecting: $80.0K liquidated across 2 orders, largest $50.0K XBTUSD short"; len(sink.announced) != 1 || sink.announced[0] != want {
+		t.Errorf("expected %q, got %q", want, sink.announced)
+	}
+
+	// The missed orders are followed like the others
+	handle(liquidationFrame("update", liquidationRow("b", "XBTUSD", "Buy", 9100, 60000)))
+	if len(sink.amended) != 1 || sink.amended[0].Quantity != 60000 {
+		t.Errorf("expected the missed order to be amended, got %v", sink.amended)
+	}
+}
+
+func TestBitMexClientAPIError(t *testing.T) {
+	m := newMockBitMex(t,
+		map[string]interface{}{"status": 400, "error": "Unknown table: liquidation"},
+		liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000)),
+	)
+
+	client, sink := newTestClient(t)
+	client.URL = m.URL()
+
+	err := client.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Unknown table") {
+		t.Fatal("expected the API error, got:", err)
+	}
+
+	if len(sink.published) != 0 {
+		t.Error("nothing should be published after an API error:", sink.published)
+	}
+}
+
+func TestBitMexClientCancel(t *testing.T) {
+	// A feed that goes quiet after the greeting
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(map[string]interface{}{"info": "Welcome to the BitMEX Realtime API."})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(t)
+	client.URL = "ws" + strings.TrimPrefix(server.URL, "http") + "/realtime"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		client.RunForever(ctx, time.Hour)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client kept running once the context was done")
+	}
+}
+
+func TestBitMexClientSubscriptionProbe(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.subscriptions = map[string]*subscription{"liquidation": {acked: true, partial: true, probing: true}}
+	gaps := metrics.Counter("rekt_feed_gaps_total", "table", "liquidation")
+	before := gaps.Value()
+
+	// A live subscription rejects the duplicate
+	alive := map[string]interface{}{
+		"status":  400.0,
+		"error":   "You are already subscribed to this topic: liquidation",
+		"request": map[string]interface{}{"op": "subscribe", "args": []interface{}{"liquidation"}},
+	}
+	if err := client.handleMessage(frameJSON(t, alive), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if client.subscriptions["liquidation"].probing || gaps.Value() != before {
+		t.Fatal("expected the probe to find the subscription alive")
+	}
+
+	// A dropped one accepts it
+	client.subscriptions["liquidation"].probing = true
+	dropped := map[string]interface{}{
+		"success":   true,
+		"subscribe": "liquidation",
+		"request":   map[string]interface{}{"op": "subscribe", "args": []interface{}{"liquidation"}},
+	}
+	if err := client.handleMessage(frameJSON(t, dropped), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if gaps.Value() != before+1 {
+		t.Error("expected the dropped subscription to be flagged as a gap")
+	}
+}
+
+func TestBitMexClientCompression(t *testing.T) {
+	m := newMockBitMex(t, liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000.5, 20000)))
+	client, sink := newTestClient(t)
+	client.URL = m.URL()
+	client.Compression = true
+
+	if err := client.Run(context.Background()); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatal("expected a normal close, got:", err)
+	}
+
+	status := client.DebugState().(clientStatus)
+	if !status.Compressed || status.WireBytes == 0 || status.PayloadBytes == 0 {
+		t.Errorf("expected compression to be negotiated and measured, got %+v", status)
+	}
+	if len(sink.published) != 1 {
+		t.Errorf("expected the liquidation to make it through, got %v", sink.published)
+	}
+}
+
+func TestBitMexClientTableRouting(t *testing.T) {
+	instrument := map[string]interface{}{
+		"table":  "instrument",
+		"action": "update",
+		"data":   []interface{}{map[string]interface{}{"symbol": "XBTUSD", "openInterest": 1e9}},
+	}
+	m := newMockBitMex(t, instrument, liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000.5, 20000)))
+	client, sink := newTestClient(t)
+	client.URL = m.URL()
+
+	var actions []string
+	client.Subscribe("instrument", func(action string, rows []interface{}, received time.Time) {
+		actions = append(actions, action)
+	})
+
+	if err := client.Run(context.Background()); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatal("expected a normal close, got:", err)
+	}
+
+	if want := []string{"partial", "update"}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("expected the instrument frames %v, got %v", want, actions)
+	}
+	if len(sink.published) != 1 {
+		t.Errorf("expected the liquidation to still be routed, got %v", sink.published)
+	}
+	if s := client.subscriptions["instrument"]; s == nil || !s.acked || !s.partial {
+		t.Errorf("expected the instrument subscription to be confirmed, got %+v", s)
+	}
+}
+
+// cascadeFrame is a single insert of n liquidations, as BitMex sends them when a cascade hits.
+func cascadeFrame(tb testing.TB, n int) []byte {
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		rows[i] = liquidationRow(fmt.Sprint("order-", i), "XBTUSD", "Sell", 9000-float64(i), 20000+int64(i))
+	}
+	return frameJSON(tb, liquidationFrame("insert", rows...))
+}
+
+func BenchmarkHandleLiquidations(b *testing.B) {
+	defer func(saved *log.Logger) { rawLog = saved }(rawLog)
+	rawLog = log.New(ioutil.Discard, "", 0)
+
+	client := NewBitMexClient(BotConfig{}, nil)
+	msg := cascadeFrame(b, 50)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.handleMessage(msg, time.Now()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// breakdownRows is how many symbols a page of the breakdown lists.
+const breakdownRows = 15
+
+// symbolTotals is what was liquidated on a symbol.
+type symbolTotals struct {
+	name          string
+	longs, shorts int64
+}
+
+// breakdownCommand is /breakdown, the symbols or underlying assets ranked by liquidated USD.
+func breakdownCommand(history *History, pages *Pages, f NumberFormat) *SlashCommand {
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "breakdown",
+			Description: "Symbols ranked by liquidated USD",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "period", Description: "How far back, such as 24h or 7d, 24h by default"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "by", Description: "Rank the contracts or their assets across contracts and exchanges, contracts by default", Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "symbol", Value: "symbol"},
+					{Name: "asset", Value: "asset"},
+				}},
+			},
+		},
+		Deferred: true,
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			periodText := req.String("period", "24h")
+			period, err := parsePeriod(periodText)
+			if err != nil {
+				return nil, err
+			}
+
+			liquidations := history.Since(time.Now().Add(-period), nil)
+			if len(liquidations) == 0 {
+				return &discordgo.InteractionResponseData{Content: "No liquidations in that period"}, nil
+			}
+
+			return pages.Reply(breakdownPages(liquidations, periodText, req.String("by", "symbol") == "asset", f)), nil
+		},
+	}
+}
+
+// breakdownPages ranks the symbols, or their underlying assets byAsset, by liquidated USD with their
+// long/short split and share of the total, as an embed of breakdownRows symbols a page.
+func breakdownPages(liquidations []Liquidation, period string, byAsset bool, f NumberFormat) []*discordgo.InteractionResponseData {
+	byName := make(map[string]*symbolTotals)
+	var ranked []*symbolTotals
+	var total int64
+	for _, l := range liquidations {
+		name := l.DisplayName()
+		if byAsset {
+			name = l.Asset()
+		}
+
+		t, ok := byName[name]
+		if !ok {
+			t = &symbolTotals{name: name}
+			byName[name] = t
+			ranked = append(ranked, t)
+		}
+
+		if l.Position() == "long" {
+			t.longs += l.USDValue()
+		} else {
+			t.shorts += l.USDValue()
+		}
+		total += l.USDValue()
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].longs+ranked[i].shorts > ranked[j].longs+ranked[j].shorts
+	})
+
+	var pages []*discordgo.InteractionResponseData
+	for start := 0; start < len(ranked); start += breakdownRows {
+		end := start + breakdownRows
+		if end > len(ranked) {
+			end = len(ranked)
+		}
+
+		var b strings.Builder
+		column := "Symbol"
+		if byAsset {
+			column = "Asset"
+		}
+		fmt.Fprintf(&b, "```\n%-12v %8v %5v %8v %8v\n", column, "USD", "%", "Longs", "Shorts")
+		for _, t := range ranked[start:end] {
+			var share float64
+			if total > 0 {
+				share = float64(t.longs+t.shorts) * 100 / float64(total)
+			}
+			fmt.Fprintf(&b, "%-12v %8v %4.0f%% %8v %8v\n", t.name, f.Short(t.longs+t.shorts), share, f.Short(t.longs), f.Short(t.shorts))
+		}
+		b.WriteString("```")
+
+		pages = append(pages, &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{{
+			Title:       fmt.Sprintf("Liquidations over the last %v", period),
+			Description: b.String(),
+			Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%v rekt across %v liquidations", f.Short(total), len(liquidations))},
+		}}})
+	}
+
+	return pages
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBreakdownPages(t *testing.T) {
+	pages := breakdownPages([]Liquidation{
+		{Symbol: "ETHUSD", Side: "Buy", USD: 1000000},
+		{Symbol: "XBTUSD", Side: "Sell", USD: 2500000},
+		{Symbol: "XBTUSD", Side: "Buy", USD: 500000},
+	}, "24h", false, DefaultFormat)
+	if len(pages) != 1 {
+		t.Fatalf("expected a single page, got %v", len(pages))
+	}
+	embed := pages[0].Embeds[0]
+
+	lines := strings.Split(embed.Description, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header and two rows, got %q", embed.Description)
+	}
+	if expected := "XBTUSD          $3.0M   75%    $2.5M  $500.0K"; lines[2] != expected {
+		t.Errorf("expected the largest first as %q, got %q", expected, lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "ETHUSD") || !strings.Contains(lines[3], "25%") {
+		t.Errorf("expected ETHUSD with a quarter of the total, got %q", lines[3])
+	}
+	if embed.Footer.Text != "$4.0M rekt across 3 liquidations" {
+		t.Errorf("unexpected footer %q", embed.Footer.Text)
+	}
+}
+
+func TestBreakdownPagination(t *testing.T) {
+	var liquidations []Liquidation
+	for i := 0; i < breakdownRows+3; i++ {
+		liquidations = append(liquidations, Liquidation{Symbol: Symbol(fmt.Sprintf("SYM%v", i)), Side: "Buy", USD: float64(i+1) * 1000})
+	}
+
+	pages := breakdownPages(liquidations, "7d", false, DefaultFormat)
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %v", len(pages))
+	}
+	if rows := strings.Count(pages[1].Embeds[0].Description, "\n") - 2; rows != 3 {
+		t.Errorf("expected the 3 smallest symbols on the second page, got %v rows", rows)
+	}
+	if !strings.Contains(pages[1].Embeds[0].Description, "SYM0 ") {
+		t.Error("expected the smallest symbol last")
+	}
+}
+
+func TestBreakdownByAsset(t *testing.T) {
+	pages := breakdownPages([]Liquidation{
+		{Symbol: "XBTUSD", Side: "Sell", USD: 2500000},
+		{Symbol: "XBTU24", Side: "Buy", USD: 500000},
+		{Symbol: "BTCUSDT", Exchange: "Binance", Side: "Buy", USD: 1000000},
+		{Symbol: "ETHUSD", Side: "Buy", USD: 1000000},
+	}, "24h", true, DefaultFormat)
+
+	lines := strings.Split(pages[0].Embeds[0].Description, "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[1], "Asset") {
+		t.Fatalf("expected an asset header and two rows, got %q", pages[0].Embeds[0].Description)
+	}
+	if expected := "BTC             $4.0M   80%    $2.5M    $1.5M"; lines[2] != expected {
+		t.Errorf("expected the bitcoin contracts together as %q, got %q", expected, lines[2])
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// errBreakerOpen is returned instead of attempting delivery while a sink's breaker is open.
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerSink stops attempting delivery to a sink after repeated failures, trying again once the cooldown has passed.
+type BreakerSink struct {
+	Sink
+	Name string
+
+	Failures int           // Consecutive failures before the breaker opens
+	Cooldown time.Duration // How long to wait before trying the sink again
+	CatchUp  bool          // Post a summary of what was missed once the sink recovers
+	Format   NumberFormat  // Of the amounts of the summary
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	missed    Missed
+}
+
+// newBreaker wraps the sink in a breaker with the configured settings.
+func newBreaker(cfg BotConfig, name string, sink Sink) *BreakerSink {
+	return &BreakerSink{
+		Sink:     sink,
+		Name:     name,
+		Failures: cfg.BreakerFailures,
+		Cooldown: cfg.BreakerCooldown.Duration,
+		CatchUp:  cfg.BreakerCatchUp,
+		Format:   cfg.DiscordFormat,
+	}
+}
+
+// Publish implements Sink.
+func (b *BreakerSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	if !b.allow() {
+		b.mu.Lock()
+		b.missed.Add(dl.Liquidation)
+		b.mu.Unlock()
+
+		return errBreakerOpen
+	}
+
+	return b.record(ctx, b.Sink.Publish(ctx, dl))
+}
+
+// Announce implements Sink.
+func (b *BreakerSink) Announce(ctx context.Context, text string) error {
+	if !b.allow() {
+		return errBreakerOpen
+	}
+
+	return b.record(ctx, b.Sink.Announce(ctx, text))
+}
+
+// Amend implements Amender.
+func (b *BreakerSink) Amend(ctx context.Context, l Liquidation) error {
+	if !b.allow() {
+		return errBreakerOpen
+	}
+
+	return b.record(ctx, amend(ctx, b.Sink, l))
+}
+
+// Post implements Poster.
+func (b *BreakerSink) Post(ctx context.Context, post Post) error {
+	if !b.allow() {
+		return errBreakerOpen
+	}
+
+	return b.record(ctx, sendPost(ctx, b.Sink, post))
+}
+
+// allow reports whether delivery should be attempted.
+func (b *BreakerSink) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !time.Now().Before(b.openUntil)
+}
+
+// record updates the breaker with the outcome of a delivery, posting the catch-up in the same context.
+func (b *BreakerSink) record(ctx context.Context, err error) error {
+	b.mu.Lock()
+
+	if err != nil {
+		b.failures++
+
+		if b.failures >= b.Failures {
+			wasOpen := !b.openUntil.IsZero()
+			b.openUntil = time.Now().Add(b.Cooldown)
+			b.mu.Unlock()
+
+			metrics.Gauge("rekt_sink_breaker_open", "sink", b.Name).Set(1)
+			if !wasOpen {
+				metrics.Counter("rekt_sink_breaker_trips_total", "sink", b.Name).Inc()
+				ops.Alert("sink_down_"+b.Name, "Sink %v failed %v times in a row, pausing delivery for %v: %v", b.Name, b.failures, b.Cooldown, err)
+			}
+			return err
+		}
+
+		b.mu.Unlock()
+		return err
+	}
+
+	recovered := !b.openUntil.IsZero()
+	missed := b.missed
+	b.failures, b.openUntil, b.missed = 0, time.Time{}, Missed{}
+	b.mu.Unlock()
+
+	if recovered {
+		metrics.Gauge("rekt_sink_breaker_open", "sink", b.Name).Set(0)
+		ops.Alert("sink_up_"+b.Name, "Sink %v recovered, missed %v liquidations", b.Name, missed.Orders)
+
+		if text := missed.Text("While I was away", b.Format); b.CatchUp && text != "" {
+			if err := b.Sink.Announce(ctx, text); err != nil {
+				log.Printf("Failed to send message %q: %v\n", text, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakySink fails while down is set.
+type flakySink struct {
+	recordingSink
+	down bool
+}
+
+func (s *flakySink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	if s.down {
+		return errors.New("discord is down")
+	}
+	return s.recordingSink.Publish(ctx, dl)
+}
+
+func TestBreakerSink(t *testing.T) {
+	inner := &flakySink{down: true}
+	b := &BreakerSink{Sink: inner, Name: "flaky", Failures: 3, Cooldown: 50 * time.Millisecond, CatchUp: true}
+
+	dl := DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Buy", Quantity: 10000}}
+
+	for i := 0; i < 3; i++ {
+		if err := b.Publish(context.Background(), dl); err == nil || err == errBreakerOpen {
+			t.Fatal("expected the sink's own error, got", err)
+		}
+	}
+
+	// Open: delivery isn't even attempted
+	inner.down = false
+	for i := 0; i < 2; i++ {
+		if err := b.Publish(context.Background(), dl); err != errBreakerOpen {
+			t.Fatal("expected the breaker to be open, got", err)
+		}
+	}
+	if len(inner.published) != 0 {
+		t.Fatal("delivery was attempted while open")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Publish(context.Background(), dl); err != nil {
+		t.Fatal("expected the sink to recover, got", err)
+	}
+
+	if len(inner.published) != 1 {
+		t.Error("expected one delivery after recovering, got", len(inner.published))
+	}
+	if len(inner.announced) != 1 || inner.announced[0] != "While I was away: $20.0K liquidated across 2 orders, largest $10.0K XBTUSD short" {
+		t.Errorf("expected a catch-up summary, got %q", inner.announced)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Budget is the messages a tenant may send in an hour, shared by its channels, so no guild can
+	// use up the rate limits of the others. Once half of it is spent the threshold rises to the
+	// median of the liquidations sent in the hour, so the largest ones still make it, and once it
+	// is all spent nothing is sent until the oldest message is an hour old.
+	Budget struct {
+		PerHour int
+
+		mu       sync.Mutex
+		sent     []budgetEntry // Oldest first, within the hour
+		notified bool          // Whether the guild was told the budget is spent
+	}
+
+	// budgetEntry is a message sent, with the worth of its liquidation, negative for announcements.
+	budgetEntry struct {
+		at  time.Time
+		usd float64
+	}
+
+	// BudgetSink only passes on the messages that fit in its budget. The amendments are edits and
+	// don't count.
+	BudgetSink struct {
+		Sink
+		Budget *Budget
+	}
+)
+
+// Allow tells whether a message about a liquidation worth usd fits in the budget, negative for an
+// announcement, recording it when it does. notify is set the first time the budget is found spent.
+func (b *Budget) Allow(usd float64, now time.Time) (ok, notify bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prune(now)
+	if len(b.sent) >= b.PerHour {
+		notify, b.notified = !b.notified, true
+		metrics.Counter("rekt_tenant_messages_total", "result", "spent").Inc()
+		return false, notify
+	}
+	if usd >= 0 && len(b.sent) >= (b.PerHour+1)/2 && usd < b.floor() {
+		metrics.Counter("rekt_tenant_messages_total", "result", "raised").Inc()
+		return false, false
+	}
+
+	b.sent = append(b.sent, budgetEntry{at: now, usd: usd})
+	metrics.Counter("rekt_tenant_messages_total", "result", "sent").Inc()
+	return true, false
+}
+
+// Usage returns the messages sent in the hour and the threshold in force, 0 while it isn't raised.
+func (b *Budget) Usage(now time.Time) (sent int, floor float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prune(now)
+	if len(b.sent) >= (b.PerHour+1)/2 {
+		floor = b.floor()
+	}
+	return len(b.sent), floor
+}
+
+// Resumes returns when the next message fits in the budget again.
+func (b *Budget) Resumes(now time.Time) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prune(now)
+	if len(b.sent) < b.PerHour || len(b.sent) == 0 {
+		return now
+	}
+	return b.sent[len(b.sent)-b.PerHour].at.Add(time.Hour)
+}
+
+func (b *Budget) prune(now time.Time) {
+	expired := sort.Search(len(b.sent), func(i int) bool { return now.Sub(b.sent[i].at) < time.Hour })
+	b.sent = b.sent[expired:]
+	if len(b.sent) < b.PerHour {
+		b.notified = false
+	}
+}
+
+// floor is the median worth of the liquidations sent in the hour.
+func (b *Budget) floor() float64 {
+	var sizes []float64
+	for _, entry := range b.sent {
+		if entry.usd >= 0 {
+			sizes = append(sizes, entry.usd)
+		}
+	}
+	if len(sizes) == 0 {
+		return 0
+	}
+	sort.Float64s(sizes)
+	return sizes[len(sizes)/2]
+}
+
+// Publish implements Sink.
+func (s *BudgetSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	ok, notify := s.Budget.Allow(float64(dl.Liquidation.USDValue()), time.Now())
+	if notify {
+		s.spent(ctx)
+	}
+	if !ok {
+		return nil
+	}
+	return s.Sink.Publish(ctx, dl)
+}
+
+// Announce implements Sink.
+func (s *BudgetSink) Announce(ctx context.Context, text string) error {
+	ok, notify := s.Budget.Allow(-1, time.Now())
+	if notify {
+		s.spent(ctx)
+	}
+	if !ok {
+		return nil
+	}
+	return s.Sink.Announce(ctx, text)
+}
+
+// Amend implements Amender.
+func (s *BudgetSink) Amend(ctx context.Context, l Liquidation) error {
+	return amend(ctx, s.Sink, l)
+}
+
+// Post implements Poster, counting as an announcement.
+func (s *BudgetSink) Post(ctx context.Context, post Post) error {
+	ok, notify := s.Budget.Allow(-1, time.Now())
+	if notify {
+		s.spent(ctx)
+	}
+	if !ok {
+		return nil
+	}
+	return sendPost(ctx, s.Sink, post)
+}
+
+// spent tells the channel the budget is spent, once per time it is, past the budget itself.
+func (s *BudgetSink) spent(ctx context.Context) {
+	text := fmt.Sprintf("This server sent its %v messages of the hour, the liquidations resume at <t:%v:t>",
+		s.Budget.PerHour, s.Budget.Resumes(time.Now()).Unix())
+	if err := s.Sink.Announce(ctx, text); err != nil {
+		log.Printf("Failed to send message %q: %v\n", text, err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	b := &Budget{PerHour: 4}
+	now := time.Now()
+
+	// Half of the budget goes to anything, then only to what beats the median
+	for _, usd := range []float64{100000, 300000} {
+		if ok, _ := b.Allow(usd, now); !ok {
+			t.Fatalf("expected $%v to fit in the budget", usd)
+		}
+	}
+	if ok, _ := b.Allow(200000, now); ok {
+		t.Error("expected a liquidation under the median to be held back")
+	}
+	if sent, floor := b.Usage(now); sent != 2 || floor != 300000 {
+		t.Errorf("expected 2 sent and the threshold raised to $300K, got %v and %v", sent, floor)
+	}
+	if ok, _ := b.Allow(500000, now); !ok {
+		t.Error("expected a larger liquidation to fit")
+	}
+	if ok, _ := b.Allow(-1, now); !ok {
+		t.Error("expected an announcement to fit")
+	}
+
+	// Spent, the guild is told once
+	if ok, notify := b.Allow(1e9, now); ok || !notify {
+		t.Errorf("expected the budget to be spent and told, got %v and %v", ok, notify)
+	}
+	if ok, notify := b.Allow(1e9, now); ok || notify {
+		t.Errorf("expected the budget to be told spent only once, got %v and %v", ok, notify)
+	}
+	if resumes := b.Resumes(now); !resumes.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected to resume in an hour, got %v", resumes)
+	}
+
+	if ok, _ := b.Allow(1, now.Add(time.Hour)); !ok {
+		t.Error("expected the budget to be back after an hour")
+	}
+}
+
+func TestBudgetSink(t *testing.T) {
+	sink := &recordingSink{}
+	s := &BudgetSink{Sink: sink, Budget: &Budget{PerHour: 1}}
+	l := Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Buy"}
+
+	for i := 0; i < 3; i++ {
+		if err := s.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sink.published) != 1 {
+		t.Errorf("expected a single liquidation to be posted, got %v", sink.published)
+	}
+	if len(sink.announced) != 1 || !strings.Contains(sink.announced[0], "sent its 1 messages of the hour") {
+		t.Errorf("expected the channel to be told once, got %q", sink.announced)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type (
+	// TTLCache keeps its entries for TTL after they were last set, and at most Max of them, the
+	// oldest evicted first, so months of uptime can't grow it without bound. Its size is reported
+	// as rekt_cache_entries, summed with that of the other caches of the same name.
+	TTLCache struct {
+		Name string
+		TTL  time.Duration
+		Max  int // 0 for no limit on the count
+
+		mu       sync.Mutex
+		entries  map[string]*list.Element
+		order    *list.List // Of the cacheEntries, the least recently set first
+		reported int        // Size last added to rekt_cache_entries
+	}
+
+	cacheEntry struct {
+		key   string
+		value interface{}
+		set   time.Time
+	}
+)
+
+// NewTTLCache returns an empty cache.
+func NewTTLCache(name string, ttl time.Duration, max int) *TTLCache {
+	return &TTLCache{
+		Name:    name,
+		TTL:     ttl,
+		Max:     max,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the value of the key, false when it isn't there or has expired.
+func (c *TTLCache) Get(key string, now time.Time) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+	if now.Sub(entry.set) > c.TTL {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set stores the value, restarting its TTL, and evicts what expired or is over Max.
+func (c *TTLCache) Set(key string, value interface{}, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.value, entry.set = value, now
+		c.order.MoveToBack(e)
+	} else {
+		c.entries[key] = c.order.PushBack(&cacheEntry{key: key, value: value, set: now})
+	}
+
+	c.evict(now)
+}
+
+// Delete removes the key.
+func (c *TTLCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+	c.report()
+}
+
+// Len returns the number of entries, the expired ones not yet evicted included.
+func (c *TTLCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// evict drops the expired entries and the oldest ones past Max. As the entries are in the order
+// they were set, only those evicted are looked at.
+func (c *TTLCache) evict(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		entry := e.Value.(*cacheEntry)
+		full := c.Max > 0 && len(c.entries) > c.Max
+		if !full && now.Sub(entry.set) <= c.TTL {
+			break
+		}
+		if full {
+			metrics.Counter("rekt_cache_evictions_total", "cache", c.Name).Inc()
+		}
+
+		c.order.Remove(e)
+		delete(c.entries, entry.key)
+	}
+	c.report()
+}
+
+func (c *TTLCache) report() {
+	metrics.Gauge("rekt_cache_entries", "cache", c.Name).Add(float64(len(c.entries) - c.reported))
+	c.reported = len(c.entries)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	c := NewTTLCache("test", time.Minute, 3)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	c.Set("a", 1, start)
+	c.Set("b", 2, start.Add(10*time.Second))
+	if v, ok := c.Get("a", start.Add(30*time.Second)); !ok || v != 1 {
+		t.Errorf("expected a to be cached, got %v, %v", v, ok)
+	}
+
+	// Expired entries are no longer returned, and evicted on the next set
+	if _, ok := c.Get("a", start.Add(2*time.Minute)); ok {
+		t.Error("expected a to have expired")
+	}
+	c.Set("b", 3, start.Add(65*time.Second))
+	if c.Len() != 1 {
+		t.Errorf("expected a to be evicted, got %v entries", c.Len())
+	}
+	if v, ok := c.Get("b", start.Add(2*time.Minute)); !ok || v != 3 {
+		t.Errorf("expected setting b again to restart its TTL, got %v, %v", v, ok)
+	}
+
+	// Past Max, the oldest go first
+	now := start.Add(70 * time.Second)
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprint(i), i, now)
+	}
+	if c.Len() != 3 {
+		t.Errorf("expected at most 3 entries, got %v", c.Len())
+	}
+	if _, ok := c.Get("1", now); ok {
+		t.Error("expected the oldest entries to be evicted")
+	}
+	if _, ok := c.Get("4", now); !ok {
+		t.Error("expected the newest entry to be kept")
+	}
+	if size := metrics.Gauge("rekt_cache_entries", "cache", "test").Value(); size != 3 {
+		t.Errorf("expected the size to be reported, got %v", size)
+	}
+
+	c.Delete("4")
+	if _, ok := c.Get("4", now); ok || c.Len() != 2 {
+		t.Error("expected 4 to be deleted")
+	}
+}
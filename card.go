@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/errwrap"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// RecordCard renders the meme-style image attached to record breaking liquidations:
+// the template with the record, the size and the contract written over it.
+type RecordCard struct {
+	Template image.Image
+}
+
+// LoadRecordCard loads the template PNG at path.
+func LoadRecordCard(path string) (*RecordCard, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	template, err := png.Decode(f)
+	if err != nil {
+		return nil, errwrap.Wrapf("bad record card template: {{err}}", err)
+	}
+
+	return &RecordCard{Template: template}, nil
+}
+
+// recordTitle names the record the liquidation broke, empty when it didn't break one worth a card.
+func recordTitle(dl DecoratedLiquidation) string {
+	title := ""
+	for _, medal := range dl.Medals {
+		switch {
+		case medal == MedalLargestEver:
+			return "NEW ALL-TIME RECORD"
+		case medal == MedalLargestMonth:
+			title = "NEW MONTHLY RECORD"
+		}
+	}
+	return title
+}
+
+// Render draws the card of the liquidation as a PNG attachment.
+func (c *RecordCard) Render(dl DecoratedLiquidation, f NumberFormat) (*discordgo.File, error) {
+	bounds := c.Template.Bounds()
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, c.Template, bounds.Min, draw.Src)
+
+	l := dl.Liquidation
+	lines := []struct {
+		text  string
+		scale int
+		color color.Color
+	}{
+		{recordTitle(dl), 4, color.RGBA{230, 190, 40, 255}},
+		{f.USD(l.USDValue()) + " " + strings.ToUpper(l.Position()) + " REKT", 6, color.White},
+		{l.DisplayName() + " @ " + f.Price(l.Price), 4, color.White},
+	}
+
+	// Spread the lines evenly down the card
+	step := bounds.Dy() / (len(lines) + 1)
+	for i, line := range lines {
+		drawCentered(img, line.text, bounds.Min.Y+step*(i+1), line.scale, line.color)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.File{Name: "record.png", ContentType: "image/png", Reader: &buf}, nil
+}
+
+// drawCentered writes text centered on y, scaling the bitmap font up and shrinking it to fit the width.
+func drawCentered(dst *image.RGBA, text string, y, scale int, c color.Color) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		return
+	}
+	for scale > 1 && width*scale > dst.Bounds().Dx()*9/10 {
+		scale--
+	}
+
+	// Render at the font's size, then blow it up with a drop shadow
+	for _, pass := range []struct {
+		color  color.Color
+		offset int
+	}{{color.Black, scale}, {c, 0}} {
+		small := image.NewRGBA(image.Rect(0, 0, width, face.Height))
+		d := font.Drawer{Dst: small, Src: image.NewUniform(pass.color), Face: face, Dot: fixed.P(0, face.Ascent)}
+		d.DrawString(text)
+
+		x := dst.Bounds().Min.X + (dst.Bounds().Dx()-width*scale)/2 + pass.offset
+		top := y - face.Height*scale/2 + pass.offset
+		draw.NearestNeighbor.Scale(dst, image.Rect(x, top, x+width*scale, top+face.Height*scale), small, small.Bounds(), draw.Over, nil)
+	}
+}
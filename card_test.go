@@ -0,0 +1,52 @@
+package main
+
+import (
+	"image/png"
+	"testing"
+)
+
+func TestRecordCard(t *testing.T) {
+	s := &State{
+		HighScores: HighScores{Scores: make(map[Symbol]Scores), Kills: make(map[Symbol]Kill)},
+		Snark:      []string{"rekt"},
+		MultiKill:  []string{"Double kill"},
+	}
+	if dl := s.Decorate(Liquidation{Symbol: "XBTUSD", Side: "Sell", Quantity: 1000000}); recordTitle(dl) != "NEW MONTHLY RECORD" {
+		t.Errorf("expected the first liquidation to only set the monthly record, got %v", dl.Medals)
+	}
+	dl := s.Decorate(Liquidation{Symbol: "XBTUSD", Side: "Sell", Quantity: 5000000, Price: 9000.5})
+	if recordTitle(dl) != "NEW ALL-TIME RECORD" {
+		t.Fatalf("expected a larger one to break the all-time record, got %v", dl.Medals)
+	}
+
+	cards, err := LoadRecordCard("text/record_card.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := cards.Render(dl, DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(file.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != cards.Template.Bounds() {
+		t.Errorf("expected the size of the template, got %v", img.Bounds())
+	}
+
+	// The size is written in white in the middle of the card
+	b := img.Bounds()
+	white := 0
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Dy()/2 - 30; y < b.Dy()/2+30; y++ {
+			if r, g, bl, _ := img.At(x, y).RGBA(); r == 0xffff && g == 0xffff && bl == 0xffff {
+				white++
+			}
+		}
+	}
+	if white == 0 {
+		t.Error("expected text to be drawn over the template")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Missed sums up the liquidations that went by while they couldn't be posted, so the channel
+// gets a single catch-up message instead of either silence or a late flood.
+type Missed struct {
+	Orders  int
+	USD     int64
+	Largest Liquidation
+}
+
+// Add counts the liquidation as missed.
+func (m *Missed) Add(l Liquidation) {
+	m.Orders++
+	m.USD += l.USDValue()
+
+	if usd, largest := l.USDValue(), m.Largest.USDValue(); m.Orders == 1 || usd > largest || (usd == largest && l.Quantity > m.Largest.Quantity) {
+		m.Largest = l
+	}
+}
+
+// Text returns the catch-up message after lead, "While I was away: $63.0M liquidated across
+// 41 orders, largest $8.2M ETHUSD short", or nothing when nothing was missed.
+func (m Missed) Text(lead string, f NumberFormat) string {
+	if m.Orders == 0 {
+		return ""
+	}
+
+	orders := "orders"
+	if m.Orders == 1 {
+		orders = "order"
+	}
+
+	// Without the instruments, only the size in contracts is known
+	if m.USD == 0 {
+		return fmt.Sprintf("%v: %v %v liquidated, largest %v contracts %v %v",
+			lead, m.Orders, orders, humanize.Comma(m.Largest.Quantity), m.Largest.DisplayName(), m.Largest.Position())
+	}
+
+	return fmt.Sprintf("%v: %v liquidated across %v %v, largest %v %v %v",
+		lead, f.Short(m.USD), m.Orders, orders, f.Short(m.Largest.USDValue()), m.Largest.DisplayName(), m.Largest.Position())
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// clickHouseBacklog caps how many batches worth of rows are kept while ClickHouse is unreachable.
+const clickHouseBacklog = 10
+
+type (
+	// ClickHouseSink buffers liquidations and inserts them in batches through the ClickHouse HTTP
+	// interface, so a cascade costs a handful of inserts rather than one per liquidation.
+	ClickHouseSink struct {
+		URL      string // e.g. "http://localhost:8123"
+		User     string
+		Password string
+		Table    string
+		Client   *http.Client
+
+		BatchSize     int           // Rows that trigger an insert
+		FlushInterval time.Duration // Longest a row waits in the buffer
+
+		mu       sync.Mutex
+		rows     []clickHouseRow
+		flushing bool
+
+		insertMu sync.Mutex // Held through an insert, so Close waits for the one under way
+		stop     chan struct{}
+		stopOnce sync.Once
+	}
+
+	clickHouseRow struct {
+		Time     string  `json:"time"`
+		Exchange string  `json:"exchange"`
+		Symbol   string  `json:"symbol"`
+		Side     string  `json:"side"`
+		Price    float64 `json:"price"`
+		Qty      int64   `json:"qty"`
+		USD      float64 `json:"usd"`
+		Key      string  `json:"idempotency_key"`
+	}
+)
+
+// NewClickHouseSink returns the configured sink, creating the table if needed and flushing on the interval.
+func NewClickHouseSink(cfg BotConfig, client *http.Client) (*ClickHouseSink, error) {
+	s := &ClickHouseSink{
+		URL:           cfg.ClickHouseURL,
+		User:          cfg.ClickHouseUser,
+		Password:      cfg.ClickHousePassword,
+		Table:         cfg.ClickHouseTable,
+		Client:        client,
+		BatchSize:     cfg.ClickHouseBatch,
+		FlushInterval: cfg.ClickHouseFlush.Duration,
+		stop:          make(chan struct{}),
+	}
+
+	err := s.exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %v (
+		time     DateTime64(6, 'UTC'),
+		exchange LowCardinality(String),
+		symbol   LowCardinality(String),
+		side     LowCardinality(String),
+		price    Float64,
+		qty      Int64,
+		usd      Float64,
+		idempotency_key String
+	) ENGINE = MergeTree ORDER BY (symbol, time)`, s.Table), nil)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not create the liquidations table: {{err}}", err)
+	}
+	// The tables created before the keys get the column, the retried batches can be told apart by it
+	if err := s.exec(fmt.Sprintf("ALTER TABLE %v ADD COLUMN IF NOT EXISTS idempotency_key String", s.Table), nil); err != nil {
+		return nil, errwrap.Wrapf("could not add the idempotency keys to the liquidations table: {{err}}", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.flush()
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+// Publish implements Sink. The liquidation is only buffered, failed inserts are alerted about and retried.
+func (s *ClickHouseSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	l := dl.Liquidation
+
+	s.mu.Lock()
+	s.rows = append(s.rows, clickHouseRow{
+		Time:     liquidationTime(l).UTC().Format("2006-01-02 15:04:05.000000"),
+		Exchange: l.Exchange,
+		Symbol:   string(l.Symbol),
+		Side:     l.Side,
+		Price:    l.Price,
+		Qty:      l.Quantity,
+		USD:      float64(l.USDValue()),
+		Key:      l.IdempotencyKey(StagePosted),
+	})
+	full := len(s.rows) >= s.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		go s.flush()
+	}
+
+	return nil
+}
+
+// QueueDepth returns how many rows are waiting to be inserted.
+func (s *ClickHouseSink) QueueDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.rows)
+}
+
+// Announce implements Sink, there is nothing to record.
+func (s *ClickHouseSink) Announce(ctx context.Context, text string) error {
+	return nil
+}
+
+// Close stops the flushes on the interval and inserts the rows still buffered, for the bot not
+// to drop them when it stops.
+func (s *ClickHouseSink) Close() error {
+	s.stopOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+	return s.insert()
+}
+
+// flush inserts the buffered rows, one flush at a time.
+func (s *ClickHouseSink) flush() {
+	s.mu.Lock()
+	if s.flushing || len(s.rows) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.flushing = true
+	s.mu.Unlock()
+
+	s.insert()
+
+	s.mu.Lock()
+	s.flushing = false
+	s.mu.Unlock()
+}
+
+// insert takes the buffered rows and inserts them, putting them back when it fails.
+func (s *ClickHouseSink) insert() error {
+	s.insertMu.Lock()
+	defer s.insertMu.Unlock()
+
+	s.mu.Lock()
+	rows := s.rows
+	s.rows = nil
+	s.mu.Unlock()
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, row := range rows {
+		encoder.Encode(row)
+	}
+
+	err := s.exec(fmt.Sprintf("INSERT INTO %v FORMAT JSONEachRow", s.Table), &body)
+
+	s.mu.Lock()
+	if err != nil {
+		// Put the rows back in front of the new ones, keeping the most recent when the backlog is full
+		s.rows = append(rows, s.rows...)
+		if limit := clickHouseBacklog * s.BatchSize; len(s.rows) > limit {
+			s.rows = s.rows[len(s.rows)-limit:]
+		}
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		ops.Alert("clickhouse", "Failed to insert %v liquidations into ClickHouse: %v", len(rows), err)
+		return err
+	}
+	log.Printf("Inserted %v liquidations into ClickHouse\n", len(rows))
+	return nil
+}
+
+// exec runs a query, with body holding the data of inserts.
+func (s *ClickHouseSink) exec(query string, body io.Reader) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return errwrap.Wrapf("invalid ClickHouse URL: {{err}}", err)
+	}
+	u.RawQuery = url.Values{"query": {query}, "async_insert": {"1"}, "wait_for_async_insert": {"1"}}.Encode()
+
+	if body == nil {
+		body = strings.NewReader("")
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if s.User != "" {
+		req.SetBasicAuth(s.User, s.Password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		text, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(text))
+	}
+
+	return nil
+}
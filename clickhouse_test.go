@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClickHouseSinkBatches(t *testing.T) {
+	var mu sync.Mutex
+	var inserts []int
+	fail := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Query().Get("query"), "INSERT") {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			http.Error(w, "too many parts", http.StatusServiceUnavailable)
+			return
+		}
+
+		rows := 0
+		for scanner := bufio.NewScanner(r.Body); scanner.Scan(); {
+			rows++
+		}
+		inserts = append(inserts, rows)
+	}))
+	defer server.Close()
+
+	s := &ClickHouseSink{URL: server.URL, Table: "liquidations", Client: server.Client(), BatchSize: 100}
+	l := DecoratedLiquidation{Liquidation: Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"}}
+
+	// The first insert fails, its rows are kept for the next one
+	for i := 0; i < 2; i++ {
+		s.Publish(context.Background(), l)
+	}
+	s.flush()
+	for i := 0; i < 3; i++ {
+		s.Publish(context.Background(), l)
+	}
+	s.flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(inserts) != 1 || inserts[0] != 5 {
+		t.Errorf("expected a single insert of 5 rows, got %v", inserts)
+	}
+}
+
+func TestClickHouseSinkClose(t *testing.T) {
+	var mu sync.Mutex
+	rows := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		for scanner := bufio.NewScanner(r.Body); scanner.Scan(); {
+			rows++
+		}
+	}))
+	defer server.Close()
+
+	s := &ClickHouseSink{URL: server.URL, Table: "liquidations", Client: server.Client(), BatchSize: 100}
+	l := DecoratedLiquidation{Liquidation: Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"}}
+	for i := 0; i < 3; i++ {
+		s.Publish(context.Background(), l)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if rows != 3 || s.QueueDepth() != 0 {
+		t.Errorf("expected the 3 buffered rows to be inserted on closing, got %v", rows)
+	}
+}
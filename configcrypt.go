@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hashicorp/errwrap"
+	"golang.org/x/crypto/scrypt"
+)
+
+// configKeyEnv holds the passphrase of an encrypted config.
+const configKeyEnv = "REKT_CONFIG_KEY"
+
+// encryptedHeader starts encrypted configs, followed by the base64 of salt, nonce and AES-GCM ciphertext.
+var encryptedHeader = []byte("rekt-encrypted-v1\n")
+
+const configSaltSize = 16
+
+func isEncryptedConfig(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHeader)
+}
+
+// configCipher derives the AES-256 key from the passphrase.
+func configCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("the config is encrypted, set %v to its passphrase", configKeyEnv)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptConfig(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, configSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := configCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(append(salt, nonce...), aead.Seal(nil, nonce, plain, encryptedHeader)...)
+	return append(append([]byte(nil), encryptedHeader...), base64.StdEncoding.EncodeToString(sealed)+"\n"...), nil
+}
+
+func decryptConfig(data []byte, passphrase string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(bytes.TrimPrefix(data, encryptedHeader))))
+	if err != nil {
+		return nil, errwrap.Wrapf("corrupt encrypted config: {{err}}", err)
+	}
+	if len(sealed) < configSaltSize {
+		return nil, errors.New("corrupt encrypted config")
+	}
+
+	aead, err := configCipher(passphrase, sealed[:configSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[configSaltSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("corrupt encrypted config")
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], encryptedHeader)
+	if err != nil {
+		return nil, errors.New("could not decrypt the config, wrong passphrase?")
+	}
+	return plain, nil
+}
+
+// configCommand manages the config file: rekt config encrypt|decrypt [--in config.json] [--out config.json]
+// The passphrase is taken from REKT_CONFIG_KEY.
+func configCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	in := fs.String("in", "config.json", "config to read")
+	out := fs.String("out", "", "file to write, the input file when empty")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: rekt config encrypt|decrypt [--in config.json] [--out file]")
+	}
+	if *out == "" {
+		*out = *in
+	}
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	passphrase := os.Getenv(configKeyEnv)
+
+	switch positional[0] {
+	case "encrypt":
+		if isEncryptedConfig(data) {
+			return errors.New("the config is already encrypted")
+		}
+		if data, err = encryptConfig(data, passphrase); err != nil {
+			return err
+		}
+	case "decrypt":
+		if !isEncryptedConfig(data) {
+			return errors.New("the config isn't encrypted")
+		}
+		if data, err = decryptConfig(data, passphrase); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown config command %q", positional[0])
+	}
+
+	return ioutil.WriteFile(*out, data, 0600)
+}
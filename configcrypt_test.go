@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConfigEncryption(t *testing.T) {
+	plain := []byte(`{"discord_token": "hunter2"}`)
+
+	encrypted, err := encryptConfig(plain, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncryptedConfig(encrypted) || bytes.Contains(encrypted, []byte("hunter2")) {
+		t.Fatalf("expected an encrypted config, got %s", encrypted)
+	}
+
+	decrypted, err := decryptConfig(encrypted, "correct horse")
+	if err != nil || !bytes.Equal(decrypted, plain) {
+		t.Fatalf("expected %s, got %s: %v", plain, decrypted, err)
+	}
+
+	if _, err := decryptConfig(encrypted, "battery staple"); err == nil {
+		t.Error("expected the wrong passphrase to fail")
+	}
+	if _, err := decryptConfig(encrypted, ""); err == nil {
+		t.Error("expected a missing passphrase to fail")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+type (
+	// Cooldown keeps a single symbol melting down from monopolizing the channel: liquidations that come
+	// within Period of the last message about their symbol are held back and posted together once it passes.
+	Cooldown struct {
+		Period time.Duration
+
+		mu      sync.Mutex
+		symbols map[Symbol]*symbolCooldown
+	}
+
+	symbolCooldown struct {
+		last time.Time
+		held []Liquidation
+	}
+)
+
+// NewCooldown returns a cooldown of the given period.
+func NewCooldown(period time.Duration) *Cooldown {
+	return &Cooldown{
+		Period:  period,
+		symbols: make(map[Symbol]*symbolCooldown),
+	}
+}
+
+// Allow reports whether the liquidation can be posted right away. When it can't, it is held and
+// rollUp is called with everything held for the symbol once the cooldown has passed.
+func (c *Cooldown) Allow(l Liquidation, rollUp func(symbol Symbol, held []Liquidation)) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	sc, ok := c.symbols[l.Symbol]
+	if !ok {
+		sc = &symbolCooldown{}
+		c.symbols[l.Symbol] = sc
+	}
+
+	if len(sc.held) == 0 && now.Sub(sc.last) >= c.Period {
+		sc.last = now
+		return true
+	}
+
+	if len(sc.held) == 0 {
+		time.AfterFunc(sc.last.Add(c.Period).Sub(now), func() {
+			c.mu.Lock()
+			held := sc.held
+			sc.held = nil
+			sc.last = time.Now()
+			c.mu.Unlock()
+
+			rollUp(l.Symbol, held)
+		})
+	}
+	sc.held = append(sc.held, l)
+
+	return false
+}
+
+// rollUpText summarizes the liquidations that were held back on a symbol.
+func rollUpText(symbol Symbol, held []Liquidation) string {
+	var longs, shorts int
+	var longQty, shortQty int64
+	for _, l := range held {
+		if l.Side == "Buy" {
+			shorts++
+			shortQty += l.Quantity
+		} else {
+			longs++
+			longQty += l.Quantity
+		}
+	}
+
+	liquidations := "liquidations"
+	if len(held) == 1 {
+		liquidations = "liquidation"
+	}
+
+	return fmt.Sprintf("%v more %v on %v: %v contracts (%v longs %v / %v shorts %v)",
+		len(held), liquidations, symbol, humanize.Comma(longQty+shortQty),
+		longs, humanize.Comma(longQty), shorts, humanize.Comma(shortQty))
+}
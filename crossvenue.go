@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// CrossVenue groups an asset getting liquidated on several exchanges at once into a single message.
+	// Liquidations are posted as usual until one comes from another exchange than the others of its asset
+	// within Window; from then on they are held until the window closes and posted as one.
+	CrossVenue struct {
+		Window  time.Duration
+		Format  NumberFormat // Of the amounts of the messages
+		Exclude []string     // Exchanges the bot follows itself, left out when another source reports them, case insensitive
+
+		mu     sync.Mutex
+		assets map[string]*venueGroup
+	}
+
+	venueGroup struct {
+		recent   []Liquidation // Within the window, oldest first
+		grouping bool
+	}
+)
+
+// NewCrossVenue returns a grouping over the given window.
+func NewCrossVenue(window time.Duration) *CrossVenue {
+	return &CrossVenue{
+		Window: window,
+		assets: make(map[string]*venueGroup),
+	}
+}
+
+// Allow reports whether the liquidation can be posted on its own. When it can't, it is held and
+// announce is called with the cross-exchange message once the window closes.
+func (c *CrossVenue) Allow(l Liquidation, announce func(text string)) bool {
+	if l.Reported && c.excluded(l.Exchange) {
+		// The bot has the liquidation from the exchange already, counting it again would double it
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	asset := l.Asset()
+
+	g, ok := c.assets[asset]
+	if !ok {
+		g = &venueGroup{}
+		c.assets[asset] = g
+	}
+
+	if g.grouping {
+		g.recent = append(g.recent, l)
+		return false
+	}
+
+	now := time.Now()
+	for len(g.recent) > 0 && now.Sub(g.recent[0].Received) > c.Window {
+		g.recent = g.recent[1:]
+	}
+
+	other := false
+	for _, r := range g.recent {
+		other = other || r.Exchange != l.Exchange
+	}
+	g.recent = append(g.recent, l)
+	if !other {
+		return true
+	}
+
+	g.grouping = true
+	time.AfterFunc(g.recent[0].Received.Add(c.Window).Sub(now), func() {
+		c.mu.Lock()
+		group := g.recent
+		g.recent, g.grouping = nil, false
+		c.mu.Unlock()
+
+		announce(crossVenueText(asset, group, c.Format))
+	})
+
+	return false
+}
+
+func (c *CrossVenue) excluded(exchange string) bool {
+	for _, e := range c.Exclude {
+		if strings.EqualFold(e, exchange) {
+			return true
+		}
+	}
+	return false
+}
+
+// crossVenueText sums up the group: "BTC: $38.0M rekt across BitMex, Binance, Bybit in 90s".
+func crossVenueText(asset string, group []Liquidation, f NumberFormat) string {
+	var usd int64
+	var venues []string
+	seen := make(map[string]bool)
+	for _, l := range group {
+		usd += l.USDValue()
+		if !seen[l.Exchange] {
+			seen[l.Exchange] = true
+			venues = append(venues, l.Exchange)
+		}
+	}
+
+	span := group[len(group)-1].Received.Sub(group[0].Received).Round(time.Second)
+	if span < time.Second {
+		span = time.Second
+	}
+
+	if emoji := group[0].Emoji; emoji != "" {
+		asset = emoji + " " + asset
+	}
+
+	return fmt.Sprintf("%v: %v rekt across %v in %v", asset, f.Short(usd), strings.Join(venues, ", "), span)
+}
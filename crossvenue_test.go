@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrossVenue(t *testing.T) {
+	c := NewCrossVenue(50 * time.Millisecond)
+	c.Exclude = []string{"BitMex"}
+	announced := make(chan string, 1)
+	announce := func(text string) { announced <- text }
+
+	now := time.Now()
+	liquidation := func(exchange string, usd float64, ago time.Duration) Liquidation {
+		return Liquidation{Symbol: "XBTUSD", Underlying: "BTC", Side: "Sell", Quantity: 1, USD: usd, Exchange: exchange, Received: now.Add(-ago)}
+	}
+
+	if !c.Allow(liquidation("BitMex", 20000000, 2*time.Second), announce) {
+		t.Fatal("expected a lone liquidation to be posted")
+	}
+	if !c.Allow(liquidation("BitMex", 1000000, 0), announce) {
+		t.Fatal("expected the liquidations of a single exchange to be posted, the first one being out of the window")
+	}
+	reported := liquidation("BITMEX", 30000000, 0)
+	reported.Reported = true
+	if !c.Allow(reported, announce) {
+		t.Fatal("expected a reported liquidation of an excluded exchange to be left out of the grouping")
+	}
+	if c.Allow(liquidation("Binance", 15000000, 0), announce) || c.Allow(liquidation("Bybit", 2000000, 0), announce) {
+		t.Fatal("expected the liquidations on another exchange to be grouped")
+	}
+
+	select {
+	case text := <-announced:
+		if expected := "BTC: $18.0M rekt across BitMex, Binance, Bybit in 1s"; text != expected {
+			t.Errorf("expected %q, got %q", expected, text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the group to be announced")
+	}
+
+	if !c.Allow(liquidation("Binance", 1000000, 0), announce) {
+		t.Error("expected the grouping to end with the window")
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// Dashboard is the web page showing the live feed, the 24h totals and the largest liquidations
+	// outside Discord, and the API behind it. It is a Sink, taking the liquidations and the
+	// announcements as they are delivered. The totals and the largest come from the history when
+	// it is kept, from the latest liquidations otherwise.
+	Dashboard struct {
+		mu      sync.Mutex
+		history *History // Set along with the format once the history is loaded
+		format  NumberFormat
+		recent  []Liquidation // Latest last, at most dashboardRecent
+		clients map[chan dashboardMessage]bool
+	}
+
+	// dashboardEvent is a liquidation as the API writes it.
+	dashboardEvent struct {
+		ID       string    `json:"id"` // Idempotency key, the same when the event is sent again
+		Time     time.Time `json:"time"`
+		Exchange string    `json:"exchange"`
+		Symbol   Symbol    `json:"symbol"`
+		Name     string    `json:"name"`
+		Position string    `json:"position"` // "long" or "short", the side that was liquidated
+		Price    float64   `json:"price"`
+		Quantity int64     `json:"quantity"`
+		USD      int64     `json:"usd"`
+		Text     string    `json:"text"` // As posted to Discord
+
+		Historical bool `json:"historical,omitempty"` // Backfilled or replayed rather than live
+	}
+
+	// dashboardTotals are the totals of the last 24h.
+	dashboardTotals struct {
+		Since  time.Time `json:"since"`
+		Orders int       `json:"orders"`
+		Longs  int64     `json:"longs_usd"`
+		Shorts int64     `json:"shorts_usd"`
+	}
+
+	// dashboardMessage is an event of the stream, in JSON and in protobuf.
+	dashboardMessage struct {
+		event string
+		id    string
+		data  []byte
+		proto []byte
+	}
+)
+
+// dashboardRecent is how many of the latest liquidations the dashboard keeps for the feed.
+const dashboardRecent = 200
+
+// dashboardPage is the dashboard, a single page reading the API.
+//
+//go:embed text/dashboard.html
+var dashboardPage []byte
+
+// dashboard is served on / when enabled, it gets the liquidations once it is one of the sinks.
+var dashboard = &Dashboard{}
+
+// SetHistory sets the history the totals and the largest are read from, and the format of the
+// texts of the events.
+func (d *Dashboard) SetHistory(history *History, format NumberFormat) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.history, d.format = history, format
+}
+
+// source returns the history, nil until it is set, and the format.
+func (d *Dashboard) source() (*History, NumberFormat) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.history, d.format
+}
+
+// Publish implements Sink.
+func (d *Dashboard) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	d.mu.Lock()
+	d.recent = append(d.recent, dl.Liquidation)
+	if len(d.recent) > dashboardRecent {
+		d.recent = d.recent[len(d.recent)-dashboardRecent:]
+	}
+	d.mu.Unlock()
+
+	// The historical liquidations are kept for the lists, the stream being the live feed
+	if dl.Liquidation.Historical {
+		return nil
+	}
+
+	event := d.event(dl.Liquidation)
+	_, format := d.source()
+	event.Text = dl.Format(format)
+	return d.broadcastEvent("liquidation", event)
+}
+
+// Amend implements Amender, replacing the liquidation in the feed and sending the amended one.
+func (d *Dashboard) Amend(ctx context.Context, l Liquidation) error {
+	d.mu.Lock()
+	for i := range d.recent {
+		if d.recent[i].OrderID == l.OrderID && d.recent[i].Exchange == l.Exchange {
+			d.recent[i] = l
+		}
+	}
+	d.mu.Unlock()
+
+	event := d.event(l)
+	event.ID = l.IdempotencyKey(StageAmended)
+	return d.broadcastEvent("amended", event)
+}
+
+func (d *Dashboard) broadcastEvent(name string, event dashboardEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	d.broadcast(dashboardMessage{event: name, id: event.ID, data: data, proto: protoLiquidationEvent(name, event)})
+	return nil
+}
+
+// Announce implements Sink.
+func (d *Dashboard) Announce(ctx context.Context, text string) error {
+	data, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	d.broadcast(dashboardMessage{event: "announcement", data: data, proto: protoAnnouncementEvent(text)})
+	return nil
+}
+
+// broadcast sends the message to every client of the stream, skipping those too slow to keep up.
+func (d *Dashboard) broadcast(msg dashboardMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for client := range d.clients {
+		select {
+		case client <- msg:
+		default:
+			metrics.Counter("rekt_dashboard_dropped_total").Inc()
+		}
+	}
+}
+
+func (d *Dashboard) event(l Liquidation) dashboardEvent {
+	_, format := d.source()
+	return dashboardEvent{
+		ID:       l.IdempotencyKey(StagePosted),
+		Time:     liquidationTime(l),
+		Exchange: l.Exchange,
+		Symbol:   l.Symbol,
+		Name:     l.DisplayName(),
+		Position: l.Position(),
+		Price:    l.Price,
+		Quantity: l.Quantity,
+		USD:      l.USDValue(),
+		Text:     l.Format(format),
+
+		Historical: l.Historical,
+	}
+}
+
+// since returns the liquidations received after t, oldest first.
+func (d *Dashboard) since(t time.Time) []Liquidation {
+	if history, _ := d.source(); history != nil {
+		return history.Since(t, nil)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var liquidations []Liquidation
+	for _, l := range d.recent {
+		if liquidationTime(l).After(t) {
+			liquidations = append(liquidations, l)
+		}
+	}
+	return liquidations
+}
+
+// Latest returns the latest liquidations, newest first.
+func (d *Dashboard) Latest(limit int) []dashboardEvent {
+	d.mu.Lock()
+	recent := append([]Liquidation(nil), d.recent...)
+	d.mu.Unlock()
+
+	events := []dashboardEvent{}
+	for i := len(recent) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, d.event(recent[i]))
+	}
+	return events
+}
+
+// Totals sums up the liquidations since the time.
+func (d *Dashboard) Totals(since time.Time) dashboardTotals {
+	totals := dashboardTotals{Since: since}
+	for _, l := range d.since(since) {
+		totals.Orders++
+		if l.Position() == "long" {
+			totals.Longs += l.USDValue()
+		} else {
+			totals.Shorts += l.USDValue()
+		}
+	}
+	return totals
+}
+
+// Top returns the largest liquidations since the time, largest first.
+func (d *Dashboard) Top(since time.Time, limit int) []dashboardEvent {
+	liquidations := d.since(since)
+	sort.SliceStable(liquidations, func(i, j int) bool { return liquidations[i].USDValue() > liquidations[j].USDValue() })
+	if len(liquidations) > limit {
+		liquidations = liquidations[:limit]
+	}
+
+	events := []dashboardEvent{}
+	for _, l := range liquidations {
+		events = append(events, d.event(l))
+	}
+	return events
+}
+
+// handle serves the page on / and the API under /api.
+func (d *Dashboard) handle(mux *http.ServeMux) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardPage)
+	})
+	mux.HandleFunc("/api/liquidations", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, r, d.Latest(queryLimit(r, 50)))
+	})
+	mux.HandleFunc("/api/totals", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.Totals(time.Now().Add(-day)))
+	})
+	mux.HandleFunc("/api/top", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, r, d.Top(time.Now().Add(-day), queryLimit(r, 10)))
+	})
+	mux.HandleFunc("/api/stream", d.serveStream)
+}
+
+// serveStream sends the liquidations and the announcements as server-sent events until the client
+// leaves, or as delimited protobuf messages in the protobuf format.
+func (d *Dashboard) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan dashboardMessage, 16)
+	d.mu.Lock()
+	if d.clients == nil {
+		d.clients = make(map[chan dashboardMessage]bool)
+	}
+	d.clients[client] = true
+	metrics.Gauge("rekt_dashboard_clients").Set(float64(len(d.clients)))
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, client)
+		metrics.Gauge("rekt_dashboard_clients").Set(float64(len(d.clients)))
+		d.mu.Unlock()
+	}()
+
+	protobuf := wantsProtobuf(r)
+	if protobuf {
+		w.Header().Set("Content-Type", protobufContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	// Comments, or empty messages, keep the proxies from closing an idle stream
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if protobuf {
+				writeDelimited(w, nil)
+			} else {
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+		case msg := <-client:
+			if protobuf {
+				writeDelimited(w, msg.proto)
+			} else {
+				if msg.id != "" {
+					fmt.Fprintf(w, "id: %v\n", msg.id)
+				}
+				fmt.Fprintf(w, "event: %v\ndata: %s\n\n", msg.event, msg.data)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvents writes the liquidations as a JSON list, or as delimited protobuf messages in the protobuf format.
+func writeEvents(w http.ResponseWriter, r *http.Request, events []dashboardEvent) {
+	if !wantsProtobuf(r) {
+		writeJSON(w, events)
+		return
+	}
+
+	w.Header().Set("Content-Type", protobufContentType)
+	for _, event := range events {
+		if err := writeDelimited(w, protoLiquidationEvent("liquidation", event)); err != nil {
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// queryLimit reads the limit parameter, between 1 and 500.
+func queryLimit(r *http.Request, fallback int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return fallback
+	}
+	if limit > 500 {
+		return 500
+	}
+	return limit
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	d := &Dashboard{}
+	mux := http.NewServeMux()
+	d.handle(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The client is registered once the headers are sent
+	now := time.Now()
+	for _, dl := range []DecoratedLiquidation{
+		{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Sell", Price: 65000, Quantity: 200000, Received: now}},
+		{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Buy", Price: 65100, Quantity: 50000, Received: now}},
+	} {
+		if err := d.Publish(context.Background(), dl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	var data string
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "data: ") {
+			data = strings.TrimPrefix(lines.Text(), "data: ")
+			break
+		}
+	}
+	var event dashboardEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil || event.USD != 200000 || event.Position != "long" {
+		t.Errorf("expected the first liquidation on the stream, got %q (%v)", data, err)
+	}
+
+	var totals dashboardTotals
+	if err := getJSON(server.URL+"/api/totals", &totals); err != nil || totals.Orders != 2 || totals.Longs != 200000 || totals.Shorts != 50000 {
+		t.Errorf("unexpected totals %+v (%v)", totals, err)
+	}
+
+	var top []dashboardEvent
+	if err := getJSON(server.URL+"/api/top?limit=1", &top); err != nil || len(top) != 1 || top[0].USD != 200000 {
+		t.Errorf("expected the largest only, got %+v (%v)", top, err)
+	}
+
+	var latest []dashboardEvent
+	if err := getJSON(server.URL+"/api/liquidations", &latest); err != nil || len(latest) != 2 || latest[0].USD != 50000 {
+		t.Errorf("expected the latest first, got %+v (%v)", latest, err)
+	}
+}
+
+func getJSON(url string, v interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	l := Liquidation{Exchange: "BitMex", OrderID: "6fb4", Symbol: "XBTUSD", Side: "Sell", Price: 65000, Quantity: 1000}
+	if key := l.IdempotencyKey(StagePosted); key != "bitmex:6fb4:posted" {
+		t.Errorf("unexpected key %q", key)
+	}
+
+	// Without an order ID the details stand in, the same for the same liquidation
+	l.OrderID, l.Received = "", time.Unix(1700000000, 0)
+	key := l.IdempotencyKey(StagePosted)
+	if again := l.IdempotencyKey(StagePosted); again != key || !strings.HasPrefix(key, "bitmex:") {
+		t.Errorf("expected a stable key, got %q and %q", key, again)
+	}
+	l.Received = l.Received.Add(time.Second)
+	if replayed := l.IdempotencyKey(StagePosted); replayed != key {
+		t.Errorf("expected the key not to depend on when the liquidation was received, got %q and %q", key, replayed)
+	}
+	l.Price++
+	if other := l.IdempotencyKey(StagePosted); other == key {
+		t.Error("expected another liquidation to get another key")
+	}
+
+	d := &Dashboard{}
+	client := make(chan dashboardMessage, 1)
+	d.clients = map[chan dashboardMessage]bool{client: true}
+	if err := d.Amend(context.Background(), Liquidation{Exchange: "BitMex", OrderID: "6fb4"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-client; msg.event != "amended" || msg.id != "bitmex:6fb4:amended" {
+		t.Errorf("expected the amended event, got %v %q", msg.event, msg.id)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+)
+
+// DebugState collects the internals of the running components for /debug/state.
+type DebugState struct {
+	mu         sync.Mutex
+	components map[string]func() interface{}
+}
+
+// debugState is the registry served on /debug/state.
+var debugState = &DebugState{components: make(map[string]func() interface{})}
+
+// Register adds a component, state is called on every request and must be safe to call concurrently.
+func (d *DebugState) Register(name string, state func() interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.components[name] = state
+}
+
+// ServeHTTP writes the state of every component as JSON.
+func (d *DebugState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	state := map[string]interface{}{
+		"runtime": map[string]interface{}{
+			"goroutines": runtime.NumGoroutine(),
+			"heap_bytes": mem.HeapAlloc,
+			"gc_cycles":  mem.NumGC,
+		},
+	}
+
+	d.mu.Lock()
+	for name, component := range d.components {
+		state[name] = component()
+	}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(state)
+}
+
+// handleDebug adds the profiler, /debug/state and /debug/reload to the mux.
+func handleDebug(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/state", debugState)
+	mux.HandleFunc("/debug/reload", serveReload)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+// maxDedupEntries bounds the liquidations remembered, far more than a window ever holds.
+const maxDedupEntries = 100000
+
+// Dedup suppresses liquidations whose content was already seen within Window, such as the same
+// event reported by two feeds or by the websocket and the REST fallback both. The venue isn't part
+// of the content, so identical reports from different adapters count as one, but the order is when
+// there is one, so two orders of the same size and price both go through.
+type Dedup struct {
+	Window time.Duration
+
+	seen *TTLCache
+}
+
+// NewDedup returns a suppression window of the given length.
+func NewDedup(window time.Duration) *Dedup {
+	return &Dedup{
+		Window: window,
+		seen:   NewTTLCache("dedup", window, maxDedupEntries),
+	}
+}
+
+// Len returns the number of liquidations remembered.
+func (d *Dedup) Len() int {
+	return d.seen.Len()
+}
+
+// Duplicate reports whether an identical liquidation was seen within the window, remembering this one otherwise.
+func (d *Dedup) Duplicate(l Liquidation, now time.Time) bool {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v|%v|%v|%v|%v", l.OrderID, l.Symbol, l.Side, l.Price, l.Quantity)))
+	key := string(sum[:])
+
+	if _, ok := d.seen.Get(key, now); ok {
+		return true
+	}
+	d.seen.Set(key, true, now)
+
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	d := NewDedup(5 * time.Second)
+	now := time.Unix(1500000000, 0)
+	l := Liquidation{Symbol: "XBTUSD", Side: "Sell", Price: 9000.5, Quantity: 20000, Exchange: "BitMex"}
+
+	if d.Duplicate(l, now) {
+		t.Error("expected the first report to go through")
+	}
+
+	other := l
+	other.Exchange = "Elsewhere"
+	if !d.Duplicate(other, now.Add(time.Second)) {
+		t.Error("expected the same liquidation from another feed to be suppressed")
+	}
+
+	order := l
+	order.OrderID = "a"
+	if d.Duplicate(order, now.Add(time.Second)) {
+		t.Error("expected another order of the same size to go through")
+	}
+	if !d.Duplicate(order, now.Add(2*time.Second)) {
+		t.Error("expected the same order to be suppressed")
+	}
+
+	bigger := l
+	bigger.Quantity++
+	if d.Duplicate(bigger, now.Add(time.Second)) {
+		t.Error("expected a different quantity to go through")
+	}
+
+	if d.Duplicate(l, now.Add(10*time.Second)) {
+		t.Error("expected the liquidation to go through again once the window passed")
+	}
+}
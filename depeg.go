@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Stable coins the contracts are margined in
+var stableCoins = []string{"USDT", "USDC", "BUSD"}
+
+// DepegWatcher follows the exchange rate of stable coin pairs, so the liquidations of the contracts
+// quoted in them can be flagged while one is off its peg: a collapsing quote currency liquidates
+// positions that had nothing to do with the asset, and readers wonder what happened.
+type DepegWatcher struct {
+	Host      string // Of the Binance API
+	Client    *http.Client
+	Pairs     []string // Such as "USDCUSDT"
+	Threshold float64  // Deviation from 1 that counts as a depeg, 0.01 being 1%
+	Interval  time.Duration
+
+	mu    sync.Mutex
+	rates map[string]float64 // Of the pairs off their peg
+}
+
+// binanceTicker is the latest price of a symbol.
+// https://binance-docs.github.io/apidocs/spot/en/#symbol-price-ticker
+type binanceTicker struct {
+	Symbol string `json:"symbol"`
+	Price  string `json:"price"`
+}
+
+// Run polls the pairs every interval.
+func (w *DepegWatcher) Run() {
+	for ; ; time.Sleep(w.Interval) {
+		for _, pair := range w.Pairs {
+			rate, err := w.fetch(pair)
+			if err != nil {
+				log.Println("Failed to fetch the stable coin rate:", err)
+				continue
+			}
+			w.Observe(pair, rate)
+		}
+	}
+}
+
+// Observe records the exchange rate of a pair.
+func (w *DepegWatcher) Observe(pair string, rate float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.rates == nil {
+		w.rates = make(map[string]float64)
+	}
+
+	if math.Abs(rate-1) >= w.Threshold {
+		w.rates[pair] = rate
+		metrics.Gauge("rekt_depeg", "pair", pair).Set(1)
+	} else {
+		delete(w.rates, pair)
+		metrics.Gauge("rekt_depeg", "pair", pair).Set(0)
+	}
+}
+
+// Flag returns the note for the liquidations on the symbol when its quote currency is part of a
+// depegged pair, such as "USDC/USDT at 0.9650", or empty when all is well.
+func (w *DepegWatcher) Flag(symbol Symbol) string {
+	quote := stableQuote(symbol)
+	if quote == "" {
+		return ""
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, pair := range w.Pairs {
+		rate, ok := w.rates[pair]
+		if !ok || !strings.Contains(pair, quote) {
+			continue
+		}
+		if base := stableQuote(Symbol(pair)); base != "" {
+			return fmt.Sprintf("%v/%v at %.4f", strings.TrimSuffix(pair, base), base, rate)
+		}
+	}
+	return ""
+}
+
+func (w *DepegWatcher) fetch(pair string) (float64, error) {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     w.Host,
+		Path:     "/api/v3/ticker/price",
+		RawQuery: url.Values{"symbol": {pair}}.Encode(),
+	}
+
+	resp, err := w.Client.Get(u.String())
+	if err != nil {
+		return 0, errwrap.Wrapf("could not fetch the price: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("could not fetch the price of %v: %v", pair, resp.Status)
+	}
+
+	var ticker binanceTicker
+	if err := json.NewDecoder(resp.Body).Decode(&ticker); err != nil {
+		return 0, errwrap.Wrapf("bad price response: {{err}}", err)
+	}
+
+	return strconv.ParseFloat(ticker.Price, 64)
+}
+
+// stableQuote returns the stable coin the symbol is quoted in, empty when it isn't.
+func stableQuote(symbol Symbol) string {
+	for _, coin := range stableCoins {
+		if strings.HasSuffix(string(symbol), coin) {
+			return coin
+		}
+	}
+	return ""
+}
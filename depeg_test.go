@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestDepegWatcherFlag(t *testing.T) {
+	w := &DepegWatcher{Pairs: []string{"USDCUSDT"}, Threshold: 0.01}
+
+	w.Observe("USDCUSDT", 0.998)
+	if flag := w.Flag("XBTUSDT"); flag != "" {
+		t.Errorf("expected no flag within the peg, got %q", flag)
+	}
+
+	w.Observe("USDCUSDT", 0.965)
+	for _, symbol := range []Symbol{"XBTUSDT", "ETHUSDC"} {
+		if flag := w.Flag(symbol); flag != "USDC/USDT at 0.9650" {
+			t.Errorf("expected %v to be flagged, got %q", symbol, flag)
+		}
+	}
+	if flag := w.Flag("XBTUSD"); flag != "" {
+		t.Errorf("expected the inverse contracts not to be flagged, got %q", flag)
+	}
+
+	w.Observe("USDCUSDT", 1.001)
+	if flag := w.Flag("XBTUSDT"); flag != "" {
+		t.Errorf("expected the flag to go once the peg is back, got %q", flag)
+	}
+}
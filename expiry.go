@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ExpiryWatcher follows the listed futures and tells when one expires or a new front month
+// takes over, so the channel isn't left wondering why XBTU24 went quiet.
+type ExpiryWatcher struct {
+	Instruments *InstrumentCache
+	Symbols     *SymbolMap
+	Interval    time.Duration
+
+	futures map[Symbol]Instrument // Tracked contracts, nil until the first poll
+	front   map[string]Symbol     // Front month of each underlying
+}
+
+// Run polls the listed instruments every interval and announces the changes.
+func (w *ExpiryWatcher) Run(announce func(text string)) {
+	for ; ; time.Sleep(w.Interval) {
+		active, err := w.Instruments.Active()
+		if err != nil {
+			log.Println("Failed to fetch the active instruments:", err)
+			continue
+		}
+
+		for _, notice := range w.update(active, time.Now()) {
+			announce(notice)
+		}
+	}
+}
+
+// update tracks the futures in the active instruments and returns the notices for what changed
+// since the previous poll. The first poll only takes note of what is listed.
+func (w *ExpiryWatcher) update(active []Instrument, now time.Time) []string {
+	futures := make(map[Symbol]Instrument)
+	front := make(map[string]Symbol)
+	for _, instrument := range active {
+		if !instrument.IsFutures() || !instrument.Expiry.After(now) {
+			continue
+		}
+		futures[instrument.Symbol] = instrument
+
+		underlying := w.info(instrument).Underlying
+		if current, ok := front[underlying]; !ok || instrument.Expiry.Before(futures[current].Expiry) {
+			front[underlying] = instrument.Symbol
+		}
+	}
+
+	first := w.futures == nil
+	previous, previousFront := w.futures, w.front
+	w.futures, w.front = futures, front
+	if first {
+		return nil
+	}
+
+	// Contracts that reached their expiry, with the contract taking over if there is one
+	var notices []string
+	rolled := make(map[string]bool)
+	for _, symbol := range sortedSymbols(previous) {
+		instrument := previous[symbol]
+		if _, ok := futures[symbol]; ok || instrument.Expiry.After(now) {
+			continue
+		}
+
+		info := w.info(instrument)
+		notice := fmt.Sprintf("%v has expired", info.Display)
+		if next, ok := front[info.Underlying]; ok && next != previousFront[info.Underlying] {
+			notice += fmt.Sprintf(", %v futures roll to %v", info.Underlying, w.describe(futures[next]))
+			rolled[info.Underlying] = true
+		}
+		notices = append(notices, notice)
+	}
+
+	// Front months that changed otherwise, such as a nearer contract being listed
+	underlyings := make([]string, 0, len(front))
+	for underlying := range front {
+		underlyings = append(underlyings, underlying)
+	}
+	sort.Strings(underlyings)
+
+	for _, underlying := range underlyings {
+		next := front[underlying]
+		if rolled[underlying] || next == previousFront[underlying] {
+			continue
+		}
+		notices = append(notices, fmt.Sprintf("New %v front month: %v", underlying, w.describe(futures[next])))
+	}
+
+	return notices
+}
+
+func (w *ExpiryWatcher) info(instrument Instrument) SymbolInfo {
+	if w.Symbols != nil {
+		return w.Symbols.Lookup(instrument.Symbol)
+	}
+	return SymbolInfo{Display: string(instrument.Symbol), Underlying: instrument.Underlying}
+}
+
+// describe names the contract along with its expiry: "XBTZ24 (expires Dec 27 12:00 UTC)".
+func (w *ExpiryWatcher) describe(instrument Instrument) string {
+	return fmt.Sprintf("%v (expires %v)", w.info(instrument).Display, instrument.Expiry.UTC().Format("Jan 2 15:04 MST"))
+}
+
+func sortedSymbols(instruments map[Symbol]Instrument) []Symbol {
+	symbols := make([]Symbol, 0, len(instruments))
+	for symbol := range instruments {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+	return symbols
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpiryWatcher(t *testing.T) {
+	now := time.Date(2024, time.September, 27, 11, 0, 0, 0, time.UTC)
+	sep := Instrument{Symbol: "XBTU24", Typ: futuresTyp, Underlying: "XBT", Expiry: now.Add(time.Hour)}
+	dec := Instrument{Symbol: "XBTZ24", Typ: futuresTyp, Underlying: "XBT", Expiry: time.Date(2024, time.December, 27, 12, 0, 0, 0, time.UTC)}
+	mar := Instrument{Symbol: "XBTH25", Typ: futuresTyp, Underlying: "XBT", Expiry: time.Date(2025, time.March, 28, 12, 0, 0, 0, time.UTC)}
+	perp := Instrument{Symbol: "XBTUSD", Typ: "FFWCSX", Underlying: "XBT"}
+
+	w := &ExpiryWatcher{Symbols: &SymbolMap{}}
+
+	if notices := w.update([]Instrument{perp, sep, dec}, now); notices != nil {
+		t.Fatalf("expected no notices on the first poll, got %q", notices)
+	}
+
+	// Nothing changed
+	if notices := w.update([]Instrument{perp, sep, dec, mar}, now); notices != nil {
+		t.Fatalf("expected no notices when only a back month is listed, got %q", notices)
+	}
+
+	// September settles
+	now = now.Add(2 * time.Hour)
+	expected := []string{"XBTU24 has expired, BTC futures roll to XBTZ24 (expires Dec 27 12:00 UTC)"}
+	if notices := w.update([]Instrument{perp, dec, mar}, now); !reflect.DeepEqual(notices, expected) {
+		t.Fatalf("expected %q, got %q", expected, notices)
+	}
+
+	if notices := w.update([]Instrument{perp, dec, mar}, now); notices != nil {
+		t.Fatalf("expected no notices once rolled, got %q", notices)
+	}
+}
+
+func TestScoreKey(t *testing.T) {
+	perp := Liquidation{Symbol: "XBTUSD", Underlying: "BTC"}
+	futures := Liquidation{Symbol: "XBTZ24", Underlying: "BTC", Expiry: time.Now()}
+
+	if key := perp.ScoreKey(); key != "XBTUSD" {
+		t.Errorf("expected perpetuals to keep their own scores, got %v", key)
+	}
+	if key := futures.ScoreKey(); key != "BTC futures" {
+		t.Errorf("expected futures to share their underlying's scores, got %v", key)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// exportLimit is the largest attachment Discord accepts from bots without boosts.
+const exportLimit = 8 << 20
+
+// exportCommand is /export, a CSV of the recent liquidations.
+func exportCommand(history *History) *SlashCommand {
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "export",
+			Description: "CSV of the recent liquidations",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "period", Description: "How far back, such as 24h or 7d, 24h by default"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "symbol", Description: "Only this contract"},
+			},
+		},
+		Deferred: true,
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			period, err := parsePeriod(req.String("period", "24h"))
+			if err != nil {
+				return nil, err
+			}
+			symbol := Symbol(strings.ToUpper(req.String("symbol", "")))
+
+			liquidations := history.Since(time.Now().Add(-period), func(l Liquidation) bool {
+				return symbol == "" || l.Symbol == symbol
+			})
+			if len(liquidations) == 0 {
+				return &discordgo.InteractionResponseData{Content: "No liquidations in that period"}, nil
+			}
+
+			name := "liquidations-" + time.Now().UTC().Format("20060102-1504")
+			if symbol != "" {
+				name += "-" + string(symbol)
+			}
+
+			file, rows, err := exportFile(name, liquidations, exportLimit)
+			if err != nil {
+				return nil, err
+			}
+
+			content := fmt.Sprintf("%v liquidations over the last %v", len(liquidations), req.String("period", "24h"))
+			if rows < len(liquidations) {
+				content += fmt.Sprintf(", truncated to the latest %v to fit Discord's size limit", rows)
+			}
+
+			return &discordgo.InteractionResponseData{
+				Content: content,
+				Files:   []*discordgo.File{file},
+			}, nil
+		},
+	}
+}
+
+// exportFile writes the liquidations as CSV, zipping it when it is too large to attach and
+// keeping only the latest rows when even that doesn't fit.
+func exportFile(name string, liquidations []Liquidation, limit int) (file *discordgo.File, rows int, err error) {
+	for rows = len(liquidations); rows > 0; rows /= 2 {
+		data, err := writeCSV(liquidations[len(liquidations)-rows:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data) <= limit {
+			return &discordgo.File{Name: name + ".csv", ContentType: "text/csv", Reader: bytes.NewReader(data)}, rows, nil
+		}
+
+		zipped, err := zipFile(name+".csv", data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(zipped) <= limit {
+			return &discordgo.File{Name: name + ".zip", ContentType: "application/zip", Reader: bytes.NewReader(zipped)}, rows, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("export doesn't fit in %v bytes", limit)
+}
+
+// writeCSV writes the liquidations with a header row.
+func writeCSV(liquidations []Liquidation) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"time", "exchange", "symbol", "side", "price", "quantity", "usd"})
+	for _, l := range liquidations {
+		w.Write([]string{
+			l.Received.UTC().Format(time.RFC3339),
+			l.Exchange,
+			string(l.Symbol),
+			l.Side,
+			strconv.FormatFloat(l.Price, 'f', -1, 64),
+			strconv.FormatInt(l.Quantity, 10),
+			strconv.FormatInt(l.USDValue(), 10),
+		})
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+func zipFile(name string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parsePeriod parses durations along with days and weeks, which people use the most: "24h", "7d", "2w".
+func parsePeriod(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64); strings.HasSuffix(s, suffix) && err == nil && n > 0 {
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period %q, try 24h or 7d", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExportFile(t *testing.T) {
+	var liquidations []Liquidation
+	for i := 0; i < 1000; i++ {
+		liquidations = append(liquidations, Liquidation{Symbol: "XBTUSD", Side: "Sell", Price: 9000, Quantity: int64(i), Received: time.Unix(int64(i), 0)})
+	}
+
+	file, rows, err := exportFile("export", liquidations, 1<<20)
+	if err != nil || file.Name != "export.csv" || rows != 1000 {
+		t.Fatalf("expected a plain CSV of every row, got %v with %v rows: %v", file, rows, err)
+	}
+
+	// Too big as text but compresses well
+	file, rows, err = exportFile("export", liquidations, 10000)
+	if err != nil || file.Name != "export.zip" || rows != 1000 {
+		t.Fatalf("expected a zipped CSV of every row, got %v with %v rows: %v", file, rows, err)
+	}
+
+	file, rows, err = exportFile("export", liquidations, 500)
+	if err != nil || rows >= 1000 || rows == 0 {
+		t.Fatalf("expected a truncated export, got %v with %v rows: %v", file, rows, err)
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	for s, expected := range map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "90m": 90 * time.Minute} {
+		if d, err := parsePeriod(s); err != nil || d != expected {
+			t.Errorf("%v: expected %v, got %v (%v)", s, expected, d, err)
+		}
+	}
+
+	for _, s := range []string{"", "d", "-1d", "soon"} {
+		if _, err := parsePeriod(s); err == nil {
+			t.Errorf("%v: expected an error", s)
+		}
+	}
+}
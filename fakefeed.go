@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// FakeFeed generates random liquidations so the formatting and delivery can be demoed and
+// load-tested without waiting for the market to move.
+type FakeFeed struct {
+	Pipeline *Pipeline
+
+	Rate      float64 // Average liquidations per second outside of cascades
+	MedianQty float64 // Median liquidation size in contracts
+	Sigma     float64 // Spread of the log-normal size distribution
+
+	BurstChance float64 // Chance that a liquidation sets off a cascade
+	BurstSize   int     // Average number of liquidations in a cascade
+
+	prices map[Symbol]float64
+}
+
+// NewFakeFeed returns a fake feed with defaults that look roughly like a busy day on BitMex.
+func NewFakeFeed(pipeline *Pipeline) *FakeFeed {
+	return &FakeFeed{
+		Pipeline:    pipeline,
+		Rate:        0.2,
+		MedianQty:   20000,
+		Sigma:       1.5,
+		BurstChance: 0.05,
+		BurstSize:   15,
+		prices: map[Symbol]float64{
+			"XBTUSD": 9000,
+			"XBTZ16": 9150,
+			"XBJ24H": 990000,
+		},
+	}
+}
+
+// RegisterFlags binds the generator settings to command line flags.
+func (f *FakeFeed) RegisterFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&f.Rate, "fake-rate", f.Rate, "average fake liquidations per second")
+	fs.Float64Var(&f.MedianQty, "fake-median", f.MedianQty, "median fake liquidation size in contracts")
+	fs.Float64Var(&f.Sigma, "fake-sigma", f.Sigma, "spread of the fake liquidation sizes")
+	fs.Float64Var(&f.BurstChance, "fake-burst-chance", f.BurstChance, "chance that a fake liquidation starts a cascade")
+	fs.IntVar(&f.BurstSize, "fake-burst-size", f.BurstSize, "average number of liquidations in a fake cascade")
+}
+
+// Check rejects the settings the generator can't run with.
+func (f *FakeFeed) Check() error {
+	if f.Rate <= 0 {
+		return fmt.Errorf("expected a positive --fake-rate, got %v", f.Rate)
+	}
+	if f.BurstSize < 1 {
+		return fmt.Errorf("expected a --fake-burst-size of at least 1, got %v", f.BurstSize)
+	}
+	return nil
+}
+
+// Run publishes fake liquidations until the context is done.
+func (f *FakeFeed) Run(ctx context.Context) error {
+	log.Println("Generating a fake feed at", f.Rate, "liquidations per second")
+
+	for {
+		// Poisson arrivals
+		if !sleep(ctx, time.Duration(rand.ExpFloat64()/f.Rate*float64(time.Second))) {
+			return nil
+		}
+
+		if rand.Float64() >= f.BurstChance {
+			f.Pipeline.Publish(f.next())
+			continue
+		}
+
+		// A cascade hammers a single symbol and side, each liquidation pushing the price further
+		cascade := f.next()
+		for n := 1 + rand.Intn(2*f.BurstSize); n > 0; n-- {
+			f.Pipeline.Publish(cascade)
+
+			if !sleep(ctx, time.Duration(50+rand.Intn(450))*time.Millisecond) {
+				return nil
+			}
+			cascade = f.move(cascade.Symbol, cascade.Side)
+		}
+	}
+}
+
+// next generates a liquidation on a random symbol and side.
+func (f *FakeFeed) next() Liquidation {
+	symbols := make([]Symbol, 0, len(f.prices))
+	for symbol := range f.prices {
+		symbols = append(symbols, symbol)
+	}
+	symbol := symbols[rand.Intn(len(symbols))]
+
+	side := "Buy"
+	if rand.Intn(2) == 0 {
+		side = "Sell"
+	}
+
+	return f.move(symbol, side)
+}
+
+// move walks the price of the symbol in the direction the liquidation pushes it and returns a liquidation there.
+func (f *FakeFeed) move(symbol Symbol, side string) Liquidation {
+	// Buying back shorts pushes the price up, selling off longs pushes it down
+	step := f.prices[symbol] * rand.Float64() * 0.001
+	if side == "Sell" {
+		step = -step
+	}
+	f.prices[symbol] += step
+
+	return Liquidation{
+		Price:    math.Round(f.prices[symbol]*2) / 2,
+		Quantity: f.quantity(),
+		Symbol:   symbol,
+		Side:     side,
+		Exchange: "fake",
+		Received: time.Now(),
+	}
+}
+
+// quantity draws a size from a log-normal distribution, as liquidations are mostly small with a long tail of whales.
+// Sizes the BitMex client would filter out are redrawn.
+func (f *FakeFeed) quantity() int64 {
+	for {
+		if qty := int64(f.MedianQty * math.Exp(f.Sigma*rand.NormFloat64())); qty >= minLeavesQty {
+			return qty
+		}
+	}
+}
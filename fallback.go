@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// RESTFallback polls the REST liquidation endpoint while the websocket of Feed can't be
+// re-established, so the channel gets the liquidations late rather than not at all.
+// It steps aside again as soon as the websocket is back.
+type RESTFallback struct {
+	Host     string
+	Client   *http.Client
+	Feed     *BitMexClient
+	After    time.Duration // How long the websocket must be down
+	Interval time.Duration // Between polls, BitMex allows 30 unauthenticated requests a minute
+
+	polling bool
+	seen    map[string]bool // Orders already published, as of the last poll
+}
+
+// restLiquidation is an open liquidation order as the REST API lists it.
+// https://www.bitmex.com/api/explorer/#!/Liquidation/Liquidation_get
+type restLiquidation struct {
+	OrderID   string  `json:"orderID"`
+	Symbol    Symbol  `json:"symbol"`
+	Side      string  `json:"side"`
+	Price     float64 `json:"price"`
+	LeavesQty int64   `json:"leavesQty"`
+}
+
+// Run checks on the websocket every interval, polling in its place while it is down, until the
+// context is done.
+func (f *RESTFallback) Run(ctx context.Context) {
+	for ; ctx.Err() == nil; sleep(ctx, f.Interval) {
+		status := f.Feed.DebugState().(clientStatus)
+		down := !status.Connected && !status.Since.IsZero() && time.Since(status.Since) >= f.After
+
+		if down != f.polling {
+			f.polling = down
+			f.seen = nil
+			if down {
+				metrics.Gauge("rekt_rest_fallback", "feed", f.Feed.Name).Set(1)
+				ops.Alert("fallback_"+f.Feed.Name, "%v has been down for %v, polling the REST API every %v instead",
+					f.Feed.Name, time.Since(status.Since).Round(time.Second), f.Interval)
+			} else {
+				metrics.Gauge("rekt_rest_fallback", "feed", f.Feed.Name).Set(0)
+				log.Printf("%v is back, no longer polling the REST API\n", f.Feed.Name)
+			}
+		}
+
+		if !f.polling {
+			continue
+		}
+
+		if err := f.poll(ctx, time.Now()); err != nil {
+			log.Println("Failed to poll the liquidations:", err)
+		}
+	}
+}
+
+// poll publishes the liquidations that weren't open as of the previous poll. Those open on the
+// first poll came in before the polls took over, they are backfilled like the websocket does.
+func (f *RESTFallback) poll(ctx context.Context, now time.Time) error {
+	metrics.Counter("rekt_rest_polls_total", "feed", f.Feed.Name).Inc()
+
+	open, err := f.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var missed, polled []Liquidation
+	seen := make(map[string]bool, len(open))
+	for _, order := range open {
+		seen[order.OrderID] = true
+		if f.seen[order.OrderID] || order.LeavesQty < minLeavesQty || f.Feed.Pipeline == nil {
+			continue
+		}
+		// Posted by the websocket before it went down
+		if _, posted := f.Feed.orders.Get(order.OrderID, f.Feed.Now()); posted {
+			continue
+		}
+
+		l := Liquidation{
+			Price:    order.Price,
+			Quantity: order.LeavesQty,
+			Symbol:   order.Symbol,
+			Side:     order.Side,
+			Exchange: "BitMex",
+			OrderID:  order.OrderID,
+			Received: now,
+		}
+		// Followed like those of the websocket, which won't backfill them again on coming back
+		f.Feed.remember(l)
+		if f.seen == nil {
+			missed = append(missed, l)
+		} else {
+			polled = append(polled, l)
+		}
+	}
+	if recovered := append(missed, polled...); len(recovered) > 0 && f.Feed.Gaps != nil {
+		f.Feed.Gaps.Recover(f.Feed.Name, len(recovered), f.Feed.Pipeline.Worth(recovered))
+	}
+	if len(missed) > 0 {
+		f.Feed.Pipeline.Backfill(missed, f.Feed.CatchUp)
+	}
+	for _, l := range polled {
+		f.Feed.Pipeline.Publish(l)
+	}
+	f.seen = seen
+
+	return nil
+}
+
+func (f *RESTFallback) fetch(ctx context.Context) ([]restLiquidation, error) {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     f.Host,
+		Path:     "/api/v1/liquidation",
+		RawQuery: url.Values{"count": {"500"}}.Encode(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not fetch liquidations: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch liquidations: %v", resp.Status)
+	}
+
+	var open []restLiquidation
+	if err := json.NewDecoder(resp.Body).Decode(&open); err != nil {
+		return nil, errwrap.Wrapf("bad liquidation response: {{err}}", err)
+	}
+
+	return open, nil
+}
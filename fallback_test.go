@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRESTFallbackPoll(t *testing.T) {
+	open := []restLiquidation{
+		{OrderID: "a", Symbol: "XBTUSD", Side: "Sell", Price: 9000.5, LeavesQty: 20000},
+		{OrderID: "b", Symbol: "XBTUSD", Side: "Buy", Price: 9100, LeavesQty: 100}, // Too small
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/liquidation" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(open)
+	}))
+	defer server.Close()
+
+	client, sink := newTestClient(t)
+	f := &RESTFallback{Host: strings.TrimPrefix(server.URL, "https://"), Client: server.Client(), Feed: client}
+
+	if err := f.poll(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.published) != 1 || sink.published[0].Liquidation.Symbol != "XBTUSD" || sink.published[0].Liquidation.Quantity != 20000 {
+		t.Fatalf("expected the open liquidation to be published, got %v", sink.published)
+	}
+	if !sink.published[0].Liquidation.Historical {
+		t.Error("expected the liquidation open before the polls to be historical")
+	}
+
+	// Still open on the next poll, along with a new one
+	open = append(open, restLiquidation{OrderID: "c", Symbol: "XBTUSD", Side: "Buy", Price: 9200, LeavesQty: 30000})
+	if err := f.poll(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.published) != 2 || sink.published[1].Liquidation.Side != "Buy" || sink.published[1].Liquidation.Historical {
+		t.Errorf("expected only the new liquidation to be published, live, got %v", sink.published)
+	}
+
+	// The websocket back, the polled orders aren't missed ones and are followed like its own
+	handle := func(frame map[string]interface{}) {
+		if err := client.handleMessage(frameJSON(t, frame), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handle(liquidationFrame("partial",
+		liquidationRow("a", "XBTUSD", "Sell", 9000.5, 20000),
+		liquidationRow("c", "XBTUSD", "Buy", 9200, 30000),
+	))
+	if len(sink.published) != 2 {
+		t.Errorf("expected the polled orders not to be backfilled again, got %v", sink.published)
+	}
+	handle(liquidationFrame("update", liquidationRow("c", "XBTUSD", "Buy", 9150, 30000)))
+	if len(sink.amended) != 1 || sink.amended[0].OrderID != "c" {
+		t.Errorf("expected the polled order to be amended, got %v", sink.amended)
+	}
+}
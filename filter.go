@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Filter decides which liquidations a sink gets. The zero value lets everything through.
+	Filter struct {
+		MinUSD  float64   `json:"min_usd"` // Only liquidations worth at least this much
+		Min     Threshold `json:"min"`     // Same in dollars, contracts or coins: "$1000000", "5000 contracts", "25 BTC"
+		Symbols []Symbol  `json:"symbols"` // Only these contracts, all of them when empty
+
+		// Perpetuals lets through every listed perpetual on top of the Symbols, the new listings
+		// included, when the listings are watched.
+		Perpetuals bool `json:"perpetuals"`
+
+		Assets []string `json:"assets"` // Only the contracts on these underlying assets, such as "BTC", all of them when empty
+		Sides  []string `json:"sides"`  // Only these positions, "long" or "short", both when empty
+		Tiers  []string `json:"tiers"`  // Only the liquidations of these tiers, such as "whale", all of them when empty
+
+		// AutoRate raises the threshold of each symbol to post about this many of its liquidations
+		// per hour, the largest ones, when the history is kept. 0 keeps the thresholds fixed.
+		AutoRate float64 `json:"auto_rate"`
+	}
+
+	// Threshold is a minimum size in Unit, "USD", "contracts" or a coin such as "BTC". The zero
+	// value lets everything through.
+	Threshold struct {
+		Amount float64
+		Unit   string
+	}
+
+	// FilterSink only passes on the liquidations matching its filter. Announcements always go through.
+	FilterSink struct {
+		Sink
+		Filter Filter
+		Prices *PriceCache // What the coin thresholds are converted with
+	}
+)
+
+// Match reports whether the liquidation passes the filter, its coin threshold converted with
+// the prices.
+func (f Filter) Match(l Liquidation, prices *PriceCache) bool {
+	if float64(l.USDValue()) < f.MinUSD || !f.Min.Met(l, prices, time.Now()) {
+		return false
+	}
+	if f.AutoRate > 0 && float64(l.USDValue()) < autoThresholds.Threshold(l.Symbol, f.AutoRate) {
+		return false
+	}
+
+	if !f.coversSymbol(l.Symbol) || !f.coversAsset(l.Asset()) {
+		return false
+	}
+
+	if len(f.Sides) > 0 {
+		found := false
+		for _, side := range f.Sides {
+			// Accept the order side as well, which is what BitMex calls it
+			found = found || strings.EqualFold(side, l.Position()) || strings.EqualFold(side, l.Side)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Tiers) > 0 {
+		found, tier := false, currentTiers().Of(float64(l.USDValue())).Name
+		for _, name := range f.Tiers {
+			found = found || strings.EqualFold(name, tier)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Covers reports whether the filter lets through liquidations of the symbol, whatever their
+// size and side.
+func (f Filter) Covers(symbol Symbol) bool {
+	return f.coversSymbol(symbol) && f.coversAsset(inferSymbol(symbol).Underlying)
+}
+
+func (f Filter) coversSymbol(symbol Symbol) bool {
+	if len(f.Symbols) == 0 {
+		return true
+	}
+	for _, s := range f.Symbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return f.Perpetuals && listings.Listed(symbol)
+}
+
+func (f Filter) coversAsset(asset string) bool {
+	if len(f.Assets) == 0 {
+		return true
+	}
+	for _, a := range f.Assets {
+		if strings.EqualFold(a, asset) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseThreshold reads a threshold written as an amount and a unit, a bare amount or one in front
+// of a $ being dollars: "25 BTC", "5000 contracts", "$1,000,000".
+func ParseThreshold(s string) (Threshold, error) {
+	s = strings.TrimSpace(strings.Replace(s, ",", "", -1))
+	if s == "" {
+		return Threshold{}, nil
+	}
+
+	amount, unit := s, "USD"
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		amount, unit = s[:i], strings.ToUpper(strings.TrimSpace(s[i+1:]))
+	}
+	amount = strings.TrimPrefix(amount, "$")
+	if unit == "CONTRACT" || unit == "CONTRACTS" {
+		unit = "contracts"
+	}
+
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil || value < 0 || unit == "" {
+		return Threshold{}, fmt.Errorf("invalid threshold %q, expected an amount and a unit such as 25 BTC", s)
+	}
+	return Threshold{Amount: value, Unit: unit}, nil
+}
+
+// String writes the threshold the way ParseThreshold reads it, empty for the zero value.
+func (t Threshold) String() string {
+	switch {
+	case t.Amount == 0:
+		return ""
+	case t.Unit == "USD":
+		return "$" + strconv.FormatFloat(t.Amount, 'f', -1, 64)
+	default:
+		return strconv.FormatFloat(t.Amount, 'f', -1, 64) + " " + t.Unit
+	}
+}
+
+// MarshalJSON writes the threshold as a string.
+func (t Threshold) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON reads a threshold string, or a number of dollars.
+func (t *Threshold) UnmarshalJSON(data []byte) error {
+	var usd float64
+	if err := json.Unmarshal(data, &usd); err == nil {
+		*t = Threshold{Amount: usd, Unit: "USD"}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Met reports whether the liquidation is at least as large as the threshold. A coin threshold
+// compares the coin quantity when the liquidation is in that coin, and is otherwise converted to
+// dollars with the latest price of the coin, so it follows the market. Until the feeds carry a
+// price of the coin, nothing gets through, counted in rekt_threshold_unpriced_total.
+func (t Threshold) Met(l Liquidation, prices *PriceCache, now time.Time) bool {
+	switch {
+	case t.Amount == 0:
+		return true
+	case t.Unit == "USD":
+		return float64(l.USDValue()) >= t.Amount
+	case t.Unit == "contracts":
+		return float64(l.Quantity) >= t.Amount
+	}
+
+	if amount, coin := l.CoinValue(); amount > 0 && sameCoin(coin, t.Unit) {
+		return amount >= t.Amount
+	}
+	var price float64
+	ok := false
+	if prices != nil {
+		price, ok = prices.CoinUSD(t.Unit, now)
+	}
+	if !ok {
+		metrics.Counter("rekt_threshold_unpriced_total", "coin", strings.ToUpper(t.Unit)).Inc()
+		return false
+	}
+	return float64(l.USDValue()) >= t.Amount*price
+}
+
+// sameCoin tells whether the tickers name the same coin, such as XBT and BTC.
+func sameCoin(a, b string) bool {
+	a, b = strings.ToUpper(a), strings.ToUpper(b)
+	if name, ok := coinNames[a]; ok {
+		a = name
+	}
+	if name, ok := coinNames[b]; ok {
+		b = name
+	}
+	return a == b
+}
+
+// Publish implements Sink.
+func (s *FilterSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	if !s.Filter.Match(dl.Liquidation, s.Prices) {
+		return nil
+	}
+	return s.Sink.Publish(ctx, dl)
+}
+
+// Amend implements Amender.
+func (s *FilterSink) Amend(ctx context.Context, l Liquidation) error {
+	return amend(ctx, s.Sink, l)
+}
+
+// Post implements Poster, leaving out the posts about symbols the filter doesn't cover.
+func (s *FilterSink) Post(ctx context.Context, post Post) error {
+	if post.Symbol != "" && !s.Filter.Covers(post.Symbol) {
+		return nil
+	}
+	return sendPost(ctx, s.Sink, post)
+}
+
+// withFilter puts the filter configured for the sink in front of it, if there is one, its coin
+// thresholds converted with the prices.
+func withFilter(cfg BotConfig, prices *PriceCache, name string, sink Sink) Sink {
+	filter, ok := cfg.SinkFilters[name]
+	if !ok {
+		return sink
+	}
+	return &FilterSink{Sink: sink, Filter: filter, Prices: prices}
+}
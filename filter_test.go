@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFilterSides(t *testing.T) {
+	short := Liquidation{Symbol: "XBTUSD", Side: "Buy"}
+	long := Liquidation{Symbol: "XBTUSD", Side: "Sell"}
+
+	if f := (Filter{Sides: []string{"short"}}); !f.Match(short, nil) || f.Match(long, nil) {
+		t.Error("expected only the shorts to match")
+	}
+	if f := (Filter{Sides: []string{"sell"}}); f.Match(short, nil) || !f.Match(long, nil) {
+		t.Error("expected the order side to be accepted too")
+	}
+	if f := (Filter{}); !f.Match(short, nil) || !f.Match(long, nil) {
+		t.Error("expected the zero filter to match everything")
+	}
+}
+
+func TestFilterAssets(t *testing.T) {
+	f := Filter{Assets: []string{"BTC"}}
+	for _, symbol := range []Symbol{"XBTUSD", "XBTU24", "BTCUSDT"} {
+		if !f.Match(Liquidation{Symbol: symbol}, nil) {
+			t.Errorf("expected %v to count as BTC", symbol)
+		}
+	}
+	if f.Match(Liquidation{Symbol: "ETHUSD"}, nil) {
+		t.Error("expected ETHUSD to be filtered out")
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	for s, want := range map[string]Threshold{
+		"25 BTC":          {Amount: 25, Unit: "BTC"},
+		"5,000 contracts": {Amount: 5000, Unit: "contracts"},
+		"$1,000,000":      {Amount: 1000000, Unit: "USD"},
+		"":                {},
+	} {
+		if got, err := ParseThreshold(s); err != nil || got != want {
+			t.Errorf("%q: expected %+v, got %+v (%v)", s, want, got, err)
+		}
+	}
+	if _, err := ParseThreshold("lots BTC"); err == nil {
+		t.Error("expected an invalid amount to fail")
+	}
+
+	var f Filter
+	if err := json.Unmarshal([]byte(`{"min": 250000}`), &f); err != nil || f.Min != (Threshold{Amount: 250000, Unit: "USD"}) {
+		t.Errorf("expected a number to be dollars, got %+v (%v)", f.Min, err)
+	}
+}
+
+func TestThresholdCoin(t *testing.T) {
+	prices := NewPriceCache()
+	now := time.Now()
+
+	min := Threshold{Amount: 10, Unit: "ETH"}
+	l := Liquidation{Symbol: "XBTUSD", Quantity: 30000, USD: 30000}
+	unpriced := metrics.Counter("rekt_threshold_unpriced_total", "coin", "ETH").Value()
+	if min.Met(l, prices, now) || min.Met(l, nil, now) {
+		t.Error("expected the liquidations to be held back without a price")
+	}
+	if missed := metrics.Counter("rekt_threshold_unpriced_total", "coin", "ETH").Value() - unpriced; missed != 2 {
+		t.Errorf("expected the 2 misses to be counted, got %v", missed)
+	}
+
+	prices.Observe("Binance", "ETHUSDT", PriceLast, 2000, now)
+	if !min.Met(l, prices, now) || min.Met(Liquidation{Symbol: "XBTUSD", Quantity: 10000, USD: 10000}, prices, now) {
+		t.Error("expected 10 ETH to be worth $20,000")
+	}
+
+	btc := Threshold{Amount: 1, Unit: "BTC"}
+	if !btc.Met(Liquidation{Symbol: "XBTUSDT", CoinQty: 1.5, Coin: "XBT"}, nil, now) {
+		t.Error("expected the XBT quantity to count as BTC")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Longest /find looks back by default, and the most results it pages through.
+const (
+	findPeriod   = "30d"
+	findLimit    = 100
+	findPageSize = 10
+)
+
+type (
+	// FindQuery selects stored liquidations.
+	FindQuery struct {
+		Symbol Symbol // Any when empty
+		MinUSD float64
+		Since  time.Time
+		Limit  int
+	}
+
+	// Finder searches stored liquidations, newest first.
+	Finder interface {
+		Find(q FindQuery) ([]Liquidation, error)
+	}
+)
+
+// Match tells whether the liquidation is selected, the limit aside.
+func (q FindQuery) Match(l Liquidation) bool {
+	return (q.Symbol == "" || l.Symbol == q.Symbol) && float64(l.USDValue()) >= q.MinUSD && !l.Received.Before(q.Since)
+}
+
+// findCommand is /find, a search of the stored liquidations.
+func findCommand(finder Finder, pages *Pages, f NumberFormat) *SlashCommand {
+	var minUSD float64
+
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "find",
+			Description: "Search the stored liquidations",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "symbol", Description: "Only this contract"},
+				{Type: discordgo.ApplicationCommandOptionNumber, Name: "min", Description: "Smallest USD value", MinValue: &minUSD},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "since", Description: "A date such as 2024-05-01 or a period such as 7d, " + findPeriod + " by default"},
+			},
+		},
+		Deferred: true,
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			since, err := parseSince(req.String("since", findPeriod), time.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			q := FindQuery{
+				Symbol: Symbol(strings.ToUpper(req.String("symbol", ""))),
+				MinUSD: req.Float("min", 0),
+				Since:  since,
+				Limit:  findLimit,
+			}
+			found, err := finder.Find(q)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return &discordgo.InteractionResponseData{Content: "No liquidations found"}, nil
+			}
+
+			return pages.Reply(findPages(found, f)), nil
+		},
+	}
+}
+
+// findPages lists the liquidations found, a page of findPageSize each.
+func findPages(found []Liquidation, f NumberFormat) []*discordgo.InteractionResponseData {
+	header := fmt.Sprintf("%v liquidations found, newest first", len(found))
+	if len(found) == findLimit {
+		header = fmt.Sprintf("The latest %v liquidations found", findLimit)
+	}
+
+	var pages []*discordgo.InteractionResponseData
+	for start := 0; start < len(found); start += findPageSize {
+		end := start + findPageSize
+		if end > len(found) {
+			end = len(found)
+		}
+
+		lines := []string{header}
+		for _, l := range found[start:end] {
+			lines = append(lines, fmt.Sprintf("<t:%v:f> %v (%v)", l.Received.Unix(), l, f.Short(l.USDValue())))
+		}
+		pages = append(pages, &discordgo.InteractionResponseData{
+			Content:         strings.Join(lines, "\n"),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+	}
+
+	return pages
+}
+
+// parseSince reads a date such as 2024-05-01, in UTC, or a period back from now such as 7d.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	period, err := parsePeriod(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date such as 2024-05-01 nor a period such as 7d", s)
+	}
+	return now.Add(-period), nil
+}
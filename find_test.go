@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestHistoryFind(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 365*day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		symbol := Symbol("SOLUSDT")
+		if i%2 == 1 {
+			symbol = "XBTUSD"
+		}
+		l := Liquidation{Symbol: symbol, Side: "Sell", Quantity: 1, USD: float64(i) * 1000000, Received: now.Add(time.Duration(i-30) * time.Hour)}
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := h.Find(FindQuery{Symbol: "SOLUSDT", MinUSD: 2000000, Since: now.Add(-20 * time.Hour), Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || found[0].USD != 28000000 || found[2].USD != 24000000 {
+		t.Errorf("expected the latest 3 matches newest first, got %v", found)
+	}
+
+	pages := NewPages(time.Minute)
+	reply := pages.Reply(findPages(make([]Liquidation, 25), DefaultFormat))
+	if !strings.HasPrefix(reply.Content, "25 liquidations found") || len(reply.Components) != 1 {
+		t.Fatalf("expected the first page with buttons, got %+v", reply)
+	}
+
+	// Flip to the last page through the next button
+	next := reply.Components[0].(discordgo.ActionsRow).Components[2].(discordgo.Button)
+	args := strings.Split(next.CustomID, ":")[1:]
+	args[1] = "2"
+	last, err := pages.Handle(&CommandRequest{}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(last.Content, "\n"); n != 5 {
+		t.Errorf("expected the 5 remaining liquidations on the last page, got %v", n)
+	}
+	buttons := last.Components[0].(discordgo.ActionsRow).Components
+	if buttons[0].(discordgo.Button).Disabled || !buttons[2].(discordgo.Button).Disabled {
+		t.Error("expected only prev to be enabled on the last page")
+	}
+
+	// Once expired, the message stays and its buttons are disabled
+	pages.Expiry = 0
+	prev := buttons[0].(discordgo.Button)
+	message := &discordgo.Message{Content: last.Content, Components: []discordgo.MessageComponent{
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&prev}},
+	}}
+	expired, err := pages.Handle(&CommandRequest{Interaction: &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{Message: message}}}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.Content != last.Content || !expired.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button).Disabled {
+		t.Errorf("expected the page with disabled buttons, got %+v", expired)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	if since, err := parseSince("2024-05-01", now); err != nil || !since.Equal(time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected May 1st, got %v (%v)", since, err)
+	}
+	if since, err := parseSince("7d", now); err != nil || !since.Equal(now.Add(-7*day)) {
+		t.Errorf("expected a week ago, got %v (%v)", since, err)
+	}
+	if _, err := parseSince("last tuesday", now); err == nil {
+		t.Error("expected an error for a bad date")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// NumberFormat controls how numbers are written in messages. The zero value is the classic format.
+	NumberFormat struct {
+		Abbreviate  bool          `json:"abbreviate"`   // 12.4M instead of 12,400,000 for quantities and USD
+		Separator   *string       `json:"separator"`    // Thousands separator, "," when unset
+		GroupPrices bool          `json:"group_prices"` // Use the thousands separator in prices too
+		Decimals    []DecimalRule `json:"decimals"`     // Decimal places of prices and coin amounts by magnitude
+		Show        []string      `json:"show"`         // Quantities to show, the first leads: "contracts", "coin" or "usd"
+		Currency    string        `json:"currency"`     // Show the USD amounts in this currency instead, such as "EUR", once its rate is known
+	}
+
+	// DecimalRule sets the decimal places of numbers below a magnitude, a Below of 0 matches everything.
+	DecimalRule struct {
+		Below  float64 `json:"below"`
+		Places int     `json:"places"`
+	}
+)
+
+// Quantities a liquidation can be shown in
+const (
+	ShowContracts = "contracts"
+	ShowCoin      = "coin"
+	ShowUSD       = "usd"
+)
+
+// DefaultFormat is used wherever no format was configured.
+var DefaultFormat NumberFormat
+
+// buffers hold the messages being written, every liquidation being formatted at least twice.
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func (f NumberFormat) separator() string {
+	if f.Separator == nil {
+		return ","
+	}
+	return *f.Separator
+}
+
+// Int writes a whole amount such as a number of contracts.
+func (f NumberFormat) Int(v int64) string {
+	if f.Abbreviate && (v >= 1000 || v <= -1000) {
+		return abbreviate(float64(v))
+	}
+
+	return group(strconv.FormatInt(v, 10), f.separator())
+}
+
+// USD writes a dollar amount, converted to Currency when it is set and its rate known.
+func (f NumberFormat) USD(v int64) string {
+	if f.Currency == "" {
+		return "$" + f.Int(v)
+	}
+
+	rate, ok := fx.Rate(f.Currency)
+	if !ok {
+		return "$" + f.Int(v)
+	}
+
+	currency := strings.ToUpper(f.Currency)
+	amount := f.Int(int64(math.Round(float64(v) * rate)))
+	if sign, ok := currencySigns[currency]; ok {
+		return sign + amount
+	}
+	return amount + " " + currency
+}
+
+// Price writes a price.
+func (f NumberFormat) Price(v float64) string {
+	s := strconv.FormatFloat(v, 'f', f.places(v), 64)
+	if !f.GroupPrices {
+		return s
+	}
+
+	return group(s, f.separator())
+}
+
+// Coin writes an amount of coin.
+func (f NumberFormat) Coin(v float64, coin string) string {
+	return group(strconv.FormatFloat(v, 'f', f.places(v), 64), f.separator()) + " " + coin
+}
+
+// places returns the decimal places for v, -1 being as many as needed.
+func (f NumberFormat) places(v float64) int {
+	for _, rule := range f.Decimals {
+		if rule.Below == 0 || math.Abs(v) < rule.Below {
+			return rule.Places
+		}
+	}
+
+	return -1
+}
+
+// group inserts the separator between the thousands of the integer part of a formatted number.
+func group(s, sep string) string {
+	if sep == "" {
+		return s
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i:]
+	}
+
+	if len(integer) <= 3 {
+		return sign + integer + fraction
+	}
+
+	// The digits are all ASCII
+	b := make([]byte, 0, len(sign)+len(integer)+(len(integer)-1)/3*len(sep)+len(fraction))
+	b = append(b, sign...)
+	for i := 0; i < len(integer); i++ {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b = append(b, sep...)
+		}
+		b = append(b, integer[i])
+	}
+	b = append(b, fraction...)
+
+	return string(b)
+}
+
+// abbreviate writes a large number with a K/M/B suffix: 12.4M.
+func abbreviate(v float64) string {
+	a := math.Abs(v)
+	switch {
+	case a >= 1e9:
+		return fmt.Sprintf("%.1fB", v/1e9)
+	case a >= 1e6:
+		return fmt.Sprintf("%.1fM", v/1e6)
+	case a >= 1e3:
+		return fmt.Sprintf("%.1fK", v/1e3)
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+// Short abbreviates a dollar amount, in the currency of the format when it has one: $950,
+// $12.4K, €3.1M, $1.2B.
+func (f NumberFormat) Short(v int64) string {
+	f.Abbreviate = true
+	return f.USD(v)
+}
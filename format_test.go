@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestNumberFormat(t *testing.T) {
+	space := " "
+	l := Liquidation{Price: 9000.5, Quantity: 1234567, Symbol: "XBTUSD", Side: "Sell"}
+
+	tests := []struct {
+		format   NumberFormat
+		expected string
+	}{
+		{DefaultFormat, "Liquidated long on XBTUSD: Sell 1,234,567 @ 9000.5"},
+		{NumberFormat{Abbreviate: true}, "Liquidated long on XBTUSD: Sell 1.2M @ 9000.5"},
+		{NumberFormat{Separator: &space, GroupPrices: true}, "Liquidated long on XBTUSD: Sell 1 234 567 @ 9 000.5"},
+		{
+			NumberFormat{Show: []string{ShowUSD, ShowContracts, ShowCoin}, Decimals: []DecimalRule{{Below: 1000, Places: 2}, {Places: 0}}},
+			"Liquidated long on XBTUSD: Sell $1,234,567 (1,234,567 contracts, 137.17 XBT) @ 9000",
+		},
+		{NumberFormat{Show: []string{ShowCoin}}, "Liquidated long on XBTUSD: Sell 137.16649075051387 XBT @ 9000.5"},
+	}
+
+	for _, test := range tests {
+		if s := l.Format(test.format); s != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, s)
+		}
+	}
+
+	if s := DefaultFormat.Short(12400000); s != "$12.4M" {
+		t.Error("unexpected abbreviation:", s)
+	}
+	if s := group("-1234567.125", ","); s != "-1,234,567.125" {
+		t.Error("unexpected grouping:", s)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ForumMode is how the messages are organized in a forum channel.
+type ForumMode string
+
+// Forum modes
+const (
+	ForumDaily   ForumMode = "day"     // A post a day, UTC
+	ForumCascade ForumMode = "cascade" // A post per burst of liquidations
+)
+
+// checkForum rejects the modes there are none of.
+func checkForum(mode ForumMode) error {
+	switch mode {
+	case "", ForumDaily, ForumCascade:
+		return nil
+	default:
+		return fmt.Errorf("unknown forum %q, use day, cascade or leave it empty", mode)
+	}
+}
+
+// A burst of liquidations is over after this long without one.
+const cascadeGap = 15 * time.Minute
+
+// sendForum replies to the current forum post, or starts a new post with the message when it's time for one.
+func (s *DiscordSink) sendForum(ctx context.Context, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var sent *discordgo.Message
+	if s.thread == "" || newForumPost(s.Forum, s.started, s.lastSent, now) {
+		thread, err := s.Session.ForumThreadStartComplex(s.Channel, &discordgo.ThreadStart{Name: forumPostName(s.Forum, now)}, msg, discordgo.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		s.thread, s.started = thread.ID, now
+
+		// The starter message of a post shares its ID
+		sent = &discordgo.Message{ID: thread.ID, ChannelID: thread.ID}
+	} else {
+		var err error
+		if sent, err = s.Session.ChannelMessageSendComplex(s.thread, msg, discordgo.WithContext(ctx)); err != nil {
+			return nil, err
+		}
+	}
+	s.lastSent = now
+
+	return sent, nil
+}
+
+// newForumPost tells whether a message sent now starts a new post, given when the current one started and was last replied to.
+func newForumPost(mode ForumMode, started, lastSent, now time.Time) bool {
+	if mode == ForumCascade {
+		return now.Sub(lastSent) > cascadeGap
+	}
+	return !now.UTC().Truncate(day).Equal(started.UTC().Truncate(day))
+}
+
+// forumPostName is the title of a post started now.
+func forumPostName(mode ForumMode, now time.Time) string {
+	if mode == ForumCascade {
+		return fmt.Sprintf("Cascade of %v", now.UTC().Format("Jan 2 15:04 MST"))
+	}
+	return fmt.Sprintf("Liquidations of %v", now.UTC().Format("Mon Jan 2"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewForumPost(t *testing.T) {
+	started := time.Date(2024, time.May, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		mode     ForumMode
+		lastSent time.Time
+		now      time.Time
+		expected bool
+	}{
+		{ForumDaily, started, started.Add(10 * time.Hour), false},
+		{ForumDaily, started, started.Add(15 * time.Hour), true}, // Past midnight
+		{ForumCascade, started.Add(time.Hour), started.Add(time.Hour + 10*time.Minute), false},
+		{ForumCascade, started.Add(time.Hour), started.Add(2 * time.Hour), true},
+	}
+	for _, test := range tests {
+		if actual := newForumPost(test.mode, started, test.lastSent, test.now); actual != test.expected {
+			t.Errorf("%v at %v: expected %v, got %v", test.mode, test.now, test.expected, actual)
+		}
+	}
+
+	if name := forumPostName(ForumDaily, started); name != "Liquidations of Wed May 1" {
+		t.Errorf("unexpected post name %q", name)
+	}
+	if name := forumPostName(ForumCascade, started); name != "Cascade of May 1 09:00 UTC" {
+		t.Errorf("unexpected post name %q", name)
+	}
+}
+
+func TestCheckForum(t *testing.T) {
+	for _, mode := range []ForumMode{"", ForumDaily, ForumCascade} {
+		if err := checkForum(mode); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", mode, err)
+		}
+	}
+	if err := checkForum("daily"); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// FundingWatcher alerts when the funding rate of a symbol reaches an extreme, which tends to come
+// before a cascade: the crowded side pays up until it gets flushed out.
+type FundingWatcher struct {
+	Threshold float64 // Absolute rate per funding interval, 0.001 being 0.1%
+	Symbols   *SymbolMap
+	Announce  func(text string)
+
+	mu      sync.Mutex
+	extreme map[Symbol]bool // Symbols alerted about, until the rate comes back under the threshold
+}
+
+// Handle is the TableHandler of the instrument table.
+func (w *FundingWatcher) Handle(action string, rows []interface{}, received time.Time) {
+	for _, row := range rows {
+		row, _ := row.(map[string]interface{})
+		symbol, _ := row["symbol"].(string)
+		if rate, ok := row["fundingRate"].(float64); ok && symbol != "" {
+			if text := w.observe(Symbol(symbol), rate); text != "" {
+				w.Announce(text)
+			}
+		}
+	}
+}
+
+// observe returns the alert for the rate when it crosses the threshold, once until it comes back under.
+func (w *FundingWatcher) observe(symbol Symbol, rate float64) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.extreme == nil {
+		w.extreme = make(map[Symbol]bool)
+	}
+
+	if math.Abs(rate) < w.Threshold {
+		delete(w.extreme, symbol)
+		return ""
+	}
+	if w.extreme[symbol] {
+		return ""
+	}
+	w.extreme[symbol] = true
+
+	return fundingText(w.name(symbol), rate)
+}
+
+func (w *FundingWatcher) name(symbol Symbol) string {
+	if w.Symbols != nil {
+		return w.Symbols.Lookup(symbol).Display
+	}
+	return string(symbol)
+}
+
+// fundingText writes the alert: "⚠️ XBTUSD funding at +0.1500% per 8h, longs are paying up".
+func fundingText(name string, rate float64) string {
+	payers := "longs"
+	if rate < 0 {
+		payers = "shorts"
+	}
+	return fmt.Sprintf("⚠️ %v funding at %+.4f%% per 8h, %v are paying up", name, rate*100, payers)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFundingWatcher(t *testing.T) {
+	var alerts []string
+	w := &FundingWatcher{Threshold: 0.001, Announce: func(text string) { alerts = append(alerts, text) }}
+
+	for _, rate := range []float64{0.0001, 0.0015, 0.002, 0.0005, -0.0012} {
+		w.Handle("update", []interface{}{map[string]interface{}{"symbol": "XBTUSD", "fundingRate": rate}}, time.Now())
+	}
+	// Other fields changing don't count
+	w.Handle("update", []interface{}{map[string]interface{}{"symbol": "XBTUSD", "markPrice": 9000.0}}, time.Now())
+
+	expected := []string{
+		"⚠️ XBTUSD funding at +0.1500% per 8h, longs are paying up",
+		"⚠️ XBTUSD funding at -0.1200% per 8h, shorts are paying up",
+	}
+	if len(alerts) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, alerts)
+	}
+	for i, alert := range alerts {
+		if alert != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], alert)
+		}
+	}
+}
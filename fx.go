@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// FXSource fetches exchange rates, as units of each currency per US dollar.
+	FXSource interface {
+		Rates(ctx context.Context) (map[string]float64, error)
+	}
+
+	// FXRates keeps the exchange rates the amounts are shown in when a format has a currency,
+	// refreshed from Source every Interval.
+	FXRates struct {
+		Source   FXSource
+		Interval time.Duration
+
+		mu    sync.RWMutex
+		rates map[string]float64
+	}
+
+	// ECBRates are the reference rates the European Central Bank publishes every working day.
+	// https://www.ecb.europa.eu/stats/policy_and_exchange_rates/euro_reference_exchange_rates/html/index.en.html
+	ECBRates struct {
+		URL    string // The daily file, ecbRatesURL
+		Client *http.Client
+	}
+
+	// JSONRates reads the rates from an API answering {"rates": {"EUR": 0.92, ...}} against the
+	// dollar, the way most free ones do, e.g. https://open.er-api.com/v6/latest/USD
+	JSONRates struct {
+		URL    string
+		Client *http.Client
+	}
+
+	// ecbEnvelope is the daily ECB file, rates against the euro.
+	ecbEnvelope struct {
+		Rates []struct {
+			Currency string  `xml:"currency,attr"`
+			Rate     float64 `xml:"rate,attr"`
+		} `xml:"Cube>Cube>Cube"`
+	}
+)
+
+const ecbRatesURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// fx are the rates NumberFormat converts with, none until they are fetched.
+var fx = &FXRates{}
+
+// Signs written in front of the amounts, the other currencies get their code instead.
+var currencySigns = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"KRW": "₩",
+	"INR": "₹",
+}
+
+// newFXSource returns the source of the configured name: "ecb" or the URL of a JSON API.
+func newFXSource(source string, client *http.Client) (FXSource, error) {
+	switch {
+	case source == "ecb":
+		return &ECBRates{URL: ecbRatesURL, Client: client}, nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return &JSONRates{URL: source, Client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown FX source %q, expected ecb or a URL", source)
+	}
+}
+
+// Start runs the rates from the source every interval until the context is done, unless they
+// already run.
+func (r *FXRates) Start(ctx context.Context, source FXSource, interval time.Duration) {
+	r.mu.Lock()
+	if r.Source != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.Source, r.Interval = source, interval
+	r.mu.Unlock()
+
+	go r.Run(ctx)
+}
+
+// Run refreshes the rates right away and then every interval, until the context is done. The
+// rates fetched last are kept while the source fails.
+func (r *FXRates) Run(ctx context.Context) {
+	for {
+		if rates, err := r.Source.Rates(ctx); err != nil {
+			log.Println("Failed to fetch the exchange rates:", err)
+		} else {
+			r.Set(rates)
+		}
+
+		if !sleep(ctx, r.Interval) {
+			return
+		}
+	}
+}
+
+// Set replaces the rates.
+func (r *FXRates) Set(rates map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rates = rates
+}
+
+// Rate returns how many units of the currency a dollar is worth, false when it isn't known.
+func (r *FXRates) Rate(currency string) (float64, bool) {
+	if strings.EqualFold(currency, "USD") {
+		return 1, true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rate, ok := r.rates[strings.ToUpper(currency)]
+	return rate, ok && rate > 0
+}
+
+// Rates implements FXSource, turning the rates against the euro into rates against the dollar.
+func (s *ECBRates) Rates(ctx context.Context) (map[string]float64, error) {
+	var envelope ecbEnvelope
+	if err := fetchRates(ctx, s.Client, s.URL, func(resp *http.Response) error {
+		return xml.NewDecoder(resp.Body).Decode(&envelope)
+	}); err != nil {
+		return nil, err
+	}
+
+	perEUR := map[string]float64{"EUR": 1}
+	for _, r := range envelope.Rates {
+		perEUR[r.Currency] = r.Rate
+	}
+	usd := perEUR["USD"]
+	if usd <= 0 {
+		return nil, fmt.Errorf("no USD rate in the ECB rates")
+	}
+
+	rates := make(map[string]float64, len(perEUR))
+	for currency, rate := range perEUR {
+		rates[currency] = rate / usd
+	}
+	return rates, nil
+}
+
+// Rates implements FXSource.
+func (s *JSONRates) Rates(ctx context.Context) (map[string]float64, error) {
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := fetchRates(ctx, s.Client, s.URL, func(resp *http.Response) error {
+		return json.NewDecoder(resp.Body).Decode(&body)
+	}); err != nil {
+		return nil, err
+	}
+	if len(body.Rates) == 0 {
+		return nil, fmt.Errorf("no rates from %v", s.URL)
+	}
+	return body.Rates, nil
+}
+
+func fetchRates(ctx context.Context, client *http.Client, url string, decode func(*http.Response) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errwrap.Wrapf("could not fetch the exchange rates: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch the exchange rates: %v", resp.Status)
+	}
+	if err := decode(resp); err != nil {
+		return errwrap.Wrapf("bad exchange rates: {{err}}", err)
+	}
+	return nil
+}
+
+// startFX starts fetching the rates once a config shows another currency than the dollar, at
+// startup or on a reload adding one.
+func startFX(ctx context.Context, cfg BotConfig, client *http.Client) error {
+	if !usesCurrency(cfg) {
+		return nil
+	}
+
+	source, err := newFXSource(cfg.FXSource, client)
+	if err != nil {
+		return err
+	}
+	fx.Start(ctx, source, cfg.FXInterval.Duration)
+	return nil
+}
+
+// usesCurrency tells whether any of the formats shows another currency than the dollar.
+func usesCurrency(cfg BotConfig) bool {
+	formats := []NumberFormat{cfg.DiscordFormat}
+	for _, target := range configTargets(cfg) {
+		formats = append(formats, target.Format)
+	}
+
+	for _, f := range formats {
+		if f.Currency != "" && !strings.EqualFold(f.Currency, "USD") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestECBRates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2024-06-03">
+			<Cube currency="USD" rate="1.0850"/>
+			<Cube currency="JPY" rate="170.10"/>
+			<Cube currency="GBP" rate="0.8500"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`)
+	}))
+	defer server.Close()
+
+	rates, err := (&ECBRates{URL: server.URL, Client: server.Client()}).Rates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rates["EUR"]-1/1.085) > 1e-9 || math.Abs(rates["JPY"]-170.10/1.085) > 1e-9 || rates["USD"] != 1 {
+		t.Errorf("unexpected rates %v", rates)
+	}
+}
+
+func TestFormatCurrency(t *testing.T) {
+	old := fx
+	defer func() { fx = old }()
+	fx = &FXRates{}
+
+	f := NumberFormat{Currency: "EUR"}
+	if s := f.USD(1000000); s != "$1,000,000" {
+		t.Errorf("expected dollars until the rate is known, got %v", s)
+	}
+
+	fx.Set(map[string]float64{"EUR": 0.92, "CHF": 0.9})
+	if s := f.USD(1000000); s != "€920,000" {
+		t.Errorf("expected euros, got %v", s)
+	}
+	if s := (NumberFormat{Currency: "chf", Abbreviate: true}).USD(1000000); s != "900.0K CHF" {
+		t.Errorf("expected francs, got %v", s)
+	}
+	if s := f.Short(12400000); s != "€11.4M" {
+		t.Errorf("expected the short amounts in euros too, got %v", s)
+	}
+}
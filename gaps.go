@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+type (
+	// Gaps records the times the exchange feeds were down, along with what the REST fallback and
+	// the backfill on reconnecting recovered of them, so the daily recap can tell its totals are
+	// short rather than understate them silently.
+	Gaps struct {
+		mu   sync.Mutex
+		gaps []Gap // Oldest first
+	}
+
+	// Gap is a time a feed was down.
+	Gap struct {
+		Feed         string
+		From, To     time.Time // To is zero while the feed is still down
+		Recovered    int       // Liquidations recovered from the REST API and the backfill
+		RecoveredUSD int64
+	}
+)
+
+// gapRetention is how long the gaps are kept, past the recap of the day they were in.
+const gapRetention = 2 * day
+
+// Open records the feed going down at now, unless it already is.
+func (g *Gaps) Open(feed string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.open(feed) != nil {
+		return
+	}
+	g.gaps = append(g.gaps, Gap{Feed: feed, From: now})
+
+	// Forget those the recaps are done with, the ones still open being needed until they close
+	kept := g.gaps[:0]
+	for _, gap := range g.gaps {
+		if gap.To.IsZero() || now.Sub(gap.To) < gapRetention {
+			kept = append(kept, gap)
+		}
+	}
+	g.gaps = kept
+}
+
+// Close records the feed coming back at now.
+func (g *Gaps) Close(feed string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if gap := g.open(feed); gap != nil {
+		gap.To = now
+	}
+}
+
+// Recover adds liquidations recovered of the feed to its gap, the open one or the last one when
+// the feed just came back, such as the orders found open on reconnecting.
+func (g *Gaps) Recover(feed string, orders int, usd int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := len(g.gaps) - 1; i >= 0; i-- {
+		if gap := &g.gaps[i]; gap.Feed == feed {
+			gap.Recovered += orders
+			gap.RecoveredUSD += usd
+			return
+		}
+	}
+}
+
+// Within returns the gaps that overlap the period, cut down to it, those still open ending at to.
+func (g *Gaps) Within(from, to time.Time) []Gap {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var within []Gap
+	for _, gap := range g.gaps {
+		end := gap.To
+		if end.IsZero() || end.After(to) {
+			end = to
+		}
+		if !end.After(from) || !gap.From.Before(to) {
+			continue
+		}
+		if gap.From.Before(from) {
+			gap.From = from
+		}
+		gap.To = end
+		within = append(within, gap)
+	}
+	return within
+}
+
+func (g *Gaps) open(feed string) *Gap {
+	for i := range g.gaps {
+		if g.gaps[i].Feed == feed && g.gaps[i].To.IsZero() {
+			return &g.gaps[i]
+		}
+	}
+	return nil
+}
+
+// gapText writes the note of the data gaps of a period the liquidations of which added up to
+// usd, with an estimate of what was missed: the rate of the rest of the period over the gaps,
+// less what was recovered: "⚠️ Data gap: BitMex down 26 min from <t:...:t>, 12 orders ($1.2M)
+// recovered, about $3.4M more likely missed, the totals are short".
+func gapText(gaps []Gap, from, to time.Time, usd int64, f NumberFormat) string {
+	if len(gaps) == 0 {
+		return ""
+	}
+
+	var down time.Duration
+	var recovered int64
+	parts := make([]string, len(gaps))
+	for i, gap := range gaps {
+		down += gap.To.Sub(gap.From)
+		recovered += gap.RecoveredUSD
+		parts[i] = fmt.Sprintf("%v down %v from <t:%v:t>", gap.Feed, durationText(gap.To.Sub(gap.From).Round(time.Minute)), gap.From.Unix())
+		if gap.Recovered > 0 {
+			orderText := "orders"
+			if gap.Recovered == 1 {
+				orderText = "order"
+			}
+			parts[i] += fmt.Sprintf(", %v %v (%v) recovered", humanize.Comma(int64(gap.Recovered)), orderText, f.Short(gap.RecoveredUSD))
+		}
+	}
+
+	text := "\n⚠️ Data gap: " + strings.Join(parts, "; ")
+	if up := to.Sub(from) - down; up > 0 {
+		live := usd - recovered
+		if missed := int64(float64(live)*float64(down)/float64(up)) - recovered; live > 0 && missed > 0 {
+			text += ", about " + f.Short(missed) + " more likely missed"
+		}
+	}
+	return text + ", the totals are short"
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGaps(t *testing.T) {
+	g := &Gaps{}
+	start := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(day)
+
+	g.Open("BitMex", start.Add(2*time.Hour))
+	g.Open("BitMex", start.Add(3*time.Hour)) // Still down
+	g.Recover("BitMex", 1, 60000)            // Polled from the REST API
+	g.Close("BitMex", start.Add(4*time.Hour))
+	g.Recover("BitMex", 1, 40000) // Found open on reconnecting
+	g.Recover("Binance", 5, 1000000)
+
+	gaps := g.Within(start, end)
+	if len(gaps) != 1 || !gaps[0].From.Equal(start.Add(2*time.Hour)) || !gaps[0].To.Equal(start.Add(4*time.Hour)) || gaps[0].Recovered != 2 || gaps[0].RecoveredUSD != 100000 {
+		t.Fatalf("expected the gap from 02:00 to 04:00 with 2 orders recovered, got %+v", gaps)
+	}
+	if gaps := g.Within(end, end.Add(day)); len(gaps) != 0 {
+		t.Errorf("expected no gaps the next day, got %+v", gaps)
+	}
+
+	// 2.2M over the 22 hours up makes 200K in the 2 down, half of which was recovered
+	expected := fmt.Sprintf("\n⚠️ Data gap: BitMex down 2 h from <t:%v:t>, 2 orders ($100.0K) recovered, about $100.0K more likely missed, the totals are short",
+		start.Add(2*time.Hour).Unix())
+	if text := gapText(gaps, start, end, 2300000, DefaultFormat); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	// A gap still open counts up to the end of the period
+	g.Open("BitMex", end.Add(-time.Hour))
+	if gaps := g.Within(start, end); len(gaps) != 2 || !gaps[1].To.Equal(end) {
+		t.Errorf("expected the open gap to end with the day, got %+v", gaps)
+	}
+
+	// The open gap is kept however long it lasts, the closed one only until the recaps are done with it
+	g.Open("Binance", end.Add(3*day))
+	if gaps := g.Within(end.Add(2*day), end.Add(3*day)); len(gaps) != 1 || gaps[0].Feed != "BitMex" || !gaps[0].To.Equal(end.Add(3*day)) {
+		t.Errorf("expected the gap open for days to be kept, got %+v", gaps)
+	}
+	if gaps := g.Within(start, end); len(gaps) != 1 {
+		t.Errorf("expected the closed gap to be forgotten, got %+v", gaps)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// GrafanaSource answers the simple JSON datasource of Grafana from the history, so it can chart
+	// the liquidations without a database of its own. The Infinity datasource reads the same
+	// endpoints. The series are the dollars liquidated per interval, in total, of the longs or of the
+	// shorts, and the number of orders, optionally of a single symbol: "usd", "longs_usd:XBTUSD".
+	// The "liquidations" table target lists them one by one.
+	// https://grafana.com/grafana/plugins/grafana-simple-json-datasource/
+	GrafanaSource struct {
+		mu      sync.Mutex
+		history *History
+	}
+
+	grafanaQuery struct {
+		Range struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		} `json:"range"`
+		IntervalMs    int64 `json:"intervalMs"`
+		MaxDataPoints int   `json:"maxDataPoints"`
+		Targets       []struct {
+			Target string `json:"target"`
+			Type   string `json:"type"` // "timeserie" or "table"
+		} `json:"targets"`
+	}
+
+	grafanaSeries struct {
+		Target     string       `json:"target"`
+		Datapoints [][2]float64 `json:"datapoints"` // Value and time in milliseconds
+	}
+
+	grafanaTable struct {
+		Type    string          `json:"type"`
+		Columns []grafanaColumn `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+
+	grafanaColumn struct {
+		Text string `json:"text"`
+		Type string `json:"type"`
+	}
+)
+
+// The series of each symbol, and of all of them without a symbol
+var grafanaSeriesNames = []string{"usd", "longs_usd", "shorts_usd", "orders"}
+
+// grafana is served under /grafana when enabled, answering once the history is loaded.
+var grafana = &GrafanaSource{}
+
+// SetHistory sets the history the queries are answered from.
+func (g *GrafanaSource) SetHistory(history *History) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.history = history
+}
+
+// History returns the history, nil until it is loaded.
+func (g *GrafanaSource) History() *History {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.history
+}
+
+// handle serves the datasource under /grafana, the URL to give Grafana. Its test of the
+// connection fails until the history is loaded.
+func (g *GrafanaSource) handle(mux *http.ServeMux) {
+	ready := func(w http.ResponseWriter) bool {
+		if g.History() == nil {
+			http.Error(w, "the history isn't kept, set history_file", http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	}
+
+	test := func(w http.ResponseWriter, r *http.Request) {
+		if ready(w) {
+			writeJSON(w, map[string]string{"status": "ok"})
+		}
+	}
+	mux.HandleFunc("/grafana", test)
+	mux.HandleFunc("/grafana/", test)
+	mux.HandleFunc("/grafana/search", func(w http.ResponseWriter, r *http.Request) {
+		if ready(w) {
+			writeJSON(w, g.Search(time.Now().Add(-g.History().Retention)))
+		}
+	})
+	mux.HandleFunc("/grafana/query", func(w http.ResponseWriter, r *http.Request) {
+		if !ready(w) {
+			return
+		}
+		var q grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, g.Query(q))
+	})
+}
+
+// Search returns the targets there is data for since the time: the series of all the symbols,
+// those of each symbol and the table.
+func (g *GrafanaSource) Search(since time.Time) []string {
+	symbols := make(map[Symbol]bool)
+	for _, l := range g.History().Since(since, nil) {
+		symbols[l.Symbol] = true
+	}
+	sorted := make([]string, 0, len(symbols))
+	for symbol := range symbols {
+		sorted = append(sorted, string(symbol))
+	}
+	sort.Strings(sorted)
+
+	targets := append([]string{"liquidations"}, grafanaSeriesNames...)
+	for _, symbol := range sorted {
+		for _, name := range grafanaSeriesNames {
+			targets = append(targets, name+":"+symbol)
+		}
+	}
+	return targets
+}
+
+// Query answers each target over the range, in order. Unknown targets get an empty series.
+func (g *GrafanaSource) Query(q grafanaQuery) []interface{} {
+	liquidations := g.History().Since(q.Range.From, func(l Liquidation) bool { return !liquidationTime(l).After(q.Range.To) })
+
+	interval := time.Duration(q.IntervalMs) * time.Millisecond
+	if span := q.Range.To.Sub(q.Range.From); q.MaxDataPoints > 0 && interval < span/time.Duration(q.MaxDataPoints) {
+		interval = span / time.Duration(q.MaxDataPoints)
+	}
+	if interval < time.Second {
+		interval = time.Minute
+	}
+
+	results := []interface{}{}
+	for _, target := range q.Targets {
+		if target.Type == "table" || target.Target == "liquidations" {
+			results = append(results, grafanaLiquidations(liquidations))
+			continue
+		}
+
+		name, symbol := target.Target, Symbol("")
+		if i := strings.Index(name, ":"); i >= 0 {
+			name, symbol = name[:i], Symbol(name[i+1:])
+		}
+		results = append(results, grafanaSeriesOf(target.Target, name, symbol, liquidations, q.Range.From, interval))
+	}
+	return results
+}
+
+// grafanaSeriesOf sums the series over each interval from the start, leaving out the empty ones.
+func grafanaSeriesOf(target, name string, symbol Symbol, liquidations []Liquidation, from time.Time, interval time.Duration) grafanaSeries {
+	series := grafanaSeries{Target: target, Datapoints: [][2]float64{}}
+
+	var bucket time.Time
+	var value float64
+	flush := func() {
+		if !bucket.IsZero() {
+			series.Datapoints = append(series.Datapoints, [2]float64{value, float64(bucket.UnixNano() / int64(time.Millisecond))})
+		}
+	}
+
+	for _, l := range liquidations {
+		if symbol != "" && l.Symbol != symbol {
+			continue
+		}
+
+		var v float64
+		switch name {
+		case "usd":
+			v = float64(l.USDValue())
+		case "longs_usd", "shorts_usd":
+			if name == l.Position()+"s_usd" {
+				v = float64(l.USDValue())
+			}
+		case "orders":
+			v = 1
+		default:
+			return series
+		}
+
+		start := from.Add(liquidationTime(l).Sub(from) / interval * interval)
+		if !start.Equal(bucket) {
+			flush()
+			bucket, value = start, 0
+		}
+		value += v
+	}
+	flush()
+	return series
+}
+
+// grafanaLiquidations lists the liquidations as a table, the newest first.
+func grafanaLiquidations(liquidations []Liquidation) grafanaTable {
+	table := grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{"Time", "time"}, {"Exchange", "string"}, {"Symbol", "string"}, {"Position", "string"},
+			{"Price", "number"}, {"Quantity", "number"}, {"USD", "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+	for i := len(liquidations) - 1; i >= 0; i-- {
+		l := liquidations[i]
+		table.Rows = append(table.Rows, []interface{}{
+			liquidationTime(l).UnixNano() / int64(time.Millisecond), l.Exchange, l.Symbol, l.Position(), l.Price, l.Quantity, l.USDValue(),
+		})
+	}
+	return table
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrafanaSource(t *testing.T) {
+	g := &GrafanaSource{}
+	mux := http.NewServeMux()
+	g.handle(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/grafana"); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the test to fail without a history, got %v (%v)", resp.Status, err)
+	}
+
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	g.SetHistory(h)
+
+	start := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+	for _, l := range []Liquidation{
+		{Symbol: "XBTUSD", Side: "Sell", USD: 100, Received: start.Add(time.Minute)},
+		{Symbol: "ETHUSD", Side: "Buy", USD: 50, Received: start.Add(2 * time.Minute)},
+		{Symbol: "XBTUSD", Side: "Buy", USD: 30, Received: start.Add(90 * time.Minute)},
+	} {
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var targets []string
+	if err := postJSON(server.URL+"/grafana/search", `{"target": ""}`, &targets); err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 13 || targets[0] != "liquidations" || targets[5] != "usd:ETHUSD" {
+		t.Errorf("unexpected targets %q", targets)
+	}
+
+	query := `{
+		"range": {"from": "` + start.Format(time.RFC3339) + `", "to": "` + start.Add(2*time.Hour).Format(time.RFC3339) + `"},
+		"intervalMs": 3600000,
+		"targets": [{"target": "usd"}, {"target": "shorts_usd:XBTUSD"}, {"target": "liquidations", "type": "table"}]
+	}`
+	var results []json.RawMessage
+	if err := postJSON(server.URL+"/grafana/query", query, &results); err != nil || len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v (%v)", len(results), err)
+	}
+
+	ms := func(t time.Time) float64 { return float64(t.UnixNano() / int64(time.Millisecond)) }
+	var usd, shorts grafanaSeries
+	json.Unmarshal(results[0], &usd)
+	json.Unmarshal(results[1], &shorts)
+	if expected := [][2]float64{{150, ms(start)}, {30, ms(start.Add(time.Hour))}}; !reflect.DeepEqual(usd.Datapoints, expected) {
+		t.Errorf("expected %v, got %v", expected, usd.Datapoints)
+	}
+	if expected := [][2]float64{{0, ms(start)}, {30, ms(start.Add(time.Hour))}}; !reflect.DeepEqual(shorts.Datapoints, expected) {
+		t.Errorf("expected %v, got %v", expected, shorts.Datapoints)
+	}
+
+	var table grafanaTable
+	json.Unmarshal(results[2], &table)
+	if len(table.Rows) != 3 || table.Rows[0][2] != "XBTUSD" || table.Rows[0][3] != "short" {
+		t.Errorf("expected the newest row first, got %v", table.Rows)
+	}
+}
+
+func postJSON(url, body string, v interface{}) error {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
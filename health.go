@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type (
+	// ConnectionHealth is how a connection to an exchange is doing.
+	ConnectionHealth struct {
+		Name        string    `json:"name"`
+		Connected   bool      `json:"connected"`
+		Since       time.Time `json:"since"` // When the connection was established or lost
+		LastMessage time.Time `json:"last_message"`
+		LastPong    time.Time `json:"last_pong"` // Answer to the pings, for the feeds that are quiet at times
+		Reconnects  int64     `json:"reconnects"`
+	}
+
+	// Health collects the exchange connections and the pipeline for /status.
+	Health struct {
+		mu          sync.Mutex
+		connections []func() ConnectionHealth
+		pipeline    *Pipeline
+	}
+
+	// healthReport is what /status shows.
+	healthReport struct {
+		Connections   []ConnectionHealth `json:"connections"`
+		Queue         int                `json:"queue"`
+		QueueCapacity int                `json:"queue_capacity"`
+		Dedup         int                `json:"dedup_entries"`
+	}
+)
+
+// health is the registry behind /status.
+var health = &Health{}
+
+// AddConnection adds an exchange connection, state must be safe to call concurrently.
+func (h *Health) AddConnection(state func() ConnectionHealth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.connections = append(h.connections, state)
+}
+
+// SetPipeline sets the pipeline whose queue and dedup are reported.
+func (h *Health) SetPipeline(p *Pipeline) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pipeline = p
+}
+
+// Report returns the state of every connection, in the order they were added, and the pipeline sizes.
+func (h *Health) Report() healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := healthReport{Connections: []ConnectionHealth{}}
+	for _, state := range h.connections {
+		report.Connections = append(report.Connections, state())
+	}
+	if h.pipeline != nil {
+		report.Queue, report.QueueCapacity = h.pipeline.QueueSize()
+		if h.pipeline.Dedup != nil {
+			report.Dedup = h.pipeline.Dedup.Len()
+		}
+	}
+	return report
+}
+
+// Alive tells whether the bot made progress within d: every connection read a message or a pong,
+// unless it is reconnecting, and the deliveries waiting in the queue aren't stalled.
+func (h *Health) Alive(now time.Time, d time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, state := range h.connections {
+		c := state()
+		last := c.Since
+		for _, t := range []time.Time{c.LastMessage, c.LastPong} {
+			if t.After(last) {
+				last = t
+			}
+		}
+		if c.Connected && now.Sub(last) > d {
+			return false
+		}
+	}
+	return h.pipeline == nil || !h.pipeline.Stalled(now, d)
+}
+
+// ServeHTTP writes the report as JSON.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(h.Report())
+}
+
+// healthText writes the report for Discord:
+// "🟢 BitMex: connected for 2 h, last message 1s ago, 3 reconnects".
+func healthText(report healthReport, now time.Time) string {
+	var lines []string
+	for _, c := range report.Connections {
+		line := fmt.Sprintf("🔴 %v: disconnected", c.Name)
+		if c.Since.IsZero() {
+			line = fmt.Sprintf("⚪ %v: connecting", c.Name)
+		} else if c.Connected {
+			line = fmt.Sprintf("🟢 %v: connected for %v", c.Name, durationText(now.Sub(c.Since).Round(time.Minute)))
+		} else {
+			line += fmt.Sprintf(" for %v", durationText(now.Sub(c.Since).Round(time.Second)))
+		}
+
+		if c.LastMessage.IsZero() {
+			line += ", no message yet"
+		} else {
+			line += fmt.Sprintf(", last message %v ago", durationText(now.Sub(c.LastMessage).Round(time.Second)))
+		}
+		if c.Reconnects == 1 {
+			line += ", 1 reconnect"
+		} else if c.Reconnects > 1 {
+			line += fmt.Sprintf(", %v reconnects", c.Reconnects)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No exchange connections")
+	}
+
+	lines = append(lines, fmt.Sprintf("Queue: %v / %v, dedup: %v entries", report.Queue, report.QueueCapacity, report.Dedup))
+	return strings.Join(lines, "\n")
+}
+
+// statusCommand shows how the exchange connections and the pipeline are doing.
+func statusCommand() *SlashCommand {
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "status",
+			Description: "Health of the exchange connections and of the delivery queue",
+		},
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			return &discordgo.InteractionResponseData{
+				Content: healthText(health.Report(), time.Now()),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			}, nil
+		},
+	}
+}
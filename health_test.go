@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	pipeline := &Pipeline{Dedup: NewDedup(time.Minute)}
+	pipeline.Start(context.Background(), 1, 100)
+	defer pipeline.Stop()
+	pipeline.Dedup.Duplicate(Liquidation{Symbol: "XBTUSD"}, now)
+
+	h := &Health{}
+	h.SetPipeline(pipeline)
+	h.AddConnection(func() ConnectionHealth {
+		return ConnectionHealth{Name: "BitMex", Connected: true, Since: now.Add(-2 * time.Hour), LastMessage: now.Add(-time.Second), Reconnects: 3}
+	})
+	h.AddConnection(func() ConnectionHealth {
+		return ConnectionHealth{Name: "Binance trades", Since: now.Add(-30 * time.Second), LastMessage: now.Add(-time.Minute), Reconnects: 1}
+	})
+
+	expected := "🟢 BitMex: connected for 2 h, last message 1s ago, 3 reconnects\n" +
+		"🔴 Binance trades: disconnected for 30s, last message 1 min ago, 1 reconnect\n" +
+		"Queue: 0 / 100, dedup: 1 entries"
+	if text := healthText(h.Report(), now); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	var report healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Connections) != 2 || report.Connections[0].Reconnects != 3 || report.QueueCapacity != 100 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestHealthAlive(t *testing.T) {
+	now := time.Now()
+	connection := ConnectionHealth{Name: "BitMex", Connected: true, Since: now.Add(-time.Hour), LastMessage: now.Add(-10 * time.Minute), LastPong: now.Add(-time.Second)}
+	h := &Health{}
+	h.AddConnection(func() ConnectionHealth { return connection })
+
+	if !h.Alive(now, time.Minute) {
+		t.Error("expected a quiet connection still answering the pings to be alive")
+	}
+	connection.LastPong = now.Add(-5 * time.Minute)
+	if h.Alive(now, time.Minute) {
+		t.Error("expected a connection reading nothing to be wedged")
+	}
+	connection.Connected = false
+	if !h.Alive(now, time.Minute) {
+		t.Error("expected a connection reconnecting to be alive")
+	}
+
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &blockingSink{started: make(chan struct{}, 16), release: make(chan struct{})}
+	p := &Pipeline{State: state, Sinks: []Sink{sink}}
+	p.Start(context.Background(), 1, 4)
+	h.SetPipeline(p)
+
+	// The first liquidation holds up the worker, the second waits behind it
+	l := Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Buy"}
+	p.Publish(l)
+	<-sink.started
+	p.Publish(l)
+	if !h.Alive(time.Now(), time.Minute) {
+		t.Error("expected the queue to be alive while the deliveries are recent")
+	}
+	if h.Alive(time.Now().Add(5*time.Minute), time.Minute) {
+		t.Error("expected the queue to be stalled")
+	}
+
+	close(sink.release)
+	p.Stop()
+	if !h.Alive(time.Now().Add(5*time.Minute), time.Minute) {
+		t.Error("expected the drained queue to be alive")
+	}
+}
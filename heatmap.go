@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+type (
+	// heatmapGrid is the dollars liquidated in each price bucket (rows, lowest first) of each
+	// period of time (columns, oldest first).
+	heatmapGrid struct {
+		cells     [][]float64 // By row then column
+		low, high float64     // Price range of the rows
+		max       float64     // Largest cell
+	}
+
+	// RecapHeatmaps attaches the heatmaps of the day to the daily recap, in the channels it is posted in.
+	RecapHeatmaps struct {
+		Symbols []Symbol
+		Format  NumberFormat // Of the amounts of the labels
+	}
+)
+
+// Size of the heatmap: the number of time and price buckets, and the pixels of a cell.
+const (
+	heatmapColumns = 48
+	heatmapRows    = 40
+	heatmapCell    = 12
+	heatmapMargin  = 80 // Room for the labels left of and under the cells
+)
+
+// bucketHeatmap sums the liquidations with a price into the grid over the period. The price range
+// is that of the liquidations, widened a little so the extremes aren't on the edges.
+func bucketHeatmap(liquidations []Liquidation, from, to time.Time, columns, rows int) heatmapGrid {
+	grid := heatmapGrid{low: math.Inf(1), high: math.Inf(-1)}
+	for _, l := range liquidations {
+		if l.Price > 0 {
+			grid.low, grid.high = math.Min(grid.low, l.Price), math.Max(grid.high, l.Price)
+		}
+	}
+	if math.IsInf(grid.low, 0) {
+		return heatmapGrid{}
+	}
+	pad := (grid.high - grid.low) * 0.05
+	if pad == 0 {
+		pad = grid.low * 0.01
+	}
+	grid.low, grid.high = grid.low-pad, grid.high+pad
+
+	grid.cells = make([][]float64, rows)
+	for i := range grid.cells {
+		grid.cells[i] = make([]float64, columns)
+	}
+
+	period := to.Sub(from)
+	for _, l := range liquidations {
+		at := liquidationTime(l)
+		if l.Price <= 0 || at.Before(from) || !at.Before(to) {
+			continue
+		}
+		column := int(float64(columns) * float64(at.Sub(from)) / float64(period))
+		row := int(float64(rows) * (l.Price - grid.low) / (grid.high - grid.low))
+		if row >= rows {
+			row = rows - 1
+		}
+
+		grid.cells[row][column] += float64(l.USDValue())
+		grid.max = math.Max(grid.max, grid.cells[row][column])
+	}
+	return grid
+}
+
+// heatColor shades the cell from the background through red to yellow, on a log scale so the
+// smaller liquidations still show next to the largest.
+func heatColor(usd, max float64) color.RGBA {
+	if usd <= 0 || max <= 0 {
+		return color.RGBA{24, 24, 32, 255}
+	}
+	heat := math.Log1p(usd) / math.Log1p(max)
+	if heat < 0.5 {
+		return color.RGBA{uint8(60 + 390*heat), 20, 30, 255}
+	}
+	return color.RGBA{255, uint8(20 + 470*(heat-0.5)), uint8(30 + 100*(heat-0.5)), 255}
+}
+
+// renderHeatmap draws the liquidation prices of the symbol over the period as a PNG attachment,
+// nil when none of them had a price.
+func renderHeatmap(symbol Symbol, liquidations []Liquidation, from, to time.Time, amounts NumberFormat) (*discordgo.File, error) {
+	grid := bucketHeatmap(liquidations, from, to, heatmapColumns, heatmapRows)
+	if grid.cells == nil {
+		return nil, nil
+	}
+
+	width := heatmapMargin + heatmapColumns*heatmapCell + 10
+	height := 30 + heatmapRows*heatmapCell + heatmapMargin/2
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(img, img.Bounds(), color.RGBA{12, 12, 16, 255})
+
+	top := 30
+	for row, cells := range grid.cells {
+		// The highest prices go on top
+		y := top + (heatmapRows-1-row)*heatmapCell
+		for column, usd := range cells {
+			x := heatmapMargin + column*heatmapCell
+			fill(img, image.Rect(x, y, x+heatmapCell-1, y+heatmapCell-1), heatColor(usd, grid.max))
+		}
+	}
+
+	// The buckets are rough, so are the prices on their side
+	f := NumberFormat{GroupPrices: true, Decimals: []DecimalRule{{Below: 1, Places: 6}, {Below: 100, Places: 2}, {Places: 0}}}
+	drawLabel(img, fmt.Sprintf("%v liquidations, %v - %v UTC, largest cell %v", symbol,
+		from.UTC().Format("Jan 2 15:04"), to.UTC().Format("Jan 2 15:04"), amounts.Short(int64(grid.max))), heatmapMargin, 18)
+	drawLabel(img, f.Price(grid.high), 4, top+10)
+	drawLabel(img, f.Price((grid.high+grid.low)/2), 4, top+heatmapRows*heatmapCell/2+4)
+	drawLabel(img, f.Price(grid.low), 4, top+heatmapRows*heatmapCell)
+	bottom := top + heatmapRows*heatmapCell + 16
+	drawLabel(img, from.UTC().Format("15:04"), heatmapMargin, bottom)
+	drawLabel(img, from.Add(to.Sub(from)/2).UTC().Format("15:04"), heatmapMargin+heatmapColumns*heatmapCell/2-17, bottom)
+	drawLabel(img, to.UTC().Format("15:04"), width-50, bottom)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	name := "heatmap-" + strings.ToLower(string(symbol)) + ".png"
+	return &discordgo.File{Name: name, ContentType: "image/png", Reader: &buf}, nil
+}
+
+func fill(dst *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dst.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// drawLabel writes text in the bitmap font with its baseline at y.
+func drawLabel(dst *image.RGBA, text string, x, y int) {
+	d := font.Drawer{Dst: dst, Src: image.NewUniform(color.RGBA{200, 200, 210, 255}), Face: basicfont.Face7x13, Dot: fixed.P(x, y)}
+	d.DrawString(text)
+}
+
+// heatmapCommand is /heatmap, the prices the recent liquidations of a contract happened at.
+func heatmapCommand(history *History, f NumberFormat) *SlashCommand {
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "heatmap",
+			Description: "Heatmap of the prices the recent liquidations of a contract happened at",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "symbol", Description: "Contract, XBTUSD by default"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "period", Description: "How far back, such as 24h or 7d, 24h by default"},
+			},
+		},
+		Deferred: true,
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			period, err := parsePeriod(req.String("period", "24h"))
+			if err != nil {
+				return nil, err
+			}
+			symbol := Symbol(strings.ToUpper(req.String("symbol", "XBTUSD")))
+
+			to := time.Now()
+			file, err := renderHeatmap(symbol, heatmapLiquidations(history, symbol, to.Add(-period)), to.Add(-period), to, f)
+			if err != nil {
+				return nil, err
+			}
+			if file == nil {
+				return &discordgo.InteractionResponseData{Content: fmt.Sprintf("No liquidations of %v in that period", symbol)}, nil
+			}
+			return &discordgo.InteractionResponseData{Files: []*discordgo.File{file}}, nil
+		},
+	}
+}
+
+func heatmapLiquidations(history *History, symbol Symbol, from time.Time) []Liquidation {
+	return history.Since(from, func(l Liquidation) bool { return l.Symbol == symbol })
+}
+
+// Posts returns the heatmap of each symbol over the day starting at start, the symbols without
+// liquidations left out.
+func (h *RecapHeatmaps) Posts(history *History, start time.Time) []Post {
+	var posts []Post
+	for _, symbol := range h.Symbols {
+		file, err := renderHeatmap(symbol, heatmapLiquidations(history, symbol, start), start, start.Add(day), h.Format)
+		if err != nil {
+			log.Println("Failed to render the heatmap:", err)
+			continue
+		}
+		if file == nil {
+			continue
+		}
+
+		data := file.Reader.(*bytes.Buffer).Bytes()
+		posts = append(posts, Post{Symbol: symbol, Files: []PostFile{{Name: file.Name, ContentType: file.ContentType, Data: data}}})
+	}
+	return posts
+}
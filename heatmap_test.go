@@ -0,0 +1,40 @@
+package main
+
+import (
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestBucketHeatmap(t *testing.T) {
+	from := time.Date(2024, time.March, 26, 0, 0, 0, 0, time.UTC)
+	liquidations := []Liquidation{
+		{Symbol: "XBTUSD", Price: 60000, USD: 1000000, Received: from.Add(time.Hour)},
+		{Symbol: "XBTUSD", Price: 60000, USD: 500000, Received: from.Add(time.Hour + time.Minute)},
+		{Symbol: "XBTUSD", Price: 70000, USD: 200000, Received: from.Add(23 * time.Hour)},
+		{Symbol: "XBTUSD", Price: 65000, USD: 300000, Received: from.Add(25 * time.Hour)}, // After the period
+	}
+
+	grid := bucketHeatmap(liquidations, from, from.Add(day), 24, 10)
+	if grid.low >= 60000 || grid.high <= 70000 {
+		t.Errorf("expected the range to cover the prices, got %v - %v", grid.low, grid.high)
+	}
+	if grid.cells[0][1] != 1500000 || grid.max != 1500000 {
+		t.Errorf("expected the first two to share the bottom cell of the 2nd hour, got %v", grid.cells[0][1])
+	}
+	if grid.cells[9][23] != 200000 {
+		t.Errorf("expected the last one in the top cell of the last hour, got %v", grid.cells[9][23])
+	}
+
+	file, err := renderHeatmap("XBTUSD", liquidations, from, from.Add(day), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(file.Reader); err != nil {
+		t.Errorf("expected a PNG: %v", err)
+	}
+
+	if file, err := renderHeatmap("XBTUSD", nil, from, from.Add(day), DefaultFormat); file != nil || err != nil {
+		t.Errorf("expected no image without liquidations, got %v, %v", file, err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// History keeps the recent liquidations for the commands that look back, such as /export.
+// They are appended to a JSON lines file and kept in memory for the retention period.
+type History struct {
+	Retention time.Duration
+
+	mu           sync.Mutex
+	liquidations []Liquidation // Oldest first
+	file         *os.File
+	enc          *json.Encoder
+}
+
+// OpenHistory loads the history file at path, dropping what is past retention, and appends to it from then on.
+func OpenHistory(path string, retention time.Duration) (*History, error) {
+	h := &History{Retention: retention}
+	cutoff := time.Now().Add(-retention)
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var l Liquidation
+			if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+				log.Println("Skipping bad history line:", err)
+				continue
+			}
+			if l.Received.After(cutoff) {
+				h.liquidations = append(h.liquidations, l)
+			}
+		}
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			return nil, errwrap.Wrapf("could not read the history: {{err}}", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	sort.SliceStable(h.liquidations, func(i, j int) bool {
+		return h.liquidations[i].Received.Before(h.liquidations[j].Received)
+	})
+
+	// Rewrite the file without the expired lines, then keep appending to it
+	if err := h.rewrite(path); err != nil {
+		return nil, errwrap.Wrapf("could not compact the history: {{err}}", err)
+	}
+
+	return h, nil
+}
+
+func (h *History) rewrite(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, l := range h.liquidations {
+		if err := enc.Encode(l); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	h.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	h.enc = json.NewEncoder(h.file)
+
+	return nil
+}
+
+// Publish implements Sink, recording every liquidation.
+func (h *History) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	l := dl.Liquidation
+	l.Received = liquidationTime(l)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.liquidations = append(h.liquidations, l)
+
+	// Forget what is past retention, the file is compacted on the next start.
+	// The array is released as appends reallocate it.
+	cutoff := time.Now().Add(-h.Retention)
+	expired := sort.Search(len(h.liquidations), func(i int) bool { return h.liquidations[i].Received.After(cutoff) })
+	h.liquidations = h.liquidations[expired:]
+
+	return h.enc.Encode(l)
+}
+
+// Announce implements Sink, there is nothing to record.
+func (h *History) Announce(ctx context.Context, text string) error {
+	return nil
+}
+
+// Since returns the liquidations received after t that match, oldest first. A nil match matches everything.
+func (h *History) Since(t time.Time, match func(l Liquidation) bool) []Liquidation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := sort.Search(len(h.liquidations), func(i int) bool { return h.liquidations[i].Received.After(t) })
+
+	var matched []Liquidation
+	for _, l := range h.liquidations[start:] {
+		if match == nil || match(l) {
+			matched = append(matched, l)
+		}
+	}
+
+	return matched
+}
+
+// Find implements Finder.
+func (h *History) Find(q FindQuery) ([]Liquidation, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var found []Liquidation
+	for i := len(h.liquidations) - 1; i >= 0 && (q.Limit <= 0 || len(found) < q.Limit); i-- {
+		l := h.liquidations[i]
+		if l.Received.Before(q.Since) {
+			break
+		}
+		if q.Match(l) {
+			found = append(found, l)
+		}
+	}
+
+	return found, nil
+}
+
+// Oldest returns when the oldest liquidation kept was received, zero when there are none.
+func (h *History) Oldest() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.liquidations) == 0 {
+		return time.Time{}
+	}
+	return h.liquidations[0].Received
+}
+
+// Close closes the history file.
+func (h *History) Close() error {
+	return h.file.Close()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	h, err := OpenHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, l := range []Liquidation{
+		{Symbol: "XBTUSD", Quantity: 10000, Received: now.Add(-2 * time.Hour)},
+		{Symbol: "XBTUSD", Quantity: 20000, Received: now.Add(-30 * time.Minute)},
+		{Symbol: "ETHUSD", Quantity: 30000, Received: now.Add(-10 * time.Minute)},
+	} {
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	// The expired liquidation is dropped on reopening
+	h, err = OpenHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if n := len(h.Since(now.Add(-24*time.Hour), nil)); n != 2 {
+		t.Errorf("expected 2 liquidations within retention, got %v", n)
+	}
+
+	eth := h.Since(now.Add(-time.Hour), func(l Liquidation) bool { return l.Symbol == "ETHUSD" })
+	if len(eth) != 1 || eth[0].Quantity != 30000 {
+		t.Errorf("expected the ETHUSD liquidation, got %v", eth)
+	}
+
+	if n := len(h.Since(now.Add(-20*time.Minute), nil)); n != 1 {
+		t.Errorf("expected 1 liquidation in the last 20 minutes, got %v", n)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// serveHTTP exposes the operational endpoints on the configured address until the listener fails.
+// The debug endpoints are only served when asked for, the profiler being expensive to leave open,
+// and so are the dashboard, which is meant for anyone to see, the Grafana datasource, the inbox
+// and the invite of hosted mode.
+func serveHTTP(cfg BotConfig) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", serveHealth)
+	mux.Handle("/status", health)
+	if cfg.HTTPDebug {
+		handleDebug(mux)
+	}
+	if cfg.HTTPDashboard {
+		dashboard.handle(mux)
+	}
+	if cfg.HTTPGrafana {
+		grafana.handle(mux)
+	}
+	if cfg.InboxToken != "" {
+		inbox.Token = cfg.InboxToken
+		mux.Handle("/inbox", inbox)
+	}
+	if cfg.Hosted && cfg.OAuthClientID != "" {
+		invites.handle(mux)
+	}
+
+	log.Println("Serving HTTP on", cfg.HTTPAddr)
+	if err := http.ListenAndServe(cfg.HTTPAddr, mux); err != nil {
+		log.Println("HTTP server failed:", err)
+	}
+}
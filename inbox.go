@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Inbox takes the liquidations and announcements operators post by hand, such as those of an
+	// exchange the bot doesn't follow yet, and sends them down the pipeline like any other: they
+	// are decorated, filtered and posted the same way. It is served on /inbox, for the holders of
+	// the token.
+	Inbox struct {
+		Token string
+
+		mu       sync.Mutex
+		pipeline *Pipeline
+	}
+
+	// inboxPost is what the inbox takes: a liquidation, or an announcement alone.
+	inboxPost struct {
+		Exchange string    `json:"exchange"` // "Manual" when empty
+		Symbol   Symbol    `json:"symbol"`
+		Position string    `json:"position"` // "long" or "short", the side that was liquidated
+		Side     string    `json:"side"`     // Or the order side, "Buy" closing a short
+		Price    float64   `json:"price"`
+		Quantity int64     `json:"quantity"`
+		USD      float64   `json:"usd"`      // Worth, when the contract can't be valued from its instrument
+		OrderID  string    `json:"order_id"` // Posting the same order again is ignored
+		Time     time.Time `json:"time"`     // Now when zero
+
+		Announcement string `json:"announcement"`
+	}
+)
+
+// inbox is served on /inbox when it has a token, taking posts once the pipeline runs.
+var inbox = &Inbox{}
+
+// SetPipeline sets the pipeline the posts go down.
+func (i *Inbox) SetPipeline(p *Pipeline) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.pipeline = p
+}
+
+// ServeHTTP takes a post, with the token as a bearer token.
+func (i *Inbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a liquidation or an announcement", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if i.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(i.Token)) != 1 {
+		metrics.Counter("rekt_inbox_total", "result", "unauthorized").Inc()
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	i.mu.Lock()
+	pipeline := i.pipeline
+	i.mu.Unlock()
+	if pipeline == nil {
+		http.Error(w, "not running yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	post, err := decodeInboxPost(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		metrics.Counter("rekt_inbox_total", "result", "invalid").Inc()
+		http.Error(w, "bad post, see rekt schema inbox: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if post.Announcement != "" {
+		log.Println("Inbox announcement:", post.Announcement)
+		pipeline.Announce(post.Announcement)
+		metrics.Counter("rekt_inbox_total", "result", "announcement").Inc()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	l, err := post.Liquidation(time.Now())
+	if err != nil {
+		metrics.Counter("rekt_inbox_total", "result", "invalid").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Println("Inbox liquidation:", l)
+	pipeline.Publish(l)
+	metrics.Counter("rekt_inbox_total", "result", "liquidation").Inc()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// decodeInboxPost reads a post, which must match the inbox schema.
+func decodeInboxPost(r io.Reader) (inboxPost, error) {
+	var post inboxPost
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return post, err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return post, err
+	}
+	if err := validateJSON(schemas["inbox"](), raw, "post"); err != nil {
+		return post, err
+	}
+	return post, json.Unmarshal(data, &post)
+}
+
+// Liquidation checks the post and returns its liquidation, received now unless it has a time.
+func (p inboxPost) Liquidation(now time.Time) (Liquidation, error) {
+	l := Liquidation{
+		Exchange: p.Exchange,
+		Symbol:   Symbol(strings.ToUpper(string(p.Symbol))),
+		Price:    p.Price,
+		Quantity: p.Quantity,
+		USD:      p.USD,
+		OrderID:  p.OrderID,
+		Reported: true,
+		Received: p.Time,
+	}
+	if l.Exchange == "" {
+		l.Exchange = "Manual"
+	}
+	if l.Received.IsZero() {
+		l.Received = now
+	}
+
+	switch {
+	case strings.EqualFold(p.Position, "long") || strings.EqualFold(p.Side, "Sell"):
+		l.Side = "Sell"
+	case strings.EqualFold(p.Position, "short") || strings.EqualFold(p.Side, "Buy"):
+		l.Side = "Buy"
+	default:
+		return Liquidation{}, fmt.Errorf("expected a position of long or short, or a side of Buy or Sell")
+	}
+
+	if l.Symbol == "" {
+		return Liquidation{}, fmt.Errorf("expected a symbol")
+	}
+	if l.Price <= 0 {
+		return Liquidation{}, fmt.Errorf("expected a price")
+	}
+	if l.Quantity <= 0 && l.USD <= 0 {
+		return Liquidation{}, fmt.Errorf("expected a quantity or a USD value")
+	}
+	if l.Quantity <= 0 {
+		// The messages show a quantity, the dollars are the best stand-in
+		l.Quantity = int64(l.USD)
+	}
+	return l, nil
+}
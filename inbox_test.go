@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInbox(t *testing.T) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{}
+	p := &Pipeline{State: state, Sinks: []Sink{sink}}
+	p.Start(context.Background(), 1, 16)
+
+	i := &Inbox{Token: "secret"}
+	i.SetPipeline(p)
+	server := httptest.NewServer(i)
+	defer server.Close()
+
+	post := func(token, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	liquidation := `{"exchange": "Hyperliquid", "symbol": "btc-usd", "position": "short", "price": 64250, "usd": 2500000}`
+	if status := post("wrong", liquidation); status != http.StatusUnauthorized {
+		t.Errorf("expected a wrong token to be refused, got %v", status)
+	}
+	if status := post("secret", `{"symbol": "BTC-USD", "position": "long", "price": 64250}`); status != http.StatusBadRequest {
+		t.Errorf("expected a liquidation without a size to be refused, got %v", status)
+	}
+	if status := post("secret", liquidation); status != http.StatusAccepted {
+		t.Errorf("expected the liquidation to be taken, got %v", status)
+	}
+	if status := post("secret", `{"announcement": "Hyperliquid is down"}`); status != http.StatusAccepted {
+		t.Errorf("expected the announcement to be taken, got %v", status)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	p.Stop()
+
+	if len(sink.published) != 1 {
+		t.Fatal("expected the liquidation to be posted, got", sink.published)
+	}
+	if l := sink.published[0].Liquidation; l.Symbol != "BTC-USD" || l.Side != "Buy" || l.USDValue() != 2500000 || l.Exchange != "Hyperliquid" {
+		t.Errorf("unexpected liquidation %+v", l)
+	}
+	if len(sink.announced) != 1 || sink.announced[0] != "Hyperliquid is down" {
+		t.Errorf("expected the announcement, got %q", sink.announced)
+	}
+}
+
+func TestInboxWhileFeedPublishes(t *testing.T) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{}
+	p := &Pipeline{State: state, Sinks: []Sink{sink}, Dedup: NewDedup(time.Minute)}
+	p.Start(context.Background(), 1, 1024)
+
+	i := &Inbox{Token: "secret"}
+	i.SetPipeline(p)
+	server := httptest.NewServer(i)
+	defer server.Close()
+
+	// The feed publishes from its own goroutine as the posts come in
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; n < 200; n++ {
+			p.Publish(Liquidation{Symbol: "XBTUSD", Side: "Sell", Price: 60000, Quantity: int64(10000 + n), Received: time.Now()})
+		}
+	}()
+
+	for n := 0; n < 50; n++ {
+		body := fmt.Sprintf(`{"exchange": "Hyperliquid", "symbol": "BTC-USD", "position": "short", "price": 64250, "usd": %v}`, 1000000+n)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	<-done
+
+	time.Sleep(50 * time.Millisecond)
+	p.Stop()
+
+	if len(sink.published) != 250 {
+		t.Errorf("expected the 250 liquidations to be posted, got %v", len(sink.published))
+	}
+}
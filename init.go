@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// starterConfig is config.json.example, every option with its default and what it does.
+//
+//go:embed config.json.example
+var starterConfig string
+
+// initQuestion is an option the wizard asks about, as a flag or interactively.
+type initQuestion struct {
+	Key      string // In config.json
+	Question string
+	Bool     bool
+}
+
+// initQuestions are the options to get right before the first run, the others keep their defaults.
+var initQuestions = []initQuestion{
+	{Key: "discord_token", Question: "Discord bot token"},
+	{Key: "discord_channel", Question: "ID of the channel to post the liquidations to"},
+	{Key: "testnet", Question: "Use the BitMex testnet?", Bool: true},
+	{Key: "ops_channel", Question: "ID of the channel for the operational alerts, empty for none"},
+	{Key: "http_addr", Question: "Address to serve /metrics and /healthz on, e.g. :8080, empty for none"},
+}
+
+// initCommand writes a commented starter config, asking for what the flags didn't give:
+// rekt init [--out config.json] [--discord_token ...] [--yes]
+func initCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	out := fs.String("out", configPath(), "file to write")
+	force := fs.Bool("force", false, "overwrite the file if it exists")
+	yes := fs.Bool("yes", false, "don't ask, keeping the defaults for what the flags don't set")
+	flags := make(map[string]*string)
+	for _, q := range initQuestions {
+		flags[q.Key] = fs.String(q.Key, "", q.Question)
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		return fmt.Errorf("%v already exists, use --force to overwrite it", *out)
+	}
+
+	answers := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := flags[f.Name]; ok {
+			answers[f.Name] = f.Value.String()
+		}
+	})
+
+	// Only ask when someone is there to answer
+	if stdin, err := os.Stdin.Stat(); err == nil && stdin.Mode()&os.ModeCharDevice != 0 && !*yes {
+		if err := askQuestions(os.Stdin, os.Stdout, answers); err != nil {
+			return err
+		}
+	}
+
+	config, err := starterConfigWith(answers)
+	if err != nil {
+		return err
+	}
+
+	// The token makes it a secret
+	if err := os.MkdirAll(filepath.Dir(*out), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*out, []byte(config), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %v, see the comments for the other options and run rekt selftest to check it\n", *out)
+	return nil
+}
+
+// askQuestions asks the questions that aren't answered yet, an empty answer keeping the default.
+func askQuestions(in io.Reader, out io.Writer, answers map[string]string) error {
+	r := bufio.NewReader(in)
+	for _, q := range initQuestions {
+		if _, ok := answers[q.Key]; ok {
+			continue
+		}
+
+		if q.Bool {
+			fmt.Fprintf(out, "%v [y/N] ", q.Question)
+		} else {
+			fmt.Fprintf(out, "%v: ", q.Question)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		answer := strings.TrimSpace(line)
+		if q.Bool && answer != "" {
+			answer = fmt.Sprint(strings.HasPrefix(strings.ToLower(answer), "y"))
+		}
+		if answer != "" {
+			answers[q.Key] = answer
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+	return nil
+}
+
+// starterConfigWith fills the answers into the starter config, checking the result loads and
+// matches the schema the bot checks the config against.
+func starterConfigWith(answers map[string]string) (string, error) {
+	config := starterConfig
+	for _, q := range initQuestions {
+		answer, ok := answers[q.Key]
+		if !ok {
+			continue
+		}
+
+		var value interface{} = answer
+		if q.Bool {
+			value = answer == "true"
+		}
+
+		var err error
+		if config, err = setOption(config, q.Key, value); err != nil {
+			return "", err
+		}
+	}
+
+	stripped := stripComments([]byte(config))
+	var cfg BotConfig
+	if err := json.Unmarshal(stripped, &cfg); err != nil {
+		return "", errwrap.Wrapf("the starter config is invalid: {{err}}", err)
+	}
+	var raw interface{}
+	json.Unmarshal(stripped, &raw)
+	if err := validateJSON(configSchema(), raw, "config"); err != nil {
+		return "", errwrap.Wrapf("the starter config is invalid: {{err}}", err)
+	}
+	return config, nil
+}
+
+// setOption replaces the value of a top level option, which must be a plain value.
+func setOption(config, key string, value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	option := regexp.MustCompile(`(?m)^(    "` + regexp.QuoteMeta(key) + `": )("(?:[^"\\]|\\.)*"|true|false|null|-?[0-9.eE+-]+)`)
+	loc := option.FindStringSubmatchIndex(config)
+	if loc == nil {
+		return "", fmt.Errorf("no %v option in the starter config", key)
+	}
+	return config[:loc[4]] + string(encoded) + config[loc[5]:], nil
+}
+
+// stripComments blanks out the // line comments outside of the strings, so config.json can be commented.
+func stripComments(data []byte) []byte {
+	stripped := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				stripped = append(stripped, '\n')
+			}
+			continue
+		}
+		stripped = append(stripped, c)
+	}
+	return stripped
+}
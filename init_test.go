@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStarterConfigHasEveryOption(t *testing.T) {
+	var options map[string]interface{}
+	if err := json.Unmarshal(stripComments([]byte(starterConfig)), &options); err != nil {
+		t.Fatal("expected the starter config to be valid once stripped of the comments:", err)
+	}
+
+	fields := reflect.TypeOf(BotConfig{})
+	for i := 0; i < fields.NumField(); i++ {
+		key := strings.Split(fields.Field(i).Tag.Get("json"), ",")[0]
+		if _, ok := options[key]; !ok {
+			t.Errorf("expected %v in config.json.example", key)
+		}
+	}
+}
+
+func TestStarterConfigWith(t *testing.T) {
+	config, err := starterConfigWith(map[string]string{"discord_token": `a"b`, "testnet": "true", "http_addr": ":8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg BotConfig
+	if err := json.Unmarshal(stripComments([]byte(config)), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DiscordToken != `a"b` || !cfg.Testnet || cfg.HTTPAddr != ":8080" || cfg.DiscordChannel != "" {
+		t.Errorf("expected the answers to be filled in, got %+v", cfg)
+	}
+	if !strings.Contains(config, "// Bot token") {
+		t.Error("expected the comments to be kept")
+	}
+}
+
+func TestAskQuestions(t *testing.T) {
+	var out bytes.Buffer
+	answers := map[string]string{"discord_token": "from a flag"}
+	if err := askQuestions(strings.NewReader("1234\ny\n\n"), &out, answers); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"discord_token": "from a flag", "discord_channel": "1234", "testnet": "true"}
+	if !reflect.DeepEqual(answers, want) {
+		t.Errorf("expected %v, got %v", want, answers)
+	}
+	if strings.Contains(out.String(), "Discord bot token") {
+		t.Error("expected the question answered by a flag not to be asked")
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	in := "{\n    // The proxy\n    \"proxy\": \"socks5://a\\\"//b\" // trailing\n}"
+	var v map[string]string
+	if err := json.Unmarshal(stripComments([]byte(in)), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["proxy"] != `socks5://a"//b` {
+		t.Errorf("expected the slashes in strings to be kept, got %q", v["proxy"])
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Instrument is the part of BitMex's contract specification the bot cares about.
+	// https://www.bitmex.com/api/explorer/#!/Instrument/Instrument_get
+	Instrument struct {
+		Symbol      Symbol  `json:"symbol"`
+		MaintMargin float64 `json:"maintMargin"`
+		InitMargin  float64 `json:"initMargin"`
+		TakerFee    float64 `json:"takerFee"`
+		TickSize    float64 `json:"tickSize"`
+		IsInverse   bool    `json:"isInverse"`
+		IsQuanto    bool    `json:"isQuanto"`
+
+		// Value of a contract in the settlement currency's smallest unit per unit of price,
+		// negative for inverse contracts where it is per unit of 1/price
+		Multiplier    float64 `json:"multiplier"`
+		Underlying    string  `json:"underlying"`
+		QuoteCurrency string  `json:"quoteCurrency"`
+		SettlCurrency string  `json:"settlCurrency"`
+		MarkPrice     float64 `json:"markPrice"`
+		Volume24h     float64 `json:"foreignNotional24h"` // Traded over the last 24 hours, in the quote currency
+
+		Typ    string    `json:"typ"`    // BitMex's CFI code, FFCCSX for futures
+		State  string    `json:"state"`  // Open, Settled, Unlisted...
+		Expiry time.Time `json:"expiry"` // Zero for perpetual contracts
+
+		Fetched time.Time `json:"-"` // When it was fetched from BitMex
+	}
+
+	// InstrumentCache fetches instruments from the BitMex REST API and keeps them for a while,
+	// since margin parameters rarely change. When BitMex can't be reached, the instruments already
+	// fetched are used for a while longer, stale.
+	InstrumentCache struct {
+		Host   string
+		Client *http.Client
+		Now    func() time.Time
+
+		// OnRefresh gets the active instruments after each refresh, when set.
+		OnRefresh func(active []Instrument)
+
+		instruments *TTLCache
+	}
+
+	cachedInstrument struct {
+		Instrument       // The last one fetched, if any
+		err        error // Of the last fetch, when it failed
+		failed     time.Time
+	}
+)
+
+// Instruments are fetched again past instrumentTTL, and failed fetches are remembered for
+// instrumentErrorTTL so an outage doesn't cost a request per liquidation. Until instrumentMaxAge,
+// the last instrument fetched is used in the meantime. Symbols that never existed count towards
+// the limit too.
+const (
+	instrumentTTL      = time.Hour
+	instrumentErrorTTL = time.Minute
+	instrumentMaxAge   = 24 * time.Hour
+	maxInstruments     = 10000
+)
+
+// Futures instrument type
+const futuresTyp = "FFCCSX"
+
+// NewInstrumentCache returns a cache for the instruments of the configured host.
+func NewInstrumentCache(host string, client *http.Client) *InstrumentCache {
+	return &InstrumentCache{
+		Host:        host,
+		Client:      client,
+		Now:         time.Now,
+		instruments: NewTTLCache("instruments", instrumentMaxAge, maxInstruments),
+	}
+}
+
+// Get returns the instrument, fetching it if it isn't cached or has expired. Should fetching it
+// fail, the instrument fetched last is returned, stale, as long as it isn't older than instrumentMaxAge.
+func (c *InstrumentCache) Get(symbol Symbol) (Instrument, error) {
+	now := c.Now()
+
+	var cached cachedInstrument
+	if value, ok := c.instruments.Get(string(symbol), now); ok {
+		cached = value.(cachedInstrument)
+		if !cached.Fetched.IsZero() && now.Sub(cached.Fetched) < instrumentTTL {
+			return cached.Instrument, nil
+		}
+		if cached.err != nil && now.Sub(cached.failed) < instrumentErrorTTL {
+			return cached.served(now)
+		}
+	}
+
+	instrument, err := c.fetch(symbol)
+	if err == nil {
+		instrument.Fetched = now
+		cached = cachedInstrument{Instrument: instrument}
+	} else {
+		cached.err, cached.failed = err, now
+	}
+	c.instruments.Set(string(symbol), cached, now)
+
+	return cached.served(now)
+}
+
+// served returns the instrument fetched last, or the error when there is none recent enough.
+func (c cachedInstrument) served(now time.Time) (Instrument, error) {
+	if c.err == nil {
+		return c.Instrument, nil
+	}
+	if c.Fetched.IsZero() || now.Sub(c.Fetched) > instrumentMaxAge {
+		return Instrument{}, c.err
+	}
+
+	metrics.Counter("rekt_stale_instruments_total").Inc()
+	debugLog.Printf("Using %v from %v ago: %v\n", c.Symbol, now.Sub(c.Fetched).Round(time.Second), c.err)
+	return c.Instrument, nil
+}
+
+// Refresh fetches the active instruments right away and then every interval until the context
+// is done, so those in use are kept fresh without a request on the way of a liquidation, and
+// passes them on to OnRefresh. It alerts once the margin parameters have gone stale.
+func (c *InstrumentCache) Refresh(ctx context.Context, interval time.Duration) {
+	last := c.Now()
+	for {
+		active, err := c.Active()
+		if err != nil {
+			log.Println("Failed to refresh the instruments:", err)
+			if age := c.Now().Sub(last); age > instrumentTTL {
+				ops.Alert("instruments", "The margin parameters are stale, last refreshed %v ago: %v", age.Round(time.Minute), err)
+			}
+		} else {
+			last = c.Now()
+			metrics.Gauge("rekt_instruments_refreshed_timestamp_seconds").Set(float64(last.Unix()))
+			if c.OnRefresh != nil {
+				c.OnRefresh(active)
+			}
+		}
+
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// Stale tells whether the instrument is older than instrumentTTL, BitMex having been unreachable since.
+func (i Instrument) Stale(now time.Time) bool {
+	return !i.Fetched.IsZero() && now.Sub(i.Fetched) > instrumentTTL
+}
+
+// Active fetches every instrument that is currently listed, refreshing the cached ones along the way.
+func (c *InstrumentCache) Active() ([]Instrument, error) {
+	instruments, err := c.query("/api/v1/instrument/active", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.Now()
+	for i := range instruments {
+		instruments[i].Fetched = now
+		c.instruments.Set(string(instruments[i].Symbol), cachedInstrument{Instrument: instruments[i]}, now)
+	}
+
+	return instruments, nil
+}
+
+// IsFutures tells whether the contract expires.
+func (i Instrument) IsFutures() bool {
+	return i.Typ == futuresTyp && !i.Expiry.IsZero()
+}
+
+// Value returns the quantity of the underlying coin and the USD notional of an amount of contracts.
+// settleUSD is the USD price of the settlement currency, which only matters for quanto contracts.
+//
+//	Inverse (XBTUSD):  settled = |multiplier| * qty / price
+//	Linear (ETHUSDT):  settled = multiplier * qty * price
+//	Quanto (ETHUSD):   settled = multiplier * qty * price, in a coin other than the underlying
+func (i Instrument) Value(qty int64, price, settleUSD float64) (coinQty, usd float64) {
+	if price <= 0 || i.Multiplier == 0 {
+		return 0, 0
+	}
+
+	var settled float64
+	if i.IsInverse {
+		settled = math.Abs(i.Multiplier) * float64(qty) / price
+	} else {
+		settled = i.Multiplier * float64(qty) * price
+	}
+	settled /= settleScale(i.SettlCurrency)
+
+	switch {
+	case i.IsInverse:
+		// Settled in the underlying, priced in the quote
+		return settled, settled * price
+	case i.IsQuanto:
+		usd = settled * settleUSD
+		return usd / price, usd
+	default:
+		// Settled in the quote
+		return settled / price, settled
+	}
+}
+
+// Loss estimates what the liquidated trader lost on a position of the given notional: the whole margin,
+// since BitMex closes it at the bankruptcy price where the margin runs out. The leverage isn't known,
+// so the maximum leverage is assumed, which makes it a lower bound. Without an initial margin, the
+// maintenance margin and fee between the liquidation and bankruptcy prices are the least they lost.
+func (i Instrument) Loss(usd float64) float64 {
+	if i.InitMargin > 0 {
+		return usd * i.InitMargin
+	}
+	return usd * (i.MaintMargin + i.TakerFee)
+}
+
+// settleScale is the number of smallest units BitMex settles in per coin.
+func settleScale(currency string) float64 {
+	switch currency {
+	case "XBt":
+		return 1e8 // Satoshis
+	case "USDt", "USDC":
+		return 1e6
+	case "Gwei":
+		return 1e9
+	default:
+		return 1
+	}
+}
+
+func (c *InstrumentCache) fetch(symbol Symbol) (Instrument, error) {
+	instruments, err := c.query("/api/v1/instrument", url.Values{"symbol": {string(symbol)}})
+	if err != nil {
+		return Instrument{}, err
+	}
+
+	if len(instruments) == 0 {
+		return Instrument{}, fmt.Errorf("unknown symbol %v", symbol)
+	}
+
+	return instruments[0], nil
+}
+
+func (c *InstrumentCache) query(path string, query url.Values) ([]Instrument, error) {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     c.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	resp, err := c.Client.Get(u.String())
+	if err != nil {
+		return nil, errwrap.Wrapf("could not fetch instrument: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch instrument: %v", resp.Status)
+	}
+
+	var instruments []Instrument
+	if err := json.NewDecoder(resp.Body).Decode(&instruments); err != nil {
+		return nil, errwrap.Wrapf("bad instrument response: {{err}}", err)
+	}
+
+	return instruments, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		instrument Instrument
+		qty        int64
+		price      float64
+		settleUSD  float64
+		coinQty    float64
+		usd        float64
+	}{
+		// $1 per contract
+		{"inverse", Instrument{Multiplier: -100000000, IsInverse: true, SettlCurrency: "XBt"}, 90000, 9000, 0, 10, 90000},
+		// 0.000001 XBT per contract, settled in USDT
+		{"linear", Instrument{Multiplier: 1, SettlCurrency: "USDt"}, 1000000, 60000, 0, 1, 60000},
+		// 0.0001 ETH per contract, settled in USDT
+		{"linear alt", Instrument{Multiplier: 100, SettlCurrency: "USDt"}, 20000, 3000, 0, 2, 6000},
+		// 100 satoshis per dollar of ETH price per contract
+		{"quanto", Instrument{Multiplier: 100, IsQuanto: true, SettlCurrency: "XBt"}, 1000, 3000, 60000, 60, 180000},
+	}
+
+	for _, test := range tests {
+		coinQty, usd := test.instrument.Value(test.qty, test.price, test.settleUSD)
+		if math.Abs(coinQty-test.coinQty) > 1e-9 || math.Abs(usd-test.usd) > 1e-6 {
+			t.Errorf("%v: expected %v coin and $%v, got %v coin and $%v", test.name, test.coinQty, test.usd, coinQty, usd)
+		}
+	}
+}
+
+func TestInstrumentLoss(t *testing.T) {
+	xbt := Instrument{InitMargin: 0.01, MaintMargin: 0.005, TakerFee: 0.00075}
+	if loss := xbt.Loss(1000000); math.Abs(loss-10000) > 1e-6 {
+		t.Errorf("expected the margin at 100x to be lost, got %v", loss)
+	}
+
+	xbt.InitMargin = 0
+	if loss := xbt.Loss(1000000); math.Abs(loss-5750) > 1e-6 {
+		t.Errorf("expected the maintenance margin and fee to be lost, got %v", loss)
+	}
+}
+
+func TestInstrumentCacheStale(t *testing.T) {
+	up := true
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !up {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `[{"symbol": "XBTUSD", "maintMargin": 0.0035}]`)
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := NewInstrumentCache(strings.TrimPrefix(server.URL, "https://"), server.Client())
+	c.Now = func() time.Time { return now }
+
+	if i, err := c.Get("XBTUSD"); err != nil || i.MaintMargin != 0.0035 || i.Stale(now) {
+		t.Fatalf("expected a fresh instrument, got %+v, %v", i, err)
+	}
+
+	// Past the TTL, the outage is bridged with the instrument fetched before
+	up = false
+	now = now.Add(2 * time.Hour)
+	i, err := c.Get("XBTUSD")
+	if err != nil || i.MaintMargin != 0.0035 || !i.Stale(now) {
+		t.Fatalf("expected the stale instrument, got %+v, %v", i, err)
+	}
+	if c.Get("XBTUSD"); requests != 2 {
+		t.Errorf("expected the failure to be remembered, got %v requests", requests)
+	}
+
+	// But not for ever
+	now = now.Add(instrumentMaxAge)
+	if _, err := c.Get("XBTUSD"); err == nil {
+		t.Error("expected the instrument to be given up on")
+	}
+}
+
+func TestInstrumentCacheRefresh(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"symbol": "XBTUSD", "typ": "FFWCSX"}]`)
+	}))
+	defer server.Close()
+
+	c := NewInstrumentCache(strings.TrimPrefix(server.URL, "https://"), server.Client())
+	refreshed := make(chan []Instrument, 1)
+	c.OnRefresh = func(active []Instrument) { refreshed <- active }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Refresh(ctx, time.Hour)
+
+	// The first refresh is right away, the listings not waiting for the interval
+	select {
+	case active := <-refreshed:
+		if len(active) != 1 || !active[0].IsPerpetual() {
+			t.Errorf("expected the active perpetual, got %+v", active)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the instruments to be refreshed right away")
+	}
+}
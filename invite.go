@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Invites is the OAuth flow through which the guilds of hosted mode add the bot: /invite sends
+	// to Discord's authorization page, which comes back to /invite/callback with the guild picked
+	// and the user who picked it, who are made a tenant.
+	Invites struct {
+		ClientID    string
+		Secret      string
+		RedirectURL string // Public URL of /invite/callback
+		API         string // Discord's API, discordAPI in production
+		Client      *http.Client
+		Tenants     *Tenants
+	}
+
+	// inviteToken is the part of the token response of the bot scope we use.
+	// https://discord.com/developers/docs/topics/oauth2#advanced-bot-authorization
+	inviteToken struct {
+		AccessToken string `json:"access_token"`
+		Guild       struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"guild"`
+	}
+)
+
+const discordAPI = "https://discord.com/api/v10"
+
+// invites are served on /invite in hosted mode, once main has set them up.
+var invites = &Invites{API: discordAPI}
+
+// inviteScopes are asked for on the invite: the bot, its commands and who is adding it.
+const inviteScopes = "bot applications.commands identify"
+
+// invitePermissions are those the bot needs in the channels it posts to: view, send, manage
+// (for the pins), embed, attach, read the history, and create and post in the forum threads.
+const invitePermissions = 1024 | 2048 | 8192 | 16384 | 32768 | 65536 | 1<<35 | 1<<38
+
+// inviteStateTTL is how long the invite link is good for, the state proving it came from us.
+const inviteStateTTL = 10 * time.Minute
+
+// handle serves the invite and its callback.
+func (i *Invites) handle(mux *http.ServeMux) {
+	mux.HandleFunc("/invite", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, i.AuthorizeURL(time.Now()), http.StatusFound)
+	})
+	mux.HandleFunc("/invite/callback", i.serveCallback)
+}
+
+// AuthorizeURL is the Discord page adding the bot, its state signed at now.
+func (i *Invites) AuthorizeURL(now time.Time) string {
+	return "https://discord.com/oauth2/authorize?" + url.Values{
+		"client_id":     {i.ClientID},
+		"scope":         {inviteScopes},
+		"permissions":   {strconv.FormatInt(invitePermissions, 10)},
+		"response_type": {"code"},
+		"redirect_uri":  {i.RedirectURL},
+		"state":         {i.state(now)},
+	}.Encode()
+}
+
+// state is the time of the invite along with its signature.
+func (i *Invites) state(now time.Time) string {
+	issued := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(i.Secret))
+	mac.Write([]byte(issued))
+	return issued + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validState tells whether the state was signed by us less than inviteStateTTL ago.
+func (i *Invites) validState(state string, now time.Time) bool {
+	parts := strings.SplitN(state, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Sub(time.Unix(issued, 0)) > inviteStateTTL {
+		return false
+	}
+	return hmac.Equal([]byte(state), []byte(i.state(time.Unix(issued, 0))))
+}
+
+func (i *Invites) serveCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "The bot wasn't added: "+query.Get("error_description"), http.StatusBadRequest)
+		return
+	}
+	if !i.validState(query.Get("state"), time.Now()) {
+		metrics.Counter("rekt_invites_total", "result", "invalid").Inc()
+		http.Error(w, "This invite has expired, start over from /invite", http.StatusBadRequest)
+		return
+	}
+
+	token, installer, err := i.exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		metrics.Counter("rekt_invites_total", "result", "failed").Inc()
+		log.Println("Failed to complete the invite:", err)
+		http.Error(w, "Discord didn't confirm the invite, try again", http.StatusBadGateway)
+		return
+	}
+	if err := i.Tenants.Join(token.Guild.ID, token.Guild.Name, installer); err != nil {
+		log.Println("Failed to save the tenants:", err)
+		http.Error(w, "The server couldn't be saved, try again later", http.StatusInternalServerError)
+		return
+	}
+	metrics.Counter("rekt_invites_total", "result", "joined").Inc()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><title>REKT</title><p>REKT was added to %v. Run <code>/tenant add</code> in the channel it should post to.</p>",
+		html.EscapeString(token.Guild.Name))
+}
+
+// exchange trades the code for the token naming the guild, and looks up who added the bot.
+func (i *Invites) exchange(ctx context.Context, code string) (inviteToken, string, error) {
+	var token inviteToken
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {i.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.API+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return token, "", err
+	}
+	req.SetBasicAuth(i.ClientID, i.Secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := i.do(req, &token); err != nil {
+		return token, "", errwrap.Wrapf("could not exchange the code: {{err}}", err)
+	}
+	if token.Guild.ID == "" {
+		return token, "", fmt.Errorf("no guild in the token response")
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, i.API+"/users/@me", nil); err != nil {
+		return token, "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	if err := i.do(req, &user); err != nil {
+		// The guild is what matters, the installer is only recorded
+		log.Println("Failed to look up who added the bot:", err)
+	}
+
+	return token, user.ID, nil
+}
+
+func (i *Invites) do(req *http.Request, v interface{}) error {
+	resp, err := i.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInviteState(t *testing.T) {
+	i := &Invites{Secret: "secret"}
+	now := time.Now()
+
+	state := i.state(now)
+	if !i.validState(state, now.Add(time.Minute)) {
+		t.Error("expected a fresh state to be valid")
+	}
+	if i.validState(state, now.Add(time.Hour)) {
+		t.Error("expected an old state to be refused")
+	}
+	if forged := (&Invites{Secret: "other"}).state(now); i.validState(forged, now) {
+		t.Error("expected a state signed by someone else to be refused")
+	}
+	if i.validState("garbage", now) {
+		t.Error("expected a malformed state to be refused")
+	}
+
+	u, err := url.Parse(i.AuthorizeURL(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := u.Query(); q.Get("scope") != inviteScopes || q.Get("state") != state || q.Get("permissions") != "309237771264" {
+		t.Errorf("unexpected authorize URL %v", u)
+	}
+}
+
+func TestInviteCallback(t *testing.T) {
+	discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			if id, secret, _ := r.BasicAuth(); id != "app" || secret != "secret" || r.FormValue("code") != "code" {
+				http.Error(w, "bad credentials", http.StatusUnauthorized)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"access_token": "token", "guild": map[string]string{"id": "g1", "name": "Degens"}})
+		case "/users/@me":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				http.Error(w, "bad token", http.StatusUnauthorized)
+				return
+			}
+			writeJSON(w, map[string]string{"id": "u1"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer discord.Close()
+
+	tenants, err := LoadTenants(filepath.Join(t.TempDir(), "tenants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Invites{ClientID: "app", Secret: "secret", API: discord.URL, Client: discord.Client(), Tenants: tenants}
+	mux := http.NewServeMux()
+	i.handle(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/invite/callback?code=code&state=forged", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a forged state to be refused, got %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/invite/callback?code=code&state="+i.state(time.Now()), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Degens") {
+		t.Fatalf("expected the invite to complete, got %v: %v", w.Code, w.Body)
+	}
+	if tenant, ok := tenants.Tenant("g1"); !ok || tenant.Name != "Degens" || tenant.Installer != "u1" {
+		t.Errorf("expected the guild to be a tenant, got %+v", tenant)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	_ "github.com/lib/pq" // Postgres driver
+)
+
+// leaderInterval is how often the leader checks it still holds the lock and followers try to take it.
+const leaderInterval = 5 * time.Second
+
+type (
+	// Leader elects a single replica through a Postgres advisory lock. The lock belongs to the session,
+	// so when the leader dies its connection drops and a follower takes over on its next attempt.
+	Leader struct {
+		DSN    string
+		LockID int64
+
+		leading int32
+	}
+
+	// LeaderSink only delivers while this replica is the leader, so standby replicas follow the feed
+	// and keep their state warm without posting.
+	LeaderSink struct {
+		Sink
+		Leader *Leader
+	}
+)
+
+// IsLeader reports whether this replica currently holds the lock.
+func (l *Leader) IsLeader() bool {
+	return atomic.LoadInt32(&l.leading) == 1
+}
+
+// Run campaigns for the lock until ctx is done.
+func (l *Leader) Run(ctx context.Context) {
+	db, err := sql.Open("postgres", l.DSN)
+	if err != nil {
+		ops.Alert("leader", "Leader election is unavailable, staying a follower: %v", err)
+		return
+	}
+	defer db.Close()
+
+	// The lock belongs to the session, so a connection given back to the pool would keep holding
+	// it: close them instead
+	db.SetMaxIdleConns(0)
+
+	for {
+		if err := l.campaign(ctx, db); err != nil {
+			ops.Alert("leader", "Leader election failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(leaderInterval):
+		}
+	}
+}
+
+// campaign tries to take the lock and holds it for as long as the connection lasts or until ctx
+// is done, releasing it on stepping down.
+func (l *Leader) campaign(ctx context.Context, db *sql.DB) error {
+	connectCtx, cancel := context.WithTimeout(ctx, leaderInterval)
+	conn, err := db.Conn(connectCtx)
+	cancel()
+	if err != nil {
+		return errwrap.Wrapf("could not connect: {{err}}", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	lockCtx, cancel := context.WithTimeout(ctx, leaderInterval)
+	err = conn.QueryRowContext(lockCtx, "SELECT pg_try_advisory_lock($1)", l.LockID).Scan(&locked)
+	cancel()
+	if err != nil {
+		return errwrap.Wrapf("could not take the lock: {{err}}", err)
+	}
+	if !locked {
+		return nil
+	}
+
+	l.setLeading(true)
+	defer l.setLeading(false)
+	defer l.unlock(conn)
+
+	ticker := time.NewTicker(leaderInterval)
+	defer ticker.Stop()
+
+	// Step down as soon as the connection can't be vouched for, since the lock may be gone with it
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, leaderInterval)
+		_, err := conn.ExecContext(pingCtx, "SELECT 1")
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			return errwrap.Wrapf("lost the lock: {{err}}", err)
+		}
+	}
+}
+
+// unlock releases the lock held on the connection, so a follower can take it over right away
+// rather than once the connection times out.
+func (l *Leader) unlock(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaderInterval)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.LockID); err != nil {
+		log.Println("Failed to release the leader lock:", err)
+	}
+}
+
+func (l *Leader) setLeading(leading bool) {
+	var value int32
+	if leading {
+		value = 1
+	}
+	if atomic.SwapInt32(&l.leading, value) == value {
+		return
+	}
+
+	metrics.Gauge("rekt_leader").Set(float64(value))
+	if leading {
+		log.Println("Became the leader")
+	} else {
+		log.Println("No longer the leader")
+	}
+}
+
+// followLeader gates the sink on the leader, when there is one.
+func followLeader(leader *Leader, sink Sink) Sink {
+	if leader == nil {
+		return sink
+	}
+	return &LeaderSink{Sink: sink, Leader: leader}
+}
+
+// Publish implements Sink.
+func (s *LeaderSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	if !s.Leader.IsLeader() {
+		return nil
+	}
+	return s.Sink.Publish(ctx, dl)
+}
+
+// Amend implements Amender.
+func (s *LeaderSink) Amend(ctx context.Context, l Liquidation) error {
+	if !s.Leader.IsLeader() {
+		return nil
+	}
+	return amend(ctx, s.Sink, l)
+}
+
+// Announce implements Sink.
+func (s *LeaderSink) Announce(ctx context.Context, text string) error {
+	if !s.Leader.IsLeader() {
+		return nil
+	}
+	return s.Sink.Announce(ctx, text)
+}
+
+// Post implements Poster.
+func (s *LeaderSink) Post(ctx context.Context, post Post) error {
+	if !s.Leader.IsLeader() {
+		return nil
+	}
+	return sendPost(ctx, s.Sink, post)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// PriceRange keeps the high and low mark price of every symbol over the lookback, fed from the
+	// instrument table. It stands in for the entry price of the liquidated positions, which BitMex doesn't tell.
+	PriceRange struct {
+		Lookback time.Duration
+
+		mu      sync.Mutex
+		symbols map[Symbol][]priceBucket
+	}
+
+	// priceBucket is the range of a minute, so the history stays small however busy the table is.
+	priceBucket struct {
+		start     time.Time
+		low, high float64
+	}
+)
+
+// Leverage brackets messages are tagged with, the usual presets of the exchanges.
+var leverageBrackets = []float64{1, 2, 3, 5, 10, 25, 50, 100}
+
+// NewPriceRange returns a price range over the given lookback.
+func NewPriceRange(lookback time.Duration) *PriceRange {
+	return &PriceRange{
+		Lookback: lookback,
+		symbols:  make(map[Symbol][]priceBucket),
+	}
+}
+
+// Handle is the TableHandler of the instrument table, whose updates only carry the fields that changed.
+func (r *PriceRange) Handle(action string, rows []interface{}, received time.Time) {
+	for _, row := range rows {
+		row, _ := row.(map[string]interface{})
+		symbol, _ := row["symbol"].(string)
+		if price, ok := row["markPrice"].(float64); ok && symbol != "" {
+			r.Observe(Symbol(symbol), price, received)
+		}
+	}
+}
+
+// Observe records a mark price.
+func (r *PriceRange) Observe(symbol Symbol, price float64, now time.Time) {
+	if price <= 0 {
+		return
+	}
+	start := now.Truncate(time.Minute)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buckets := r.symbols[symbol]
+	for len(buckets) > 0 && now.Sub(buckets[0].start) > r.Lookback {
+		buckets = buckets[1:]
+	}
+
+	if last := len(buckets) - 1; last >= 0 && buckets[last].start.Equal(start) {
+		if price < buckets[last].low {
+			buckets[last].low = price
+		}
+		if price > buckets[last].high {
+			buckets[last].high = price
+		}
+	} else {
+		buckets = append(buckets, priceBucket{start: start, low: price, high: price})
+	}
+	r.symbols[symbol] = buckets
+}
+
+// Range returns the low and high over the lookback, false when there were no prices.
+func (r *PriceRange) Range(symbol Symbol, now time.Time) (low, high float64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, bucket := range r.symbols[symbol] {
+		if now.Sub(bucket.start) > r.Lookback {
+			continue
+		}
+		if !ok || bucket.low < low {
+			low = bucket.low
+		}
+		if !ok || bucket.high > high {
+			high = bucket.high
+		}
+		ok = true
+	}
+
+	return low, high, ok
+}
+
+// inferLeverage guesses the leverage bracket of a position liquidated at price, assuming it was opened
+// at the far end of the recent range: the top for longs, the bottom for shorts. Entering anywhere else
+// takes more leverage, so the guess errs low. It returns 0 when the range says nothing.
+func inferLeverage(long bool, price, low, high, maintMargin float64) float64 {
+	var distance float64
+	if long && high > 0 {
+		distance = (high - price) / high
+	} else if !long && low > 0 {
+		distance = (price - low) / low
+	}
+	if distance <= 0 {
+		return 0
+	}
+
+	// The position is liquidated once the loss leaves only the maintenance margin of the initial margin
+	leverage := 1 / (distance + maintMargin)
+
+	bracket := 0.0
+	for _, b := range leverageBrackets {
+		if b <= leverage {
+			bracket = b
+		}
+	}
+	return bracket
+}
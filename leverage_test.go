@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceRange(t *testing.T) {
+	r := NewPriceRange(time.Hour)
+	now := time.Unix(1500000000, 0)
+
+	r.Handle("update", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "markPrice": 10000.0},
+		map[string]interface{}{"symbol": "XBTUSD", "fundingRate": 0.0001}, // Not a price update
+	}, now.Add(-2*time.Hour))
+	r.Observe("XBTUSD", 9500, now.Add(-30*time.Minute))
+	r.Observe("XBTUSD", 9800, now.Add(-30*time.Minute))
+	r.Observe("XBTUSD", 9000, now)
+
+	low, high, ok := r.Range("XBTUSD", now)
+	if !ok || low != 9000 || high != 9800 {
+		t.Errorf("expected 9000 - 9800 within the hour, got %v - %v (%v)", low, high, ok)
+	}
+
+	if _, _, ok := r.Range("ETHUSD", now); ok {
+		t.Error("expected no range for a symbol without prices")
+	}
+}
+
+func TestInferLeverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		long     bool
+		price    float64
+		leverage float64
+	}{
+		{"long 1.5% off the top", true, 9850, 50},
+		{"long 9% off the top", true, 9100, 10},
+		{"short 3.5% off the bottom", false, 9315, 25},
+		{"long above the top", true, 10100, 0},
+	}
+
+	for _, test := range tests {
+		if leverage := inferLeverage(test.long, test.price, 9000, 10000, 0.005); leverage != test.leverage {
+			t.Errorf("%v: expected %vx, got %vx", test.name, test.leverage, leverage)
+		}
+	}
+}
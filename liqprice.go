@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	humanize "github.com/dustin/go-humanize"
+)
+
+// liqPriceCommand is /liqprice, an approximate liquidation price calculator for isolated positions.
+func liqPriceCommand(instruments *InstrumentCache, prices *PriceCache) *SlashCommand {
+	minLeverage := 1.0
+
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "liqprice",
+			Description: "Approximate liquidation price of an isolated position",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionNumber, Name: "leverage", Description: "Leverage", Required: true, MinValue: &minLeverage, MaxValue: 100},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "side", Description: "Position side", Required: true, Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "long", Value: "long"},
+					{Name: "short", Value: "short"},
+				}},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "symbol", Description: "Contract, XBTUSD by default"},
+				{Type: discordgo.ApplicationCommandOptionNumber, Name: "entry", Description: "Entry price, the mark price by default"},
+			},
+		},
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			leverage := req.Float("leverage", 1)
+			side := req.String("side", "long")
+			symbol := Symbol(strings.ToUpper(req.String("symbol", "XBTUSD")))
+			entry := req.Float("entry", 0)
+			if entry == 0 {
+				q, _ := prices.Get("BitMex", symbol)
+				mark, ok := q.Price(time.Now(), maxPriceAge)
+				if !ok {
+					return nil, fmt.Errorf("no recent price of %v, give the entry price", symbol)
+				}
+				entry = mark
+			}
+
+			instrument, err := instruments.Get(symbol)
+			if err != nil {
+				return nil, err
+			}
+
+			price, err := liquidationPrice(instrument, entry, leverage, side == "long")
+			if err != nil {
+				return nil, err
+			}
+
+			content := fmt.Sprintf("A %vx %v on %v from %v gets liquidated around **%v** (maintenance margin %v%%, taker fee %v%%)",
+				leverage, side, symbol, humanize.Commaf(entry), humanize.Commaf(price),
+				instrument.MaintMargin*100, instrument.TakerFee*100)
+			if now := time.Now(); instrument.Stale(now) {
+				content += fmt.Sprintf("\n⚠️ BitMex can't be reached, the margin parameters are from %v ago", durationText(now.Sub(instrument.Fetched).Round(time.Minute)))
+			}
+
+			return &discordgo.InteractionResponseData{Content: content}, nil
+		},
+	}
+}
+
+// liquidationPrice approximates where an isolated position gets liquidated: once the loss eats the initial margin
+// down to the maintenance margin plus the fee to close. Funding and risk limit steps are ignored.
+func liquidationPrice(instrument Instrument, entry, leverage float64, long bool) (float64, error) {
+	if entry <= 0 || leverage <= 0 {
+		return 0, errors.New("entry and leverage must be positive")
+	}
+
+	initMargin := 1 / leverage
+	maintMargin := instrument.MaintMargin + instrument.TakerFee
+	if initMargin <= maintMargin {
+		return 0, fmt.Errorf("%vx is above the maximum leverage for %v", leverage, instrument.Symbol)
+	}
+
+	var price float64
+	switch {
+	// Inverse contracts are margined in the coin, so the loss is measured in 1/price
+	case instrument.IsInverse && long:
+		price = entry / (1 + initMargin - maintMargin)
+	case instrument.IsInverse:
+		price = entry / (1 - initMargin + maintMargin)
+	case long:
+		price = entry * (1 - initMargin + maintMargin)
+	default:
+		price = entry * (1 + initMargin - maintMargin)
+	}
+
+	if instrument.TickSize > 0 {
+		price = math.Round(price/instrument.TickSize) * instrument.TickSize
+	}
+
+	return price, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLiquidationPrice(t *testing.T) {
+	xbtusd := Instrument{Symbol: "XBTUSD", MaintMargin: 0.0035, TakerFee: 0.00075, TickSize: 0.5, IsInverse: true}
+	ethusdt := Instrument{Symbol: "ETHUSDT", MaintMargin: 0.01, TakerFee: 0.00075, TickSize: 0.05}
+
+	tests := []struct {
+		instrument Instrument
+		entry      float64
+		leverage   float64
+		long       bool
+		expected   float64
+	}{
+		{xbtusd, 45000, 25, true, 43447},
+		{xbtusd, 45000, 25, false, 46668.5},
+		{xbtusd, 10000, 2, false, 19831.5},
+		{ethusdt, 3000, 10, true, 2732.25},
+		{ethusdt, 3000, 10, false, 3267.75},
+	}
+
+	for _, test := range tests {
+		price, err := liquidationPrice(test.instrument, test.entry, test.leverage, test.long)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if math.Abs(price-test.expected) > 1e-6 {
+			t.Errorf("%v %vx long=%v from %v: expected %v, got %v",
+				test.instrument.Symbol, test.leverage, test.long, test.entry, test.expected, price)
+		}
+	}
+
+	if _, err := liquidationPrice(xbtusd, 45000, 500, true); err == nil {
+		t.Error("expected leverage above the maximum to be refused")
+	}
+}
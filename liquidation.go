@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
-
-	humanize "github.com/dustin/go-humanize"
+	"time"
 )
 
 type (
@@ -17,24 +21,175 @@ type (
 		Quantity int64
 		Symbol   Symbol
 		Side     string
+		Exchange string
+		OrderID  string // Identifies the order on the exchange, when it tells
+		Reported bool   // Posted to the inbox by another source rather than received from the exchange
+
+		Received time.Time // When the liquidation reached us, for latency tracking
+
+		// Historical is set on the liquidations backfilled or replayed rather than received live.
+		// The sinks storing them keep them, those posting about them leave them out.
+		Historical bool
+
+		Display    string // Name shown in messages, the symbol when empty
+		Underlying string // Asset the contract tracks
+		Emoji      string // Shown in front of the messages, when set
+
+		// Value computed from the instrument's contract specification, when it is known
+		USD      float64 // Notional in USD
+		CoinQty  float64 // Quantity of the underlying coin
+		Coin     string  // Underlying coin, as the exchange names it
+		Loss     float64 // Estimated loss of the liquidated trader in USD, zero when unknown
+		Leverage float64 // Inferred leverage bracket of the position, zero when unknown
+
+		Expiry time.Time // Expiry of futures contracts, zero otherwise or when unknown
+
+		Depeg string // Rate of the stable coin pair off its peg, when the contract is quoted in one of them
 	}
 )
 
 // String implements Stringer.
 func (l Liquidation) String() string {
-	var position string
+	return l.Format(DefaultFormat)
+}
+
+// Format writes the liquidation with the numbers in the given format.
+func (l Liquidation) Format(f NumberFormat) string {
+	buf := getBuffer()
+	defer buffers.Put(buf)
+
+	l.writeTo(buf, f)
+	return buf.String()
+}
+
+// writeTo writes the liquidation piece by piece, as it is on the path of every message.
+func (l Liquidation) writeTo(buf *bytes.Buffer, f NumberFormat) {
+	if l.Emoji != "" {
+		buf.WriteString(l.Emoji)
+		buf.WriteByte(' ')
+	}
+
+	// Liquidated short on XBTUSD: Buy 130,170 @ 772.02
+	buf.WriteString("Liquidated ")
+	if l.Leverage > 0 {
+		// Liquidated ~50x short on XBTUSD: Buy 130,170 @ 772.02
+		buf.WriteByte('~')
+		buf.WriteString(strconv.FormatFloat(l.Leverage, 'g', -1, 64))
+		buf.WriteString("x ")
+	}
+	buf.WriteString(l.Position())
+	buf.WriteString(" on ")
+	buf.WriteString(l.DisplayName())
+	buf.WriteString(": ")
+	buf.WriteString(l.Side)
+	buf.WriteByte(' ')
+	buf.WriteString(l.formatQuantity(f))
+	buf.WriteString(" @ ")
+	buf.WriteString(f.Price(l.Price))
+
+	if l.Depeg != "" {
+		// Liquidated long on XBTUSDT: Sell 5,000 @ 60000 ⚠️ depeg: USDC/USDT at 0.9650
+		buf.WriteString(" ⚠️ depeg: ")
+		buf.WriteString(l.Depeg)
+	}
+}
+
+// Stages of the events about a liquidation, the last part of their idempotency keys
+const (
+	StagePosted  = "posted"
+	StageAmended = "amended"
+)
+
+// IdempotencyKey identifies the event about the liquidation at the stage, the same across the
+// retries and the restarts of the bot, for the consumers to dedupe on: "bitmex:<order ID>:posted".
+// A hash of the details of the liquidation stands in for the order ID when the exchange has none,
+// leaving out when it was received, which differs between the bots and across the replays.
+func (l Liquidation) IdempotencyKey(stage string) string {
+	id := l.OrderID
+	if id == "" {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%v|%v|%v|%v", l.Symbol, l.Side, l.Price, l.Quantity)))
+		id = hex.EncodeToString(sum[:8])
+	}
+	return strings.ToLower(l.Exchange) + ":" + id + ":" + stage
+}
+
+// ScoreKey is what the high scores and streaks are kept under. Futures count together under
+// their underlying so the records carry over when the contracts roll.
+func (l Liquidation) ScoreKey() Symbol {
+	if !l.Expiry.IsZero() && l.Underlying != "" {
+		return Symbol(l.Underlying + " futures")
+	}
+	return l.Symbol
+}
+
+// Asset returns the underlying asset, the one every contract and exchange on it counts towards.
+func (l Liquidation) Asset() string {
+	if l.Underlying != "" {
+		return l.Underlying
+	}
+	return inferSymbol(l.Symbol).Underlying
+}
+
+// Position returns the side of the position that was liquidated: buying closes a short.
+func (l Liquidation) Position() string {
 	if l.Side == "Buy" {
-		position = "short"
-	} else {
-		position = "long"
+		return "short"
+	}
+	return "long"
+}
+
+// DisplayName returns the name of the contract as shown in messages.
+func (l Liquidation) DisplayName() string {
+	if l.Display != "" {
+		return l.Display
+	}
+	return string(l.Symbol)
+}
+
+// formatQuantity writes the size in the quantities asked for, the first leading and the others in parentheses.
+func (l Liquidation) formatQuantity(f NumberFormat) string {
+	show := f.Show
+	if len(show) == 0 {
+		return f.Int(l.Quantity)
+	}
+
+	var parts []string
+	for _, quantity := range show {
+		switch quantity {
+		case ShowContracts:
+			if len(show) == 1 {
+				parts = append(parts, f.Int(l.Quantity))
+			} else {
+				parts = append(parts, f.Int(l.Quantity)+" contracts")
+			}
+		case ShowUSD:
+			if usd := l.USDValue(); usd > 0 {
+				parts = append(parts, f.USD(usd))
+			}
+		case ShowCoin:
+			if amount, coin := l.CoinValue(); amount > 0 {
+				parts = append(parts, f.Coin(amount, coin))
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return f.Int(l.Quantity)
+	}
+	if len(parts) == 1 {
+		return parts[0]
 	}
 
-	// Liquidated short on XBTUSD: Buy 130170 @ 772.02
-	return fmt.Sprintf("Liquidated %v on %v: %v %v @ %v", position, l.Symbol, l.Side, humanize.Comma(l.Quantity), l.Price)
+	return parts[0] + " (" + strings.Join(parts[1:], ", ") + ")"
 }
 
 // USDValue returns the USD value of the liquidation.
 func (l Liquidation) USDValue() int64 {
+	if l.USD > 0 {
+		return int64(math.Round(l.USD))
+	}
+
+	// Without the instrument, guess from the symbol
 	if strings.HasPrefix(string(l.Symbol), "XBT") {
 		return l.Quantity
 	}
@@ -51,3 +206,17 @@ func (l Liquidation) USDValue() int64 {
 
 	return 0
 }
+
+// CoinValue returns the amount of coin the liquidation is worth and which coin that is.
+func (l Liquidation) CoinValue() (float64, string) {
+	if l.CoinQty > 0 {
+		return l.CoinQty, l.Coin
+	}
+
+	// XBT contracts are worth a dollar each
+	if strings.HasPrefix(string(l.Symbol), "XBT") && l.Price > 0 {
+		return float64(l.USDValue()) / l.Price, "XBT"
+	}
+
+	return 0, ""
+}
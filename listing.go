@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// ListingWatcher follows the listed perpetuals on each refresh of the instruments, so the filters
+// limited to some symbols can take in every perpetual, the ones listed later included, without a
+// config update. With Announce set, the new listings are announced.
+type ListingWatcher struct {
+	Symbols  *SymbolMap
+	Announce func(text string)
+
+	mu         sync.Mutex
+	perpetuals map[Symbol]bool // Listed, nil until the first poll
+}
+
+// Perpetual instrument type
+const perpetualTyp = "FFWCSX"
+
+// listings are the perpetuals the filters with perpetuals on take in, none until they are watched.
+var listings = &ListingWatcher{}
+
+// IsPerpetual tells whether the contract is a perpetual swap.
+func (i Instrument) IsPerpetual() bool {
+	return i.Typ == perpetualTyp
+}
+
+// Observe is the OnRefresh of the InstrumentCache, taking note of the listed perpetuals and
+// announcing the new ones.
+func (w *ListingWatcher) Observe(active []Instrument) {
+	for _, notice := range w.update(active) {
+		if w.Announce != nil {
+			w.Announce(notice)
+		}
+	}
+}
+
+// update takes note of the perpetuals in the active instruments and returns the notices of those
+// listed since the previous poll. The first poll only takes note of what is listed.
+func (w *ListingWatcher) update(active []Instrument) []string {
+	perpetuals := make(map[Symbol]bool)
+	for _, instrument := range active {
+		if instrument.IsPerpetual() {
+			perpetuals[instrument.Symbol] = true
+		}
+	}
+
+	w.mu.Lock()
+	previous := w.perpetuals
+	w.perpetuals = perpetuals
+	w.mu.Unlock()
+	metrics.Gauge("rekt_listed_perpetuals").Set(float64(len(perpetuals)))
+
+	if previous == nil {
+		return nil
+	}
+
+	var listed []string
+	for symbol := range perpetuals {
+		if !previous[symbol] {
+			listed = append(listed, string(symbol))
+		}
+	}
+	sort.Strings(listed)
+
+	var notices []string
+	for _, symbol := range listed {
+		log.Println("New perpetual listed:", symbol)
+		notices = append(notices, fmt.Sprintf("🆕 %v is now listed on BitMex", w.name(Symbol(symbol))))
+	}
+	return notices
+}
+
+// Listed reports whether the symbol is a listed perpetual, as of the last poll.
+func (w *ListingWatcher) Listed(symbol Symbol) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.perpetuals[symbol]
+}
+
+func (w *ListingWatcher) name(symbol Symbol) string {
+	if w.Symbols != nil {
+		return w.Symbols.Lookup(symbol).Display
+	}
+	return string(symbol)
+}
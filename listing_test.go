@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListingWatcher(t *testing.T) {
+	xbt := Instrument{Symbol: "XBTUSD", Typ: perpetualTyp}
+	sol := Instrument{Symbol: "SOLUSDT", Typ: perpetualTyp}
+	future := Instrument{Symbol: "XBTZ24", Typ: futuresTyp}
+
+	w := &ListingWatcher{}
+	if notices := w.update([]Instrument{xbt, future}); notices != nil {
+		t.Fatalf("expected no notices on the first poll, got %q", notices)
+	}
+
+	expected := []string{"🆕 SOLUSDT is now listed on BitMex"}
+	if notices := w.update([]Instrument{xbt, future, sol}); !reflect.DeepEqual(notices, expected) {
+		t.Fatalf("expected %q, got %q", expected, notices)
+	}
+	if !w.Listed("SOLUSDT") || w.Listed("XBTZ24") {
+		t.Error("expected only the perpetuals to be listed")
+	}
+
+	// Filters limited to some symbols take in the listed perpetuals when asked to
+	old := listings
+	defer func() { listings = old }()
+	listings = w
+
+	f := Filter{Symbols: []Symbol{"XBTUSD"}}
+	if f.Match(Liquidation{Symbol: "SOLUSDT"}, nil) {
+		t.Error("expected the new listing to be filtered out by default")
+	}
+	f.Perpetuals = true
+	if !f.Match(Liquidation{Symbol: "SOLUSDT"}, nil) || f.Match(Liquidation{Symbol: "XBTZ24"}, nil) {
+		t.Error("expected the new perpetual, and only it, to be let through")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// logFlags are the flags of every logger.
+const logFlags = log.Lshortfile | log.LstdFlags | log.Lmicroseconds
+
+// The verbose logs, going along with the main log until setupLogs gives them files of their own.
+var (
+	debugLog = log.Default() // Details only worth reading when something is off
+	rawLog   = log.Default() // Every frame received from BitMex
+)
+
+// RotatingFile is a log file that is rotated once it grows past MaxSize or gets older than
+// MaxAge, keeping the MaxBackups most recent rotations next to it.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64         // Bytes, 0 for no limit
+	MaxAge     time.Duration // 0 for no limit
+	MaxBackups int           // 0 to keep them all
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// OpenRotatingFile opens the log file for appending, creating it and its directory as needed.
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{Path: path, MaxSize: maxSize, MaxAge: maxAge, MaxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write implements io.Writer, rotating the file first when it is due.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	full := f.MaxSize > 0 && f.size+int64(len(p)) > f.MaxSize && f.size > 0
+	old := f.MaxAge > 0 && time.Since(f.created) > f.MaxAge
+	if full || old {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the current file rather than losing the lines
+			fmt.Fprintln(os.Stderr, "Failed to rotate the log:", err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// The modification time stands in for the creation time an existing file doesn't tell
+	f.file, f.size, f.created = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		f.created = info.ModTime()
+	}
+	return nil
+}
+
+// rotate renames the current file with the time as a suffix, starts a new one and prunes the old ones.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	backup := f.Path + "." + time.Now().UTC().Format("20060102T150405.000")
+	if err := os.Rename(f.Path, backup); err != nil {
+		f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	return f.prune()
+}
+
+// prune removes the rotated files beyond MaxBackups, the oldest first.
+func (f *RotatingFile) prune() error {
+	if f.MaxBackups <= 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(f.Path))
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	prefix := filepath.Base(f.Path) + "."
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) {
+			backups = append(backups, entry.Name())
+		}
+	}
+
+	// The suffixes sort in time order
+	sort.Strings(backups)
+	for len(backups) > f.MaxBackups {
+		if err := os.Remove(filepath.Join(filepath.Dir(f.Path), backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// setupLogs sends the main, debug and raw frame logs where the config says, returning what to
+// close on exit.
+func setupLogs(cfg BotConfig) (io.Closer, error) {
+	var files multiCloser
+	open := func(path string) (io.Writer, error) {
+		f, err := OpenRotatingFile(path, int64(cfg.LogMaxSizeMB)<<20, cfg.LogMaxAge.Duration, cfg.LogMaxBackups)
+		if err != nil {
+			return nil, errwrap.Wrapf("could not open the log file: {{err}}", err)
+		}
+		files = append(files, f)
+		return f, nil
+	}
+
+	var main []io.Writer
+	if cfg.LogConsole || cfg.LogFile == "" {
+		main = append(main, os.Stderr)
+	}
+	if cfg.LogFile != "" {
+		f, err := open(cfg.LogFile)
+		if err != nil {
+			return files, err
+		}
+		main = append(main, f)
+	}
+	log.SetOutput(io.MultiWriter(main...))
+
+	debugLog, rawLog = log.Default(), log.Default()
+	if cfg.DebugLogFile != "" {
+		f, err := open(cfg.DebugLogFile)
+		if err != nil {
+			return files, err
+		}
+		debugLog = log.New(f, "", logFlags)
+	}
+	if cfg.RawLogFile != "" {
+		f, err := open(cfg.RawLogFile)
+		if err != nil {
+			return files, err
+		}
+		rawLog = log.New(f, "", log.LstdFlags|log.Lmicroseconds)
+	}
+	if !cfg.LogRawFrames {
+		rawLog = log.New(ioutil.Discard, "", 0)
+	}
+
+	return files, nil
+}
+
+// multiCloser closes all of the files.
+type multiCloser []io.Closer
+
+// Close implements io.Closer.
+func (c multiCloser) Close() error {
+	var first error
+	for _, closer := range c {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rekt.log")
+
+	f, err := OpenRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // Tell the rotations apart
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "fourth\n" {
+		t.Errorf("expected the current file to only have the last line, got %q", data)
+	}
+
+	// first, second and third were rotated out, the oldest pruned
+	matches, _ := filepath.Glob(path + ".*")
+	sort.Strings(matches)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 backups kept, got %v", matches)
+	}
+	if data, _ := ioutil.ReadFile(matches[0]); string(data) != "second\n" {
+		t.Errorf("expected the oldest backup kept to have the second line, got %q", data)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raw.log")
+	f, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("yesterday\n"))
+	f.created = time.Now().Add(-2 * time.Hour)
+	f.Write([]byte("today\n"))
+
+	data, _ := ioutil.ReadFile(path)
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 1 || strings.TrimSpace(string(data)) != "today" {
+		t.Errorf("expected the old file to be rotated, got %v and %q", matches, data)
+	}
+}
@@ -1,212 +1,538 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"math/rand"
-	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/gorilla/websocket"
 	"github.com/hashicorp/errwrap"
 )
 
-// BotConfig store the bot configuration.
-type BotConfig struct {
-	BitMexHost     string `json:"bitmex_host"`
-	DiscordToken   string `json:"discord_token"`
-	DiscordChannel string `json:"discord_channel"`
+// commands are the subcommands available besides running the bot.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"backup":   backupCommand,
+	"config":   configCommand,
+	"init":     initCommand,
+	"record":   recordCommand,
+	"replay":   replayCommand,
+	"restore":  restoreCommand,
+	"schema":   schemaCommand,
+	"selftest": selftestCommand,
+	"service":  serviceCommand,
+	"version":  versionCommand,
 }
 
-func loadConfig() (config BotConfig, err error) {
-	configPath := os.Getenv("CONFIG")
-	if configPath == "" {
-		configPath = "config.json"
+// parseFlags parses flags that may appear before or after the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) (positional []string, err error) {
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
+}
 
-	file, err := os.Open(configPath)
+// runCommand runs the bot until the context is done: rekt [--fake-feed]
+func runCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rekt", flag.ExitOnError)
+	fakeFeed := fs.Bool("fake-feed", false, "post generated liquidations instead of the BitMex feed")
+	fake := NewFakeFeed(nil)
+	fake.RegisterFlags(fs)
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *fakeFeed {
+		if err := fake.Check(); err != nil {
+			return err
+		}
+	}
+
+	build := buildInfo()
+	log.Println("Starting", build)
+	metrics.Gauge("rekt_build_info", "version", build.Version, "commit", build.Commit).Set(1)
+
+	cfg, err := loadConfig()
 	if err != nil {
-		return config, err
+		return errwrap.Wrapf("unable to load config: {{err}}", err)
 	}
 
-	if err := json.NewDecoder(file).Decode(&config); err != nil {
-		return config, err
+	logs, err := setupLogs(cfg)
+	defer logs.Close()
+	if err != nil {
+		return err
 	}
 
-	return config, nil
-}
+	state, err := NewState()
+	if err != nil {
+		return errwrap.Wrapf("failed to load state: {{err}}", err)
+	}
+	state.Fsync = cfg.StateFsync
 
-// Constants for Websocket
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
+	proxy, err := newProxy(cfg.Proxy)
+	if err != nil {
+		return errwrap.Wrapf("invalid proxy: {{err}}", err)
+	}
 
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
+	discord, err := discordgo.New("Bot " + cfg.DiscordToken)
+	if err != nil {
+		return errwrap.Wrapf("unable to run discord: {{err}}", err)
+	}
+	useProxy(discord, proxy)
+	if err := discord.Open(); err != nil {
+		return errwrap.Wrapf("unable to run discord: {{err}}", err)
+	}
 
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-)
+	ops.Session = discord
+	ops.Channel = cfg.OpsChannel
+	ops.WebhookURL = cfg.OpsWebhook
+	ops.Client = newHTTPClient(proxy)
+	ops.Label = cfg.Label()
+
+	if cfg.OTLPEndpoint != "" {
+		traces.Endpoint = cfg.OTLPEndpoint
+		traces.Client = newHTTPClient(proxy)
+		go traces.Run(5 * time.Second)
+	}
+
+	var tenants *Tenants
+	if cfg.Hosted {
+		if tenants, err = LoadTenants(cfg.TenantsFile); err != nil {
+			return errwrap.Wrapf("failed to load the tenants: {{err}}", err)
+		}
+		tenants.Defaults, tenants.MaxChannels, tenants.MessagesPerHour = cfg.TenantDefaults, cfg.TenantMaxChannels, cfg.TenantMessages
+		invites.ClientID, invites.Secret, invites.RedirectURL = cfg.OAuthClientID, cfg.OAuthSecret, cfg.OAuthRedirectURL
+		invites.Client, invites.Tenants = newHTTPClient(proxy), tenants
+	}
+
+	if cfg.HTTPAddr != "" {
+		go serveHTTP(cfg)
+	}
+
+	var leader *Leader
+	if cfg.LeaderPostgres != "" {
+		leader = &Leader{DSN: cfg.LeaderPostgres, LockID: cfg.LeaderLockID}
+		go leader.Run(ctx)
+	}
+
+	if err := startFX(ctx, cfg, newHTTPClient(proxy)); err != nil {
+		return err
+	}
+
+	instruments := NewInstrumentCache(cfg.BitMexHost, newHTTPClient(proxy))
+	prices := NewPriceCache()
+	var history *History
+	if cfg.HistoryFile != "" {
+		if history, err = OpenHistory(cfg.HistoryFile, cfg.HistoryRetention.Duration); err != nil {
+			return errwrap.Wrapf("failed to load history: {{err}}", err)
+		}
+		defer history.Close()
+		grafana.SetHistory(history)
 
-func runClient(cfg BotConfig, discord *discordgo.Session, state *State) error {
-	// Subscribe to the liquidation feed.
-	// https://www.bitmex.com/app/wsAPI
-	var u url.URL
-	u.Scheme = "wss"
-	u.Host = cfg.BitMexHost
-	u.Path = "realtime"
-	u.RawQuery = "subscribe=liquidation"
-
-	// Connect the websocket
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), http.Header{})
+		// Read from the first filter with an auto rate on
+		autoThresholds.History, autoThresholds.Window, autoThresholds.Interval = history, cfg.AutoWindow.Duration, autoThresholdInterval
+	}
+
+	var cards *RecordCard
+	if cfg.RecordCardUSD > 0 {
+		if cards, err = LoadRecordCard(cfg.RecordCardPNG); err != nil {
+			return errwrap.Wrapf("failed to load the record card template: {{err}}", err)
+		}
+	}
+
+	settings, err := LoadSettings(cfg.SettingsFile)
 	if err != nil {
-		return errwrap.Wrapf("could not connect to BitMex: {{err}}", err)
+		return errwrap.Wrapf("failed to load settings: {{err}}", err)
+	}
+	if tenants != nil {
+		tenants.Settings = settings
+	}
+
+	// The filters route by the tiers of the config, the reloads included
+	setTiers(cfg.Tiers)
+
+	newSink := func(cfg BotConfig, target Target) Sink {
+		var merge *Merger
+		if cfg.MergeWindow.Duration > 0 {
+			merge = &Merger{Window: cfg.MergeWindow.Duration, Tolerance: cfg.MergeTolerance}
+		}
+		pins := &DailyPin{Settings: settings, Default: cfg.PinDailyRecord}
+		if history != nil {
+			filter := settings.Filter(target.Channel, target.Filter)
+			pins.Seed(history, func(l Liquidation) bool { return filter.Match(l, prices) }, time.Now())
+		}
+		return followLeader(leader, metered(cfg, "discord:"+target.Channel, &DiscordSink{
+			Session:       discord,
+			Channel:       target.Channel,
+			Forum:         target.Forum,
+			Label:         cfg.Label(),
+			Format:        target.Format,
+			LatencyFooter: cfg.LatencyFooter,
+			Timestamps:    cfg.DiscordTimestamps,
+			LossMinUSD:    cfg.LossMinUSD,
+
+			AlertButtonUSD: cfg.AlertButtonUSD,
+			Cards:          cards,
+			CardMinUSD:     cfg.RecordCardUSD,
+			Pins:           pins,
+			Merge:          merge,
+		}))
 	}
 
-	log.Println("Connected to BitMex:", u.String())
+	audit, err := OpenAuditLog(cfg.AuditFile)
+	if err != nil {
+		return errwrap.Wrapf("failed to open the audit log: {{err}}", err)
+	}
+	defer audit.Close()
 
-	// Handle the pings
-	go func() {
-		ticker := time.NewTicker(pingPeriod)
-		defer func() {
-			ticker.Stop()
-			conn.Close()
-		}()
+	// /find searches the SQL store when there is one, the history otherwise
+	var finder Finder
+	if history != nil {
+		finder = history
+	}
 
-		for _ = range ticker.C {
-			conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-				return
+	var sinks []Sink
+	if cfg.AlertButtonUSD > 0 {
+		sinks = append(sinks, followLeader(leader, metered(cfg, "alerts", &AlertSink{Session: discord, Settings: settings, Format: cfg.DiscordFormat})))
+	}
+	if history != nil {
+		sinks = append(sinks, withFilter(cfg, prices, "history", metered(cfg, "history", history)))
+	}
+	if cfg.HTTPAddr != "" && cfg.HTTPDashboard {
+		dashboard.SetHistory(history, cfg.DiscordFormat)
+		sinks = append(sinks, withFilter(cfg, prices, "dashboard", metered(cfg, "dashboard", dashboard)))
+	}
+	if cfg.InfluxURL != "" {
+		influx := &InfluxSink{
+			URL:    cfg.InfluxURL,
+			Token:  cfg.InfluxToken,
+			Org:    cfg.InfluxOrg,
+			Bucket: cfg.InfluxBucket,
+			Client: newHTTPClient(proxy),
+		}
+		sinks = append(sinks, withFilter(cfg, prices, "influxdb", metered(cfg, "influxdb", newBreaker(cfg, "influxdb", influx))))
+	}
+	if cfg.TimescaleDSN != "" {
+		timescale, err := NewTimescaleSink(cfg.TimescaleDSN)
+		if err != nil {
+			return errwrap.Wrapf("unable to connect to TimescaleDB: {{err}}", err)
+		}
+		sinks = append(sinks, withFilter(cfg, prices, "timescaledb", followLeader(leader, metered(cfg, "timescaledb", newBreaker(cfg, "timescaledb", timescale)))))
+		finder = timescale
+	}
+	if cfg.ClickHouseURL != "" {
+		clickhouse, err := NewClickHouseSink(cfg, newHTTPClient(proxy))
+		if err != nil {
+			return errwrap.Wrapf("unable to connect to ClickHouse: {{err}}", err)
+		}
+		defer clickhouse.Close()
+		sinks = append(sinks, withFilter(cfg, prices, "clickhouse", followLeader(leader, metered(cfg, "clickhouse", clickhouse))))
+	}
+	if cfg.SheetsID != "" {
+		sheets, err := NewSheetsSink(cfg, newHTTPClient(proxy))
+		if err != nil {
+			return errwrap.Wrapf("unable to use the Google Sheet: {{err}}", err)
+		}
+		sinks = append(sinks, withFilter(cfg, prices, "sheets", followLeader(leader, metered(cfg, "sheets", newBreaker(cfg, "sheets", sheets)))))
+	}
+
+	slash := NewSlashCommands(discord, cfg.CommandGuild)
+	slash.Settings = settings
+	for name, cooldown := range cfg.CommandCooldowns {
+		slash.Cooldowns[name] = cooldown.Duration
+	}
+	if leader != nil {
+		slash.Active = leader.IsLeader
+	}
+	pages := NewPages(15 * time.Minute)
+	slash.AddComponent("page", pages.Handle)
+	slash.AddComponent("alert", alertButton(settings, cfg.DiscordFormat))
+	slash.Add(liqPriceCommand(instruments, prices))
+	slash.Add(priceCommand(prices))
+	slash.Add(aboutCommand())
+	slash.Add(statusCommand())
+	if history != nil {
+		slash.Add(exportCommand(history))
+		slash.Add(heatmapCommand(history, cfg.DiscordFormat))
+		slash.Add(breakdownCommand(history, pages, cfg.DiscordFormat))
+	}
+	if finder != nil {
+		slash.Add(findCommand(finder, pages, cfg.DiscordFormat))
+	}
+	reloader := &Reloader{Settings: settings, Static: sinks, NewSink: newSink, Tenants: tenants, Prices: prices}
+	reloader.StartFX = func(cfg BotConfig) error { return startFX(ctx, cfg, newHTTPClient(proxy)) }
+	slash.Add(rektCommand(reloader.Targets, settings, audit))
+	if tenants != nil {
+		slash.GuildQuota = cfg.TenantCommands
+		tenants.SetOnChange(reloader.Refresh)
+		slash.Add(tenantCommand(tenants, settings))
+		onboarding := &Onboarding{Tenants: tenants, Settings: settings, Instruments: instruments}
+		slash.AddComponent("setup", onboarding.Handle)
+		discord.AddHandler(onboarding.HandleGuildCreate)
+		discord.AddHandler(tenants.HandleGuildDelete)
+	}
+	if err := slash.Register(); err != nil {
+		ops.Alert("discord", "Slash commands are unavailable: %v", err)
+	}
+
+	quarantine := &Quarantine{Dir: cfg.QuarantineDir, Max: cfg.QuarantineMax}
+	pipeline := &Pipeline{
+		State:    state,
+		Overflow: cfg.Overflow,
+		Format:   cfg.DiscordFormat,
+		Symbols:  &SymbolMap{Aliases: cfg.Symbols, DisplayNames: cfg.DisplayNames},
+
+		Instruments: instruments,
+		Quotes:      prices,
+		Quarantine:  quarantine,
+		SinkTimeout: cfg.SinkTimeout.Duration,
+	}
+	if cfg.SymbolEmoji {
+		pipeline.Symbols.Emoji = cfg.Emoji
+		if pipeline.Symbols.Emoji == nil {
+			pipeline.Symbols.Emoji = make(map[string]string)
+		}
+	}
+	if cfg.DedupWindow.Duration > 0 {
+		pipeline.Dedup = NewDedup(cfg.DedupWindow.Duration)
+	}
+	if cfg.CrossVenueWindow.Duration > 0 {
+		pipeline.CrossVenue = NewCrossVenue(cfg.CrossVenueWindow.Duration)
+		pipeline.CrossVenue.Format = cfg.DiscordFormat
+		// The inbox sources reporting BitMex too would have it counted twice
+		pipeline.CrossVenue.Exclude = []string{"BitMex"}
+	}
+	reloader.Pipeline = pipeline
+	reloader.Load(cfg)
+	reloads = reloader
+	go reloader.WatchSignals()
+
+	pipeline.Start(ctx, cfg.Workers, cfg.QueueSize)
+	defer pipeline.Stop()
+	debugState.Register("pipeline", pipeline.DebugState)
+
+	if *fakeFeed {
+		// The fake contracts don't have instruments to value them with
+		pipeline.Instruments = nil
+		fake.Pipeline = pipeline
+		return fake.Run(ctx)
+	}
+
+	// The times BitMex was down, noted in the daily recaps
+	gaps := &Gaps{}
+
+	if history != nil && (cfg.DailyRecap || cfg.WeeklyRecap) {
+		recap := &Recap{History: history, Daily: cfg.DailyRecap, Weekly: cfg.WeeklyRecap, Format: cfg.DiscordFormat, Zones: settings.Zones, Gaps: gaps}
+		if cfg.ThirdPartyURL != "" {
+			// BitMex is left out of their totals, the recap already counting it
+			recap.ThirdParty = &ThirdPartyTotals{
+				URL:     cfg.ThirdPartyURL,
+				Name:    cfg.ThirdPartyName,
+				Headers: cfg.ThirdPartyHeaders,
+				Exclude: []string{"BitMex"},
+				Client:  newHTTPClient(proxy),
 			}
 		}
-	}()
+		if cfg.RecapReminder != "" {
+			recap.Reminder = &RecapReminder{Mode: cfg.RecapReminder}
+		}
+		if len(cfg.RecapHeatmaps) > 0 && cfg.DailyRecap {
+			recap.Heatmaps = &RecapHeatmaps{Symbols: cfg.RecapHeatmaps, Format: cfg.DiscordFormat}
+		}
+		inZone := func(zone *time.Location) func(Sink) bool {
+			return func(sink Sink) bool { return recapZone(discord, settings, sink).String() == zone.String() }
+		}
+		go recap.Run(func(text string, zone *time.Location) {
+			pipeline.AnnounceTo(text, inZone(zone))
+		}, func(post Post, zone *time.Location) {
+			pipeline.PostTo(post, inZone(zone))
+		})
+	}
 
-	// Handle the websocket read
-	conn.SetReadDeadline(time.Now().Add(pongWait))
-	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	if history != nil && cfg.TickerChannel != "" {
+		ticker := &VoiceTicker{Session: discord, Channel: cfg.TickerChannel, History: history, Interval: cfg.TickerInterval.Duration, Format: cfg.DiscordFormat}
+		if leader != nil {
+			ticker.Active = leader.IsLeader
+		}
+		go ticker.Run()
+	}
 
-	// The BitMex may "insert" / "delete / "insert" the order when it is able to liquidate at a better price
-	// "insert" is sent when the order is submitted
-	// "delete" is sent when the order is executed
-	// It may also "update" the order when the it is amended or partially filled
-	// The following sequence is possible: insert ..... update ..... delete/insert ..... update ..... delete/insert ..... delete
-	// ..... indicated a posssible time delay
+	if cfg.ExpiryNotices {
+		expiry := &ExpiryWatcher{Instruments: instruments, Symbols: pipeline.Symbols, Interval: 15 * time.Minute}
+		go expiry.Run(pipeline.Announce)
+	}
 
-	// Thus we need to keep track of when the order was last deleted and purge it as neccessary
-	lastDelete := make(map[string]time.Time)
+	// The listed perpetuals are looked up on each refresh of the instruments
+	listings.Symbols = pipeline.Symbols
+	if cfg.ListingNotices {
+		listings.Announce = pipeline.Announce
+	}
+	instruments.OnRefresh = listings.Observe
+	if cfg.InstrumentRefresh.Duration > 0 {
+		go instruments.Refresh(ctx, cfg.InstrumentRefresh.Duration)
+	}
 
-	for {
-		var data map[string]interface{}
-		if err := conn.ReadJSON(&data); err != nil {
-			return err
+	if cfg.StatusNotices {
+		status := &StatusWatcher{Host: cfg.BitMexHost, StatusHost: cfg.StatusHost, Client: newHTTPClient(proxy), Interval: 5 * time.Minute}
+		go status.Run(pipeline.Announce)
+	}
+
+	if cfg.BitMexAPIKey != "" {
+		private, err := privateSink(discord, cfg)
+		if err != nil {
+			return errwrap.Wrapf("unable to open the private channel: {{err}}", err)
 		}
 
-		if err, ok := data["error"]; ok {
-			return fmt.Errorf("error in API response: %v", err)
-		}
-
-		log.Printf("%#v\n", data)
-
-		if table, ok := data["table"]; ok {
-			switch table {
-			case "liquidation":
-				// This will panic if the cast fails, but it is fine, because it meant bitmex sent us bad data
-				innerDataList := data["data"].([]interface{})
-
-				switch data["action"] {
-				case "partial":
-				case "delete":
-					for _, innerData := range innerDataList {
-						innerData := innerData.(map[string]interface{})
-						orderID := innerData["orderID"].(string)
-
-						lastDelete[orderID] = time.Now()
-					}
-
-				case "update":
-					// The liquidation may amended by bitmex (position may be reduced or price changed)
-
-				case "insert":
-					for _, innerData := range innerDataList {
-						innerData := innerData.(map[string]interface{})
-
-						price := innerData["price"].(float64)
-						leavesQty := int64(innerData["leavesQty"].(float64)) // Cast to int64 because this is always int
-						if leavesQty < 5000 {
-							continue
-						}
-						symbol := innerData["symbol"].(string)
-						side := innerData["side"].(string)
-						orderID := innerData["orderID"].(string)
-
-						// Check if this is an insert after a delete
-						if _, ok := lastDelete[orderID]; ok {
-							continue
-						}
-
-						l := Liquidation{
-							Price:    price,
-							Quantity: leavesQty,
-							Symbol:   Symbol(symbol),
-							Side:     side,
-						}
-
-						dl := state.Decorate(l)
-						// TODO: fix this: this does a disk write every time we tweet, which isn't too terrible since we barely do a tweet a second
-						if err := state.Save(); err != nil {
-							log.Println("Failed to save state:", err)
-						}
-
-						status := dl.String()
-
-						_, err = discord.ChannelMessageSend(cfg.DiscordChannel, status)
-						if err != nil {
-							log.Println("Failed to send message:", status)
-						} else {
-							log.Printf("Sent message: %v\n", status)
-						}
-					}
-				}
-			}
+		positions := NewPositionWatcher(followLeader(leader, private), cfg.PrivateWarnDistance, cfg.PrivateMarginRatio)
+		privateClient := NewPrivateBitMexClient(cfg, positions)
+		privateClient.Dialer = newDialer(proxy)
+		privateClient.Quarantine = quarantine
+		debugState.Register("private", privateClient.DebugState)
+		health.AddConnection(privateClient.Health)
+		go privateClient.RunForever(ctx, cfg.ReconnectDelay.Duration)
+	}
+
+	client := NewBitMexClient(cfg, pipeline)
+	client.Gaps = gaps
+	client.Dialer = newDialer(proxy)
+	client.Quarantine = quarantine
+	client.Subscribe("instrument", prices.HandleBitMexInstrument)
+	if cfg.LeverageLookback.Duration > 0 {
+		pipeline.Prices = NewPriceRange(cfg.LeverageLookback.Duration)
+		client.Subscribe("instrument", pipeline.Prices.Handle)
+	}
+	if len(cfg.DepegPairs) > 0 {
+		pipeline.Depeg = &DepegWatcher{
+			Host:      "api.binance.com",
+			Client:    newHTTPClient(proxy),
+			Pairs:     cfg.DepegPairs,
+			Threshold: cfg.DepegThreshold,
+			Interval:  time.Minute,
+		}
+		go pipeline.Depeg.Run()
+	}
+	if cfg.SettlementNotices {
+		settlements := &SettlementWatcher{Symbols: pipeline.Symbols, Announce: pipeline.Announce}
+		client.Subscribe("instrument", settlements.Handle)
+	}
+	if cfg.FundingAlertRate > 0 {
+		funding := &FundingWatcher{Threshold: cfg.FundingAlertRate, Symbols: pipeline.Symbols, Announce: pipeline.Announce}
+		client.Subscribe("instrument", funding.Handle)
+	}
+	if cfg.OIAlertChange > 0 {
+		oi := &OIWatcher{Change: cfg.OIAlertChange, Window: cfg.OIAlertWindow.Duration, Symbols: pipeline.Symbols, Announce: pipeline.Announce}
+		if cfg.OIAlertChannel != "" {
+			alerts := &Pipeline{Sinks: []Sink{followLeader(leader, &DiscordSink{Session: discord, Channel: cfg.OIAlertChannel, Label: cfg.Label()})}}
+			alerts.Start(ctx, 1, cfg.QueueSize)
+			defer alerts.Stop()
+			oi.Announce = alerts.Announce
 		}
+		client.Subscribe("instrument", oi.Handle)
+	}
+	debugState.Register("bitmex", client.DebugState)
+	health.AddConnection(client.Health)
+	health.SetPipeline(pipeline)
+	inbox.SetPipeline(pipeline)
+	if cfg.WhaleChannel != "" {
+		// The trades have a queue of their own so a busy tape can't hold up the liquidations
+		whales := &WhaleFeed{
+			MinUSD:   cfg.WhaleMinUSD,
+			Pipeline: &Pipeline{Sinks: []Sink{followLeader(leader, &DiscordSink{Session: discord, Channel: cfg.WhaleChannel, Label: cfg.Label()})}},
+			Format:   cfg.DiscordFormat,
+		}
+		whales.Pipeline.Start(ctx, 1, cfg.QueueSize)
+		defer whales.Pipeline.Stop()
+		if cfg.WhaleBitMex {
+			client.Subscribe("trade", whales.HandleBitMex)
+			client.Subscribe("trade", prices.HandleBitMexTrade)
+		}
+		if len(cfg.WhaleBinanceSymbols) > 0 {
+			binance := &BinanceTrades{URL: binanceStreamURL, Symbols: cfg.WhaleBinanceSymbols, Dialer: newDialer(proxy), Feed: whales, Quarantine: quarantine, Prices: prices}
+			health.AddConnection(binance.Health)
+			go binance.RunForever(ctx, cfg.ReconnectDelay.Duration)
+		}
+	}
+	if cfg.RESTFallbackAfter.Duration > 0 {
+		fallback := &RESTFallback{
+			Host:     cfg.BitMexHost,
+			Client:   newHTTPClient(proxy),
+			Feed:     client,
+			After:    cfg.RESTFallbackAfter.Duration,
+			Interval: cfg.RESTPollInterval.Duration,
+		}
+		go fallback.Run(ctx)
+	}
+	if cfg.BackupS3 != "" {
+		backups := &BackupScheduler{Target: cfg.BackupS3, Interval: cfg.BackupInterval.Duration, Files: backupFiles(cfg), Client: newHTTPClient(proxy)}
+		go backups.Run(ctx)
+	}
+	notifySystemd("READY=1")
+	go watchdogSystemd(health.Alive)
+	client.RunForever(ctx, cfg.ReconnectDelay.Duration)
+
+	// The deferred stops give up on the deliveries under way, the context being done
+	log.Println("Shutting down")
+	notifySystemd("STOPPING=1")
+	return nil
+}
 
-		// Purge expired orders so we don't hemorrhage memory
-		now := time.Now()
-		for orderID, timestamp := range lastDelete {
-			if now.Sub(timestamp) > 10*time.Second {
-				delete(lastDelete, orderID)
-			}
+// privateSink returns the sink for private warnings: the private channel, or a DM to the private user.
+func privateSink(discord *discordgo.Session, cfg BotConfig) (Sink, error) {
+	channel := cfg.PrivateChannel
+	if channel == "" {
+		if cfg.PrivateUser == "" {
+			return nil, errors.New("private_channel or private_user must be set along with the API key")
 		}
+
+		dm, err := discord.UserChannelCreate(cfg.PrivateUser)
+		if err != nil {
+			return nil, err
+		}
+		channel = dm.ID
 	}
 
+	return &DiscordSink{Session: discord, Channel: channel, Label: cfg.Label()}, nil
 }
 
 func main() {
-	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+	log.SetFlags(logFlags)
 
 	rand.Seed(time.Now().UnixNano())
+	configDir, stateDir = appDirs()
 
-	cfg, err := loadConfig()
-	if err != nil {
-		log.Fatal("Unable to load config:", err)
+	command, args := runCommand, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		var ok bool
+		if command, ok = commands[args[0]]; !ok {
+			log.Fatal("Unknown command: ", args[0])
+		}
+		args = args[1:]
 	}
 
-	state, err := NewState()
-	if err != nil {
-		log.Fatal("Failed to load state:", err)
-	}
+	// Interrupting the bot cancels the work under way rather than killing it halfway through
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	discord, err := discordgo.New("Bot " + cfg.DiscordToken)
-	discord.Open()
-	if err != nil {
-		log.Fatal("Unable to run discord:", err)
+	if inService, err := runService(ctx, func(ctx context.Context) error { return command(ctx, args) }); inService || err != nil {
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		return
 	}
 
-	if err := runClient(cfg, discord, state); err != nil {
-		log.Fatal("Error:", err)
+	if err := command(ctx, args); err != nil {
+		log.Fatal("Error: ", err)
 	}
 }
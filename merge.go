@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type (
+	// Merger folds the near-identical liquidations of a symbol and side that follow one another in
+	// a channel, such as the partial fills of one large position reported as separate orders, into
+	// the message of the first, edited to their running total.
+	Merger struct {
+		Window    time.Duration // Longest gap between two liquidations of a run
+		Tolerance float64       // Largest difference between two sizes that are near-identical, 0.1 for 10%
+
+		mu  sync.Mutex
+		run *mergeRun // The last message of the channel, when it is about a liquidation
+	}
+
+	// mergeRun is a message and the liquidations it sums up, as last amended.
+	mergeRun struct {
+		Message postedMessage
+
+		mu    sync.Mutex
+		parts []Liquidation
+		at    time.Time
+	}
+)
+
+// Fold adds the liquidation to the run of the last message when it continues it, returning the
+// run. ok is false when the liquidation is to be posted on its own.
+func (m *Merger) Fold(l Liquidation, now time.Time) (run *mergeRun, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run = m.run
+	if run == nil {
+		return nil, false
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	first, last := run.parts[0], run.parts[len(run.parts)-1]
+	if first.Symbol != l.Symbol || first.Side != l.Side || now.Sub(run.at) > m.Window || !m.similar(last.Quantity, l.Quantity) {
+		return nil, false
+	}
+	run.parts = append(run.parts, l)
+	run.at = now
+
+	return run, true
+}
+
+// Start begins a run at the message posted about a liquidation.
+func (m *Merger) Start(message postedMessage, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.run = &mergeRun{Message: message, parts: []Liquidation{message.DL.Liquidation}, at: now}
+}
+
+// Break ends the run, another message having been posted after it.
+func (m *Merger) Break() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.run = nil
+}
+
+// similar tells whether two sizes are near-identical.
+func (m *Merger) similar(a, b int64) bool {
+	if a <= 0 || b <= 0 {
+		return false
+	}
+	return math.Abs(float64(a-b)) <= m.Tolerance*math.Max(float64(a), float64(b))
+}
+
+// Orders returns the orders the run sums up.
+func (r *mergeRun) Orders() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	orders := make([]string, 0, len(r.parts))
+	for _, l := range r.parts {
+		if l.OrderID != "" {
+			orders = append(orders, l.OrderID)
+		}
+	}
+	return orders
+}
+
+// Amend replaces the liquidation of the order in the run, telling whether it is one of its.
+func (r *mergeRun) Amend(l Liquidation) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.parts {
+		if r.parts[i].OrderID == l.OrderID {
+			r.parts[i] = l
+			return true
+		}
+	}
+	return false
+}
+
+// Total sums up the liquidations of the run, at the average of their prices weighted by the
+// quantities, returning it along with their number.
+func (r *mergeRun) Total() (total Liquidation, orders int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var notional float64
+	for i, l := range r.parts {
+		if i == 0 {
+			total = l
+		} else {
+			total.Quantity += l.Quantity
+			total.USD += l.USD
+			total.CoinQty += l.CoinQty
+			total.Loss += l.Loss
+		}
+		notional += l.Price * float64(l.Quantity)
+	}
+	if total.Quantity > 0 {
+		total.Price = notional / float64(total.Quantity)
+	}
+	return total, len(r.parts)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMerger(t *testing.T) {
+	m := &Merger{Window: time.Minute, Tolerance: 0.1}
+	now := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	first := Liquidation{OrderID: "a", Symbol: "XBTUSD", Side: "Sell", Quantity: 100000, Price: 60000, USD: 100000}
+	if _, ok := m.Fold(first, now); ok {
+		t.Fatal("expected nothing to fold into before the first message")
+	}
+	m.Start(postedMessage{Channel: "c1", ID: "m1", DL: DecoratedLiquidation{Liquidation: first}}, now)
+
+	next := first
+	next.OrderID, next.Quantity, next.Price, next.USD = "b", 95000, 59000, 95000
+	run, ok := m.Fold(next, now.Add(10*time.Second))
+	if !ok || run.Message.ID != "m1" {
+		t.Fatalf("expected the near-identical size to fold into m1, got %v", ok)
+	}
+	total, orders := run.Total()
+	if orders != 2 || total.Quantity != 195000 || total.USD != 195000 || total.Price < 59500 || total.Price > 59520 {
+		t.Errorf("expected the total of 2 orders with the weighted price, got %v %+v", orders, total)
+	}
+	if ids := run.Orders(); len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("expected the run to sum up a and b, got %v", ids)
+	}
+
+	// An amendment to one of the orders changes its part of the total
+	amended := next
+	amended.Quantity, amended.USD = 90000, 90000
+	if !run.Amend(amended) {
+		t.Fatal("expected b to be amended")
+	}
+	if total, _ := run.Total(); total.Quantity != 190000 || total.USD != 190000 {
+		t.Errorf("expected the amended total, got %+v", total)
+	}
+	if run.Amend(Liquidation{OrderID: "c"}) {
+		t.Error("expected an order of another message not to be amended")
+	}
+
+	for name, l := range map[string]Liquidation{
+		"symbol": {Symbol: "ETHUSD", Side: "Sell", Quantity: 95000},
+		"side":   {Symbol: "XBTUSD", Side: "Buy", Quantity: 95000},
+		"size":   {Symbol: "XBTUSD", Side: "Sell", Quantity: 50000},
+	} {
+		if _, ok := m.Fold(l, now.Add(20*time.Second)); ok {
+			t.Errorf("expected a different %v not to fold", name)
+		}
+	}
+	if _, ok := m.Fold(next, now.Add(2*time.Minute)); ok {
+		t.Error("expected a liquidation past the window not to fold")
+	}
+
+	m.Break()
+	if _, ok := m.Fold(next, now.Add(15*time.Second)); ok {
+		t.Error("expected another message to end the run")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// summaryWindow is the number of recent observations a Summary keeps for its quantiles.
+const summaryWindow = 1024
+
+type (
+	// Counter is a value that only goes up.
+	Counter struct {
+		value int64
+	}
+
+	// Gauge is a value that can go up and down.
+	Gauge struct {
+		bits uint64
+	}
+
+	// Summary tracks the count, sum and quantiles of observations such as latencies.
+	Summary struct {
+		mu     sync.Mutex
+		window []float64
+		next   int
+		count  int64
+		sum    float64
+	}
+
+	// series is a single metric along with its name and labels.
+	series struct {
+		name   string
+		labels string
+		metric interface{}
+	}
+
+	// Metrics is a registry of metrics rendered in the Prometheus text format.
+	Metrics struct {
+		mu     sync.Mutex
+		series map[string]*series
+	}
+)
+
+// Quantiles reported for every summary.
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// metrics is the registry served on /metrics.
+var metrics = NewMetrics()
+
+// NewMetrics returns an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{series: make(map[string]*series)}
+}
+
+// Counter returns the counter with the given name and label pairs, creating it if needed.
+func (m *Metrics) Counter(name string, labels ...string) *Counter {
+	return m.get(name, labels, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Gauge returns the gauge with the given name and label pairs, creating it if needed.
+func (m *Metrics) Gauge(name string, labels ...string) *Gauge {
+	return m.get(name, labels, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+// Summary returns the summary with the given name and label pairs, creating it if needed.
+func (m *Metrics) Summary(name string, labels ...string) *Summary {
+	return m.get(name, labels, func() interface{} { return &Summary{} }).(*Summary)
+}
+
+func (m *Metrics) get(name string, labels []string, create func() interface{}) interface{} {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%v=%q", labels[i], labels[i+1]))
+	}
+	formatted := strings.Join(pairs, ",")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := name + "{" + formatted + "}"
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{name: name, labels: formatted, metric: create()}
+		m.series[key] = s
+	}
+
+	return s.metric
+}
+
+// ServeHTTP renders every metric in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	all := make([]*series, 0, len(m.series))
+	for _, s := range m.series {
+		all = append(all, s)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		return all[i].labels < all[j].labels
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	var lastName string
+	for _, s := range all {
+		switch metric := s.metric.(type) {
+		case *Counter:
+			writeType(w, s.name, "counter", &lastName)
+			fmt.Fprintf(w, "%v%v %v\n", s.name, braces(s.labels), metric.Value())
+
+		case *Gauge:
+			writeType(w, s.name, "gauge", &lastName)
+			fmt.Fprintf(w, "%v%v %v\n", s.name, braces(s.labels), metric.Value())
+
+		case *Summary:
+			writeType(w, s.name, "summary", &lastName)
+			count, sum, quantiles := metric.Snapshot()
+			for i, q := range summaryQuantiles {
+				labels := fmt.Sprintf("quantile=%q", fmt.Sprint(q))
+				if s.labels != "" {
+					labels = s.labels + "," + labels
+				}
+				fmt.Fprintf(w, "%v{%v} %v\n", s.name, labels, quantiles[i])
+			}
+			fmt.Fprintf(w, "%v_sum%v %v\n", s.name, braces(s.labels), sum)
+			fmt.Fprintf(w, "%v_count%v %v\n", s.name, braces(s.labels), count)
+		}
+	}
+}
+
+func writeType(w http.ResponseWriter, name, kind string, lastName *string) {
+	if name != *lastName {
+		fmt.Fprintf(w, "# TYPE %v %v\n", name, kind)
+		*lastName = name
+	}
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+// Add adds n, which must not be negative.
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.value, n)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// Set replaces the value of the gauge.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds delta, which may be negative, to the value of the gauge.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// Observe records a single observation.
+func (s *Summary) Observe(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	s.sum += v
+
+	if len(s.window) < summaryWindow {
+		s.window = append(s.window, v)
+		return
+	}
+	s.window[s.next] = v
+	s.next = (s.next + 1) % summaryWindow
+}
+
+// Quantile returns the q-quantile of the recent observations, or NaN if there are none.
+func (s *Summary) Quantile(q float64) float64 {
+	_, _, quantiles := s.snapshot([]float64{q})
+	return quantiles[0]
+}
+
+// Snapshot returns the count, sum and the reported quantiles of the summary.
+func (s *Summary) Snapshot() (count int64, sum float64, quantiles []float64) {
+	return s.snapshot(summaryQuantiles)
+}
+
+func (s *Summary) snapshot(qs []float64) (count int64, sum float64, quantiles []float64) {
+	s.mu.Lock()
+	sorted := append([]float64(nil), s.window...)
+	count, sum = s.count, s.sum
+	s.mu.Unlock()
+
+	sort.Float64s(sorted)
+
+	quantiles = make([]float64, len(qs))
+	for i, q := range qs {
+		if len(sorted) == 0 {
+			quantiles[i] = math.NaN()
+			continue
+		}
+		quantiles[i] = sorted[int(q*float64(len(sorted)-1)+0.5)]
+	}
+
+	return count, sum, quantiles
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSummaryQuantiles(t *testing.T) {
+	var s Summary
+	if !math.IsNaN(s.Quantile(0.5)) {
+		t.Error("empty summary should have no quantiles")
+	}
+
+	for i := 1; i <= 100; i++ {
+		s.Observe(float64(i))
+	}
+
+	if q := s.Quantile(0.5); q != 50 && q != 51 {
+		t.Error("unexpected p50:", q)
+	}
+	if q := s.Quantile(0.99); q < 98 {
+		t.Error("unexpected p99:", q)
+	}
+
+	// Only the most recent observations count towards the quantiles
+	for i := 0; i < summaryWindow; i++ {
+		s.Observe(1)
+	}
+	if q := s.Quantile(0.99); q != 1 {
+		t.Error("old observations should have rotated out:", q)
+	}
+
+	count, _, _ := s.Snapshot()
+	if count != 100+summaryWindow {
+		t.Error("unexpected count:", count)
+	}
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	m.Counter("rekt_test_total", "sink", "discord").Inc()
+	m.Counter("rekt_test_total", "sink", "discord").Inc()
+	m.Gauge("rekt_test_gauge").Set(1.5)
+	m.Summary("rekt_test_seconds", "stage", "save").Observe(0.25)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE rekt_test_total counter",
+		`rekt_test_total{sink="discord"} 2`,
+		"rekt_test_gauge 1.5",
+		`rekt_test_seconds{stage="save",quantile="0.99"} 0.25`,
+		`rekt_test_seconds_count{stage="save"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%v", line, body)
+		}
+	}
+}
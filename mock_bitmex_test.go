@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mockBitMex is a test double that speaks enough of the BitMex realtime protocol to drive
+// a BitMexClient end-to-end: it greets the client, acknowledges the subscription from the
+// URL query, sends the partial, pings the client and waits for the pong, and then plays back
+// a script of frames before closing the connection.
+type mockBitMex struct {
+	*httptest.Server
+
+	t      *testing.T
+	script []interface{}
+}
+
+func newMockBitMex(t *testing.T, script ...interface{}) *mockBitMex {
+	m := &mockBitMex{
+		t:      t,
+		script: script,
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// URL returns the websocket address a BitMexClient should dial.
+func (m *mockBitMex) URL() string {
+	return "ws" + strings.TrimPrefix(m.Server.URL, "http") + "/realtime"
+}
+
+func (m *mockBitMex) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		m.t.Error("mock upgrade failed:", err)
+		return
+	}
+	defer conn.Close()
+
+	pongs := make(chan struct{}, 1)
+	conn.SetPongHandler(func(string) error {
+		select {
+		case pongs <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	// Keep reading so control frames are processed, answering the text heartbeat as BitMex does
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "ping" {
+				conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+			}
+		}
+	}()
+
+	send := func(v interface{}) {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteJSON(v); err != nil {
+			m.t.Error("mock write failed:", err)
+		}
+	}
+
+	send(map[string]interface{}{
+		"info":      "Welcome to the BitMEX Realtime API.",
+		"version":   "2.0.0",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"docs":      "https://www.bitmex.com/app/wsAPI",
+		"limit":     map[string]interface{}{"remaining": 39},
+	})
+
+	for _, table := range strings.Split(r.URL.Query().Get("subscribe"), ",") {
+		send(map[string]interface{}{
+			"success":   true,
+			"subscribe": table,
+			"request":   map[string]interface{}{"op": "subscribe", "args": table},
+		})
+		send(map[string]interface{}{
+			"table":  table,
+			"action": "partial",
+			"keys":   []string{"orderID"},
+			"data":   []interface{}{},
+		})
+	}
+
+	conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+	select {
+	case <-pongs:
+	case <-time.After(5 * time.Second):
+		m.t.Error("client never answered the ping")
+	}
+
+	for _, frame := range m.script {
+		send(frame)
+	}
+
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+}
+
+// frameJSON encodes a frame as it comes off the wire.
+func frameJSON(t testing.TB, frame interface{}) []byte {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// liquidationFrame builds a liquidation table frame for the given action.
+func liquidationFrame(action string, rows ...map[string]interface{}) map[string]interface{} {
+	data := make([]interface{}, len(rows))
+	for i, row := range rows {
+		data[i] = row
+	}
+
+	return map[string]interface{}{
+		"table":  "liquidation",
+		"action": action,
+		"data":   data,
+	}
+}
+
+// liquidationRow builds a single liquidation row as BitMex would send it.
+func liquidationRow(orderID string, symbol Symbol, side string, price float64, leavesQty int64) map[string]interface{} {
+	return map[string]interface{}{
+		"orderID":   orderID,
+		"symbol":    string(symbol),
+		"side":      side,
+		"price":     price,
+		"leavesQty": float64(leavesQty), // As decoded from JSON
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// notifySystemd tells systemd how the service is doing when it runs the bot with Type=notify,
+// and does nothing otherwise: "READY=1", "RELOADING=1", "STOPPING=1" or "WATCHDOG=1".
+// https://www.freedesktop.org/software/systemd/man/sd_notify.html
+func notifySystemd(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	// The abstract namespace is written with a leading @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Println("Failed to notify systemd:", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Println("Failed to notify systemd:", err)
+	}
+}
+
+// watchdogStale is how long the bot can go without progress before the watchdog stops being
+// pinged, past the pongs the BitMex connection gets every pingPeriod.
+const watchdogStale = 2 * pongWait
+
+// watchdogSystemd pings the systemd watchdog at half its timeout when WatchdogSec is set, as long
+// as alive tells the connections and the deliveries made progress, so a wedged process gets
+// restarted.
+func watchdogSystemd(alive func(now time.Time, d time.Duration) bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+
+	stalled := false
+	for now := range time.Tick(time.Duration(usec) * time.Microsecond / 2) {
+		if !alive(now, watchdogStale) {
+			if !stalled {
+				log.Println("No progress for", watchdogStale, "no longer pinging the systemd watchdog")
+			}
+			stalled = true
+			continue
+		}
+		stalled = false
+		notifySystemd("WATCHDOG=1")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifySystemd(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skip("no unix datagram sockets:", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	notifySystemd("READY=1")
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("expected READY=1, got %q", got)
+	}
+}
+
+func TestStatePath(t *testing.T) {
+	dir := t.TempDir()
+	defer func(previous string) { stateDir = previous }(stateDir)
+
+	stateDir = "."
+	if path := statePath("settings.json"); path != "settings.json" {
+		t.Errorf("expected the working directory to be used as it is, got %v", path)
+	}
+
+	stateDir = filepath.Join(dir, "rekt")
+	if path := statePath("settings.json"); path != filepath.Join(dir, "rekt", "settings.json") || !fileExists(stateDir) {
+		t.Errorf("expected the file in the created state directory, got %v", path)
+	}
+	if path := statePath("/var/lib/rekt/audit.jsonl"); path != "/var/lib/rekt/audit.jsonl" {
+		t.Errorf("expected an absolute path to be kept, got %v", path)
+	}
+}
+
+func TestAppDirs(t *testing.T) {
+	t.Setenv(homeEnv, "/srv/rekt")
+	if config, state := appDirs(); config != "/srv/rekt" || state != "/srv/rekt" {
+		t.Errorf("expected REKT_HOME for both, got %v and %v", config, state)
+	}
+}
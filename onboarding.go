@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Onboarding walks the guilds that just added the bot through their setup in hosted mode: a
+// message with menus to pick the channel, the threshold and the symbols, and a button to start
+// posting. It is DMed to whoever added the bot when the invite told, posted in the system channel
+// of the guild otherwise, or DMed to its owner. The choices are kept with the tenant until done.
+type Onboarding struct {
+	Tenants     *Tenants
+	Settings    *Settings        // Roles of the admins who may answer the wizard in the guild
+	Instruments *InstrumentCache // The perpetuals of the menu of contracts, when set
+}
+
+// onboardingWindow is how recently the bot must have joined a guild to greet it, the guilds it was
+// in already being announced on every start.
+const onboardingWindow = 10 * time.Minute
+
+// Choices of the wizard, the contracts being those of the menu when the instruments can't be fetched
+var (
+	setupThresholds = []float64{10000, 100000, 1000000, 10000000}
+	setupSymbols    = []Symbol{"XBTUSD", "ETHUSD", "SOLUSD", "XRPUSD", "DOGEUSD", "XBTUSDT", "ETHUSDT"}
+)
+
+// maxMenuOptions is the most options a select menu of Discord holds.
+const maxMenuOptions = 25
+
+// HandleGuildCreate adds the guild to the tenants and greets it with the wizard when it is new.
+func (o *Onboarding) HandleGuildCreate(s *discordgo.Session, e *discordgo.GuildCreate) {
+	o.Tenants.HandleGuildCreate(s, e)
+	if e.JoinedAt.IsZero() || time.Since(e.JoinedAt) > onboardingWindow {
+		return
+	}
+
+	tenant, _ := o.Tenants.Tenant(e.ID)
+	user := tenant.Installer
+	if user == "" && e.SystemChannelID == "" {
+		user = e.OwnerID
+	}
+	setup, started, err := o.Tenants.StartSetup(e.ID, user)
+	if err != nil {
+		log.Println("Failed to save the tenants:", err)
+	}
+	if !started {
+		return
+	}
+
+	channel := e.SystemChannelID
+	if user != "" {
+		dm, err := s.UserChannelCreate(user)
+		if err != nil {
+			log.Printf("Failed to DM the setup of %v: %v\n", e.Name, err)
+			return
+		}
+		channel = dm.ID
+	}
+
+	msg := setupMessage(e.Guild, setup, e.Channels, o.symbols(), o.Tenants.Defaults.Format)
+	if _, err := s.ChannelMessageSendComplex(channel, &discordgo.MessageSend{Content: msg.Content, Embeds: msg.Embeds, Components: msg.Components}); err != nil {
+		log.Printf("Failed to send the setup of %v: %v\n", e.Name, err)
+		return
+	}
+	metrics.Counter("rekt_onboarding_total", "step", "started").Inc()
+}
+
+// Handle answers the wizard, "setup:<choice>:<guild>", replacing it with the choices made.
+func (o *Onboarding) Handle(req *CommandRequest, args []string) (*discordgo.InteractionResponseData, error) {
+	if len(args) != 2 {
+		return nil, errors.New("bad setup component")
+	}
+	choice, guild := args[0], args[1]
+	if err := o.authorize(req, guild); err != nil {
+		return nil, err
+	}
+
+	if choice == "done" {
+		target, err := o.Tenants.FinishSetup(guild)
+		if err != nil {
+			return nil, err
+		}
+		metrics.Counter("rekt_onboarding_total", "step", "done").Inc()
+		return &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("All set, posting %v in <#%v>. Change it there with /rekt set, or add channels with /tenant add", setupFilterText(target.MinUSD, target.Symbols, target.Format), target.Channel),
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		}, nil
+	}
+
+	values := req.Interaction.MessageComponentData().Values
+	setup, err := o.Tenants.ChangeSetup(guild, func(setup *TenantSetup) {
+		switch choice {
+		case "channel":
+			if len(values) == 1 {
+				setup.Channel = values[0]
+			}
+		case "min":
+			if len(values) == 1 {
+				setup.MinUSD, _ = strconv.ParseFloat(values[0], 64)
+			}
+		case "symbols":
+			setup.Symbols = nil
+			for _, value := range values {
+				setup.Symbols = append(setup.Symbols, Symbol(value))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := req.Session.GuildChannels(guild)
+	if err != nil {
+		return nil, err
+	}
+	tenant, _ := o.Tenants.Tenant(guild)
+	return setupMessage(&discordgo.Guild{ID: guild, Name: tenant.Name}, setup, channels, o.symbols(), o.Tenants.Defaults.Format), nil
+}
+
+// symbols returns the contracts of the menu, the most traded of the listed perpetuals.
+func (o *Onboarding) symbols() []Symbol {
+	if o.Instruments == nil {
+		return setupSymbols
+	}
+	active, err := o.Instruments.Active()
+	if err != nil {
+		log.Println("Failed to fetch the active instruments:", err)
+		return setupSymbols
+	}
+	return setupMenuSymbols(active)
+}
+
+// setupMenuSymbols returns the perpetuals by their volume of the last 24 hours, as many as a menu
+// holds, the fixed list when there are none.
+func setupMenuSymbols(active []Instrument) []Symbol {
+	var perpetuals []Instrument
+	for _, instrument := range active {
+		if instrument.IsPerpetual() {
+			perpetuals = append(perpetuals, instrument)
+		}
+	}
+	if len(perpetuals) == 0 {
+		return setupSymbols
+	}
+
+	sort.SliceStable(perpetuals, func(i, j int) bool { return perpetuals[i].Volume24h > perpetuals[j].Volume24h })
+	if len(perpetuals) > maxMenuOptions {
+		perpetuals = perpetuals[:maxMenuOptions]
+	}
+	symbols := make([]Symbol, len(perpetuals))
+	for i, instrument := range perpetuals {
+		symbols[i] = instrument.Symbol
+	}
+	return symbols
+}
+
+// authorize lets the admins of the guild answer the wizard posted in it, and only the one it was
+// DMed to answer it in DMs.
+func (o *Onboarding) authorize(req *CommandRequest, guild string) error {
+	setup, ok := o.Tenants.Setup(guild)
+	if !ok {
+		return errors.New("this setup is over, run /tenant add in the channel to post to")
+	}
+	if req.Interaction.GuildID == "" {
+		if req.User().ID != setup.User {
+			return errors.New("this setup is someone else's")
+		}
+		return nil
+	}
+	if req.Interaction.GuildID != guild || !allowed(req, o.Settings, PermissionAdmin) {
+		return errors.New("only the admins of the server can set the bot up")
+	}
+	return nil
+}
+
+// setupMessage is the wizard with the choices made so far, the channels being those of the
+// guild the bot can post in and the symbols those of the menu of contracts.
+func setupMessage(guild *discordgo.Guild, setup TenantSetup, channels []*discordgo.Channel, symbols []Symbol, f NumberFormat) *discordgo.InteractionResponseData {
+	var channelOptions []discordgo.SelectMenuOption
+	for _, channel := range postableChannels(channels) {
+		channelOptions = append(channelOptions, discordgo.SelectMenuOption{
+			Label:   "#" + channel.Name,
+			Value:   channel.ID,
+			Default: channel.ID == setup.Channel,
+		})
+	}
+
+	var minOptions []discordgo.SelectMenuOption
+	for _, usd := range setupThresholds {
+		minOptions = append(minOptions, discordgo.SelectMenuOption{
+			Label:   f.Short(int64(usd)) + " and more",
+			Value:   strconv.FormatFloat(usd, 'f', -1, 64),
+			Default: usd == setup.MinUSD,
+		})
+	}
+
+	var symbolOptions []discordgo.SelectMenuOption
+	for _, symbol := range symbols {
+		chosen := false
+		for _, s := range setup.Symbols {
+			chosen = chosen || s == symbol
+		}
+		symbolOptions = append(symbolOptions, discordgo.SelectMenuOption{Label: string(symbol), Value: string(symbol), Default: chosen})
+	}
+
+	none := 0
+	components := []discordgo.MessageComponent{}
+	if len(channelOptions) > 0 {
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{CustomID: "setup:channel:" + guild.ID, Placeholder: "Channel to post to", Options: channelOptions},
+		}})
+	}
+	components = append(components,
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{CustomID: "setup:min:" + guild.ID, Placeholder: "Smallest liquidation to post", Options: minOptions},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{CustomID: "setup:symbols:" + guild.ID, Placeholder: "Contracts, all of them when none",
+				MinValues: &none, MaxValues: len(symbolOptions), Options: symbolOptions},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Start posting", Style: discordgo.SuccessButton, CustomID: "setup:done:" + guild.ID, Disabled: setup.Channel == ""},
+		}},
+	)
+
+	channel := "not picked yet"
+	if setup.Channel != "" {
+		channel = "<#" + setup.Channel + ">"
+	}
+	name := guild.Name
+	if name == "" {
+		name = "your server"
+	}
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       "Set up REKT in " + name,
+			Description: "Pick the channel to post the liquidations to and which of them, then start posting. It can all be changed later with /rekt set.",
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Channel", Value: channel, Inline: true},
+				{Name: "Posting", Value: setupFilterText(setup.MinUSD, setup.Symbols, f), Inline: true},
+			},
+		}},
+		Components: components,
+	}
+}
+
+// postableChannels are the text, announcement and forum channels, in the order of the guild,
+// as many as a menu holds.
+func postableChannels(channels []*discordgo.Channel) []*discordgo.Channel {
+	var postable []*discordgo.Channel
+	for _, channel := range channels {
+		switch channel.Type {
+		case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeGuildForum:
+			postable = append(postable, channel)
+		}
+	}
+	sort.SliceStable(postable, func(i, j int) bool { return postable[i].Position < postable[j].Position })
+	if len(postable) > maxMenuOptions {
+		postable = postable[:maxMenuOptions]
+	}
+	return postable
+}
+
+// setupFilterText describes the liquidations picked: "the liquidations of $100K and more on XBTUSD".
+func setupFilterText(minUSD float64, symbols []Symbol, f NumberFormat) string {
+	text := "every liquidation"
+	if minUSD > 0 {
+		text = "the liquidations of " + f.Short(int64(minUSD)) + " and more"
+	}
+	if len(symbols) > 0 {
+		names := make([]string, len(symbols))
+		for i, symbol := range symbols {
+			names[i] = string(symbol)
+		}
+		text += " on " + strings.Join(names, ", ")
+	}
+	return text
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestOnboarding(t *testing.T) {
+	tenants, err := LoadTenants(filepath.Join(t.TempDir(), "tenants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants.Defaults = Target{Filter: Filter{MinUSD: 100000}}
+	if err := tenants.Join("g1", "Degens", "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	setup, started, err := tenants.StartSetup("g1", "u1")
+	if err != nil || !started || setup.MinUSD != 100000 {
+		t.Fatalf("expected the setup to start from the defaults, got %+v, %v, %v", setup, started, err)
+	}
+	if _, started, _ := tenants.StartSetup("g1", "u1"); started {
+		t.Error("expected a single setup at a time")
+	}
+
+	msg := setupMessage(&discordgo.Guild{ID: "g1", Name: "Degens"}, setup, []*discordgo.Channel{
+		{ID: "c2", Name: "general", Type: discordgo.ChannelTypeGuildText, Position: 2},
+		{ID: "v1", Name: "voice", Type: discordgo.ChannelTypeGuildVoice},
+		{ID: "c1", Name: "rekt", Type: discordgo.ChannelTypeGuildText, Position: 1},
+	}, setupSymbols, DefaultFormat)
+	menu := msg.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if len(menu.Options) != 2 || menu.Options[0].Value != "c1" || menu.CustomID != "setup:channel:g1" {
+		t.Errorf("expected the text channels in order, got %+v", menu)
+	}
+	if button := msg.Components[3].(discordgo.ActionsRow).Components[0].(discordgo.Button); !button.Disabled {
+		t.Error("expected the start button to wait for a channel")
+	}
+
+	// The menu of contracts has the most traded perpetuals
+	symbols := setupMenuSymbols([]Instrument{
+		{Symbol: "ETHUSD", Typ: perpetualTyp, Volume24h: 1000000},
+		{Symbol: "XBTZ24", Typ: futuresTyp, Volume24h: 50000000},
+		{Symbol: "XBTUSD", Typ: perpetualTyp, Volume24h: 9000000},
+	})
+	if len(symbols) != 2 || symbols[0] != "XBTUSD" || symbols[1] != "ETHUSD" {
+		t.Errorf("expected the perpetuals by volume, got %v", symbols)
+	}
+
+	// The choices of the wizard leave the targets alone
+	changes := 0
+	tenants.SetOnChange(func() { changes++ })
+	if _, err := tenants.ChangeSetup("g1", func(setup *TenantSetup) { setup.MinUSD = 1000000 }); err != nil || changes != 0 {
+		t.Errorf("expected the choice to be saved without a rebuild, got %v changes, %v", changes, err)
+	}
+
+	o := &Onboarding{Tenants: tenants}
+	dm := func(user string) *CommandRequest {
+		return &CommandRequest{Interaction: &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{User: &discordgo.User{ID: user}}}}
+	}
+	if _, err := o.Handle(dm("u1"), []string{"done", "g1"}); err == nil {
+		t.Error("expected the setup not to finish without a channel")
+	}
+	if _, err := tenants.ChangeSetup("g1", func(setup *TenantSetup) {
+		setup.Channel, setup.MinUSD, setup.Symbols = "c1", 100000, []Symbol{"XBTUSD"}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Handle(dm("u2"), []string{"done", "g1"}); err == nil {
+		t.Error("expected someone else not to answer the DMed setup")
+	}
+
+	resp, err := o.Handle(dm("u1"), []string{"done", "g1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Content, "$100.0K and more on XBTUSD in <#c1>") || len(resp.Components) != 0 {
+		t.Errorf("expected the channel to be set up, got %+v", resp)
+	}
+
+	tenant, _ := tenants.Tenant("g1")
+	if tenant.Setup != nil || len(tenant.Targets) != 1 || tenant.Targets[0].MinUSD != 100000 || len(tenant.Targets[0].Symbols) != 1 {
+		t.Errorf("expected the picked channel and filters to be stored, got %+v", tenant)
+	}
+	if _, started, _ := tenants.StartSetup("g1", "u1"); started {
+		t.Error("expected a guild posting somewhere not to be set up again")
+	}
+}
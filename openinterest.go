@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type (
+	// OIWatcher alerts when the open interest of a symbol builds up or gets flushed by more than
+	// Change within Window. It follows the instrument table, which streams the open interest.
+	OIWatcher struct {
+		Change   float64 // Fraction of the open interest, 0.1 being 10%
+		Window   time.Duration
+		Symbols  *SymbolMap
+		Announce func(text string)
+
+		mu      sync.Mutex
+		samples map[Symbol][]oiSample
+	}
+
+	oiSample struct {
+		at time.Time
+		oi float64
+	}
+)
+
+// Handle is the TableHandler of the instrument table.
+func (w *OIWatcher) Handle(action string, rows []interface{}, received time.Time) {
+	for _, row := range rows {
+		row, _ := row.(map[string]interface{})
+		symbol, _ := row["symbol"].(string)
+		if oi, ok := row["openInterest"].(float64); ok && symbol != "" {
+			if text := w.observe(Symbol(symbol), oi, received); text != "" {
+				w.Announce(text)
+			}
+		}
+	}
+}
+
+// observe records the open interest and returns the alert when it moved too much within the window.
+// The samples start over after an alert, so the same move isn't reported twice.
+func (w *OIWatcher) observe(symbol Symbol, oi float64, now time.Time) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.samples == nil {
+		w.samples = make(map[Symbol][]oiSample)
+	}
+
+	samples := w.samples[symbol]
+	for len(samples) > 0 && now.Sub(samples[0].at) > w.Window {
+		samples = samples[1:]
+	}
+	samples = append(samples, oiSample{at: now, oi: oi})
+	w.samples[symbol] = samples
+
+	oldest := samples[0]
+	if oldest.oi <= 0 {
+		return ""
+	}
+	change := oi/oldest.oi - 1
+	if math.Abs(change) < w.Change {
+		return ""
+	}
+	w.samples[symbol] = []oiSample{{at: now, oi: oi}}
+
+	return oiText(w.name(symbol), change, oi, w.Window)
+}
+
+func (w *OIWatcher) name(symbol Symbol) string {
+	if w.Symbols != nil {
+		return w.Symbols.Lookup(symbol).Display
+	}
+	return string(symbol)
+}
+
+// oiText writes the alert: "📈 XBTUSD open interest +12.5% in 1 h to 1.2B contracts, positions are building up".
+func oiText(name string, change, oi float64, window time.Duration) string {
+	emoji, what := "📈", "positions are building up"
+	if change < 0 {
+		emoji, what = "📉", "positions are being flushed"
+	}
+	return fmt.Sprintf("%v %v open interest %+.1f%% in %v to %v contracts, %v",
+		emoji, name, change*100, durationText(window), NumberFormat{Abbreviate: true}.Int(int64(oi)), what)
+}
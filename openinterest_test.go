@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOIWatcher(t *testing.T) {
+	var alerts []string
+	w := &OIWatcher{Change: 0.1, Window: time.Hour, Announce: func(text string) { alerts = append(alerts, text) }}
+
+	start := time.Date(2024, time.May, 1, 9, 0, 0, 0, time.UTC)
+	steps := []struct {
+		after time.Duration
+		oi    float64
+	}{
+		{0, 1e9},
+		{20 * time.Minute, 1.05e9},
+		{40 * time.Minute, 1.12e9},  // Build up
+		{50 * time.Minute, 1.15e9},  // Same move, already reported
+		{3 * time.Hour, 1.3e9},      // Too slow, the earlier samples expired
+		{190 * time.Minute, 1.15e9}, // Flush
+	}
+	for _, step := range steps {
+		w.Handle("update", []interface{}{map[string]interface{}{"symbol": "XBTUSD", "openInterest": step.oi}}, start.Add(step.after))
+	}
+
+	expected := []string{
+		"📈 XBTUSD open interest +12.0% in 1 h to 1.1B contracts, positions are building up",
+		"📉 XBTUSD open interest -11.5% in 1 h to 1.1B contracts, positions are being flushed",
+	}
+	if len(alerts) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, alerts)
+	}
+	for i, alert := range alerts {
+		if alert != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], alert)
+		}
+	}
+}
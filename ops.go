@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// alertInterval is how often alerts of the same kind may be posted, so a flapping connection can't flood the channel.
+const alertInterval = time.Minute
+
+// Alerter posts operational events (reconnects, save failures, sink outages) for the people running the bot.
+// Every alert is logged; it is also sent to the ops channel and/or webhook when they are configured.
+type Alerter struct {
+	Session    *discordgo.Session
+	Channel    string
+	WebhookURL string
+	Client     *http.Client
+	Label      string
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// ops is the alerter used throughout the bot, it only logs until configured.
+var ops = &Alerter{}
+
+// Alert reports an operational event of the given kind.
+func (a *Alerter) Alert(kind string, format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	log.Println("Ops alert:", text)
+	metrics.Counter("rekt_ops_alerts_total", "kind", kind).Inc()
+
+	if a.Channel == "" && a.WebhookURL == "" {
+		return
+	}
+
+	a.mu.Lock()
+	if a.last == nil {
+		a.last = make(map[string]time.Time)
+	}
+	if time.Since(a.last[kind]) < alertInterval {
+		a.mu.Unlock()
+		return
+	}
+	a.last[kind] = time.Now()
+	a.mu.Unlock()
+
+	// Never hold up the caller, which is often the feed itself
+	go a.send(text)
+}
+
+func (a *Alerter) send(text string) {
+	text = "⚠️ " + text
+	if a.Label != "" {
+		text = a.Label + " " + text
+	}
+
+	if a.Channel != "" && a.Session != nil {
+		if _, err := a.Session.ChannelMessageSend(a.Channel, text); err != nil {
+			log.Println("Failed to send ops alert:", err)
+		}
+	}
+
+	if a.WebhookURL != "" {
+		body, _ := json.Marshal(map[string]string{"content": text})
+		client := a.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+
+		resp, err := client.Post(a.WebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Println("Failed to send ops alert:", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			log.Println("Failed to send ops alert:", resp.Status)
+		}
+	}
+}
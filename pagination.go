@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Replies Pages remembers at most, the oldest are forgotten past that.
+const maxPagedReplies = 100
+
+type (
+	// Pages splits long command replies over several pages, flipped through with buttons until Expiry.
+	Pages struct {
+		Expiry time.Duration
+
+		mu      sync.Mutex
+		next    int
+		replies map[string]*pagedReply
+		order   []string // Oldest first
+	}
+
+	pagedReply struct {
+		pages   []*discordgo.InteractionResponseData
+		created time.Time
+	}
+)
+
+// NewPages returns an empty store of paged replies that can be flipped through for expiry.
+func NewPages(expiry time.Duration) *Pages {
+	return &Pages{
+		Expiry:  expiry,
+		replies: make(map[string]*pagedReply),
+	}
+}
+
+// Reply returns the first page, with the buttons to the others when there is more than one.
+func (p *Pages) Reply(pages []*discordgo.InteractionResponseData) *discordgo.InteractionResponseData {
+	if len(pages) == 1 {
+		return pages[0]
+	}
+
+	now := time.Now()
+
+	p.mu.Lock()
+	p.next++
+	id := strconv.Itoa(p.next)
+	p.replies[id] = &pagedReply{pages: pages, created: now}
+	p.order = append(p.order, id)
+
+	// Forget the expired replies, which are the oldest
+	for len(p.order) > 0 && (len(p.order) > maxPagedReplies || now.Sub(p.replies[p.order[0]].created) > p.Expiry) {
+		delete(p.replies, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.mu.Unlock()
+
+	return withPageButtons(id, pages, 0)
+}
+
+// Handle answers the page buttons, whose custom IDs are "page:<reply>:<page>". The buttons of
+// expired replies are disabled.
+func (p *Pages) Handle(req *CommandRequest, args []string) (*discordgo.InteractionResponseData, error) {
+	if len(args) != 2 {
+		return nil, errors.New("bad page button")
+	}
+
+	p.mu.Lock()
+	reply, ok := p.replies[args[0]]
+	p.mu.Unlock()
+	if !ok || time.Since(reply.created) > p.Expiry {
+		return expiredPage(req.Interaction.Message), nil
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 || n >= len(reply.pages) {
+		return nil, errors.New("bad page button")
+	}
+
+	return withPageButtons(args[0], reply.pages, n), nil
+}
+
+// withPageButtons returns page n with the previous and next buttons.
+func withPageButtons(id string, pages []*discordgo.InteractionResponseData, n int) *discordgo.InteractionResponseData {
+	page := *pages[n]
+	page.Components = []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Prev", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("page:%v:%v", id, n-1), Disabled: n == 0},
+			discordgo.Button{Label: fmt.Sprintf("%v/%v", n+1, len(pages)), Style: discordgo.SecondaryButton, CustomID: "page:" + id, Disabled: true},
+			discordgo.Button{Label: "Next", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("page:%v:%v", id, n+1), Disabled: n == len(pages)-1},
+		}},
+	}
+
+	return &page
+}
+
+// expiredPage keeps the message as it is with its buttons disabled.
+func expiredPage(message *discordgo.Message) *discordgo.InteractionResponseData {
+	page := &discordgo.InteractionResponseData{
+		Content:         message.Content,
+		Embeds:          message.Embeds,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+
+	for _, component := range message.Components {
+		row, ok := component.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+
+		disabled := discordgo.ActionsRow{}
+		for _, c := range row.Components {
+			if button, ok := c.(*discordgo.Button); ok {
+				b := *button
+				b.Disabled = true
+				disabled.Components = append(disabled.Components, b)
+			}
+		}
+		page.Components = append(page.Components, disabled)
+	}
+
+	return page
+}
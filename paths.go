@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// homeEnv overrides where the config and the state live.
+const homeEnv = "REKT_HOME"
+
+// Where the config and the state files live, set from appDirs on startup.
+var configDir, stateDir = ".", "."
+
+// appDirs returns the directories of the config and of the state: REKT_HOME when set, the
+// working directory when it has a config.json as it always did, and the OS conventions otherwise,
+// $XDG_CONFIG_HOME/rekt and $XDG_STATE_HOME/rekt on Linux, %APPDATA%\rekt and %LOCALAPPDATA%\rekt on Windows.
+func appDirs() (config, state string) {
+	if home := os.Getenv(homeEnv); home != "" {
+		return home, home
+	}
+	if _, err := os.Stat("config.json"); err == nil {
+		return ".", "."
+	}
+
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return ".", "."
+	}
+	config = filepath.Join(base, "rekt")
+
+	switch runtime.GOOS {
+	case "windows":
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			return config, filepath.Join(local, "rekt")
+		}
+	case "darwin":
+		// Application Support holds both
+	default:
+		if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+			return config, filepath.Join(xdg, "rekt")
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return config, filepath.Join(home, ".local", "state", "rekt")
+		}
+	}
+	return config, config
+}
+
+// configPath returns the config file: $CONFIG when set, config.json in the config directory otherwise.
+func configPath() string {
+	if path := os.Getenv("CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(configDir, "config.json")
+}
+
+// statePath puts a relative state file in the state directory, creating it on first use.
+func statePath(name string) string {
+	if name == "" || filepath.IsAbs(name) || stateDir == "." {
+		return name
+	}
+
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return name
+	}
+	return filepath.Join(stateDir, name)
+}
+
+// assetPath finds a file shipped with the bot, such as the memes, in the working directory or
+// next to the executable, as services rarely start where the bot was installed.
+func assetPath(name string) string {
+	if filepath.IsAbs(name) || fileExists(name) {
+		return name
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return name
+	}
+	if beside := filepath.Join(filepath.Dir(exe), name); fileExists(beside) {
+		return beside
+	}
+	return name
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
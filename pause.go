@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// targetPause holds back the liquidations and announcements of a paused target, for the
+// catch-up summary.
+type targetPause struct {
+	since         time.Time
+	until         time.Time // Zero until resumed by hand
+	held          *Aggregator
+	announcements int // Held back
+	timer         *time.Timer
+}
+
+// Pause stops posting the liquidations and announcements for d, or until Resume when d is 0.
+// The liquidations keep being counted and are summed up on resume. It returns the pause, to
+// keep in the settings across restarts.
+func (t *TargetSink) Pause(d time.Duration) SavedPause {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pause == nil {
+		t.pause = &targetPause{since: time.Now(), held: &Aggregator{Format: t.Format}}
+	}
+	if t.pause.timer != nil {
+		t.pause.timer.Stop()
+		t.pause.timer = nil
+	}
+
+	t.pause.until = time.Time{}
+	if d > 0 {
+		t.pause.until = time.Now().Add(d)
+		t.endLater(t.pause)
+	}
+	return SavedPause{Since: t.pause.since, Until: t.pause.until}
+}
+
+// restorePause pauses the target as the settings kept it, unless it is paused already.
+func (t *TargetSink) restorePause(saved SavedPause) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pause != nil {
+		return
+	}
+	t.pause = &targetPause{since: saved.Since, until: saved.Until, held: &Aggregator{Format: t.Format}}
+	if !saved.Until.IsZero() {
+		t.endLater(t.pause)
+	}
+}
+
+// endLater resumes once the pause runs out, announcing the catch-up summary.
+func (t *TargetSink) endLater(pause *targetPause) {
+	pause.timer = time.AfterFunc(time.Until(pause.until), func() {
+		if text, ok := t.resume(pause); ok {
+			t.announce(text)
+		}
+	})
+}
+
+// Paused returns when the pause ends, zero when resumed by hand, and whether the target is paused.
+func (t *TargetSink) Paused() (until time.Time, paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pause == nil {
+		return time.Time{}, false
+	}
+	return t.pause.until, true
+}
+
+// Resume posts again, announcing what happened while paused.
+func (t *TargetSink) Resume() bool {
+	t.mu.Lock()
+	pause := t.pause
+	t.mu.Unlock()
+
+	text, ok := t.resume(pause)
+	if ok {
+		t.announce(text)
+	}
+	return ok
+}
+
+// resume ends the pause if it is still the current one, returning the catch-up summary.
+func (t *TargetSink) resume(pause *targetPause) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pause == nil || t.pause != pause {
+		return "", false
+	}
+	t.pause = nil
+	if pause.timer != nil {
+		pause.timer.Stop()
+	}
+
+	return catchUpText(pause, time.Now()), true
+}
+
+// takePause moves the pause of the previous sink of the channel over, to end on this one.
+func (t *TargetSink) takePause(prev *TargetSink) {
+	prev.mu.Lock()
+	pause := prev.pause
+	prev.pause = nil
+	prev.mu.Unlock()
+	if pause == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pause = pause
+	if pause.timer != nil {
+		pause.timer.Stop()
+		t.endLater(pause)
+	}
+}
+
+// hold counts the liquidation towards the catch-up summary when the target is paused.
+func (t *TargetSink) hold(dl DecoratedLiquidation) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pause == nil {
+		return false
+	}
+	t.pause.held.Add(dl)
+	return true
+}
+
+// holdAnnouncement counts the announcement towards the catch-up summary when the target is paused.
+func (t *TargetSink) holdAnnouncement() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pause == nil {
+		return false
+	}
+	t.pause.announcements++
+	return true
+}
+
+// catchUpText sums up a pause: "Back! Last 45 min: $12.0M longs / $3.0M shorts rekt across 17 orders".
+func catchUpText(pause *targetPause, now time.Time) string {
+	pause.held.Interval = now.Sub(pause.since).Round(time.Minute)
+	if pause.held.Interval < time.Minute {
+		pause.held.Interval = time.Minute
+	}
+
+	text := fmt.Sprintf("Back! Nothing got liquidated in the last %v", durationText(pause.held.Interval))
+	if summary := pause.held.flush(); summary != "" {
+		text = "Back! " + summary
+	}
+	switch {
+	case pause.announcements == 1:
+		text += ", 1 announcement was held back"
+	case pause.announcements > 1:
+		text += fmt.Sprintf(", %v announcements were held back", pause.announcements)
+	}
+	return text
+}
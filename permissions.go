@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Permission is who may run a command.
+type Permission string
+
+// Permissions
+const (
+	PermissionMember Permission = "member" // Stats and calculators, everyone unless the guild limits it to roles
+	PermissionAdmin  Permission = "admin"  // Changing the bot, server managers and the admin roles
+)
+
+// allowed tells whether the user who ran the command has the permission, going by the guild's roles
+// in the settings. People who can manage the server are always admins; there are no admins in DMs.
+func allowed(req *CommandRequest, settings *Settings, level Permission) bool {
+	member := req.Interaction.Member
+	if member == nil {
+		return level == PermissionMember
+	}
+
+	if member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0 {
+		return true
+	}
+	if settings == nil {
+		return level == PermissionMember
+	}
+
+	admins := settings.Roles(req.Interaction.GuildID, PermissionAdmin)
+	if hasRole(member, admins) {
+		return true
+	}
+	if level == PermissionAdmin {
+		return false
+	}
+
+	members := settings.Roles(req.Interaction.GuildID, PermissionMember)
+	return len(members) == 0 || hasRole(member, members)
+}
+
+func hasRole(member *discordgo.Member, roles []string) bool {
+	for _, role := range roles {
+		for _, memberRole := range member.Roles {
+			if role == memberRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rolesText mentions the roles, or tells who has the permission when there are none.
+func rolesText(roles []string, level Permission) string {
+	if len(roles) == 0 {
+		if level == PermissionAdmin {
+			return "server managers only"
+		}
+		return "everyone"
+	}
+
+	text := ""
+	for i, role := range roles {
+		if i > 0 {
+			text += ", "
+		}
+		text += fmt.Sprintf("<@&%v>", role)
+	}
+	return text
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPermissions(t *testing.T) {
+	settings, err := LoadSettings(filepath.Join(t.TempDir(), "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(member *discordgo.Member) *CommandRequest {
+		return &CommandRequest{Interaction: &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{GuildID: "guild", Member: member}}}
+	}
+	owner := request(&discordgo.Member{Permissions: discordgo.PermissionManageGuild})
+	mod := request(&discordgo.Member{Roles: []string{"mods"}})
+	pleb := request(&discordgo.Member{Roles: []string{"plebs"}})
+	dm := &CommandRequest{Interaction: &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{User: &discordgo.User{}}}}
+
+	check := func(name string, req *CommandRequest, level Permission, expected bool) {
+		if allowed(req, settings, level) != expected {
+			t.Errorf("%v: expected %v for %v to be %v", name, level, req.Interaction.Member, expected)
+		}
+	}
+
+	check("defaults", owner, PermissionAdmin, true)
+	check("defaults", mod, PermissionAdmin, false)
+	check("defaults", pleb, PermissionMember, true)
+	check("defaults", dm, PermissionMember, true)
+	check("defaults", dm, PermissionAdmin, false)
+
+	settings.SetRoles("guild", PermissionAdmin, []string{"mods"})
+	settings.SetRoles("guild", PermissionMember, []string{"subscribers"})
+
+	check("roles", mod, PermissionAdmin, true)
+	check("roles", mod, PermissionMember, true)
+	check("roles", pleb, PermissionMember, false)
+	check("roles", owner, PermissionMember, true)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DailyPin keeps the largest liquidation of the day pinned in a channel, unpinning the one it replaces.
+type DailyPin struct {
+	Settings *Settings // Whether each guild wants it
+	Default  bool      // For the guilds that didn't choose
+
+	mu      sync.Mutex
+	day     time.Time // UTC day of the pinned message
+	usd     int64
+	channel string
+	id      string
+}
+
+// Update pins the message if it is the largest of the day in the channel, sent being a liquidation worth usd.
+func (p *DailyPin) Update(session *discordgo.Session, channel string, sent *discordgo.Message, usd int64, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.replaces(usd, now) || !p.Settings.Pinning(channelGuild(session, channel), p.Default) {
+		return
+	}
+
+	if err := session.ChannelMessagePin(sent.ChannelID, sent.ID); err != nil {
+		log.Println("Failed to pin the daily record:", err)
+		return
+	}
+	if p.id != "" {
+		if err := session.ChannelMessageUnpin(p.channel, p.id); err != nil {
+			log.Println("Failed to unpin the previous record:", err)
+		}
+	}
+
+	p.day, p.usd, p.channel, p.id = now.UTC().Truncate(day), usd, sent.ChannelID, sent.ID
+}
+
+// Seed takes the largest liquidation of the day in the history that matches as the record, so a
+// restart doesn't pin a smaller one. Its message isn't known, it stays pinned once replaced.
+func (p *DailyPin) Seed(history *History, match func(l Liquidation) bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	today := now.UTC().Truncate(day)
+	for _, l := range history.Since(today, match) {
+		if usd := l.USDValue(); !l.Historical && usd > p.usd {
+			p.day, p.usd = today, usd
+		}
+	}
+}
+
+// replaces tells whether a liquidation worth usd takes the pin: it is the first of the day or larger than the pinned one.
+func (p *DailyPin) replaces(usd int64, now time.Time) bool {
+	return !now.UTC().Truncate(day).Equal(p.day) || usd > p.usd
+}
+
+// channelGuild returns the guild of the channel, empty when it can't be told.
+func channelGuild(session *discordgo.Session, channel string) string {
+	if c, err := session.State.Channel(channel); err == nil {
+		return c.GuildID
+	}
+	c, err := session.Channel(channel)
+	if err != nil {
+		log.Println("Failed to look up the channel:", err)
+		return ""
+	}
+	return c.GuildID
+}
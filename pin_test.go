@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDailyPinReplaces(t *testing.T) {
+	now := time.Date(2024, time.May, 1, 9, 0, 0, 0, time.UTC)
+
+	p := &DailyPin{}
+	if !p.replaces(1000, now) {
+		t.Error("the first liquidation should be pinned")
+	}
+
+	p.day, p.usd, p.id = now.Truncate(day), 5000000, "1"
+	tests := []struct {
+		usd      int64
+		now      time.Time
+		expected bool
+	}{
+		{1000000, now.Add(time.Hour), false},
+		{6000000, now.Add(time.Hour), true},
+		{1000000, now.Add(15 * time.Hour), true}, // Next day
+	}
+	for _, test := range tests {
+		if actual := p.replaces(test.usd, test.now); actual != test.expected {
+			t.Errorf("$%v at %v: expected %v, got %v", test.usd, test.now, test.expected, actual)
+		}
+	}
+}
+
+func TestDailyPinSeed(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	for _, l := range []Liquidation{
+		{Symbol: "XBTUSD", USD: 20000000, Received: now.UTC().Truncate(day).Add(-time.Hour)}, // Yesterday
+		{Symbol: "XBTUSD", USD: 5000000, Received: now},
+		{Symbol: "ETHUSD", USD: 8000000, Received: now},
+		{Symbol: "XBTUSD", USD: 9000000, Received: now, Historical: true},
+	} {
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &DailyPin{}
+	p.Seed(h, func(l Liquidation) bool { return l.Symbol == "XBTUSD" }, now)
+	if p.replaces(4000000, now) {
+		t.Error("expected a liquidation smaller than the record of the history not to be pinned")
+	}
+	if !p.replaces(6000000, now) {
+		t.Error("expected a liquidation larger than the record of the history to be pinned")
+	}
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+type (
+	// OverflowPolicy decides what happens to liquidations that don't fit in the delivery queue.
+	OverflowPolicy string
+
+	// Pipeline decorates liquidations, persists the state and hands the result to the sinks.
+	Pipeline struct {
+		State *State
+		Sinks []Sink // Replaced through SetSinks once the pipeline runs
+
+		// DryRun logs the messages instead of delivering them and leaves the state file untouched.
+		DryRun bool
+
+		// Overflow applies once Start has been called and the sinks fall behind.
+		Overflow OverflowPolicy
+
+		// Dedup drops liquidations identical to one seen just before, when set.
+		Dedup *Dedup
+
+		// CrossVenue groups an asset liquidated on several exchanges at once, when set.
+		CrossVenue *CrossVenue
+
+		// Format is that of the amounts of the announcements made to every sink, such as the
+		// summary of CatchUp.
+		Format NumberFormat
+
+		// Symbols names the contracts and their underlying, when set.
+		Symbols *SymbolMap
+
+		// Instruments values the liquidations from the contract specifications, when set.
+		Instruments *InstrumentCache
+
+		// Prices infer the leverage of the liquidated positions along with the instruments, when set.
+		Prices *PriceRange
+
+		// Quotes price the settlement coin of the quanto contracts, rather than the instrument
+		// fetched last, when set.
+		Quotes *PriceCache
+
+		// Depeg flags the contracts quoted in a stable coin that is off its peg, when set.
+		Depeg *DepegWatcher
+
+		// Quarantine keeps the liquidations a stage panicked on, they are only logged when nil.
+		Quarantine *Quarantine
+
+		// SinkTimeout bounds each delivery to a sink and each save of the state, 0 for no limit.
+		SinkTimeout time.Duration
+
+		ctx context.Context // Cancelled on shutdown, giving up on the deliveries under way
+
+		queue   chan delivery
+		workers sync.WaitGroup
+
+		sinksMu sync.RWMutex
+
+		// Serializes the decoration, the state and the stages before the queue, the feeds, the
+		// REST fallback and the inbox publishing from goroutines of their own
+		publishMu sync.Mutex
+
+		mu         sync.Mutex
+		stopped    bool
+		dropped    int
+		droppedQty int64
+		delivered  time.Time // When a delivery last finished, for the watchdog
+
+		// Deliveries held back behind the one of their order that is queued or being delivered,
+		// by order, so an amendment never overtakes the message it edits on another worker
+		orders map[string][]delivery
+	}
+
+	// delivery is waiting in the queue: either a liquidation, an amendment to one, a plain
+	// announcement when text is set or a post when post is.
+	delivery struct {
+		dl      DecoratedLiquidation
+		text    string
+		post    *Post
+		amended bool
+		span    *Span           // Trace of the liquidation, ended once delivered
+		to      func(Sink) bool // Sinks the announcement goes to, all of them when nil
+	}
+)
+
+// Overflow policies
+const (
+	OverflowDrop      OverflowPolicy = "drop"      // Only log and count the dropped liquidations
+	OverflowSummarize OverflowPolicy = "summarize" // Post a summary of what was dropped once the queue drains
+)
+
+// Start delivers to the sinks from a pool of workers reading a bounded queue, so slow sinks can
+// never stall the feed. Until it is called, Publish delivers inline. Cancelling the context
+// cancels the deliveries under way.
+func (p *Pipeline) Start(ctx context.Context, workers, queueSize int) {
+	p.ctx = ctx
+	p.queue = make(chan delivery, queueSize)
+	p.delivered = time.Now()
+
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+
+			for d := range p.queue {
+				metrics.Gauge("rekt_queue_depth").Set(float64(len(p.queue)))
+				p.deliverOrder(d)
+
+				p.mu.Lock()
+				p.delivered = time.Now()
+				p.mu.Unlock()
+
+				if len(p.queue) == 0 {
+					p.summarizeDropped()
+				}
+			}
+		}()
+	}
+}
+
+// SetSinks replaces the sinks, the deliveries under way finishing with the previous ones.
+func (p *Pipeline) SetSinks(sinks []Sink) {
+	p.sinksMu.Lock()
+	defer p.sinksMu.Unlock()
+
+	p.Sinks = sinks
+}
+
+func (p *Pipeline) sinks() []Sink {
+	p.sinksMu.RLock()
+	defer p.sinksMu.RUnlock()
+
+	return p.Sinks
+}
+
+// Stop waits for the queued liquidations to be delivered and stops the workers.
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	p.workers.Wait()
+}
+
+// Stalled tells whether deliveries are waiting in the queue while none finished within d, the
+// sinks being wedged.
+func (p *Pipeline) Stalled(now time.Time, d time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.queue) > 0 && now.Sub(p.delivered) > d
+}
+
+// QueueSize returns how many deliveries are waiting in the queue and how many it holds, 0 before Start.
+func (p *Pipeline) QueueSize() (queued, capacity int) {
+	return len(p.queue), cap(p.queue)
+}
+
+// Publish decorates the liquidation and sends it to every sink.
+func (p *Pipeline) Publish(l Liquidation) {
+	p.isolate("decorate", l, func() { p.publish(l) })
+}
+
+func (p *Pipeline) publish(l Liquidation) {
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	// The historical liquidations were missed or are replayed, they neither count as duplicates nor
+	// towards the state
+	if !l.Historical && p.Dedup != nil && p.Dedup.Duplicate(l, l.Received) {
+		metrics.Counter("rekt_duplicates_total").Inc()
+		return
+	}
+
+	// The trace starts on receipt, the time until now being spent decoding the frame
+	span := traces.Start("liquidation", l.Received)
+	span.SetAttribute("symbol", string(l.Symbol))
+	span.SetAttribute("exchange", l.Exchange)
+	span.Child("decode", l.Received).Finish(time.Now())
+
+	decorate := span.Child("decorate", time.Now())
+	p.describe(&l)
+
+	dl := DecoratedLiquidation{Liquidation: l}
+	if !l.Historical {
+		dl = p.State.Decorate(l)
+	}
+	observeStage("decorate", l.Received)
+	decorate.Finish(time.Now())
+
+	if p.DryRun {
+		log.Println("Dry run:", dl.String())
+		span.Finish(time.Now())
+		return
+	}
+
+	// The stages posting about the liquidations have nothing to do with the historical ones
+	if l.Historical {
+		p.enqueue(delivery{dl: dl, span: span})
+		return
+	}
+
+	// TODO: fix this: this does a disk write every time we tweet, which isn't too terrible since we barely do a tweet a second
+	persist := span.Child("persist", time.Now())
+	ctx, cancel := p.operation()
+	err := p.State.Save(ctx)
+	cancel()
+	if err != nil {
+		ops.Alert("state", "Failed to save state: %v", err)
+	}
+	observeStage("save", l.Received)
+	persist.Finish(time.Now())
+
+	held := func(by string) {
+		span.SetAttribute("held_by", by)
+		span.Finish(time.Now())
+	}
+
+	if p.CrossVenue != nil && !p.CrossVenue.Allow(l, p.Announce) {
+		held("cross_venue")
+		return
+	}
+
+	p.enqueue(delivery{dl: dl, span: span})
+}
+
+// Amend corrects the messages already sent about a liquidation the exchange amended. It goes
+// through the queue, held back until the message about the liquidation is delivered, and leaves
+// the state alone.
+func (p *Pipeline) Amend(l Liquidation) {
+	p.describe(&l)
+
+	if p.DryRun {
+		log.Println("Dry run, amended:", l.String())
+		return
+	}
+
+	p.enqueue(delivery{dl: DecoratedLiquidation{Liquidation: l}, amended: true})
+}
+
+// Worth sums up the liquidations in USD, valued as they are when published.
+func (p *Pipeline) Worth(ls []Liquidation) int64 {
+	var usd int64
+	for _, l := range ls {
+		p.describe(&l)
+		usd += l.USDValue()
+	}
+	return usd
+}
+
+// describe names and values the liquidation.
+func (p *Pipeline) describe(l *Liquidation) {
+	if p.Symbols != nil {
+		info := p.Symbols.Lookup(l.Symbol)
+		l.Display, l.Underlying, l.Emoji = info.Display, info.Underlying, info.Emoji
+	}
+
+	if p.Instruments != nil {
+		p.value(l)
+	}
+
+	if p.Depeg != nil {
+		l.Depeg = p.Depeg.Flag(l.Symbol)
+	}
+}
+
+// CatchUp posts a single summary of the liquidations found still open on reconnecting, rather
+// than each of them late. BitMex only lists the open orders, so it is no account of all that
+// went by. Each sink gets the summary of the liquidations its filter lets through.
+func (p *Pipeline) CatchUp(missed []Liquidation) {
+	described := make([]Liquidation, len(missed))
+	for i, l := range missed {
+		p.describe(&l)
+		described[i] = l
+	}
+
+	var texts []string
+	seen := make(map[string]bool)
+	for _, sink := range p.sinks() {
+		if text := p.catchUpText(sink, described); text != "" && !seen[text] {
+			seen[text] = true
+			texts = append(texts, text)
+		}
+	}
+	for _, text := range texts {
+		text := text
+		p.AnnounceTo(text, func(sink Sink) bool { return p.catchUpText(sink, described) == text })
+	}
+}
+
+// catchUpText sums up the liquidations that the filter of the sink lets through, in its format.
+func (p *Pipeline) catchUpText(sink Sink, missed []Liquidation) string {
+	match, f := func(Liquidation) bool { return true }, p.Format
+	switch sink := sink.(type) {
+	case *TargetSink:
+		filter := sink.Filter()
+		match = func(l Liquidation) bool { return filter.Match(l, sink.Prices) }
+		f = sink.Format
+	case *FilterSink:
+		match = func(l Liquidation) bool { return sink.Filter.Match(l, sink.Prices) }
+	}
+
+	var m Missed
+	for _, l := range missed {
+		if match(l) {
+			m.Add(l)
+		}
+	}
+	return m.Text("Still open on reconnecting", f)
+}
+
+// Backfill publishes the liquidations that went by while the bot wasn't listening as historical,
+// so the sinks storing them still get them, and posts the summary of CatchUp when summarize is set.
+func (p *Pipeline) Backfill(missed []Liquidation, summarize bool) {
+	for _, l := range missed {
+		l.Historical = true
+		p.Publish(l)
+	}
+
+	if summarize {
+		p.CatchUp(missed)
+	}
+}
+
+// Announce sends a plain message to every sink, through the queue like the liquidations.
+func (p *Pipeline) Announce(text string) {
+	if p.DryRun {
+		log.Println("Dry run:", text)
+		return
+	}
+
+	p.enqueue(delivery{text: text})
+}
+
+// AnnounceTo sends a plain message to the sinks to picks, through the queue like Announce.
+func (p *Pipeline) AnnounceTo(text string, to func(sink Sink) bool) {
+	if p.DryRun {
+		log.Println("Dry run:", text)
+		return
+	}
+
+	p.enqueue(delivery{text: text, to: to})
+}
+
+// PostTo sends a post to the sinks to picks that can take it, through the queue like AnnounceTo.
+func (p *Pipeline) PostTo(post Post, to func(sink Sink) bool) {
+	if p.DryRun {
+		log.Println("Dry run:", post.String())
+		return
+	}
+
+	p.enqueue(delivery{post: &post, to: to})
+}
+
+func (p *Pipeline) enqueue(d delivery) {
+	if p.queue == nil {
+		p.deliver(d)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	id := d.orderID()
+	if held, busy := p.orders[id]; busy {
+		p.orders[id] = append(held, d)
+		return
+	}
+
+	select {
+	case p.queue <- d:
+		metrics.Gauge("rekt_queue_depth").Set(float64(len(p.queue)))
+		if id != "" {
+			if p.orders == nil {
+				p.orders = make(map[string][]delivery)
+			}
+			p.orders[id] = nil
+		}
+	default:
+		metrics.Counter("rekt_dropped_total").Inc()
+		if d.text != "" {
+			log.Println("Delivery queue is full, dropping:", d.text)
+			return
+		}
+		if d.post != nil {
+			log.Println("Delivery queue is full, dropping:", d.post.String())
+			return
+		}
+		if d.amended {
+			log.Println("Delivery queue is full, dropping the amendment:", d.dl.Liquidation.String())
+			return
+		}
+		log.Println("Delivery queue is full, dropping:", d.dl.String())
+		d.span.SetAttribute("dropped", "true")
+		d.span.Finish(time.Now())
+
+		p.dropped++
+		p.droppedQty += d.dl.Liquidation.Quantity
+	}
+}
+
+// deliverOrder delivers d, then those of its order held back in the meantime, in turn.
+func (p *Pipeline) deliverOrder(d delivery) {
+	for {
+		p.deliver(d)
+
+		id := d.orderID()
+		if id == "" {
+			return
+		}
+
+		p.mu.Lock()
+		held := p.orders[id]
+		if len(held) == 0 {
+			delete(p.orders, id)
+			p.mu.Unlock()
+			return
+		}
+		d, p.orders[id] = held[0], held[1:]
+		p.mu.Unlock()
+	}
+}
+
+// orderID returns the order the delivery is about, empty for announcements.
+func (d delivery) orderID() string {
+	if d.text != "" || d.post != nil {
+		return ""
+	}
+	return d.dl.Liquidation.OrderID
+}
+
+// deliver sends the decorated liquidation, announcement or post to every sink.
+func (p *Pipeline) deliver(d delivery) {
+	if d.text != "" {
+		p.announce(d.text, d.to)
+		return
+	}
+	if d.post != nil {
+		p.sendPost(*d.post, d.to)
+		return
+	}
+	if d.amended {
+		for _, sink := range p.sinks() {
+			p.isolate("amend", d.dl.Liquidation, func() {
+				ctx, cancel := p.operation()
+				defer cancel()
+
+				if err := amend(ctx, sink, d.dl.Liquidation); err != nil && err != errBreakerOpen {
+					log.Printf("Failed to amend message %q: %v\n", d.dl.Liquidation.String(), err)
+				}
+			})
+		}
+		return
+	}
+
+	defer func() { d.span.Finish(time.Now()) }()
+
+	for _, sink := range p.sinks() {
+		publish := d.span.Child("publish", time.Now())
+		publish.SetAttribute("sink", fmt.Sprintf("%T", sink))
+
+		// A sink panicking on the liquidation doesn't keep it from the others
+		err := errSinkPanicked
+		p.isolate("publish", d.dl.Liquidation, func() {
+			ctx, cancel := p.operation()
+			defer cancel()
+
+			err = sink.Publish(ctx, d.dl)
+		})
+		if err != nil {
+			publish.SetAttribute("error", err.Error())
+		}
+		publish.Finish(time.Now())
+
+		if err == errBreakerOpen {
+			continue
+		} else if err != nil {
+			log.Printf("Failed to send message %q: %v\n", d.dl.String(), err)
+			continue
+		}
+		if d.dl.Liquidation.Historical {
+			continue
+		}
+		metrics.Summary("rekt_receive_to_post_seconds").Observe(time.Since(d.dl.Liquidation.Received).Seconds())
+	}
+}
+
+func (p *Pipeline) announce(text string, to func(Sink) bool) {
+	for _, sink := range p.sinks() {
+		if to != nil && !to(sink) {
+			continue
+		}
+
+		ctx, cancel := p.operation()
+		err := sink.Announce(ctx, text)
+		cancel()
+
+		if err != nil && err != errBreakerOpen {
+			log.Printf("Failed to send message %q: %v\n", text, err)
+		}
+	}
+}
+
+func (p *Pipeline) sendPost(post Post, to func(Sink) bool) {
+	for _, sink := range p.sinks() {
+		if to != nil && !to(sink) {
+			continue
+		}
+
+		ctx, cancel := p.operation()
+		err := sendPost(ctx, sink, post)
+		cancel()
+
+		if err != nil && err != errBreakerOpen {
+			log.Printf("Failed to send post %q: %v\n", post.String(), err)
+		}
+	}
+}
+
+// operation returns the context of a single delivery or save, bounded by SinkTimeout.
+func (p *Pipeline) operation() (context.Context, context.CancelFunc) {
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.SinkTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.SinkTimeout)
+}
+
+// errSinkPanicked is what a sink that panicked on a liquidation is taken to have returned.
+var errSinkPanicked = errors.New("the sink panicked")
+
+// isolate runs a stage of the handling of the liquidation, turning a panic into an alert and
+// the quarantine of the liquidation rather than the end of the bot.
+func (p *Pipeline) isolate(stage string, l Liquidation, run func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		metrics.Counter("rekt_panics_total", "stage", stage).Inc()
+		log.Printf("Panic in the %v stage: %v\n%s", stage, r, debug.Stack())
+
+		data, _ := json.Marshal(l)
+		p.Quarantine.Save("pipeline "+stage, time.Now(), data, fmt.Errorf("panic in the %v stage: %v", stage, r))
+	}()
+
+	run()
+}
+
+// summarizeDropped posts what was dropped since the last summary, if the policy asks for it.
+func (p *Pipeline) summarizeDropped() {
+	p.mu.Lock()
+	dropped, droppedQty := p.dropped, p.droppedQty
+	p.dropped, p.droppedQty = 0, 0
+	p.mu.Unlock()
+
+	if dropped == 0 || p.Overflow == OverflowDrop {
+		return
+	}
+
+	p.announce(fmt.Sprintf("Fell behind and skipped %v liquidations (%v contracts)", dropped, humanize.Comma(droppedQty)), nil)
+}
+
+// DebugState reports the queue for /debug/state.
+func (p *Pipeline) DebugState() interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return map[string]interface{}{
+		"queue_depth":    len(p.queue),
+		"queue_capacity": cap(p.queue),
+		"dropped":        p.dropped,
+		"stopped":        p.stopped,
+	}
+}
+
+// value fills in the coin quantity and USD notional of the liquidation from its instrument.
+// The symbol based guesses are kept when the instrument can't be fetched.
+func (p *Pipeline) value(l *Liquidation) {
+	instrument, err := p.Instruments.Get(l.Symbol)
+	if err != nil {
+		log.Println("Failed to value liquidation:", err)
+		return
+	}
+
+	// Quanto contracts settle in XBT whatever their underlying is
+	var settleUSD float64
+	if instrument.IsQuanto && instrument.SettlCurrency == "XBt" {
+		settleUSD = p.xbtPrice()
+		if settleUSD == 0 {
+			return
+		}
+	}
+
+	l.CoinQty, l.USD = instrument.Value(l.Quantity, l.Price, settleUSD)
+	l.Coin = instrument.Underlying
+	l.Loss = instrument.Loss(l.USD)
+
+	if p.Prices != nil {
+		if low, high, ok := p.Prices.Range(l.Symbol, l.Received); ok {
+			l.Leverage = inferLeverage(l.Position() == "long", l.Price, low, high, instrument.MaintMargin)
+		}
+		if l.Leverage > 0 {
+			l.Loss = l.USD / l.Leverage
+		}
+	}
+	if instrument.IsFutures() {
+		l.Expiry = instrument.Expiry
+	}
+}
+
+// xbtPrice returns the price of XBT from the quotes when they have a recent one, from its instrument
+// otherwise, 0 when neither can tell.
+func (p *Pipeline) xbtPrice() float64 {
+	if p.Quotes != nil {
+		if q, ok := p.Quotes.Get("BitMex", "XBTUSD"); ok {
+			if price, ok := q.Price(time.Now(), maxPriceAge); ok {
+				return price
+			}
+		}
+	}
+
+	xbt, err := p.Instruments.Get("XBTUSD")
+	if err != nil {
+		log.Println("Failed to value liquidation:", err)
+		return 0
+	}
+	return xbt.MarkPrice
+}
+
+// observeStage records how long after receipt the liquidation made it through a pipeline stage.
+func observeStage(stage string, received time.Time) {
+	metrics.Summary("rekt_stage_latency_seconds", "stage", stage).Observe(time.Since(received).Seconds())
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingSink holds up delivery until released.
+type blockingSink struct {
+	recordingSink
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.recordingSink.Publish(ctx, dl)
+}
+
+func TestPipelineOverflow(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowSummarize, OverflowDrop} {
+		state, err := NewState()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sink := &blockingSink{
+			started: make(chan struct{}, 16),
+			release: make(chan struct{}),
+		}
+		p := &Pipeline{State: state, Sinks: []Sink{sink}, Overflow: policy}
+		p.Start(context.Background(), 1, 2)
+
+		l := Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Buy"}
+
+		// The first liquidation occupies the worker, the next two fill the queue and the rest are dropped
+		p.Publish(l)
+		<-sink.started
+		for i := 0; i < 4; i++ {
+			p.Publish(l)
+		}
+
+		close(sink.release)
+		p.Stop()
+
+		if len(sink.published) != 3 {
+			t.Errorf("%v: expected 3 deliveries, got %d", policy, len(sink.published))
+		}
+
+		switch policy {
+		case OverflowSummarize:
+			if len(sink.announced) != 1 || !strings.Contains(sink.announced[0], "skipped 2 liquidations (20,000 contracts)") {
+				t.Errorf("%v: expected a summary of the dropped liquidations, got %q", policy, sink.announced)
+			}
+		case OverflowDrop:
+			if len(sink.announced) != 0 {
+				t.Errorf("%v: expected no summary, got %q", policy, sink.announced)
+			}
+		}
+	}
+}
+
+func TestPipelineHistorical(t *testing.T) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &recordingSink{}
+	p := &Pipeline{State: state, Sinks: []Sink{sink}, Dedup: NewDedup(time.Minute)}
+	p.Start(context.Background(), 1, 16)
+
+	// The backfilled liquidations reach the sinks without going through the dedup
+	p.Publish(Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"})
+	scores := state.HighScores.Scores["XBTUSD"]
+	p.Backfill([]Liquidation{
+		{Price: 8990, Quantity: 20000, Symbol: "XBTUSD", Side: "Sell"},
+		{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"},
+	}, false)
+
+	time.Sleep(150 * time.Millisecond)
+	p.Stop()
+
+	if len(sink.published) != 3 || !sink.published[1].Liquidation.Historical || !sink.published[2].Liquidation.Historical {
+		t.Fatal("expected the historical liquidations to be delivered, got", sink.published)
+	}
+	if after := state.HighScores.Scores["XBTUSD"]; after != scores || len(sink.published[1].Medals) != 0 {
+		t.Errorf("expected the historical liquidations to leave the scores alone, got %+v", after)
+	}
+	if len(sink.announced) != 0 {
+		t.Errorf("expected no summary, got %q", sink.announced)
+	}
+}
+
+func TestPipelineCatchUp(t *testing.T) {
+	all, eth := &recordingSink{}, &recordingSink{}
+	p := &Pipeline{Sinks: []Sink{all, NewTargetSink(Target{Channel: "eth", Filter: Filter{Symbols: []Symbol{"ETHUSD"}}}, eth)}}
+
+	p.CatchUp([]Liquidation{
+		{Symbol: "XBTUSD", Side: "Sell", Quantity: 50000, USD: 50000},
+		{Symbol: "ETHUSD", Side: "Buy", Quantity: 20000, USD: 20000},
+	})
+
+	if want := "Still open on reconnecting: $70.0K liquidated across 2 orders, largest $50.0K XBTUSD long"; len(all.announced) != 1 || all.announced[0] != want {
+		t.Errorf("expected %q, got %q", want, all.announced)
+	}
+	if want := "Still open on reconnecting: $20.0K liquidated across 1 order, largest $20.0K ETHUSD short"; len(eth.announced) != 1 || eth.announced[0] != want {
+		t.Errorf("expected the target to sum up what its filter lets through, %q, got %q", want, eth.announced)
+	}
+}
+
+// panickingSink panics on the liquidations of a symbol.
+type panickingSink struct {
+	recordingSink
+	symbol Symbol
+}
+
+func (s *panickingSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	if dl.Liquidation.Symbol == s.symbol {
+		panic("unexpected liquidation")
+	}
+	return s.recordingSink.Publish(ctx, dl)
+}
+
+func TestPipelineIsolatesPanics(t *testing.T) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad, good := &panickingSink{symbol: "XBTZ16"}, &recordingSink{}
+	p := &Pipeline{State: state, Sinks: []Sink{bad, good}, Quarantine: &Quarantine{Dir: t.TempDir()}}
+	p.Start(context.Background(), 1, 16)
+
+	p.Publish(Liquidation{Price: 9150, Quantity: 50000, Symbol: "XBTZ16", Side: "Sell"})
+	p.Publish(Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"})
+	p.Stop()
+
+	if len(bad.published) != 1 || len(good.published) != 2 {
+		t.Errorf("expected the panic to only cost the one delivery, got %v and %v", bad.published, good.published)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(p.Quarantine.Dir, "*-pipeline-publish.jsonl")); len(matches) != 1 {
+		t.Errorf("expected the liquidation to be quarantined, got %v", matches)
+	}
+}
+
+// stallingSink waits for its context, as a sink that stopped answering would.
+type stallingSink struct {
+	recordingSink
+
+	errs chan error
+}
+
+func (s *stallingSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	<-ctx.Done()
+	s.errs <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestPipelineCancellation(t *testing.T) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Liquidation{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"}
+
+	// Each delivery gives up after the timeout
+	sink := &stallingSink{errs: make(chan error, 1)}
+	p := &Pipeline{State: state, Sinks: []Sink{sink}, SinkTimeout: 10 * time.Millisecond}
+	p.Publish(l)
+	if err := <-sink.errs; err != context.DeadlineExceeded {
+		t.Error("expected the delivery to time out, got:", err)
+	}
+
+	// Shutting down cancels the deliveries under way
+	ctx, cancel := context.WithCancel(context.Background())
+	p = &Pipeline{State: state, Sinks: []Sink{sink}}
+	p.Start(ctx, 1, 16)
+	p.Publish(l)
+	cancel()
+	if err := <-sink.errs; err != context.Canceled {
+		t.Error("expected the delivery to be cancelled, got:", err)
+	}
+	p.Stop()
+}
+
+// formattingSink writes the messages out and throws them away, as a sink posting them would.
+type formattingSink struct{}
+
+func (formattingSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	dl.Format(DefaultFormat)
+	return nil
+}
+
+func (formattingSink) Announce(ctx context.Context, text string) error {
+	return nil
+}
+
+// BenchmarkHotPath runs a cascade through decoding, decorating and formatting.
+func BenchmarkHotPath(b *testing.B) {
+	defer func(saved *log.Logger) { rawLog = saved }(rawLog)
+	rawLog = log.New(ioutil.Discard, "", 0)
+
+	state, err := NewState()
+	if err != nil {
+		b.Fatal(err)
+	}
+	state.SaveFile = filepath.Join(b.TempDir(), "high_scores.json")
+
+	client := NewBitMexClient(BotConfig{}, &Pipeline{State: state, Sinks: []Sink{formattingSink{}}})
+	msg := cascadeFrame(b, 50)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Every insert of the same order after the first would be taken for a re-insert
+		client.trackOrders()
+		if err := client.handleMessage(msg, time.Now()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// slowSink takes a while to post, remembering the orders it posted as the Discord sink does.
+type slowSink struct {
+	mu      sync.Mutex
+	posted  map[string]bool
+	amended []Liquidation
+	lost    int // Amendments to orders not posted yet
+}
+
+func (s *slowSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	time.Sleep(20 * time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.posted[dl.Liquidation.OrderID] = true
+	return nil
+}
+
+func (s *slowSink) Announce(ctx context.Context, text string) error { return nil }
+
+func (s *slowSink) Amend(ctx context.Context, l Liquidation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.posted[l.OrderID] {
+		s.lost++
+		return nil
+	}
+	s.amended = append(s.amended, l)
+	return nil
+}
+
+func TestPipelineAmendsAfterThePost(t *testing.T) {
+	state, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &slowSink{posted: make(map[string]bool)}
+	p := &Pipeline{State: state, Sinks: []Sink{sink}}
+	p.Start(context.Background(), 4, 32)
+
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprint("order", i)
+		p.Publish(Liquidation{OrderID: id, Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"})
+		p.Amend(Liquidation{OrderID: id, Price: 8990, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"})
+		p.Amend(Liquidation{OrderID: id, Price: 8980, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"})
+	}
+	p.Stop()
+
+	if sink.lost != 0 || len(sink.amended) != 8 {
+		t.Fatalf("expected every amendment to follow its post, got %v lost and %v amended", sink.lost, len(sink.amended))
+	}
+	last := make(map[string]float64)
+	for _, l := range sink.amended {
+		last[l.OrderID] = l.Price
+	}
+	for id, price := range last {
+		if price != 8980 {
+			t.Errorf("expected the amendments of %v in order, ended at %v", id, price)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type (
+	// Quote is the latest prices of a symbol, each with when it was received, zero when the feeds
+	// didn't tell.
+	Quote struct {
+		Last, Mark, Index             float64
+		LastTime, MarkTime, IndexTime time.Time
+	}
+
+	// PriceCache keeps the latest prices of every symbol the exchange streams carry, for whatever
+	// needs a price: valuing the quanto contracts, /price and /liqprice. Any feed can write to it
+	// through Observe, the BitMex tables and the Binance trades have handlers of their own.
+	PriceCache struct {
+		mu     sync.RWMutex
+		quotes map[string]Quote // By exchange and symbol
+	}
+
+	// PriceKind is which price of a quote is observed.
+	PriceKind int
+)
+
+// The prices of a quote.
+const (
+	PriceLast PriceKind = iota
+	PriceMark
+	PriceIndex
+)
+
+// maxPriceAge is how old a price can be and still be used in place of fetching one.
+const maxPriceAge = 5 * time.Minute
+
+// NewPriceCache returns an empty cache.
+func NewPriceCache() *PriceCache {
+	return &PriceCache{quotes: make(map[string]Quote)}
+}
+
+func quoteKey(exchange string, symbol Symbol) string {
+	return strings.ToLower(exchange) + ":" + strings.ToUpper(string(symbol))
+}
+
+// Observe records a price of the symbol received at the time.
+func (c *PriceCache) Observe(exchange string, symbol Symbol, kind PriceKind, price float64, at time.Time) {
+	if price <= 0 || symbol == "" {
+		return
+	}
+	key := quoteKey(exchange, symbol)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	q := c.quotes[key]
+	switch kind {
+	case PriceLast:
+		q.Last, q.LastTime = price, at
+	case PriceMark:
+		q.Mark, q.MarkTime = price, at
+	case PriceIndex:
+		q.Index, q.IndexTime = price, at
+	}
+	c.quotes[key] = q
+	metrics.Gauge("rekt_price_cache_symbols").Set(float64(len(c.quotes)))
+}
+
+// Get returns the quote of the symbol, false when no feed carried it.
+func (c *PriceCache) Get(exchange string, symbol Symbol) (Quote, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	q, ok := c.quotes[quoteKey(exchange, symbol)]
+	return q, ok
+}
+
+// CoinUSD returns the dollar price of a coin from its BitMex or Binance dollar pairs, false
+// when none of them had a recent price.
+func (c *PriceCache) CoinUSD(coin string, now time.Time) (float64, bool) {
+	coin = strings.ToUpper(coin)
+	bitmex := coin
+	if coin == "BTC" {
+		bitmex = "XBT"
+	}
+
+	for _, pair := range []struct {
+		exchange string
+		symbol   Symbol
+	}{
+		{"BitMex", Symbol(bitmex + "USD")},
+		{"BitMex", Symbol(bitmex + "USDT")},
+		{"Binance", Symbol(coin + "USDT")},
+	} {
+		if q, ok := c.Get(pair.exchange, pair.symbol); ok {
+			if price, ok := q.Price(now, maxPriceAge); ok {
+				return price, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Price returns the mark price, or the last one without a mark, as long as it is younger than maxAge.
+func (q Quote) Price(now time.Time, maxAge time.Duration) (float64, bool) {
+	if q.Mark > 0 && now.Sub(q.MarkTime) <= maxAge {
+		return q.Mark, true
+	}
+	if q.Last > 0 && now.Sub(q.LastTime) <= maxAge {
+		return q.Last, true
+	}
+	return 0, false
+}
+
+// HandleBitMexInstrument is the TableHandler of the instrument table, whose updates only carry the
+// fields that changed. Its index prices are those of the indices the contracts track, so the
+// index of a contract is its indicative settlement price.
+func (c *PriceCache) HandleBitMexInstrument(action string, rows []interface{}, received time.Time) {
+	for _, row := range rows {
+		row, _ := row.(map[string]interface{})
+		symbol, _ := row["symbol"].(string)
+		for field, kind := range map[string]PriceKind{"lastPrice": PriceLast, "markPrice": PriceMark, "indicativeSettlePrice": PriceIndex} {
+			if price, ok := row[field].(float64); ok {
+				c.Observe("BitMex", Symbol(symbol), kind, price, received)
+			}
+		}
+	}
+}
+
+// HandleBitMexTrade is the TableHandler of the trade table.
+func (c *PriceCache) HandleBitMexTrade(action string, rows []interface{}, received time.Time) {
+	if action != "insert" {
+		return
+	}
+
+	for _, row := range rows {
+		row, _ := row.(map[string]interface{})
+		symbol, _ := row["symbol"].(string)
+		price, _ := row["price"].(float64)
+		c.Observe("BitMex", Symbol(symbol), PriceLast, price, received)
+	}
+}
+
+// ObserveTrade records the price of a trade from any exchange.
+func (c *PriceCache) ObserveTrade(t Trade, received time.Time) {
+	c.Observe(t.Exchange, Symbol(t.Symbol), PriceLast, t.Price, received)
+}
+
+// quoteText writes the quote: "XBTUSD on BitMex: last 65,000.5, mark 65,010.2, index 65,005.1, 2s ago".
+func quoteText(exchange string, symbol Symbol, q Quote, now time.Time) string {
+	f := NumberFormat{GroupPrices: true}
+
+	var parts []string
+	latest := time.Time{}
+	for _, p := range []struct {
+		name  string
+		price float64
+		at    time.Time
+	}{{"last", q.Last, q.LastTime}, {"mark", q.Mark, q.MarkTime}, {"index", q.Index, q.IndexTime}} {
+		if p.price <= 0 {
+			continue
+		}
+		parts = append(parts, p.name+" "+f.Price(p.price))
+		if p.at.After(latest) {
+			latest = p.at
+		}
+	}
+
+	return fmt.Sprintf("%v on %v: %v, %v ago", symbol, exchange, strings.Join(parts, ", "), durationText(now.Sub(latest).Round(time.Second)))
+}
+
+// priceCommand is /price, the latest prices the feeds carried for a symbol.
+func priceCommand(prices *PriceCache) *SlashCommand {
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "price",
+			Description: "Latest prices of a contract",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "symbol", Description: "Contract, XBTUSD by default"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "exchange", Description: "BitMex by default"},
+			},
+		},
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			symbol := Symbol(strings.ToUpper(req.String("symbol", "XBTUSD")))
+			exchange := req.String("exchange", "BitMex")
+
+			q, ok := prices.Get(exchange, symbol)
+			if !ok {
+				return nil, fmt.Errorf("no price of %v on %v yet", symbol, exchange)
+			}
+			return &discordgo.InteractionResponseData{Content: quoteText(exchange, symbol, q, time.Now())}, nil
+		},
+	}
+}
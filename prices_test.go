@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceCache(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := NewPriceCache()
+
+	c.HandleBitMexInstrument("partial", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "lastPrice": 65000.5, "markPrice": 65010.25, "indicativeSettlePrice": 65005.0},
+	}, now.Add(-time.Minute))
+	// Updates only carry what changed
+	c.HandleBitMexInstrument("update", []interface{}{map[string]interface{}{"symbol": "XBTUSD", "markPrice": 65020.0}}, now.Add(-2*time.Second))
+	c.ObserveTrade(Trade{Exchange: "Binance", Symbol: "BTCUSDT", Price: 64990}, now)
+
+	q, ok := c.Get("bitmex", "xbtusd")
+	if !ok || q.Last != 65000.5 || q.Mark != 65020 || q.Index != 65005 {
+		t.Fatalf("unexpected quote %+v", q)
+	}
+	if price, ok := q.Price(now, maxPriceAge); !ok || price != 65020 {
+		t.Errorf("expected the mark price, got %v, %v", price, ok)
+	}
+	if _, ok := q.Price(now.Add(time.Hour), maxPriceAge); ok {
+		t.Error("expected an old price to be refused")
+	}
+
+	expected := "XBTUSD on BitMex: last 65,000.5, mark 65,020, index 65,005, 2s ago"
+	if text := quoteText("BitMex", "XBTUSD", q, now); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	if q, ok := c.Get("Binance", "BTCUSDT"); !ok || q.Last != 64990 || q.Mark != 0 {
+		t.Errorf("unexpected Binance quote %+v", q)
+	}
+}
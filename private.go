@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// PositionWatcher follows the account's positions and margin on the private stream and warns
+// when they get close to liquidation.
+type PositionWatcher struct {
+	Sink Sink
+
+	Distance    float64 // Warn when the mark price is within this fraction of the liquidation price
+	MarginRatio float64 // Warn when maintenance margin uses this fraction of the margin balance
+
+	// Rows of the position (by symbol) and margin (by currency) tables, updates only carry the changed fields
+	tables map[string]map[string]map[string]interface{}
+
+	// Warnings that were sent and haven't been cleared by the position getting safer
+	warned map[string]bool
+}
+
+// NewPositionWatcher returns a watcher sending its warnings to the sink.
+func NewPositionWatcher(sink Sink, distance, marginRatio float64) *PositionWatcher {
+	return &PositionWatcher{
+		Sink:        sink,
+		Distance:    distance,
+		MarginRatio: marginRatio,
+		tables: map[string]map[string]map[string]interface{}{
+			"position": make(map[string]map[string]interface{}),
+			"margin":   make(map[string]map[string]interface{}),
+		},
+		warned: make(map[string]bool),
+	}
+}
+
+// Handle applies a frame of the position or margin table and checks the affected rows.
+func (w *PositionWatcher) Handle(table, action string, rows []interface{}) {
+	key := "symbol"
+	if table == "margin" {
+		key = "currency"
+	}
+
+	byKey := w.tables[table]
+	if action == "partial" {
+		for id := range byKey {
+			delete(byKey, id)
+		}
+	}
+
+	for _, row := range rows {
+		row := row.(map[string]interface{})
+		id, _ := row[key].(string)
+
+		switch action {
+		case "partial", "insert":
+			byKey[id] = row
+
+		case "update":
+			merged, ok := byKey[id]
+			if !ok {
+				merged = make(map[string]interface{})
+				byKey[id] = merged
+			}
+			for k, v := range row {
+				merged[k] = v
+			}
+
+		case "delete":
+			delete(byKey, id)
+			delete(w.warned, table+" "+id)
+			continue
+		}
+
+		if table == "margin" {
+			w.checkMargin(id, byKey[id])
+		} else {
+			w.checkPosition(id, byKey[id])
+		}
+	}
+}
+
+func (w *PositionWatcher) checkPosition(symbol string, position map[string]interface{}) {
+	qty, _ := position["currentQty"].(float64)
+	mark, _ := position["markPrice"].(float64)
+	liquidation, _ := position["liquidationPrice"].(float64)
+
+	if qty == 0 || mark == 0 || liquidation == 0 {
+		delete(w.warned, "position "+symbol)
+		return
+	}
+
+	side := "long"
+	if qty < 0 {
+		side = "short"
+	}
+
+	distance := math.Abs(mark-liquidation) / mark
+	w.warn("position "+symbol, distance <= w.Distance, distance > 2*w.Distance,
+		fmt.Sprintf("Your %v %v of %v is %.1f%% away from liquidation at %v (mark %v)",
+			symbol, side, humanize.Comma(int64(math.Abs(qty))), distance*100, liquidation, mark))
+}
+
+func (w *PositionWatcher) checkMargin(currency string, margin map[string]interface{}) {
+	balance, _ := margin["marginBalance"].(float64)
+	maint, _ := margin["maintMargin"].(float64)
+
+	if balance <= 0 {
+		return
+	}
+
+	ratio := maint / balance
+	w.warn("margin "+currency, ratio >= w.MarginRatio, ratio < 0.9*w.MarginRatio,
+		fmt.Sprintf("Your %v maintenance margin is %.0f%% of your margin balance", currency, ratio*100))
+}
+
+// warn sends the warning once when entering danger, and re-arms it once things are safe again.
+func (w *PositionWatcher) warn(id string, danger, safe bool, text string) {
+	switch {
+	case danger && !w.warned[id]:
+		w.warned[id] = true
+		if err := announceLater(w.Sink, text); err != nil {
+			log.Printf("Failed to send message %q: %v\n", text, err)
+		}
+
+	case safe:
+		delete(w.warned, id)
+	}
+}
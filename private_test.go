@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPositionWatcher(t *testing.T) {
+	sink := &recordingSink{}
+	w := NewPositionWatcher(sink, 0.05, 0.8)
+
+	w.Handle("position", "partial", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "currentQty": 10000.0, "markPrice": 9000.0, "liquidationPrice": 8000.0},
+	})
+	if len(sink.announced) != 0 {
+		t.Fatal("no warning expected while far from liquidation:", sink.announced)
+	}
+
+	// Updates only carry the changed fields
+	w.Handle("position", "update", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "markPrice": 8300.0},
+	})
+	w.Handle("position", "update", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "markPrice": 8200.0},
+	})
+	if len(sink.announced) != 1 || !strings.Contains(sink.announced[0], "XBTUSD long of 10,000 is 3.6% away") {
+		t.Fatalf("expected a single warning, got %q", sink.announced)
+	}
+
+	// Recovering re-arms the warning
+	w.Handle("position", "update", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "markPrice": 9500.0},
+	})
+	w.Handle("position", "update", []interface{}{
+		map[string]interface{}{"symbol": "XBTUSD", "markPrice": 8100.0},
+	})
+	if len(sink.announced) != 2 {
+		t.Fatalf("expected a second warning, got %q", sink.announced)
+	}
+
+	w.Handle("margin", "partial", []interface{}{
+		map[string]interface{}{"currency": "XBt", "marginBalance": 1000000.0, "maintMargin": 850000.0},
+	})
+	if len(sink.announced) != 3 || !strings.Contains(sink.announced[2], "XBt maintenance margin is 85%") {
+		t.Fatalf("expected a margin warning, got %q", sink.announced)
+	}
+}
+
+func TestAuthHeader(t *testing.T) {
+	header := authHeader("LAqUlngMIQkIUjXMUreyu3qn", "chNOOS4KvNXR_Xq4k4c9qsfoKWvnDecLATCRlcBwyKDYnWgO", 1518064236)
+
+	if header.Get("api-signature") != "6d459dc02866d35a2b965edeecc68063d488e296b77982235fc6eca24b934945" {
+		t.Error("unexpected signature:", header.Get("api-signature"))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+)
+
+// liquidationProto is the protobuf schema of the events in the protobuf format of the dashboard
+// API, as rekt schema proto prints it. The messages are written one after the other, each with
+// its length in front as a varint, the way protobuf's writeDelimitedTo does. An empty message
+// only keeps the connection alive.
+const liquidationProto = `syntax = "proto3";
+
+package rekt;
+
+message Event {
+  oneof event {
+    Liquidation liquidation = 1;
+    Announcement announcement = 2;
+    Liquidation amended = 3; // A liquidation the exchange amended, sent again with its new values
+  }
+}
+
+message Liquidation {
+  int64 time_unix_ms = 1;
+  string exchange = 2;
+  string symbol = 3;
+  string name = 4;
+  string position = 5; // "long" or "short", the side that was liquidated
+  double price = 6;
+  int64 quantity = 7;
+  int64 usd = 8;
+  string text = 9; // As posted to Discord
+  string id = 10; // Idempotency key, the same when the event is sent again
+  bool historical = 11; // Backfilled or replayed rather than live
+}
+
+message Announcement {
+  string text = 1;
+}
+`
+
+// protobufContentType is what the protobuf format is served as.
+const protobufContentType = "application/x-protobuf; messageType=rekt.Event; delimited=true"
+
+// Protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+func appendProtoVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendProtoTag(b []byte, field, wireType int) []byte {
+	return appendProtoVarint(b, uint64(field<<3|wireType))
+}
+
+// The fields left at their zero value aren't written, as in proto3.
+func appendProtoString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendProtoTag(b, field, protoBytes)
+	b = appendProtoVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendProtoInt64(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	return appendProtoVarint(appendProtoTag(b, field, protoVarint), uint64(v))
+}
+
+func appendProtoBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendProtoVarint(appendProtoTag(b, field, protoVarint), 1)
+}
+
+func appendProtoDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	var fixed [8]byte
+	binary.LittleEndian.PutUint64(fixed[:], math.Float64bits(v))
+	return append(appendProtoTag(b, field, protoFixed64), fixed[:]...)
+}
+
+func appendProtoMessage(b []byte, field int, message []byte) []byte {
+	b = appendProtoTag(b, field, protoBytes)
+	b = appendProtoVarint(b, uint64(len(message)))
+	return append(b, message...)
+}
+
+// protoLiquidationEvent encodes the liquidation as an Event, of the "liquidation" or "amended" kind.
+func protoLiquidationEvent(kind string, e dashboardEvent) []byte {
+	var l []byte
+	l = appendProtoInt64(l, 1, e.Time.UnixNano()/1e6)
+	l = appendProtoString(l, 2, e.Exchange)
+	l = appendProtoString(l, 3, string(e.Symbol))
+	l = appendProtoString(l, 4, e.Name)
+	l = appendProtoString(l, 5, e.Position)
+	l = appendProtoDouble(l, 6, e.Price)
+	l = appendProtoInt64(l, 7, e.Quantity)
+	l = appendProtoInt64(l, 8, e.USD)
+	l = appendProtoString(l, 9, e.Text)
+	l = appendProtoString(l, 10, e.ID)
+	l = appendProtoBool(l, 11, e.Historical)
+	if kind == "amended" {
+		return appendProtoMessage(nil, 3, l)
+	}
+	return appendProtoMessage(nil, 1, l)
+}
+
+// protoAnnouncementEvent encodes the announcement as an Event.
+func protoAnnouncementEvent(text string) []byte {
+	return appendProtoMessage(nil, 2, appendProtoString(nil, 1, text))
+}
+
+// writeDelimited writes the message with its length in front.
+func writeDelimited(w http.ResponseWriter, message []byte) error {
+	_, err := w.Write(append(appendProtoVarint(nil, uint64(len(message))), message...))
+	return err
+}
+
+// wantsProtobuf tells whether the request asks for the protobuf format, with ?format=protobuf
+// or by accepting it.
+func wantsProtobuf(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "protobuf" || r.Header.Get("Accept") == "application/x-protobuf"
+}
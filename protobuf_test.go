@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// protoFields decodes the fields of a message, by number, the varints and the bytes as is.
+func protoFields(t *testing.T, b []byte) map[int][]byte {
+	fields := make(map[int][]byte)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		switch wireType {
+		case protoVarint:
+			_, n := binary.Uvarint(b)
+			fields[field], b = b[:n], b[n:]
+		case protoFixed64:
+			fields[field], b = b[:8], b[8:]
+		case protoBytes:
+			length, n := binary.Uvarint(b)
+			fields[field], b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %v", wireType)
+		}
+	}
+	return fields
+}
+
+func TestProtobufEvents(t *testing.T) {
+	if got, expected := protoAnnouncementEvent("hi"), []byte{0x12, 0x04, 0x0a, 0x02, 'h', 'i'}; !bytes.Equal(got, expected) {
+		t.Errorf("expected %x, got %x", expected, got)
+	}
+
+	at := time.Unix(1700000000, 0)
+	event := protoFields(t, protoLiquidationEvent("liquidation", dashboardEvent{Time: at, Symbol: "XBTUSD", Position: "long", Price: 65000.5, Quantity: 1000, USD: 1000}))
+	l := protoFields(t, event[1])
+	if ms, _ := binary.Uvarint(l[1]); ms != 1700000000000 {
+		t.Errorf("expected the time in milliseconds, got %v", ms)
+	}
+	if string(l[3]) != "XBTUSD" || string(l[5]) != "long" {
+		t.Errorf("unexpected symbol %q or position %q", l[3], l[5])
+	}
+	if price := math.Float64frombits(binary.LittleEndian.Uint64(l[6])); price != 65000.5 {
+		t.Errorf("expected the price, got %v", price)
+	}
+	if _, ok := l[2]; ok {
+		t.Error("expected the empty exchange to be left out")
+	}
+
+	w := httptest.NewRecorder()
+	writeDelimited(w, protoAnnouncementEvent("hi"))
+	if got := w.Body.Bytes(); len(got) != 7 || got[0] != 6 {
+		t.Errorf("expected the length in front, got %x", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/websocket"
+)
+
+// ProxyFunc picks the proxy for an outgoing request, as used by http.Transport and websocket.Dialer.
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// newProxy returns the configured proxy, or the one from HTTP_PROXY / HTTPS_PROXY / NO_PROXY when there is none.
+func newProxy(raw string) (ProxyFunc, error) {
+	if raw == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+	}
+
+	return http.ProxyURL(u), nil
+}
+
+// newDialer returns a websocket dialer going through the proxy.
+func newDialer(proxy ProxyFunc) *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            proxy,
+		HandshakeTimeout: 45 * time.Second,
+	}
+}
+
+// countingConn counts the bytes read from the network, to measure what compression saves.
+type countingConn struct {
+	net.Conn
+	read *Counter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// countingDialer returns a copy of the dialer counting the bytes read from its connections into read.
+func countingDialer(d *websocket.Dialer, read *Counter) *websocket.Dialer {
+	counting := *d
+	dial := d.NetDialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	counting.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &countingConn{Conn: conn, read: read}, nil
+	}
+
+	return &counting
+}
+
+// newHTTPClient returns an HTTP client going through the proxy.
+func newHTTPClient(proxy ProxyFunc) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &http.Client{Transport: transport, Timeout: 20 * time.Second}
+}
+
+// useProxy routes both the Discord REST API and the gateway websocket through the proxy.
+func useProxy(s *discordgo.Session, proxy ProxyFunc) {
+	s.Client = newHTTPClient(proxy)
+	s.Dialer = newDialer(proxy)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quarantine keeps the frames that couldn't be processed, a file each, so a change of payload
+// can be looked into and replayed with rekt replay instead of crashing the bot or going unnoticed.
+type Quarantine struct {
+	Dir string
+	Max int // Files kept, the oldest removed past it, 0 for no limit
+
+	mu sync.Mutex
+}
+
+// quarantinedFrame is a frame as Replay reads it, along with what went wrong with it.
+type quarantinedFrame struct {
+	Frame
+	Raw    string `json:"raw,omitempty"` // The frame as received when it isn't even JSON
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+// malformedFrame is the error of a frame that doesn't look the way it should.
+type malformedFrame struct {
+	Reason interface{}
+}
+
+func (e *malformedFrame) Error() string {
+	return fmt.Sprintf("malformed frame: %v", e.Reason)
+}
+
+// Save writes the frame to the quarantine and alerts about it. Without a directory, the frame is only logged.
+func (q *Quarantine) Save(source string, received time.Time, msg []byte, reason error) {
+	metrics.Counter("rekt_quarantined_frames_total", "source", source).Inc()
+	ops.Alert("quarantine_"+source, "Quarantined a frame from %v that couldn't be processed: %v", source, reason)
+
+	if q == nil || q.Dir == "" {
+		log.Printf("Skipping a frame from %v: %q\n", source, msg)
+		return
+	}
+
+	frame := quarantinedFrame{Frame: Frame{Time: received}, Source: source, Reason: reason.Error()}
+	if json.Valid(msg) {
+		frame.Data = msg
+	} else {
+		frame.Raw = string(msg)
+	}
+
+	if err := q.write(source, frame); err != nil {
+		log.Println("Failed to quarantine the frame:", err)
+	}
+}
+
+func (q *Quarantine) write(source string, frame quarantinedFrame) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.MkdirAll(q.Dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	slug := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '/' || r == '\\' {
+			return '-'
+		}
+		return r
+	}, strings.ToLower(source))
+	name := frame.Time.UTC().Format("20060102T150405.000000") + "-" + slug + ".jsonl"
+	if err := ioutil.WriteFile(filepath.Join(q.Dir, name), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	log.Println("Quarantined a frame to", filepath.Join(q.Dir, name))
+
+	return q.prune()
+}
+
+// prune removes the oldest files past Max.
+func (q *Quarantine) prune() error {
+	if q.Max <= 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(q.Dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".jsonl") {
+			names = append(names, entry.Name())
+		}
+	}
+
+	// The names start with the time
+	sort.Strings(names)
+	for len(names) > q.Max {
+		if err := os.Remove(filepath.Join(q.Dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// recoverMalformed turns the panic of a handler meeting an unexpected schema into a malformedFrame error.
+func recoverMalformed(err *error) {
+	if r := recover(); r != nil {
+		*err = &malformedFrame{Reason: r}
+	}
+}
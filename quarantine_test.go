@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestQuarantine(t *testing.T) {
+	q := &Quarantine{Dir: t.TempDir(), Max: 2}
+	received := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	q.Save("BitMex", received, []byte(`{"table":"liquidation","action":"insert","data":"oops"}`), &malformedFrame{Reason: "bad cast"})
+	q.Save("BitMex", received.Add(time.Second), []byte("not json"), &malformedFrame{Reason: "invalid"})
+	q.Save("Binance", received.Add(2*time.Second), []byte(`{}`), &malformedFrame{Reason: "empty"})
+
+	matches, _ := filepath.Glob(filepath.Join(q.Dir, "*.jsonl"))
+	if len(matches) != 2 {
+		t.Fatalf("expected the 2 most recent frames to be kept, got %v", matches)
+	}
+	if !strings.HasSuffix(matches[0], "20240601T120001.000000-bitmex.jsonl") {
+		t.Errorf("expected the oldest frame to be pruned, got %v", matches)
+	}
+
+	data, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frame quarantinedFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Raw != "not json" || frame.Source != "BitMex" || frame.Reason != "malformed frame: invalid" {
+		t.Errorf("expected the raw frame and its reason, got %+v", frame)
+	}
+}
+
+func TestBitMexClientQuarantine(t *testing.T) {
+	m := newMockBitMex(t,
+		// The rows of the liquidation table are objects
+		liquidationFrame("insert", nil),
+		map[string]interface{}{"table": "liquidation", "action": "insert", "data": []interface{}{"not a row"}},
+		liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000)),
+	)
+
+	client, sink := newTestClient(t)
+	client.URL = m.URL()
+	client.Quarantine = &Quarantine{Dir: t.TempDir()}
+
+	if err := client.Run(context.Background()); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatal("expected the bad frames to be skipped, got:", err)
+	}
+	if len(sink.published) != 1 {
+		t.Errorf("expected the frame after the bad ones to be handled, got %v", sink.published)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(client.Quarantine.Dir, "*.jsonl")); len(matches) != 2 {
+		t.Errorf("expected the bad frames to be quarantined, got %v", matches)
+	}
+}
+
+func TestBitMexClientQuarantineRow(t *testing.T) {
+	client, sink := newTestClient(t)
+	client.Quarantine = &Quarantine{Dir: t.TempDir()}
+
+	missingPrice := liquidationRow("a", "XBTUSD", "Sell", 9000, 20000)
+	delete(missingPrice, "price")
+	if err := client.handleMessage(frameJSON(t, liquidationFrame("insert", missingPrice, liquidationRow("b", "XBTUSD", "Buy", 9100, 30000))), time.Now()); err != nil {
+		t.Fatal("expected the bad row to be handled on its own, got", err)
+	}
+
+	if len(sink.published) != 1 || sink.published[0].Liquidation.OrderID != "b" {
+		t.Errorf("expected the other row to be published, got %v", sink.published)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(client.Quarantine.Dir, "*-bitmex-liquidation.jsonl")); len(matches) != 1 {
+		t.Errorf("expected the row to be quarantined, got %v", matches)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	humanize "github.com/dustin/go-humanize"
+)
+
+type (
+	// Recap posts the daily and weekly totals from the history after each midnight, compared
+	// with the period before and with the same weekday of the previous weeks. The guilds that
+	// chose a timezone get the recaps of their own days, the others those of the UTC days.
+	Recap struct {
+		History *History
+		Daily   bool
+		Weekly  bool         // Posted on Mondays for the week before
+		Format  NumberFormat // Of the amounts
+
+		// Zones returns the timezones chosen besides UTC, when set.
+		Zones func() []*time.Location
+
+		// Reminder gives notice of the weekly recap on Sundays, when set.
+		Reminder *RecapReminder
+
+		// ThirdParty adds the totals of the other exchanges to the recaps, when set.
+		ThirdParty *ThirdPartyTotals
+
+		// Heatmaps follow the daily recap of UTC, when set.
+		Heatmaps *RecapHeatmaps
+
+		// Gaps are noted in the daily recap with an estimate of what they missed, when set.
+		Gaps *Gaps
+	}
+
+	// recapTotals sums up the liquidations of a period.
+	recapTotals struct {
+		orders        int
+		longs, shorts int64
+	}
+)
+
+const day = 24 * time.Hour
+
+// recapTick is how often Run looks for a midnight, the offsets of the timezones being whole
+// quarters of an hour.
+const recapTick = 15 * time.Minute
+
+// Run waits for each midnight, of UTC and of the timezones chosen, and announces the recaps that
+// are due to the guilds of the timezone. What isn't plain text is posted to them with post.
+func (r *Recap) Run(announce func(text string, zone *time.Location), post func(post Post, zone *time.Location)) {
+	for {
+		now := time.Now()
+		tick := now.Truncate(recapTick).Add(recapTick)
+		time.Sleep(tick.Sub(now))
+
+		for _, zone := range r.zones() {
+			midnight := tick.In(zone)
+			if midnight.Hour() != 0 || midnight.Minute() != 0 {
+				continue
+			}
+			for _, text := range r.due(midnight) {
+				announce(text, zone)
+			}
+		}
+
+		midnight := tick.UTC()
+		if midnight.Hour() != 0 || midnight.Minute() != 0 {
+			continue
+		}
+		if r.Daily && r.Heatmaps != nil {
+			for _, p := range r.Heatmaps.Posts(r.History, midnight.Add(-day)) {
+				post(p, time.UTC)
+			}
+		}
+		if r.Weekly && r.Reminder != nil && midnight.Weekday() == time.Sunday {
+			r.Reminder.Remind(midnight.Add(day), func(text string) { announce(text, time.UTC) }, func(p Post) { post(p, time.UTC) })
+		}
+	}
+}
+
+// zones returns UTC and the timezones chosen.
+func (r *Recap) zones() []*time.Location {
+	zones := []*time.Location{time.UTC}
+	if r.Zones != nil {
+		zones = append(zones, r.Zones()...)
+	}
+	return zones
+}
+
+// recapZone returns the timezone of the recaps the sink posts, that of its guild for a target
+// and UTC for the other sinks.
+func recapZone(session *discordgo.Session, settings *Settings, sink Sink) *time.Location {
+	target, ok := sink.(*TargetSink)
+	if !ok {
+		return time.UTC
+	}
+	guild := channelGuild(session, target.Channel)
+	if guild == "" {
+		return time.UTC
+	}
+	return settings.Timezone(guild)
+}
+
+// due returns the recaps of the periods that ended at midnight, in the timezone of midnight.
+func (r *Recap) due(midnight time.Time) []string {
+	var recaps []string
+	if r.Daily {
+		if text := r.daily(midnight.AddDate(0, 0, -1)); text != "" {
+			recaps = append(recaps, text)
+		}
+	}
+	if r.Weekly && midnight.Weekday() == time.Monday {
+		if text := r.weekly(midnight.AddDate(0, 0, -7)); text != "" {
+			recaps = append(recaps, text)
+		}
+	}
+	return recaps
+}
+
+// daily recaps the day starting at start: "Recap of Tue Mar 26: $120.5M rekt ..., +240% vs yesterday, largest Tuesday since Mar 5".
+func (r *Recap) daily(start time.Time) string {
+	end := start.AddDate(0, 0, 1)
+	totals := r.totals(start, end)
+	if totals.orders == 0 {
+		// A day without orders is worth a word when the feeds were down for some of it
+		var gaps []Gap
+		if r.Gaps != nil {
+			gaps = r.Gaps.Within(start, end)
+		}
+		if len(gaps) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("Recap of %v: nothing got liquidated", start.Format("Mon Jan 2")) + gapText(gaps, start, end, 0, r.Format)
+	}
+
+	text := fmt.Sprintf("Recap of %v: %v", start.Format("Mon Jan 2"), totals.text(r.Format))
+	if change := changeText(totals.usd(), r.totals(start.AddDate(0, 0, -1), start).usd()); change != "" {
+		text += ", " + change + " vs yesterday"
+	}
+	if record := r.weekdayRecord(start, totals.usd()); record != "" {
+		text += ", " + record
+	}
+
+	text += r.elsewhere(start, end)
+	if r.Gaps != nil {
+		text += gapText(r.Gaps.Within(start, end), start, end, totals.usd(), r.Format)
+	}
+	return text
+}
+
+// weekly recaps the week starting at start: "Recap of Mar 18 - Mar 24: $512.0M rekt ..., -12% vs the week before".
+func (r *Recap) weekly(start time.Time) string {
+	end := start.AddDate(0, 0, 7)
+	totals := r.totals(start, end)
+	if totals.orders == 0 {
+		return ""
+	}
+
+	text := fmt.Sprintf("Recap of %v - %v: %v", start.Format("Jan 2"), start.AddDate(0, 0, 6).Format("Jan 2"), totals.text(r.Format))
+	if change := changeText(totals.usd(), r.totals(start.AddDate(0, 0, -7), start).usd()); change != "" {
+		text += ", " + change + " vs the week before"
+	}
+
+	return text + r.elsewhere(start, end)
+}
+
+// elsewhere returns the line of the third-party totals over the period, empty without them.
+func (r *Recap) elsewhere(from, to time.Time) string {
+	if r.ThirdParty == nil {
+		return ""
+	}
+
+	venues, err := r.ThirdParty.Fetch(from, to)
+	if err != nil {
+		log.Println("Failed to fetch the third-party totals:", err)
+		return ""
+	}
+	if len(venues) == 0 {
+		return ""
+	}
+	return "\n" + thirdPartyText(r.ThirdParty.Name, venues, r.Format)
+}
+
+// weekdayRecord compares the day with the same weekday of the previous weeks in the history,
+// when it beats at least two of them: "largest Tuesday since Mar 5", "largest Tuesday in 4 weeks".
+func (r *Recap) weekdayRecord(start time.Time, usd int64) string {
+	oldest := r.History.Oldest()
+
+	weeks := 0
+	for previous := start.AddDate(0, 0, -7); !oldest.IsZero() && !previous.Before(oldest.Truncate(day)); previous = previous.AddDate(0, 0, -7) {
+		if r.totals(previous, previous.AddDate(0, 0, 1)).usd() >= usd {
+			if weeks < 2 {
+				return ""
+			}
+			return fmt.Sprintf("largest %v since %v", start.Weekday(), previous.Format("Jan 2"))
+		}
+		weeks++
+	}
+
+	if weeks < 2 {
+		return ""
+	}
+	return fmt.Sprintf("largest %v in %v weeks", start.Weekday(), weeks+1)
+}
+
+func (r *Recap) totals(from, to time.Time) recapTotals {
+	var totals recapTotals
+	for _, l := range r.History.Since(from, func(l Liquidation) bool { return l.Received.Before(to) }) {
+		totals.orders++
+		if l.Position() == "long" {
+			totals.longs += l.USDValue()
+		} else {
+			totals.shorts += l.USDValue()
+		}
+	}
+	return totals
+}
+
+func (t recapTotals) usd() int64 {
+	return t.longs + t.shorts
+}
+
+// text writes the totals: "$120.5M rekt (longs $80.0M / shorts $40.5M) across 1,234 orders".
+func (t recapTotals) text(f NumberFormat) string {
+	orderText := "orders"
+	if t.orders == 1 {
+		orderText = "order"
+	}
+
+	return fmt.Sprintf("%v rekt (longs %v / shorts %v) across %v %v",
+		f.Short(t.usd()), f.Short(t.longs), f.Short(t.shorts), humanize.Comma(int64(t.orders)), orderText)
+}
+
+// changeText writes the change from the previous period as a percentage, empty when there was nothing to compare with.
+func changeText(current, previous int64) string {
+	if previous == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+d%%", int64(math.Round(float64(current-previous)*100/float64(previous))))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecap(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 10*365*day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	date := func(d int) time.Time { return time.Date(2024, time.March, d, 12, 0, 0, 0, time.UTC) }
+	for _, l := range []Liquidation{
+		{Side: "Sell", USD: 200000000, Received: date(5)}, // Tuesday
+		{Side: "Sell", USD: 20000000, Received: date(12)}, // Tuesday
+		{Side: "Sell", USD: 10000000, Received: date(19)}, // Tuesday
+		{Side: "Buy", USD: 50000000, Received: date(25)},
+		{Side: "Sell", USD: 80000000, Received: date(26)},
+		{Side: "Buy", USD: 40000000, Received: date(26).Add(time.Hour)},
+	} {
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Recap{History: h, Daily: true, Weekly: true}
+
+	expected := "Recap of Tue Mar 26: $120.0M rekt (longs $80.0M / shorts $40.0M) across 2 orders, +140% vs yesterday, largest Tuesday since Mar 5"
+	if recaps := r.due(time.Date(2024, time.March, 27, 0, 0, 0, 0, time.UTC)); len(recaps) != 1 || recaps[0] != expected {
+		t.Errorf("expected %q, got %q", expected, recaps)
+	}
+
+	// Monday midnight also recaps the week
+	expected = "Recap of Mar 18 - Mar 24: $10.0M rekt (longs $10.0M / shorts $0) across 1 order, -50% vs the week before"
+	if recaps := r.due(time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)); len(recaps) != 1 || recaps[0] != expected {
+		t.Errorf("expected only %q, got %q", expected, recaps)
+	}
+
+	// A day without orders is recapped only when the feed was down
+	if recaps := r.due(time.Date(2024, time.March, 21, 0, 0, 0, 0, time.UTC)); len(recaps) != 0 {
+		t.Errorf("expected no recap of a quiet day, got %q", recaps)
+	}
+	r.Gaps = &Gaps{}
+	r.Gaps.Open("BitMex", date(20).Add(-time.Hour))
+	expected = fmt.Sprintf("Recap of Wed Mar 20: nothing got liquidated\n⚠️ Data gap: BitMex down 13 h from <t:%v:t>, the totals are short", date(20).Add(-time.Hour).Unix())
+	if recaps := r.due(time.Date(2024, time.March, 21, 0, 0, 0, 0, time.UTC)); len(recaps) != 1 || recaps[0] != expected {
+		t.Errorf("expected %q, got %q", expected, recaps)
+	}
+}
+
+func TestRecapTimezone(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 10*365*day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	for _, l := range []Liquidation{
+		{Side: "Sell", USD: 1000000, Received: time.Date(2024, time.March, 26, 23, 30, 0, 0, time.UTC)},
+		{Side: "Sell", USD: 2000000, Received: time.Date(2024, time.March, 27, 10, 0, 0, 0, time.UTC)},
+	} {
+		if err := h.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings, err := LoadSettings(filepath.Join(t.TempDir(), "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.SetTimezone("guild", "Mars/Olympus"); err == nil {
+		t.Error("expected an unknown timezone to be refused")
+	}
+	if err := settings.SetTimezone("guild", "Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if zones := settings.Zones(); len(zones) != 1 || zones[0].String() != "Asia/Tokyo" {
+		t.Fatalf("expected Asia/Tokyo, got %v", zones)
+	}
+	if zone := settings.Timezone("other"); zone != time.UTC {
+		t.Errorf("expected UTC by default, got %v", zone)
+	}
+
+	r := &Recap{History: h, Daily: true}
+
+	// Both are on Mar 27 in Tokyo, where the day ends at 15:00 UTC
+	tokyo := time.Date(2024, time.March, 28, 0, 0, 0, 0, settings.Timezone("guild"))
+	expected := "Recap of Wed Mar 27: $3.0M rekt (longs $3.0M / shorts $0) across 2 orders"
+	if recaps := r.due(tokyo); len(recaps) != 1 || recaps[0] != expected {
+		t.Errorf("expected %q, got %q", expected, recaps)
+	}
+
+	expected = "Recap of Wed Mar 27: $2.0M rekt (longs $2.0M / shorts $0) across 1 order, +100% vs yesterday"
+	if recaps := r.due(time.Date(2024, time.March, 28, 0, 0, 0, 0, time.UTC)); len(recaps) != 1 || recaps[0] != expected {
+		t.Errorf("expected %q, got %q", expected, recaps)
+	}
+}
+
+func TestReminderEvent(t *testing.T) {
+	drop := time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)
+	var posted []Post
+	(&RecapReminder{Mode: ReminderEvent}).Remind(drop, func(string) { t.Error("announced the event") }, func(p Post) { posted = append(posted, p) })
+	if len(posted) != 1 || posted[0].Event == nil || !posted[0].Event.Start.Equal(drop) {
+		t.Fatalf("expected the event of the drop, got %v", posted)
+	}
+
+	// The channels of a guild create it once
+	once := posted[0].Event.Once
+	if !once("a") || once("a") || !once("b") {
+		t.Error("expected the event to be created once in each guild")
+	}
+}
+
+func TestReminderText(t *testing.T) {
+	drop := time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)
+	if text := reminderText(drop); text != "📅 The weekly recap drops <t:1711324800:F> (<t:1711324800:R>)" {
+		t.Errorf("unexpected reminder %q", text)
+	}
+}
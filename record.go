@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Frame is a raw websocket message along with the time it was received.
+	Frame struct {
+		Time time.Time       `json:"time"`
+		Data json.RawMessage `json:"data"`
+	}
+
+	// Recorder appends raw frames to a JSON lines file.
+	Recorder struct {
+		file *os.File
+		enc  *json.Encoder
+	}
+)
+
+// NewRecorder creates (or appends to) the recording at path.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Record writes a single frame. Frames that are not JSON (such as the "pong" heartbeat) are skipped.
+func (r *Recorder) Record(t time.Time, msg []byte) error {
+	if !json.Valid(msg) {
+		return nil
+	}
+
+	return r.enc.Encode(Frame{Time: t, Data: msg})
+}
+
+// Close flushes and closes the recording.
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// Replay feeds a recording back through the client, reproducing the original gaps between frames
+// divided by speed. A speed of zero replays as fast as possible. The client's clock follows the
+// recorded timestamps so dedup windows behave the way they did live.
+func Replay(path string, speed float64, c *BitMexClient) (frames int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var now time.Time
+	c.Now = func() time.Time { return now }
+
+	dec := json.NewDecoder(f)
+	for {
+		var frame Frame
+		if err := dec.Decode(&frame); err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return frames, errwrap.Wrapf("bad frame in recording: {{err}}", err)
+		}
+
+		if speed > 0 && !now.IsZero() {
+			time.Sleep(time.Duration(float64(frame.Time.Sub(now)) / speed))
+		}
+		now = frame.Time
+
+		var malformed *malformedFrame
+		if err := c.handleMessage(frame.Data, time.Now()); errors.As(err, &malformed) {
+			log.Println("Skipping a frame:", err)
+		} else if err != nil {
+			return frames, err
+		}
+		frames++
+	}
+}
+
+// parseSpeed parses a replay speed such as "10x" or "0.5".
+func parseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed < 0 {
+		return 0, fmt.Errorf("invalid speed: %q", s)
+	}
+
+	return speed, nil
+}
+
+// recordCommand captures the raw BitMex feed to a file: rekt record --out feed.jsonl
+func recordCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	out := fs.String("out", "feed.jsonl", "file to append the recorded frames to")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return errwrap.Wrapf("unable to load config: {{err}}", err)
+	}
+
+	recorder, err := NewRecorder(*out)
+	if err != nil {
+		return err
+	}
+	defer recorder.Close()
+
+	proxy, err := newProxy(cfg.Proxy)
+	if err != nil {
+		return errwrap.Wrapf("invalid proxy: {{err}}", err)
+	}
+
+	client := NewBitMexClient(cfg, nil)
+	client.Dialer = newDialer(proxy)
+	client.Recorder = recorder
+
+	log.Println("Recording to", *out)
+	return client.Run(ctx)
+}
+
+// replayCommand feeds a recording through the pipeline in dry-run: rekt replay feed.jsonl --speed 10x
+func replayCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	speedFlag := fs.String("speed", "1x", "replay speed, 0 for as fast as possible")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("usage: rekt replay <feed.jsonl> [--speed 10x]")
+	}
+
+	speed, err := parseSpeed(*speedFlag)
+	if err != nil {
+		return err
+	}
+
+	state, err := NewState()
+	if err != nil {
+		return errwrap.Wrapf("failed to load state: {{err}}", err)
+	}
+
+	client := NewBitMexClient(BotConfig{}, &Pipeline{State: state, DryRun: true})
+	client.Historical = true
+
+	frames, err := Replay(files[0], speed, client)
+	log.Println("Replayed", frames, "frames from", files[0])
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	m := newMockBitMex(t,
+		liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000.5, 20000)),
+		liquidationFrame("delete", liquidationRow("a", "XBTUSD", "Sell", 9000.5, 20000)),
+		liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000)),
+		liquidationFrame("insert", liquidationRow("b", "XBTZ16", "Buy", 780, 130170)),
+	)
+
+	path := filepath.Join(t.TempDir(), "feed.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordingClient := NewBitMexClient(BotConfig{}, nil)
+	recordingClient.URL = m.URL()
+	recordingClient.Recorder = recorder
+	recordingClient.Run(context.Background())
+	recorder.Close()
+
+	client, sink := newTestClient(t)
+	frames, err := Replay(path, 0, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Welcome, subscription ack, partial and the four scripted frames
+	if frames != 7 {
+		t.Error("expected 7 frames, got", frames)
+	}
+
+	if len(sink.published) != 2 {
+		t.Fatal("expected 2 liquidations, got", sink.published)
+	}
+	if sink.published[0].Liquidation.Symbol != "XBTUSD" || sink.published[1].Liquidation.Symbol != "XBTZ16" {
+		t.Error("unexpected liquidations:", sink.published)
+	}
+}
+
+func TestReplayUsesRecordedTime(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "feed.jsonl")
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []struct {
+		offset time.Duration
+		frame  interface{}
+	}{
+		{0, liquidationFrame("delete", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000))},
+		{5 * time.Second, liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 9000, 20000))},
+		{20 * time.Second, liquidationFrame("insert", liquidationRow("b", "XBTZ16", "Buy", 780, 130170))},
+		// Long after the delete, the dedup window has expired
+		{30 * time.Second, liquidationFrame("insert", liquidationRow("a", "XBTUSD", "Sell", 8000, 20000))},
+	}
+	for _, f := range frames {
+		msg, err := json.Marshal(f.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Record(start.Add(f.offset), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder.Close()
+
+	client, sink := newTestClient(t)
+	if _, err := Replay(path, 0, client); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.published) != 2 {
+		t.Fatal("expected the two inserts after the window to be published, got", sink.published)
+	}
+	if sink.published[1].Liquidation.Price != 8000 {
+		t.Error("unexpected liquidation:", sink.published[1].Liquidation)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type (
+	// Reloader rebuilds the target sinks from the config while the bot runs, on SIGHUP or a POST to
+	// /debug/reload, so channels can be added and removed without dropping the exchange connections.
+	// Unchanged targets are kept as they are, cooldowns and bars included, and those changed take
+	// over the pause and the cooldown of their channel.
+	Reloader struct {
+		Pipeline *Pipeline
+		Settings *Settings   // Filters changed at runtime, applied to the new targets
+		Static   []Sink      // Sinks that aren't targets, kept across reloads
+		Tenants  *Tenants    // Channels of the guilds of hosted mode, built along with the config's
+		Prices   *PriceCache // What the coin thresholds of the filters are converted with
+
+		// NewSink builds the sink a target delivers to
+		NewSink func(cfg BotConfig, target Target) Sink
+
+		// StartFX starts fetching the exchange rates once a format shows another currency, when set
+		StartFX func(cfg BotConfig) error
+
+		mu      sync.Mutex
+		cfg     BotConfig // Last loaded, rebuilt from when the tenants change
+		loaded  bool
+		targets []*TargetSink
+		built   map[string]Target // What each target was built from, by channel
+	}
+
+	// sinkSettings are the settings of the config the sinks of the targets are built with, a
+	// change to any of them building the sinks anew.
+	sinkSettings struct {
+		Label                                  string
+		LatencyFooter, Timestamps, Pin         bool
+		LossMinUSD, AlertButtonUSD, CardMinUSD float64
+		MergeWindow                            time.Duration
+		MergeTolerance, AvailabilityAlert      float64
+		BreakerFailures                        int
+		BreakerCooldown                        time.Duration
+		BreakerCatchUp                         bool
+	}
+)
+
+func sinkSettingsOf(cfg BotConfig) sinkSettings {
+	return sinkSettings{
+		Label:             cfg.Label(),
+		LatencyFooter:     cfg.LatencyFooter,
+		Timestamps:        cfg.DiscordTimestamps,
+		Pin:               cfg.PinDailyRecord,
+		LossMinUSD:        cfg.LossMinUSD,
+		AlertButtonUSD:    cfg.AlertButtonUSD,
+		CardMinUSD:        cfg.RecordCardUSD,
+		MergeWindow:       cfg.MergeWindow.Duration,
+		MergeTolerance:    cfg.MergeTolerance,
+		AvailabilityAlert: cfg.SinkAvailabilityAlert,
+		BreakerFailures:   cfg.BreakerFailures,
+		BreakerCooldown:   cfg.BreakerCooldown.Duration,
+		BreakerCatchUp:    cfg.BreakerCatchUp,
+	}
+}
+
+// reloads is the reloader behind /debug/reload, nil until the bot runs.
+var reloads *Reloader
+
+// Load builds the targets of the config, reusing those that didn't change, and switches the pipeline over.
+func (r *Reloader) Load(cfg BotConfig) (added, removed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := make(map[string]*TargetSink, len(r.targets))
+	for _, t := range r.targets {
+		previous[t.Channel] = t
+	}
+
+	// A change to how the sinks are built rebuilds every target over a new one
+	resink := r.loaded && sinkSettingsOf(r.cfg) != sinkSettingsOf(cfg)
+
+	wanted := configTargets(cfg)
+	if r.Tenants != nil {
+		wanted = append(wanted, r.Tenants.Targets()...)
+	}
+
+	var targets []*TargetSink
+	built := make(map[string]Target)
+	for _, target := range wanted {
+		t, ok := previous[target.Channel]
+		if !ok || resink || !reflect.DeepEqual(r.built[target.Channel], target) {
+			t = r.rebuild(cfg, target, t, resink)
+			if r.Settings != nil {
+				r.Settings.Apply([]*TargetSink{t})
+			}
+			added++
+		}
+		delete(previous, target.Channel)
+
+		targets = append(targets, t)
+		built[target.Channel] = target
+	}
+	removed = len(previous)
+	for _, t := range previous {
+		t.Stop()
+	}
+	r.targets, r.built = targets, built
+	r.cfg, r.loaded = cfg, true
+	setTiers(cfg.Tiers)
+
+	sinks := make([]Sink, 0, len(targets)+len(r.Static))
+	for _, t := range targets {
+		sinks = append(sinks, t)
+	}
+	r.Pipeline.SetSinks(append(sinks, r.Static...))
+
+	return added, removed
+}
+
+// rebuild builds the target sink of a changed target, taking over from prev, the previous one of
+// its channel if any. The sink behind it is kept unless its name, format or forum changed, or
+// resink tells the settings of the config it is built with did.
+func (r *Reloader) rebuild(cfg BotConfig, target Target, prev *TargetSink, resink bool) *TargetSink {
+	var t *TargetSink
+	if prev == nil {
+		t = targetSink(cfg, target, r.sink(cfg))
+		t.Prices = r.Prices
+		return t
+	}
+
+	if old := r.built[target.Channel]; !resink && old.Name == target.Name && old.Forum == target.Forum && reflect.DeepEqual(old.Format, target.Format) {
+		t = NewTargetSink(target, prev.Sink)
+	} else {
+		t = targetSink(cfg, target, r.sink(cfg))
+	}
+	t.Prices = r.Prices
+	t.takeOver(prev)
+	return t
+}
+
+// sink builds the sink of a target, behind the budget of its tenant if it is one's.
+func (r *Reloader) sink(cfg BotConfig) func(target Target) Sink {
+	return func(target Target) Sink {
+		sink := r.NewSink(cfg, target)
+		if r.Tenants != nil {
+			sink = r.Tenants.Budgeted(target.Channel, sink)
+		}
+		return sink
+	}
+}
+
+// Targets returns the current target sinks.
+func (r *Reloader) Targets() []*TargetSink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.targets
+}
+
+// Refresh rebuilds the targets from the config last loaded, as the tenants changed. Until the
+// first Load there is nothing to rebuild.
+func (r *Reloader) Refresh() {
+	r.mu.Lock()
+	cfg, loaded := r.cfg, r.loaded
+	r.mu.Unlock()
+	if !loaded {
+		return
+	}
+
+	added, removed := r.Load(cfg)
+	log.Printf("Rebuilt the targets of the tenants: %v built, %v removed\n", added, removed)
+}
+
+// Reload reads the config again and loads its targets.
+func (r *Reloader) Reload() (string, error) {
+	notifySystemd("RELOADING=1")
+	defer notifySystemd("READY=1")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if r.StartFX != nil {
+		if err := r.StartFX(cfg); err != nil {
+			return "", err
+		}
+	}
+
+	added, removed := r.Load(cfg)
+	text := fmt.Sprintf("Reloaded the targets: %v built, %v removed", added, removed)
+	log.Println(text)
+	return text, nil
+}
+
+// WatchSignals reloads on every SIGHUP.
+func (r *Reloader) WatchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		if _, err := r.Reload(); err != nil {
+			ops.Alert("reload", "Failed to reload the config, keeping the current targets: %v", err)
+		}
+	}
+}
+
+// serveReload reloads on POST.
+func serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST to reload", http.StatusMethodNotAllowed)
+		return
+	}
+	if reloads == nil {
+		http.Error(w, "Nothing to reload yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	text, err := reloads.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, text)
+}
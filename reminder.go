@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// ReminderMode is how members are told the weekly recap is coming.
+	ReminderMode string
+
+	// RecapReminder gives notice of the weekly recap a day before it drops, so members get
+	// Discord's own reminders.
+	RecapReminder struct {
+		Mode ReminderMode
+	}
+)
+
+// Reminder modes
+const (
+	ReminderEvent    ReminderMode = "event"    // A scheduled event in each guild
+	ReminderAnnounce ReminderMode = "announce" // A message with the time in each member's timezone
+)
+
+// Remind gives notice of the recap dropping at drop, announcing the text or posting the event
+// to the channels the recap is posted in.
+func (r *RecapReminder) Remind(drop time.Time, announce func(text string), post func(post Post)) {
+	switch r.Mode {
+	case ReminderAnnounce:
+		announce(reminderText(drop))
+	case ReminderEvent:
+		post(reminderEvent(drop))
+	}
+}
+
+// reminderEvent is the scheduled event of the recap, created once in each guild.
+func reminderEvent(drop time.Time) Post {
+	created := make(map[string]bool)
+	return Post{Event: &PostEvent{
+		Name:        "Weekly liquidation recap",
+		Description: "The totals of the week",
+		Start:       drop,
+		End:         drop.Add(time.Hour),
+		Once: func(guild string) bool {
+			if created[guild] {
+				return false
+			}
+			created[guild] = true
+			return true
+		},
+	}}
+}
+
+// reminderText announces the drop in Discord's timestamp markup, which shows in the reader's timezone.
+func reminderText(drop time.Time) string {
+	return fmt.Sprintf("📅 The weekly recap drops <t:%[1]v:F> (<t:%[1]v:R>)", drop.Unix())
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonSchema is the part of JSON Schema the bot writes and enforces: types, formats, patterns,
+// properties and items.
+type jsonSchema struct {
+	Schema      string      `json:"$schema,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Type        interface{} `json:"type,omitempty"` // A type or a list of them
+	Format      string      `json:"format,omitempty"`
+	Pattern     string      `json:"pattern,omitempty"`
+	PatternText string      `json:"-"` // What the pattern matches, for the errors: "a duration such as 1h30m"
+
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // A schema, or false for none
+	Items                *jsonSchema            `json:"items,omitempty"`
+}
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches what time.ParseDuration reads, such as "1h30m".
+const durationPattern = `^(0|-?([0-9]*\.)?[0-9]+(ns|us|µs|ms|s|m|h))+$`
+
+// schemas are the documents rekt schema prints: the config and the events integrators see.
+var schemas = map[string]func() *jsonSchema{
+	"config": configSchema,
+	"liquidation": func() *jsonSchema {
+		return titled(schemaOf(reflect.TypeOf(dashboardEvent{})), "Liquidation event",
+			"A liquidation as the dashboard API returns it and the stream sends it")
+	},
+	"announcement": func() *jsonSchema {
+		return titled(schemaOf(reflect.TypeOf(struct {
+			Text string `json:"text"`
+		}{})), "Announcement event", "An announcement as the dashboard stream sends it")
+	},
+	"inbox": func() *jsonSchema {
+		return titled(schemaOf(reflect.TypeOf(inboxPost{})), "Inbox post",
+			"A liquidation or an announcement posted by hand on /inbox")
+	},
+}
+
+// configSchema describes config.json, each option with its comment in config.json.example.
+func configSchema() *jsonSchema {
+	s := titled(schemaOf(reflect.TypeOf(BotConfig{})), "REKT config", "config.json, with // comments allowed")
+	for key, comment := range exampleComments(starterConfig) {
+		if property, ok := s.Properties[key]; ok {
+			property.Description = comment
+		}
+	}
+	return s
+}
+
+func titled(s *jsonSchema, title, description string) *jsonSchema {
+	s.Schema, s.Title, s.Description = jsonSchemaDraft, title, description
+	return s
+}
+
+// schemaOf describes how the type is encoded. The structs take no other keys than their fields.
+func schemaOf(t reflect.Type) *jsonSchema {
+	switch t {
+	case reflect.TypeOf(Duration{}):
+		return &jsonSchema{Type: "string", Pattern: durationPattern, PatternText: "a duration such as 1h30m"}
+	case reflect.TypeOf(time.Time{}):
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(Threshold{}):
+		return &jsonSchema{Type: []string{"string", "number"}}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Ptr:
+		s := schemaOf(t.Elem())
+		s.Type = nullable(s.Type)
+		return s
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: nullable("array"), Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: nullable("object"), AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema), AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				for key, property := range schemaOf(field.Type).Properties {
+					s.Properties[key] = property
+				}
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			s.Properties[name] = schemaOf(field.Type)
+		}
+		return s
+	}
+	return &jsonSchema{}
+}
+
+func nullable(t interface{}) interface{} {
+	if name, ok := t.(string); ok {
+		return []string{name, "null"}
+	}
+	return t
+}
+
+// exampleKey is a top level key of config.json.example, the nested ones being indented further.
+var exampleKey = regexp.MustCompile(`^    "(\w+)":`)
+
+// exampleComments returns the comment above each top level key of the example config.
+func exampleComments(example string) map[string]string {
+	comments := make(map[string]string)
+	var comment []string
+	for _, line := range strings.Split(example, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "//") {
+			comment = append(comment, strings.TrimSpace(strings.TrimPrefix(trimmed, "//")))
+			continue
+		}
+		if m := exampleKey.FindStringSubmatch(line); m != nil && len(comment) > 0 {
+			comments[m[1]] = strings.Join(comment, " ")
+		}
+		comment = nil
+	}
+	return comments
+}
+
+// validate checks the decoded JSON against the schema, returning every mismatch with its path,
+// and apart the paths of the keys the schema doesn't know.
+func (s *jsonSchema) validate(value interface{}, path string) (problems, unknown []string) {
+	if !s.allows(value) {
+		return []string{fmt.Sprintf("%v: expected %v, got %v", path, typeText(s.Type), jsonTypeOf(value))}, nil
+	}
+
+	add := func(p, u []string) {
+		problems, unknown = append(problems, p...), append(unknown, u...)
+	}
+	switch v := value.(type) {
+	case string:
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(v) {
+			problems = append(problems, fmt.Sprintf("%v: %q isn't %v", path, v, s.patternText()))
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%v: %q isn't an RFC 3339 time", path, v))
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				add(s.Items.validate(item, fmt.Sprintf("%v[%v]", path, i)))
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := path + "." + key
+			if property := s.property(key); property != nil {
+				add(property.validate(v[key], child))
+			} else if additional, ok := s.AdditionalProperties.(*jsonSchema); ok {
+				add(additional.validate(v[key], child))
+			} else if s.AdditionalProperties == false {
+				unknown = append(unknown, child)
+			}
+		}
+	}
+	return problems, unknown
+}
+
+// patternText describes what the pattern matches.
+func (s *jsonSchema) patternText() string {
+	if s.PatternText != "" {
+		return s.PatternText
+	}
+	return "matching " + s.Pattern
+}
+
+// property returns the schema of the key, matched without regard to case like encoding/json does.
+func (s *jsonSchema) property(key string) *jsonSchema {
+	if property, ok := s.Properties[key]; ok {
+		return property
+	}
+	for name, property := range s.Properties {
+		if strings.EqualFold(name, key) {
+			return property
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) allows(value interface{}) bool {
+	if s.Type == nil {
+		return true
+	}
+	actual := jsonTypeOf(value)
+	types, ok := s.Type.([]string)
+	if !ok {
+		types = []string{s.Type.(string)}
+	}
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeText(t interface{}) string {
+	if types, ok := t.([]string); ok {
+		return strings.Join(types, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// validateJSON checks the decoded JSON against the schema, refusing the unknown keys too.
+func validateJSON(s *jsonSchema, value interface{}, name string) error {
+	problems, unknown := s.validate(value, name)
+	for _, key := range unknown {
+		problems = append(problems, key+": unknown key")
+	}
+	return problemsError(problems)
+}
+
+// problemsError joins the mismatches of a document, nil when there are none.
+func problemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// schemaCommand prints a schema: rekt schema config|liquidation|announcement|inbox|proto
+func schemaCommand(ctx context.Context, args []string) error {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(args) == 1 && args[0] == "proto" {
+		fmt.Print(liquidationProto)
+		return nil
+	}
+	if len(args) != 1 || schemas[args[0]] == nil {
+		return fmt.Errorf("usage: rekt schema %v|proto", strings.Join(names, "|"))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(schemas[args[0]]())
+}
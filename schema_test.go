@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigSchema(t *testing.T) {
+	var example interface{}
+	if err := json.Unmarshal(stripComments([]byte(starterConfig)), &example); err != nil {
+		t.Fatal(err)
+	}
+	s := configSchema()
+	if err := validateJSON(s, example, "config"); err != nil {
+		t.Errorf("expected the example config to be valid: %v", err)
+	}
+	if s.Properties["http_addr"].Description != `Serves /metrics when set, e.g. ":8080"` {
+		t.Errorf("expected the comment of the example, got %q", s.Properties["http_addr"].Description)
+	}
+
+	var bad interface{}
+	json.Unmarshal([]byte(`{"discord_tokn": "x", "queue_size": "64", "sink_timeout": "soon", "targets": [{"channel": 1}]}`), &bad)
+	expected := []string{
+		`config.queue_size: expected integer, got string`,
+		`config.sink_timeout: "soon" isn't a duration such as 1h30m`,
+		"config.targets[0].channel: expected string, got integer",
+	}
+	problems, unknown := s.validate(bad, "config")
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %q, got %q", expected, problems)
+	}
+	if len(unknown) != 1 || unknown[0] != "config.discord_tokn" {
+		t.Errorf("expected the misspelt key apart, got %q", unknown)
+	}
+
+	pattern := &jsonSchema{Type: "string", Pattern: `^[A-Z]+$`}
+	if problems, _ := pattern.validate("xbt", "symbol"); len(problems) != 1 || problems[0] != `symbol: "xbt" isn't matching ^[A-Z]+$` {
+		t.Errorf("expected the pattern in the problem, got %q", problems)
+	}
+}
+
+func TestEventSchemas(t *testing.T) {
+	d := &Dashboard{}
+	data, _ := json.Marshal(d.event(Liquidation{Symbol: "XBTUSD", Side: "Sell", Price: 65000, Quantity: 1000, Received: time.Now()}))
+	var event interface{}
+	json.Unmarshal(data, &event)
+	if err := validateJSON(schemas["liquidation"](), event, "event"); err != nil {
+		t.Errorf("expected the events to match their schema: %v", err)
+	}
+
+	if _, err := decodeInboxPost(strings.NewReader(`{"symbol": "BTC-USD", "postion": "long"}`)); err == nil || !strings.Contains(err.Error(), "post.postion: unknown key") {
+		t.Errorf("expected the misspelt key to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"golang.org/x/oauth2/google"
+)
+
+// Secret references in the config are resolved at startup, so tokens don't have to sit in config.json:
+//
+//	vault://secret/data/rekt#discord_token   HashiCorp Vault, VAULT_ADDR and VAULT_TOKEN
+//	awssm://rekt/prod#discord_token          AWS Secrets Manager, the AWS_* environment
+//	gcpsm://projects/p/secrets/s#key         Google Secret Manager, the application default credentials
+//
+// The fragment picks a field when the secret is a JSON object.
+var secretResolvers = map[string]func(ref *url.URL) (string, error){
+	"vault": vaultSecret,
+	"awssm": awsSecret,
+	"gcpsm": gcpSecret,
+}
+
+// resolveSecrets replaces every secret reference in the decoded config by the secret's value.
+func resolveSecrets(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			resolved, err := resolveSecrets(value)
+			if err != nil {
+				return nil, errwrap.Wrapf(key+": {{err}}", err)
+			}
+			v[key] = resolved
+		}
+	case []interface{}:
+		for i, value := range v {
+			resolved, err := resolveSecrets(value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	case string:
+		ref, err := url.Parse(v)
+		if err != nil {
+			return v, nil
+		}
+		if resolve, ok := secretResolvers[ref.Scheme]; ok {
+			return resolve(ref)
+		}
+	}
+
+	return v, nil
+}
+
+// secretField returns the field of a JSON object secret, or the secret itself when no field is asked for.
+func secretField(secret []byte, field string) (string, error) {
+	if field == "" {
+		return string(secret), nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(secret, &fields); err != nil {
+		return "", errwrap.Wrapf("secret isn't a JSON object: {{err}}", err)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// vaultSecret reads a KV secret from Vault, both the v1 and v2 engines.
+func vaultSecret(ref *url.URL) (string, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR must be set to resolve %v", ref.Redacted())
+	}
+
+	req, err := http.NewRequest(http.MethodGet, addr+"/v1/"+ref.Host+ref.Path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	body, err := secretRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", errwrap.Wrapf("bad Vault response: {{err}}", err)
+	}
+
+	// KV v2 nests the secret in data.data
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return "", err
+	}
+	if nested, ok := resp.Data["data"]; ok {
+		data = nested
+	}
+
+	field := ref.Fragment
+	if field == "" {
+		field = "value"
+	}
+	return secretField(data, field)
+}
+
+// awsSecret reads a secret from AWS Secrets Manager, signing the request with the environment's credentials.
+func awsSecret(ref *url.URL) (string, error) {
+	region := awsRegion()
+	if region == "" || os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		return "", fmt.Errorf("AWS_REGION and AWS_ACCESS_KEY_ID must be set to resolve %v", ref.Redacted())
+	}
+
+	payload, _ := json.Marshal(map[string]string{"SecretId": strings.TrimPrefix(ref.Host+ref.Path, "/")})
+	host := "secretsmanager." + region + ".amazonaws.com"
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWS(req, payload, region, "secretsmanager", time.Now())
+
+	body, err := secretRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", errwrap.Wrapf("bad Secrets Manager response: {{err}}", err)
+	}
+
+	return secretField([]byte(resp.SecretString), ref.Fragment)
+}
+
+// awsRegion returns the region of the AWS_* environment.
+func awsRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// signAWS adds a Signature Version 4 authorization to the request.
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signAWS(req *http.Request, payload []byte, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	// Every header set above or by the caller is signed, in order
+	var names []string
+	for _, name := range []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date", "x-amz-security-token", "x-amz-target"} {
+		if req.Header.Get(name) != "" {
+			names = append(names, name)
+		}
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		os.Getenv("AWS_ACCESS_KEY_ID"), scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpSecret reads a secret version from Google Secret Manager, the latest one unless the reference names one.
+func gcpSecret(ref *url.URL) (string, error) {
+	name := strings.TrimPrefix(ref.Host+ref.Path, "/")
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return "", errwrap.Wrapf("no Google credentials: {{err}}", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://secretmanager.googleapis.com/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := secretRequestWith(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", errwrap.Wrapf("bad Secret Manager response: {{err}}", err)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", errwrap.Wrapf("bad Secret Manager payload: {{err}}", err)
+	}
+
+	return secretField(secret, ref.Fragment)
+}
+
+func secretRequest(req *http.Request) ([]byte, error) {
+	return secretRequestWith(&http.Client{Timeout: 30 * time.Second}, req)
+}
+
+func secretRequestWith(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not fetch secret: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not fetch secret: {{err}}", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch secret: %v", resp.Status)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestSignAWS checks the signature against the example of the AWS documentation, the IAM ListUsers request.
+func TestSignAWS(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWS(req, nil, "us-east-1", "iam", time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if authorization := req.Header.Get("Authorization"); authorization != expected {
+		t.Errorf("expected %q, got %q", expected, authorization)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/rekt" || r.Header.Get("X-Vault-Token") != "root" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"discord_token": "hunter2"}, "metadata": {"version": 3}}}`))
+	}))
+	defer vault.Close()
+
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	config := map[string]interface{}{
+		"discord_token": "vault://secret/data/rekt#discord_token",
+		"sheets_range":  "Sheet1!A:G",
+		"targets":       []interface{}{map[string]interface{}{"channel": "1234"}},
+	}
+	resolved, err := resolveSecrets(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"discord_token": "hunter2",
+		"sheets_range":  "Sheet1!A:G",
+		"targets":       []interface{}{map[string]interface{}{"channel": "1234"}},
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("expected %v, got %v", expected, resolved)
+	}
+
+	if _, err := resolveSecrets(map[string]interface{}{"proxy": "vault://secret/data/rekt#proxy"}); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/errwrap"
+)
+
+// selfCheck is one of the checks of rekt selftest, returning what it found.
+type selfCheck struct {
+	Name string
+	Run  func() (string, error)
+}
+
+// namedChannel is a channel the bot posts to and what it is for.
+type namedChannel struct {
+	Name string
+	ID   string
+}
+
+// channelPermissions are what the bot needs in the channels it posts to.
+var channelPermissions = []struct {
+	Name string
+	Bit  int64
+}{
+	{"view channel", discordgo.PermissionViewChannel},
+	{"send messages", discordgo.PermissionSendMessages},
+	{"embed links", discordgo.PermissionEmbedLinks},
+	{"attach files", discordgo.PermissionAttachFiles},
+}
+
+// selftestCommand checks that the bot can run with the config: rekt selftest
+func selftestCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return errwrap.Wrapf("unable to load config: {{err}}", err)
+	}
+
+	proxy, err := newProxy(cfg.Proxy)
+	if err != nil {
+		return errwrap.Wrapf("invalid proxy: {{err}}", err)
+	}
+
+	discord, err := discordgo.New("Bot " + cfg.DiscordToken)
+	if err != nil {
+		return errwrap.Wrapf("unable to run discord: {{err}}", err)
+	}
+	useProxy(discord, proxy)
+
+	client := NewBitMexClient(cfg, nil)
+	client.Dialer = newDialer(proxy)
+	instruments := NewInstrumentCache(cfg.BitMexHost, newHTTPClient(proxy))
+
+	checks := []selfCheck{
+		{"BitMex REST API", func() (string, error) {
+			active, err := instruments.Active()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%v active instruments", len(active)), nil
+		}},
+		{"BitMex websocket", func() (string, error) {
+			endpoint, err := client.subscribeURL()
+			if err != nil {
+				return "", err
+			}
+			conn, _, err := client.Dialer.Dial(endpoint, nil)
+			if err != nil {
+				return "", err
+			}
+			conn.Close()
+			return endpoint, nil
+		}},
+	}
+
+	// The channel checks need to know who the bot is
+	var me *discordgo.User
+	checks = append(checks, selfCheck{"Discord token", func() (string, error) {
+		user, err := discord.User("@me")
+		if err != nil {
+			return "", err
+		}
+		me = user
+		return "logged in as " + me.String(), nil
+	}})
+
+	for _, channel := range selftestChannels(cfg) {
+		channel := channel
+		checks = append(checks, selfCheck{"Permissions in " + channel.Name, func() (string, error) {
+			if me == nil {
+				return "", errors.New("skipped without a valid token")
+			}
+			perms, err := discord.UserChannelPermissions(me.ID, channel.ID)
+			if err != nil {
+				return "", err
+			}
+			if missing := missingPermissions(perms); len(missing) > 0 {
+				return "", fmt.Errorf("missing %v", strings.Join(missing, ", "))
+			}
+			return "all granted", nil
+		}})
+	}
+
+	for _, path := range []string{statePath(highScoresFile), cfg.SettingsFile, cfg.AuditFile, cfg.HistoryFile} {
+		path := path
+		if path == "" {
+			continue
+		}
+		checks = append(checks, selfCheck{"Writing " + path, func() (string, error) {
+			return "writable", checkWritable(path)
+		}})
+	}
+
+	return runChecks(os.Stdout, checks)
+}
+
+// selftestChannels returns the channels the bot posts to, named after what they are for.
+func selftestChannels(cfg BotConfig) []namedChannel {
+	var channels []namedChannel
+	for _, target := range configTargets(cfg) {
+		channels = append(channels, namedChannel{"channel " + target.Channel, target.Channel})
+	}
+
+	for _, channel := range []namedChannel{
+		{"the ops channel", cfg.OpsChannel},
+		{"the whale channel", cfg.WhaleChannel},
+		{"the open interest channel", cfg.OIAlertChannel},
+		{"the private warning channel", cfg.PrivateChannel},
+	} {
+		if channel.ID != "" {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+// runChecks runs every check, reporting each on its own line, and fails when any did.
+func runChecks(w io.Writer, checks []selfCheck) error {
+	failed := 0
+	for _, check := range checks {
+		result, err := check.Run()
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "✗ %v: %v\n", check.Name, err)
+			continue
+		}
+		fmt.Fprintf(w, "✓ %v: %v\n", check.Name, result)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of %v checks failed", failed, len(checks))
+	}
+	fmt.Fprintf(w, "All %v checks passed\n", len(checks))
+	return nil
+}
+
+// missingPermissions names the channel permissions the bot lacks.
+func missingPermissions(perms int64) []string {
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return nil
+	}
+
+	var missing []string
+	for _, permission := range channelPermissions {
+		if perms&permission.Bit == 0 {
+			missing = append(missing, permission.Name)
+		}
+	}
+	return missing
+}
+
+// checkWritable opens the file for writing without changing it, removing it again if it didn't exist.
+func checkWritable(path string) error {
+	_, err := os.Stat(path)
+	existed := err == nil
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if !existed {
+		return os.Remove(path)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRunChecks(t *testing.T) {
+	var out bytes.Buffer
+	err := runChecks(&out, []selfCheck{
+		{"Exchange", func() (string, error) { return "reachable", nil }},
+		{"Discord token", func() (string, error) { return "", errors.New("401 Unauthorized") }},
+	})
+
+	if err == nil || err.Error() != "1 of 2 checks failed" {
+		t.Errorf("expected the failure to be reported, got %v", err)
+	}
+	if want := "✓ Exchange: reachable\n✗ Discord token: 401 Unauthorized\n"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	perms := int64(discordgo.PermissionViewChannel | discordgo.PermissionSendMessages)
+	if missing := missingPermissions(perms); !reflect.DeepEqual(missing, []string{"embed links", "attach files"}) {
+		t.Errorf("expected embed links and attach files to be missing, got %v", missing)
+	}
+	if missing := missingPermissions(discordgo.PermissionAdministrator); missing != nil {
+		t.Errorf("expected an administrator to have every permission, got %v missing", missing)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "high_scores.json")
+	if err := checkWritable(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the file created for the check to be removed")
+	}
+
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWritable(path); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{}" {
+		t.Errorf("expected the existing file to be left alone, got %q", data)
+	}
+
+	if err := checkWritable(filepath.Join(dir, "missing", "settings.json")); err == nil {
+		t.Error("expected a file in a missing directory not to be writable")
+	}
+}
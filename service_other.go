@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// runService runs the bot under the Windows service manager, which only exists on Windows.
+func runService(ctx context.Context, run func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
+
+// serviceCommand registers the bot with the Windows service manager.
+func serviceCommand(ctx context.Context, args []string) error {
+	return errors.New("rekt service is for Windows, use rekt.service with systemd elsewhere")
+}
@@ -0,0 +1,124 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is what the bot is registered as with the service manager.
+const serviceName = "rekt"
+
+// runService runs the bot under the Windows service manager when it started the process,
+// returning false when run from a console. Stopping the service cancels the context.
+func runService(ctx context.Context, run func(ctx context.Context) error) (bool, error) {
+	inService, err := svc.IsWindowsService()
+	if err != nil || !inService {
+		return false, err
+	}
+
+	return true, svc.Run(serviceName, &windowsService{ctx: ctx, run: run})
+}
+
+// serviceStopWait is how long the bot gets to shut down once the service is stopped.
+const serviceStopWait = 20 * time.Second
+
+// windowsService answers the service manager while the bot runs.
+type windowsService struct {
+	ctx context.Context
+	run func(ctx context.Context) error
+}
+
+// Execute implements svc.Handler.
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- s.run(ctx) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Println("Bot stopped:", err)
+				return false, 1
+			}
+			return false, 0
+
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopWait / time.Millisecond)}
+				cancel()
+
+				select {
+				case <-done:
+				case <-time.After(serviceStopWait):
+					log.Println("Timed out waiting for the bot to stop")
+				}
+				return false, 0
+			}
+		}
+	}
+}
+
+// serviceCommand registers the bot with the Windows service manager: rekt service install|uninstall
+// The service runs with the config and state of REKT_HOME, or of %APPDATA%\rekt for the account it runs as.
+func serviceCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: rekt service install|uninstall")
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	switch args[0] {
+	case "install":
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "REKT",
+			Description: "Posts the BitMex liquidations to Discord",
+			StartType:   mgr.StartAutomatic,
+		})
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		// Restart on failure like the systemd unit does
+		return s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}, 24*60*60)
+
+	case "uninstall":
+		s, err := m.OpenService(serviceName)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		return s.Delete()
+
+	default:
+		return fmt.Errorf("unknown service command %q", args[0])
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	// The hosts running the bot, Windows in particular, may not have the timezone database
+	_ "time/tzdata"
+)
+
+// Settings are the changes made at runtime through the commands, kept across restarts.
+// They take precedence over config.json.
+type Settings struct {
+	Path string `json:"-"`
+
+	mu         sync.Mutex
+	Filters    map[string]Filter                  `json:"filters"`   // Target filters by channel
+	GuildRoles map[string]map[Permission][]string `json:"roles"`     // Roles granted each permission, by guild
+	Alerts     map[string]float64                 `json:"alerts"`    // Smallest liquidation DMed to each user, by user ID
+	Pins       map[string]bool                    `json:"pins"`      // Whether the daily record is pinned, by guild
+	Timezones  map[string]string                  `json:"timezones"` // Timezone of the recaps, by guild
+	Pauses     map[string]SavedPause              `json:"pauses"`    // Paused targets by channel
+}
+
+// SavedPause is the pause of a target, kept across restarts.
+type SavedPause struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"` // Zero until resumed by hand
+}
+
+// LoadSettings loads the settings at path, starting empty when it doesn't exist yet.
+func LoadSettings(path string) (*Settings, error) {
+	s := &Settings{Path: path, Filters: make(map[string]Filter), GuildRoles: make(map[string]map[Permission][]string), Alerts: make(map[string]float64), Pins: make(map[string]bool), Timezones: make(map[string]string), Pauses: make(map[string]SavedPause)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Filters == nil {
+		s.Filters = make(map[string]Filter)
+	}
+	if s.GuildRoles == nil {
+		s.GuildRoles = make(map[string]map[Permission][]string)
+	}
+	if s.Alerts == nil {
+		s.Alerts = make(map[string]float64)
+	}
+	if s.Pins == nil {
+		s.Pins = make(map[string]bool)
+	}
+	if s.Timezones == nil {
+		s.Timezones = make(map[string]string)
+	}
+	if s.Pauses == nil {
+		s.Pauses = make(map[string]SavedPause)
+	}
+
+	return s, nil
+}
+
+// Apply replaces the filters of the targets that were changed at runtime and pauses those that
+// were paused, the pauses that ran out since being forgotten.
+func (s *Settings) Apply(targets []*TargetSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, target := range targets {
+		if filter, ok := s.Filters[target.Channel]; ok {
+			target.SetFilter(filter)
+		}
+		if pause, ok := s.Pauses[target.Channel]; ok {
+			if !pause.Until.IsZero() && !pause.Until.After(now) {
+				delete(s.Pauses, target.Channel)
+				continue
+			}
+			target.restorePause(pause)
+		}
+	}
+}
+
+// Filter returns the filter of the target on channel, def when it wasn't changed at runtime.
+func (s *Settings) Filter(channel string, def Filter) Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if filter, ok := s.Filters[channel]; ok {
+		return filter
+	}
+	return def
+}
+
+// SetFilter stores the filter of the target on channel.
+func (s *Settings) SetFilter(channel string, f Filter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Filters[channel] = f
+	return s.save()
+}
+
+// ClearFilter forgets the filter of the target on channel, which goes back to its own.
+func (s *Settings) ClearFilter(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Filters[channel]; !ok {
+		return nil
+	}
+	delete(s.Filters, channel)
+	return s.save()
+}
+
+// SetPause stores the pause of the target on channel.
+func (s *Settings) SetPause(channel string, pause SavedPause) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Pauses[channel] = pause
+	return s.save()
+}
+
+// ClearPause forgets the pause of the target on channel, once resumed.
+func (s *Settings) ClearPause(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Pauses[channel]; !ok {
+		return nil
+	}
+	delete(s.Pauses, channel)
+	return s.save()
+}
+
+// Forget clears the settings of the guild and of its channels, once it is no longer served.
+func (s *Settings) Forget(guild string, channels []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, channel := range channels {
+		delete(s.Filters, channel)
+		delete(s.Pauses, channel)
+	}
+	delete(s.GuildRoles, guild)
+	delete(s.Pins, guild)
+	delete(s.Timezones, guild)
+	return s.save()
+}
+
+// Roles returns the roles granted the permission in the guild.
+func (s *Settings) Roles(guild string, level Permission) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.GuildRoles[guild][level]
+}
+
+// SetRoles stores the roles granted the permission in the guild.
+func (s *Settings) SetRoles(guild string, level Permission, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.GuildRoles[guild] == nil {
+		s.GuildRoles[guild] = make(map[Permission][]string)
+	}
+	s.GuildRoles[guild][level] = roles
+	return s.save()
+}
+
+// SetAlert DMs the user the liquidations of at least minUSD from now on, or stops when it is 0.
+func (s *Settings) SetAlert(user string, minUSD float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if minUSD > 0 {
+		s.Alerts[user] = minUSD
+	} else {
+		delete(s.Alerts, user)
+	}
+	return s.save()
+}
+
+// Alerted returns the users who asked for a DM about a liquidation worth usd.
+func (s *Settings) Alerted(usd float64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []string
+	for user, minUSD := range s.Alerts {
+		if usd >= minUSD {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Pinning tells whether the daily record is pinned in the guild, def when it wasn't chosen.
+func (s *Settings) Pinning(guild string, def bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pin, ok := s.Pins[guild]; ok {
+		return pin
+	}
+	return def
+}
+
+// SetPinning stores whether the daily record is pinned in the guild.
+func (s *Settings) SetPinning(guild string, pin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Pins[guild] = pin
+	return s.save()
+}
+
+// Timezone returns the timezone of the recaps of the guild, UTC when it wasn't chosen.
+func (s *Settings) Timezone(guild string) *time.Location {
+	s.mu.Lock()
+	name := s.Timezones[guild]
+	s.mu.Unlock()
+
+	if zone, err := time.LoadLocation(name); err == nil {
+		return zone
+	}
+	return time.UTC
+}
+
+// SetTimezone stores the timezone of the recaps of the guild, an IANA name such as
+// Europe/Paris, UTC clearing it.
+func (s *Settings) SetTimezone(guild, name string) error {
+	if name == "Local" {
+		return fmt.Errorf("unknown time zone %v", name)
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if zone == time.UTC {
+		delete(s.Timezones, guild)
+	} else {
+		s.Timezones[guild] = zone.String()
+	}
+	return s.save()
+}
+
+// Zones returns the timezones chosen by the guilds, other than UTC.
+func (s *Settings) Zones() []*time.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var zones []*time.Location
+	seen := make(map[string]bool)
+	for _, name := range s.Timezones {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if zone, err := time.LoadLocation(name); err == nil {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].String() < zones[j].String() })
+	return zones
+}
+
+func (s *Settings) save() error {
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(s.Path, true, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SettlementWatcher follows the state of the instruments on the instrument feed and tells when a
+// contract settles, gets delisted or halted, since the liquidations around them need the context.
+type SettlementWatcher struct {
+	Symbols  *SymbolMap
+	Announce func(text string)
+
+	mu     sync.Mutex
+	states map[Symbol]string // Last state seen of each instrument
+}
+
+// Handle is the TableHandler of the instrument table. The partial only takes note of the states.
+func (w *SettlementWatcher) Handle(action string, rows []interface{}, received time.Time) {
+	for _, row := range rows {
+		row, _ := row.(map[string]interface{})
+		symbol, _ := row["symbol"].(string)
+		state, ok := row["state"].(string)
+		if !ok || symbol == "" {
+			continue
+		}
+
+		price, _ := row["settledPrice"].(float64)
+		if text := w.observe(Symbol(symbol), state, price, action == "partial"); text != "" {
+			w.Announce(text)
+		}
+	}
+}
+
+// observe returns the notice for the state of the instrument when it changed, empty otherwise.
+func (w *SettlementWatcher) observe(symbol Symbol, state string, settledPrice float64, partial bool) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.states == nil {
+		w.states = make(map[Symbol]string)
+	}
+
+	previous, known := w.states[symbol]
+	w.states[symbol] = state
+	if partial || !known || previous == state {
+		return ""
+	}
+
+	return settlementText(w.name(symbol), previous, state, settledPrice)
+}
+
+func (w *SettlementWatcher) name(symbol Symbol) string {
+	if w.Symbols != nil {
+		return w.Symbols.Lookup(symbol).Display
+	}
+	return string(symbol)
+}
+
+// settlementText writes the notice of a change of state: "🏁 XBTU24 has settled at 63250.5".
+// BitMex calls the states Open, Closed when trading is halted, Settled and Unlisted. The futures
+// being unlisted once settled, that goes without a notice of its own.
+func settlementText(name, previous, state string, settledPrice float64) string {
+	switch state {
+	case "Settled":
+		if settledPrice > 0 {
+			return fmt.Sprintf("🏁 %v has settled at %v", name, NumberFormat{}.Price(settledPrice))
+		}
+		return fmt.Sprintf("🏁 %v has settled", name)
+	case "Unlisted", "Delisted":
+		if previous == "Settled" {
+			return ""
+		}
+		return fmt.Sprintf("🚫 %v has been delisted, there won't be any more liquidations on it", name)
+	case "Closed", "Halted", "Suspended":
+		return fmt.Sprintf("⏸️ Trading of %v is halted, liquidations are paused until it reopens", name)
+	case "Open":
+		if previous == "Closed" || previous == "Halted" || previous == "Suspended" {
+			return fmt.Sprintf("▶️ Trading of %v has resumed", name)
+		}
+	}
+	return ""
+}
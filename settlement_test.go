@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSettlementWatcher(t *testing.T) {
+	var notices []string
+	w := &SettlementWatcher{Announce: func(text string) { notices = append(notices, text) }}
+	row := func(fields ...interface{}) []interface{} {
+		r := map[string]interface{}{}
+		for i := 0; i < len(fields); i += 2 {
+			r[fields[i].(string)] = fields[i+1]
+		}
+		return []interface{}{r}
+	}
+
+	w.Handle("partial", row("symbol", "XBTU24", "state", "Open"), time.Now())
+	w.Handle("partial", row("symbol", "ETHUSD", "state", "Open"), time.Now())
+	w.Handle("update", row("symbol", "XBTU24", "markPrice", 63000.0), time.Now())
+	w.Handle("update", row("symbol", "XBTU24", "state", "Settled", "settledPrice", 63250.5), time.Now())
+	w.Handle("update", row("symbol", "XBTU24", "state", "Unlisted"), time.Now())
+	w.Handle("update", row("symbol", "ETHUSD", "state", "Closed"), time.Now())
+	w.Handle("update", row("symbol", "ETHUSD", "state", "Closed"), time.Now())
+	w.Handle("update", row("symbol", "ETHUSD", "state", "Open"), time.Now())
+	w.Handle("update", row("symbol", "ETHUSD", "state", "Unlisted"), time.Now())
+
+	expected := []string{
+		"🏁 XBTU24 has settled at 63250.5",
+		"⏸️ Trading of ETHUSD is halted, liquidations are paused until it reopens",
+		"▶️ Trading of ETHUSD has resumed",
+		"🚫 ETHUSD has been delisted, there won't be any more liquidations on it",
+	}
+	if !reflect.DeepEqual(notices, expected) {
+		t.Errorf("expected %q, got %q", expected, notices)
+	}
+}
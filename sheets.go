@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/errwrap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// SheetsSink appends whale liquidations as rows of a Google Sheet, for shared trackers.
+// It authenticates as a service account, which needs to be given edit access to the sheet.
+type SheetsSink struct {
+	API           string // The Sheets API, sheetsAPI in production
+	SpreadsheetID string
+	Range         string  // Where the table is, e.g. "Sheet1!A:G"
+	MinUSD        float64 // Smaller liquidations are left out
+	Client        *http.Client
+}
+
+const sheetsAPI = "https://sheets.googleapis.com/v4"
+
+// NewSheetsSink returns a sink authenticated with the service account credentials file.
+// Tokens are fetched and refreshed through client.
+func NewSheetsSink(cfg BotConfig, client *http.Client) (*SheetsSink, error) {
+	credentials, err := ioutil.ReadFile(cfg.SheetsCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := google.JWTConfigFromJSON(credentials, "https://www.googleapis.com/auth/spreadsheets")
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid service account credentials: {{err}}", err)
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	return &SheetsSink{
+		API:           sheetsAPI,
+		SpreadsheetID: cfg.SheetsID,
+		Range:         cfg.SheetsRange,
+		MinUSD:        cfg.SheetsMinUSD,
+		Client:        jwt.Client(ctx),
+	}, nil
+}
+
+// Publish implements Sink.
+func (s *SheetsSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	l := dl.Liquidation
+	if float64(l.USDValue()) < s.MinUSD {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"values": [][]interface{}{{
+			liquidationTime(l).UTC().Format("2006-01-02 15:04:05"),
+			l.Exchange,
+			l.DisplayName(),
+			l.Position(),
+			l.Price,
+			l.Quantity,
+			l.USDValue(),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%v/spreadsheets/%v/values/%v:append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS",
+		s.API, url.PathEscape(s.SpreadsheetID), url.PathEscape(s.Range))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return errwrap.Wrapf("could not append to the sheet: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		text, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("could not append to the sheet: %v: %s", resp.Status, bytes.TrimSpace(text))
+	}
+
+	return nil
+}
+
+// Announce implements Sink, the sheet only has liquidations.
+func (s *SheetsSink) Announce(ctx context.Context, text string) error {
+	return nil
+}
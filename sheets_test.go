@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSheetsSink(t *testing.T) {
+	var rows [][]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/spreadsheets/sheet/values/Sheet1!A:G:append" || r.URL.Query().Get("valueInputOption") != "USER_ENTERED" {
+			http.Error(w, "unexpected "+r.URL.String(), http.StatusNotFound)
+			return
+		}
+
+		var body struct{ Values [][]interface{} }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rows = append(rows, body.Values...)
+	}))
+	defer server.Close()
+
+	s := &SheetsSink{API: server.URL, SpreadsheetID: "sheet", Range: "Sheet1!A:G", MinUSD: 1000000, Client: server.Client()}
+	whale := Liquidation{Exchange: "BitMex", Symbol: "XBTUSD", Side: "Sell", Price: 60000, Quantity: 2000000, USD: 2000000}
+	if err := s.Publish(context.Background(), DecoratedLiquidation{Liquidation: whale}); err != nil {
+		t.Fatal(err)
+	}
+	small := whale
+	small.Quantity, small.USD = 1000, 1000
+	if err := s.Publish(context.Background(), DecoratedLiquidation{Liquidation: small}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || len(rows[0]) != 7 || rows[0][1] != "BitMex" || rows[0][5] != float64(2000000) {
+		t.Errorf("expected a single row for the whale, got %v", rows)
+	}
+
+	s.SpreadsheetID = "missing"
+	if err := s.Publish(context.Background(), DecoratedLiquidation{Liquidation: whale}); err == nil {
+		t.Error("expected the failed append to be reported")
+	}
+}
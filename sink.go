@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Sink delivers decorated liquidations somewhere people can read them. The deliveries give
+	// up once the context is done.
+	Sink interface {
+		Publish(ctx context.Context, dl DecoratedLiquidation) error
+
+		// Announce posts a plain message that isn't about a single liquidation.
+		Announce(ctx context.Context, text string) error
+	}
+
+	// Amender is a sink that can correct what it posted about a liquidation the exchange amended.
+	Amender interface {
+		Amend(ctx context.Context, l Liquidation) error
+	}
+
+	// Poster is a sink that can post what a plain message can't carry: files, or a scheduled
+	// event in the guild of its channel.
+	Poster interface {
+		Post(ctx context.Context, post Post) error
+	}
+
+	// Post is an announcement with files, or a scheduled event when Event is set.
+	Post struct {
+		Text  string
+		Files []PostFile
+		Event *PostEvent
+
+		// Symbol the post is about, left out by the filters that don't cover it, when set.
+		Symbol Symbol
+	}
+
+	// PostFile is a file attached to a post, read anew by each sink.
+	PostFile struct {
+		Name, ContentType string
+		Data              []byte
+	}
+
+	// PostEvent is a scheduled event created in the guild of the channel, located in the channel.
+	PostEvent struct {
+		Name, Description string
+		Start, End        time.Time
+
+		// Once tells whether the event is still to be created in the guild, so the channels of a
+		// guild create it once, when set.
+		Once func(guild string) bool
+	}
+
+	// DiscordSink posts liquidations to a Discord channel, in the templates and colors of the
+	// current tiers, so that a reload changes them.
+	DiscordSink struct {
+		Session *discordgo.Session
+		Channel string
+		Forum   ForumMode // Channel is a forum channel, posted to as this says
+
+		// Label is put in front of every message, such as "[TESTNET]".
+		Label string
+
+		// Format of the numbers in the liquidation messages.
+		Format NumberFormat
+
+		// LatencyFooter appends the time since the liquidation was received, for debugging lag.
+		LatencyFooter bool
+
+		// Timestamps appends when the liquidation happened, which Discord shows in the reader's
+		// timezone and as the time since, "2 minutes ago".
+		Timestamps bool
+
+		// LossMinUSD adds the estimated loss of the trader to liquidations this large, when set.
+		LossMinUSD float64
+
+		// AlertButtonUSD puts the buttons to be DMed liquidations this large under them, when set.
+		AlertButtonUSD float64
+
+		// Cards attaches an image to the monthly and all-time records at least CardMinUSD large, when set.
+		Cards      *RecordCard
+		CardMinUSD float64
+
+		// Pins keeps the largest liquidation of the day pinned, when set.
+		Pins *DailyPin
+
+		// Merge folds the runs of near-identical liquidations into a single message, when set.
+		Merge *Merger
+
+		// Forum post the messages go under
+		mu       sync.Mutex
+		thread   string
+		started  time.Time
+		lastSent time.Time
+
+		// Messages posted about each order, for amending them
+		postedOnce sync.Once
+		posted     *TTLCache
+	}
+
+	// postedMessage is a liquidation message that can still be edited.
+	postedMessage struct {
+		Channel string
+		ID      string
+		DL      DecoratedLiquidation
+		Sent    time.Time
+	}
+)
+
+// Amendments are only followed for this long after the message was posted.
+const amendWindow = time.Hour
+
+// Publish implements Sink.
+func (s *DiscordSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	if dl.Liquidation.Historical {
+		return nil
+	}
+
+	if s.Merge != nil {
+		if merged, err := s.merge(ctx, dl.Liquidation); merged {
+			return err
+		}
+	}
+
+	status := s.status(dl)
+	if s.LatencyFooter {
+		status += fmt.Sprintf("\n`receive to post: %v`", time.Since(dl.Liquidation.Received).Round(time.Microsecond))
+	}
+
+	usd := float64(dl.Liquidation.USDValue())
+	msg := &discordgo.MessageSend{Content: status}
+	if embed := currentTiers().Of(usd).Embed(status); embed != nil {
+		msg.Content, msg.Embeds = "", []*discordgo.MessageEmbed{embed}
+	}
+	if s.AlertButtonUSD > 0 && usd >= s.AlertButtonUSD {
+		msg.Components = alertButtons(s.AlertButtonUSD, s.Format)
+	}
+	if s.Cards != nil && usd >= s.CardMinUSD && recordTitle(dl) != "" {
+		if card, err := s.Cards.Render(dl, s.Format); err != nil {
+			log.Println("Failed to render the record card:", err)
+		} else {
+			msg.Files = []*discordgo.File{card}
+		}
+	}
+
+	sent, err := s.sendComplex(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if s.Pins != nil {
+		s.Pins.Update(s.Session, s.Channel, sent, dl.Liquidation.USDValue(), time.Now())
+	}
+	posted := postedMessage{Channel: sent.ChannelID, ID: sent.ID, DL: dl, Sent: time.Now()}
+	if orderID := dl.Liquidation.OrderID; orderID != "" {
+		s.remember(orderID, posted)
+	}
+	if s.Merge != nil {
+		s.Merge.Start(posted, time.Now())
+	}
+
+	return nil
+}
+
+// Amend implements Amender, editing the message posted about the order to the new values.
+func (s *DiscordSink) Amend(ctx context.Context, l Liquidation) error {
+	cached, ok := s.messages().Get(l.OrderID, time.Now())
+	if !ok {
+		return nil
+	}
+
+	var content string
+	var err error
+	switch cached := cached.(type) {
+	case *mergeRun:
+		// The message sums up several orders, the amendment changes its part of the total
+		if !cached.Amend(l) {
+			return nil
+		}
+		total, orders := cached.Total()
+		content, err = s.edit(ctx, cached.Message, total, fmt.Sprintf("%v orders, amended", orders))
+	case postedMessage:
+		content, err = s.edit(ctx, cached, l, "amended")
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Amended message: %v\n", content)
+	return nil
+}
+
+// edit rewrites the message posted to the liquidation, with the note after it.
+func (s *DiscordSink) edit(ctx context.Context, posted postedMessage, l Liquidation, note string) (string, error) {
+	dl := posted.DL
+	dl.Liquidation = l
+	content := s.status(dl) + " (" + note + ")"
+	edit := discordgo.NewMessageEdit(posted.Channel, posted.ID)
+	if embed := currentTiers().Of(float64(l.USDValue())).Embed(content); embed != nil {
+		edit.SetContent(s.Label).SetEmbeds([]*discordgo.MessageEmbed{embed})
+	} else {
+		if s.Label != "" {
+			content = s.Label + " " + content
+		}
+		edit.SetContent(content).SetEmbeds([]*discordgo.MessageEmbed{})
+	}
+
+	_, err := s.Session.ChannelMessageEditComplex(edit, discordgo.WithContext(ctx))
+	return content, err
+}
+
+// merge folds the liquidation into the last message when it continues its run, telling whether it did.
+func (s *DiscordSink) merge(ctx context.Context, l Liquidation) (bool, error) {
+	run, ok := s.Merge.Fold(l, time.Now())
+	if !ok {
+		return false, nil
+	}
+	// The message sums up several orders now, the amendments to any of them edit their part
+	for _, orderID := range run.Orders() {
+		s.messages().Set(orderID, run, run.Message.Sent)
+	}
+
+	total, orders := run.Total()
+	content, err := s.edit(ctx, run.Message, total, fmt.Sprintf("%v orders", orders))
+	if err != nil {
+		return true, err
+	}
+	metrics.Counter("rekt_merged_total").Inc()
+	log.Printf("Merged into message: %v\n", content)
+	return true, nil
+}
+
+// status is the text of the message about the liquidation.
+func (s *DiscordSink) status(dl DecoratedLiquidation) string {
+	status := currentTiers().Of(float64(dl.Liquidation.USDValue())).Text(dl, s.Format)
+	if s.Timestamps {
+		status += fmt.Sprintf(" ~ <t:%v:R>", liquidationTime(dl.Liquidation).Unix())
+	}
+	if l := dl.Liquidation; s.LossMinUSD > 0 && l.USD >= s.LossMinUSD && l.Loss > 0 {
+		status += "\napprox. loss: " + s.Format.USD(int64(l.Loss))
+	}
+	return status
+}
+
+// remember keeps the message for amending it, forgetting those too old to be amended anymore.
+func (s *DiscordSink) remember(orderID string, posted postedMessage) {
+	s.messages().Set(orderID, posted, posted.Sent)
+}
+
+// messages returns the messages that can still be amended, by order.
+func (s *DiscordSink) messages() *TTLCache {
+	s.postedOnce.Do(func() {
+		s.posted = NewTTLCache("messages", amendWindow, maxTrackedOrders)
+	})
+	return s.posted
+}
+
+// Announce implements Sink.
+func (s *DiscordSink) Announce(ctx context.Context, text string) error {
+	if s.Merge != nil {
+		s.Merge.Break()
+	}
+	_, err := s.sendComplex(ctx, &discordgo.MessageSend{Content: text})
+	return err
+}
+
+// Post implements Poster.
+func (s *DiscordSink) Post(ctx context.Context, post Post) error {
+	if post.Event != nil {
+		return s.schedule(ctx, *post.Event)
+	}
+
+	if s.Merge != nil {
+		s.Merge.Break()
+	}
+	msg := &discordgo.MessageSend{Content: post.Text}
+	for _, file := range post.Files {
+		msg.Files = append(msg.Files, &discordgo.File{Name: file.Name, ContentType: file.ContentType, Reader: bytes.NewReader(file.Data)})
+	}
+	_, err := s.sendComplex(ctx, msg)
+	return err
+}
+
+// schedule creates the event in the guild of the channel.
+func (s *DiscordSink) schedule(ctx context.Context, event PostEvent) error {
+	channel, err := s.Session.State.Channel(s.Channel)
+	if err != nil {
+		if channel, err = s.Session.Channel(s.Channel, discordgo.WithContext(ctx)); err != nil {
+			return errwrap.Wrapf("failed to look up the channel: {{err}}", err)
+		}
+	}
+	if channel.GuildID == "" || (event.Once != nil && !event.Once(channel.GuildID)) {
+		return nil
+	}
+
+	_, err = s.Session.GuildScheduledEventCreate(channel.GuildID, &discordgo.GuildScheduledEventParams{
+		Name:               event.Name,
+		Description:        event.Description,
+		ScheduledStartTime: &event.Start,
+		ScheduledEndTime:   &event.End,
+		PrivacyLevel:       discordgo.GuildScheduledEventPrivacyLevelGuildOnly,
+		EntityType:         discordgo.GuildScheduledEventEntityTypeExternal,
+		EntityMetadata:     &discordgo.GuildScheduledEventEntityMetadata{Location: "#" + channel.Name},
+	}, discordgo.WithContext(ctx))
+	if err == nil {
+		log.Printf("Created event in guild %v: %v\n", channel.GuildID, event.Name)
+	}
+	return err
+}
+
+func (s *DiscordSink) sendComplex(ctx context.Context, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	if s.Label != "" {
+		msg.Content = s.Label + " " + msg.Content
+	}
+
+	var sent *discordgo.Message
+	var err error
+	if s.Forum != "" {
+		sent, err = s.sendForum(ctx, msg)
+	} else {
+		sent, err = s.Session.ChannelMessageSendComplex(s.Channel, msg, discordgo.WithContext(ctx))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text := msg.Content
+	for _, embed := range msg.Embeds {
+		text += " " + embed.Description
+	}
+	log.Printf("Sent message: %v\n", strings.TrimSpace(text))
+	return sent, nil
+}
+
+// amend passes the amended liquidation on to the sink if it can take it.
+func amend(ctx context.Context, sink Sink, l Liquidation) error {
+	if amender, ok := sink.(Amender); ok {
+		return amender.Amend(ctx, l)
+	}
+	return nil
+}
+
+// String describes the post in the logs.
+func (p Post) String() string {
+	if p.Event != nil {
+		return "event " + p.Event.Name
+	}
+	names := make([]string, len(p.Files))
+	for i, file := range p.Files {
+		names[i] = file.Name
+	}
+	return strings.TrimSpace(p.Text + " " + strings.Join(names, " "))
+}
+
+// sendPost passes the post on to the sink if it can take it.
+func sendPost(ctx context.Context, sink Sink, post Post) error {
+	if poster, ok := sink.(Poster); ok {
+		return poster.Post(ctx, post)
+	}
+	return nil
+}
+
+// timerTimeout bounds the announcements made by timers rather than on the pipeline, which
+// have no delivery to take a context from.
+const timerTimeout = 30 * time.Second
+
+// announceLater posts the text from a timer, such as a roll-up or the end of a pause.
+func announceLater(sink Sink, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timerTimeout)
+	defer cancel()
+
+	return sink.Announce(ctx, text)
+}
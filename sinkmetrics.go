@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// availabilityWindow is how many recent deliveries the availability of a sink is computed over.
+const availabilityWindow = 1000
+
+// Availability isn't alerted about until the window has this many deliveries.
+const minAvailabilitySamples = 100
+
+type (
+	// MeteredSink counts the deliveries to a sink, their failures and latency, and tracks its
+	// availability over the recent deliveries.
+	MeteredSink struct {
+		Sink
+		Name string
+
+		// AlertBelow alerts the operators when the availability drops under it, when set.
+		AlertBelow float64
+
+		mu       sync.Mutex
+		outcomes [availabilityWindow]bool // Whether each recent delivery failed, as a ring
+		next     int
+		count    int
+		failures int
+	}
+
+	// queuedSink is a sink that holds deliveries back, such as to batch them.
+	queuedSink interface {
+		QueueDepth() int
+	}
+)
+
+// metered wraps the sink in the delivery metrics, alerting when its availability drops below the configured level.
+func metered(cfg BotConfig, name string, sink Sink) *MeteredSink {
+	return &MeteredSink{Sink: sink, Name: name, AlertBelow: cfg.SinkAvailabilityAlert}
+}
+
+// Publish implements Sink.
+func (s *MeteredSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	start := time.Now()
+	return s.record(s.Sink.Publish(ctx, dl), start)
+}
+
+// Announce implements Sink.
+func (s *MeteredSink) Announce(ctx context.Context, text string) error {
+	start := time.Now()
+	return s.record(s.Sink.Announce(ctx, text), start)
+}
+
+// Amend implements Amender.
+func (s *MeteredSink) Amend(ctx context.Context, l Liquidation) error {
+	start := time.Now()
+	return s.record(amend(ctx, s.Sink, l), start)
+}
+
+// Post implements Poster.
+func (s *MeteredSink) Post(ctx context.Context, post Post) error {
+	start := time.Now()
+	return s.record(sendPost(ctx, s.Sink, post), start)
+}
+
+// Availability returns the fraction of the recent deliveries that succeeded, 1 before the first.
+func (s *MeteredSink) Availability() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.availability()
+}
+
+func (s *MeteredSink) availability() float64 {
+	if s.count == 0 {
+		return 1
+	}
+	return 1 - float64(s.failures)/float64(s.count)
+}
+
+// record updates the metrics with the outcome of a delivery. Skipping one because the breaker is
+// open counts as a failure: the message didn't make it.
+func (s *MeteredSink) record(err error, start time.Time) error {
+	metrics.Counter("rekt_sink_attempts_total", "sink", s.Name).Inc()
+	metrics.Summary("rekt_sink_latency_seconds", "sink", s.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.Counter("rekt_sink_failures_total", "sink", s.Name).Inc()
+	}
+	if queued, ok := s.Sink.(queuedSink); ok {
+		metrics.Gauge("rekt_sink_queue_depth", "sink", s.Name).Set(float64(queued.QueueDepth()))
+	}
+
+	s.mu.Lock()
+	if s.count == availabilityWindow && s.outcomes[s.next] {
+		s.failures--
+	}
+	if s.count < availabilityWindow {
+		s.count++
+	}
+	s.outcomes[s.next] = err != nil
+	if err != nil {
+		s.failures++
+	}
+	s.next = (s.next + 1) % availabilityWindow
+
+	availability, count := s.availability(), s.count
+	s.mu.Unlock()
+
+	metrics.Gauge("rekt_sink_availability", "sink", s.Name).Set(availability)
+	if s.AlertBelow > 0 && count >= minAvailabilitySamples && availability < s.AlertBelow {
+		ops.Alert("availability_"+s.Name, "Only %.1f%% of the last %v deliveries to %v succeeded", availability*100, count, s.Name)
+	}
+
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMeteredSinkAvailability(t *testing.T) {
+	inner := &flakySink{}
+	s := &MeteredSink{Sink: inner, Name: "flaky"}
+	dl := DecoratedLiquidation{Liquidation: Liquidation{Quantity: 10000}}
+
+	if a := s.Availability(); a != 1 {
+		t.Errorf("expected full availability before any delivery, got %v", a)
+	}
+
+	for i := 0; i < 90; i++ {
+		s.Publish(context.Background(), dl)
+	}
+	inner.down = true
+	for i := 0; i < 10; i++ {
+		s.Publish(context.Background(), dl)
+	}
+	if a := s.Availability(); a != 0.9 {
+		t.Errorf("expected 90%% availability, got %v", a)
+	}
+
+	// The failures leave the window as deliveries succeed again
+	inner.down = false
+	for i := 0; i < availabilityWindow; i++ {
+		s.Publish(context.Background(), dl)
+	}
+	if a := s.Availability(); a != 1 {
+		t.Errorf("expected the old failures to be forgotten, got %v", a)
+	}
+
+	if v := metrics.Counter("rekt_sink_failures_total", "sink", "flaky").Value(); v != 10 {
+		t.Errorf("expected 10 failures counted, got %v", v)
+	}
+}
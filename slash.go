@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// CommandRequest is a single invocation of a slash command.
+	CommandRequest struct {
+		Session     *discordgo.Session
+		Interaction *discordgo.InteractionCreate
+		Subcommand  string // Name of the subcommand, for commands that have them
+		Options     map[string]*discordgo.ApplicationCommandInteractionDataOption
+	}
+
+	// SlashCommand is a Discord application command along with its handler.
+	SlashCommand struct {
+		Definition *discordgo.ApplicationCommand
+		Permission Permission // Who may run it, members by default
+		Handle     func(req *CommandRequest) (*discordgo.InteractionResponseData, error)
+
+		// Deferred acknowledges the command at once and edits the reply in once Handle returns, for
+		// those that can take longer than the 3 seconds Discord waits for an answer
+		Deferred bool
+	}
+
+	// ComponentHandler answers clicks on the message components whose custom ID starts with its prefix,
+	// args being the rest of the ID split on colons. The reply replaces the message, unless it is ephemeral.
+	// The members may click them, each prefix having the cooldown of the command of its name.
+	ComponentHandler func(req *CommandRequest, args []string) (*discordgo.InteractionResponseData, error)
+
+	// SlashCommands registers the bot's slash commands and dispatches interactions to them.
+	SlashCommands struct {
+		Session *discordgo.Session
+		GuildID string // Commands registered in a single guild show up instantly, global ones can take an hour
+
+		// Active tells whether this replica should answer, every replica does when nil
+		Active func() bool
+
+		// Settings holds the roles of each permission, when nil only server managers are admins
+		Settings *Settings
+
+		// Cooldowns is how long each user has to wait between runs of a command, by command name
+		Cooldowns map[string]time.Duration
+
+		// GuildQuota is how many commands each guild may run an hour, 0 for no limit. The admin
+		// commands are left out, so a guild can always change its settings.
+		GuildQuota int
+
+		commands   map[string]*SlashCommand
+		components map[string]ComponentHandler
+
+		mu        sync.Mutex
+		lastRun   map[string]time.Time   // By command and user
+		guildRuns map[string][]time.Time // Within the hour, oldest first, by guild
+	}
+)
+
+// NewSlashCommands returns an empty set of commands for the session.
+func NewSlashCommands(session *discordgo.Session, guildID string) *SlashCommands {
+	return &SlashCommands{
+		Session:    session,
+		GuildID:    guildID,
+		commands:   make(map[string]*SlashCommand),
+		components: make(map[string]ComponentHandler),
+		Cooldowns:  make(map[string]time.Duration),
+		lastRun:    make(map[string]time.Time),
+		guildRuns:  make(map[string][]time.Time),
+	}
+}
+
+// Add adds a command, it is only visible to users after Register.
+func (c *SlashCommands) Add(cmd *SlashCommand) {
+	c.commands[cmd.Definition.Name] = cmd
+}
+
+// AddComponent routes the components whose custom ID is prefix or starts with "prefix:" to handler.
+func (c *SlashCommands) AddComponent(prefix string, handler ComponentHandler) {
+	c.components[prefix] = handler
+}
+
+// Register replaces the application's commands with ours and starts answering them.
+func (c *SlashCommands) Register() error {
+	definitions := make([]*discordgo.ApplicationCommand, 0, len(c.commands))
+	for _, cmd := range c.commands {
+		definitions = append(definitions, cmd.Definition)
+	}
+
+	if _, err := c.Session.ApplicationCommandBulkOverwrite(c.Session.State.User.ID, c.GuildID, definitions); err != nil {
+		return errwrap.Wrapf("could not register slash commands: {{err}}", err)
+	}
+
+	c.Session.AddHandler(c.handle)
+	return nil
+}
+
+func (c *SlashCommands) handle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if c.Active != nil && !c.Active() {
+		return
+	}
+	if i.Type == discordgo.InteractionMessageComponent {
+		c.handleComponent(s, i)
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	cmd, ok := c.commands[data.Name]
+	if !ok {
+		return
+	}
+
+	req := &CommandRequest{
+		Session:     s,
+		Interaction: i,
+		Options:     make(map[string]*discordgo.ApplicationCommandInteractionDataOption),
+	}
+	options := data.Options
+	if len(options) == 1 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		req.Subcommand = options[0].Name
+		options = options[0].Options
+	}
+	for _, option := range options {
+		req.Options[option.Name] = option
+	}
+
+	level := cmd.Permission
+	if level == "" {
+		level = PermissionMember
+	}
+
+	var resp *discordgo.InteractionResponseData
+	err := c.admit(req, data.Name, "/"+data.Name, level)
+	if err == nil {
+		if wait := c.quota(i.GuildID, level, time.Now()); wait > 0 {
+			err = fmt.Errorf("this server ran its %v commands of the hour, they are available again in %v", c.GuildQuota, wait.Round(time.Second))
+		}
+	}
+	if err == nil && cmd.Deferred {
+		c.answerLater(req, cmd)
+		return
+	}
+	if err == nil {
+		resp, err = cmd.Handle(req)
+	}
+	if err != nil {
+		// Errors are only shown to the user who ran the command
+		resp = &discordgo.InteractionResponseData{
+			Content: "Error: " + err.Error(),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		}
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: resp,
+	}); err != nil {
+		log.Printf("Failed to answer /%v: %v\n", data.Name, err)
+	}
+}
+
+func (c *SlashCommands) handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.Split(i.MessageComponentData().CustomID, ":")
+	handler, ok := c.components[parts[0]]
+	if !ok {
+		return
+	}
+
+	req := &CommandRequest{Session: s, Interaction: i}
+	respType := discordgo.InteractionResponseUpdateMessage
+	var resp *discordgo.InteractionResponseData
+	err := c.admit(req, parts[0], "the "+parts[0]+" button", PermissionMember)
+	if err == nil {
+		resp, err = handler(req, parts[1:])
+	}
+	if err == nil && resp.Flags&discordgo.MessageFlagsEphemeral != 0 {
+		respType = discordgo.InteractionResponseChannelMessageWithSource
+	} else if err != nil {
+		// Leave the message alone and only tell the user who clicked
+		respType = discordgo.InteractionResponseChannelMessageWithSource
+		resp = &discordgo.InteractionResponseData{
+			Content: "Error: " + err.Error(),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		}
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: respType, Data: resp}); err != nil {
+		log.Printf("Failed to answer the %v button: %v\n", parts[0], err)
+	}
+}
+
+// answerLater acknowledges the command, then edits the reply in once it is ready. An error
+// replaces the reply by a message only the user who ran the command sees.
+func (c *SlashCommands) answerLater(req *CommandRequest, cmd *SlashCommand) {
+	s, i, name := req.Session, req.Interaction, cmd.Definition.Name
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	}); err != nil {
+		log.Printf("Failed to answer /%v: %v\n", name, err)
+		return
+	}
+
+	resp, err := cmd.Handle(req)
+	if err != nil {
+		content := "Error: " + err.Error()
+		if err := s.InteractionResponseDelete(i.Interaction); err != nil {
+			log.Printf("Failed to answer /%v: %v\n", name, err)
+		}
+		if _, err := s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		}); err != nil {
+			log.Printf("Failed to answer /%v: %v\n", name, err)
+		}
+		return
+	}
+
+	edit := &discordgo.WebhookEdit{Content: &resp.Content, Files: resp.Files}
+	if resp.Embeds != nil {
+		edit.Embeds = &resp.Embeds
+	}
+	if resp.Components != nil {
+		edit.Components = &resp.Components
+	}
+	if _, err := s.InteractionResponseEdit(i.Interaction, edit); err != nil {
+		log.Printf("Failed to answer /%v: %v\n", name, err)
+	}
+}
+
+// admit checks that the user may run the command or click the component of the name and isn't
+// within its cooldown, described naming it in the errors: "/find" or "the alert button".
+func (c *SlashCommands) admit(req *CommandRequest, name, described string, level Permission) error {
+	if !allowed(req, c.Settings, level) {
+		return fmt.Errorf("you don't have permission to use %v", described)
+	}
+	if wait := c.cooldown(name, req.User().ID, time.Now()); wait > 0 {
+		return fmt.Errorf("slow down, %v is available again in %v", described, wait.Round(time.Second))
+	}
+	return nil
+}
+
+// cooldown returns how long the user still has to wait before running the command, starting a new
+// cooldown when it is zero.
+func (c *SlashCommands) cooldown(name, user string, now time.Time) time.Duration {
+	period := c.Cooldowns[name]
+	if period <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := name + "/" + user
+	if wait := c.lastRun[key].Add(period).Sub(now); wait > 0 {
+		return wait
+	}
+	c.lastRun[key] = now
+
+	// Forget the cooldowns that are over so the map doesn't grow with every user, none lasting
+	// longer than the longest
+	var longest time.Duration
+	for _, d := range c.Cooldowns {
+		if d > longest {
+			longest = d
+		}
+	}
+	for k, t := range c.lastRun {
+		if now.Sub(t) > longest {
+			delete(c.lastRun, k)
+		}
+	}
+
+	return 0
+}
+
+// quota returns how long the guild still has to wait before running a command of the level,
+// counting the run when it is zero.
+func (c *SlashCommands) quota(guild string, level Permission, now time.Time) time.Duration {
+	if c.GuildQuota <= 0 || guild == "" || level == PermissionAdmin {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	runs := c.guildRuns[guild]
+	for len(runs) > 0 && now.Sub(runs[0]) >= time.Hour {
+		runs = runs[1:]
+	}
+	if len(runs) >= c.GuildQuota {
+		c.guildRuns[guild] = runs
+		metrics.Counter("rekt_tenant_commands_total", "result", "over_quota").Inc()
+		return runs[len(runs)-c.GuildQuota].Add(time.Hour).Sub(now)
+	}
+	c.guildRuns[guild] = append(runs, now)
+	metrics.Counter("rekt_tenant_commands_total", "result", "run").Inc()
+	return 0
+}
+
+// User returns who ran the command, whether in a guild or a DM.
+func (req *CommandRequest) User() *discordgo.User {
+	if req.Interaction.Member != nil {
+		return req.Interaction.Member.User
+	}
+	return req.Interaction.User
+}
+
+// Int returns the integer option, or def if it wasn't given.
+func (req *CommandRequest) Int(name string, def int64) int64 {
+	if option, ok := req.Options[name]; ok {
+		return option.IntValue()
+	}
+	return def
+}
+
+// String returns the string option, or def if it wasn't given.
+func (req *CommandRequest) String(name, def string) string {
+	if option, ok := req.Options[name]; ok {
+		return option.StringValue()
+	}
+	return def
+}
+
+// Float returns the number option, or def if it wasn't given.
+func (req *CommandRequest) Float(name string, def float64) float64 {
+	if option, ok := req.Options[name]; ok {
+		return option.FloatValue()
+	}
+	return def
+}
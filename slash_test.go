@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSlashCooldown(t *testing.T) {
+	c := NewSlashCommands(nil, "")
+	c.Cooldowns["export"] = time.Minute
+	now := time.Now()
+
+	if wait := c.cooldown("export", "alice", now); wait != 0 {
+		t.Fatalf("expected the first run to go through, got a %v wait", wait)
+	}
+	if wait := c.cooldown("export", "alice", now.Add(20*time.Second)); wait != 40*time.Second {
+		t.Errorf("expected a 40s wait, got %v", wait)
+	}
+	if wait := c.cooldown("export", "bob", now.Add(20*time.Second)); wait != 0 {
+		t.Errorf("expected other users not to wait, got %v", wait)
+	}
+	if wait := c.cooldown("liqprice", "alice", now.Add(20*time.Second)); wait != 0 {
+		t.Errorf("expected commands without a cooldown not to wait, got %v", wait)
+	}
+	if wait := c.cooldown("export", "alice", now.Add(time.Minute)); wait != 0 {
+		t.Errorf("expected the cooldown to be over, got %v", wait)
+	}
+
+	// The cooldowns longer than an hour are kept until they are over
+	c.Cooldowns["backup"] = 2 * time.Hour
+	c.cooldown("backup", "alice", now)
+	c.cooldown("export", "bob", now.Add(90*time.Minute))
+	if wait := c.cooldown("backup", "alice", now.Add(90*time.Minute)); wait != 30*time.Minute {
+		t.Errorf("expected a 30m wait, got %v", wait)
+	}
+}
+
+func TestSlashGuildQuota(t *testing.T) {
+	c := NewSlashCommands(nil, "")
+	c.GuildQuota = 2
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if wait := c.quota("g1", PermissionMember, now.Add(time.Duration(i)*time.Minute)); wait != 0 {
+			t.Fatalf("expected run %v to be within the quota, got a %v wait", i, wait)
+		}
+	}
+	if wait := c.quota("g1", PermissionMember, now.Add(10*time.Minute)); wait != 50*time.Minute {
+		t.Errorf("expected a 50m wait, got %v", wait)
+	}
+	if wait := c.quota("g1", PermissionAdmin, now.Add(10*time.Minute)); wait != 0 {
+		t.Errorf("expected the admin commands to be left out, got %v", wait)
+	}
+	if wait := c.quota("g2", PermissionMember, now.Add(10*time.Minute)); wait != 0 {
+		t.Errorf("expected other guilds to have their own quota, got %v", wait)
+	}
+	if wait := c.quota("g1", PermissionMember, now.Add(time.Hour)); wait != 0 {
+		t.Errorf("expected the first run to be over an hour old, got %v", wait)
+	}
+}
+
+func TestSlashAdmit(t *testing.T) {
+	settings, err := LoadSettings(filepath.Join(t.TempDir(), "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.SetRoles("guild", PermissionMember, []string{"subscribers"})
+
+	c := NewSlashCommands(nil, "")
+	c.Settings = settings
+	c.Cooldowns["alert"] = time.Minute
+	request := func(roles ...string) *CommandRequest {
+		member := &discordgo.Member{User: &discordgo.User{ID: "alice"}, Roles: roles}
+		return &CommandRequest{Interaction: &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{GuildID: "guild", Member: member}}}
+	}
+
+	// The buttons take the same permissions and cooldowns as the commands
+	if err := c.admit(request(), "alert", "the alert button", PermissionMember); err == nil || !strings.Contains(err.Error(), "permission to use the alert button") {
+		t.Errorf("expected the members without the role to be refused, got %v", err)
+	}
+	if err := c.admit(request("subscribers"), "alert", "the alert button", PermissionMember); err != nil {
+		t.Errorf("expected the subscribers to click the button, got %v", err)
+	}
+	if err := c.admit(request("subscribers"), "alert", "the alert button", PermissionMember); err == nil || !strings.Contains(err.Error(), "slow down, the alert button") {
+		t.Errorf("expected the cooldown of the button, got %v", err)
+	}
+}
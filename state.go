@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type (
@@ -17,6 +22,10 @@ type (
 		SaveFile   string
 		HighScores HighScores
 
+		// Fsync flushes every save to the disk before it replaces the previous one, so even a
+		// power cut leaves a complete file behind.
+		Fsync bool
+
 		Snark      []string
 		SnarkIndex int
 
@@ -28,6 +37,7 @@ type (
 		HighestDay   int64 `json:"highest_day"`
 		HighestWeek  int64 `json:"highest_week"`
 		HighestMonth int64 `json:"highest_month"`
+		HighestEver  int64 `json:"highest_ever"`
 
 		LastDay   int        `json:"last_day"`
 		LastWeek  int        `json:"last_week"`
@@ -41,10 +51,20 @@ type (
 		UnixTime int64 `json:"unix_time"`
 	}
 
+	// SideStreak counts the consecutive liquidations of the same side on a symbol.
+	SideStreak struct {
+		Side  string `json:"side"`
+		Count int    `json:"count"`
+	}
+
 	// HighScores defines a data structure that store high scores.
 	HighScores struct {
-		Scores map[Symbol]Scores `json:"scores"`
-		Kills  map[Symbol]Kill   `json:"kills"`
+		Scores map[Symbol]Scores     `json:"scores"`
+		Kills  map[Symbol]Kill       `json:"kills"`
+		Sides  map[Symbol]SideStreak `json:"sides"`
+
+		// Checksum is the SHA-256 of the rest, files from before it don't have one.
+		Checksum string `json:"checksum,omitempty"`
 	}
 
 	// A Medal is awarded to the liquidation if it breaks a high score.
@@ -53,12 +73,19 @@ type (
 	// DecoratedLiquidation gives liqudation extra properties based on its timing and size.
 	DecoratedLiquidation struct {
 		Streak      string      // Multikills
+		SideStreak  int         // Liquidations of the same side in a row on the symbol, this one included
 		Medals      []Medal     // Medals
 		Snark       string      // Snarky meme text to salt the wound
 		Liquidation Liquidation // Actual liquidiation
 	}
 )
 
+// Side streaks this long are mentioned.
+const notableSideStreak = 10
+
+// highScoresFile is where the high scores are saved, in the state directory.
+const highScoresFile = "high_scores.json"
+
 // Medals a liqudiation can win.
 const (
 	MedalLargestToday Medal = iota
@@ -69,6 +96,8 @@ const (
 	MedalStreak    // Killed as part of a kill streak
 	MedalSecKilled // Killed within two seconds of the previous
 
+	MedalLargestEver // Largest since the high scores have been kept
+
 	// TODO: More to come
 )
 
@@ -79,22 +108,24 @@ var medalMap = map[Medal]string{
 	Medal100k:         "\U0001F4AF",
 	MedalStreak:       "\U0001F525",
 	MedalSecKilled:    "\U000026A1",
+	MedalLargestEver:  "\U0001F451",
 }
 
 // NewState returns a new state object.
 func NewState() (*State, error) {
 	// TODO: move hardcoded files out of here.
-	highScoresFile := "high_scores.json"
-	snarkFile := "text/memes.txt"
-	multiKillFile := "text/kill_streaks.txt"
+	saveFile := statePath(highScoresFile)
+	snarkFile := assetPath("text/memes.txt")
+	multiKillFile := assetPath("text/kill_streaks.txt")
 
 	var state State
 
 	// Load high scores
-	if f, err := os.Open(highScoresFile); err != nil {
+	if f, err := os.Open(saveFile); err != nil {
 		state.HighScores = HighScores{
-			make(map[Symbol]Scores),
-			make(map[Symbol]Kill),
+			Scores: make(map[Symbol]Scores),
+			Kills:  make(map[Symbol]Kill),
+			Sides:  make(map[Symbol]SideStreak),
 		}
 	} else {
 		defer f.Close()
@@ -102,8 +133,11 @@ func NewState() (*State, error) {
 		if err := json.NewDecoder(f).Decode(&state.HighScores); err != nil {
 			return nil, err
 		}
+		if sum := state.HighScores.Checksum; sum != "" && sum != state.HighScores.checksum() {
+			return nil, fmt.Errorf("%v is corrupt, its checksum doesn't match: move it away to start the records over", saveFile)
+		}
 	}
-	state.SaveFile = highScoresFile
+	state.SaveFile = saveFile
 
 	// Load memes
 	snarkText, err := ioutil.ReadFile(snarkFile)
@@ -133,25 +167,66 @@ func (s *State) resetSnark() {
 		s.Snark[i], s.Snark[j] = s.Snark[j], s.Snark[i]
 	}
 
-	log.Println("Banter order:")
+	debugLog.Println("Banter order:")
 	for _, v := range s.Snark {
-		log.Println("    ", v)
+		debugLog.Println("    ", v)
 	}
 }
 
-// Save stores the high scores back to disk.
-func (s *State) Save() error {
-	f, err := os.OpenFile(s.SaveFile, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
+// Save stores the high scores back to disk. They are written next to the file and renamed over
+// it once complete, so a crash halfway through leaves the previous save intact.
+func (s *State) Save(ctx context.Context) error {
+	// Shutting down, the work under way no longer needs saving
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	defer f.Close()
 
-	if err := json.NewEncoder(f).Encode(s.HighScores); err != nil {
+	scores := s.HighScores
+	scores.Checksum = scores.checksum()
+
+	return writeAtomic(s.SaveFile, s.Fsync, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(scores)
+	})
+}
+
+// writeAtomic writes the file next to path and renames it over path once complete, synced to
+// disk first when fsync is set, so a crash halfway through leaves the previous file intact.
+func writeAtomic(path string, fsync bool, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
 		return err
 	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// checksum returns the SHA-256 of the high scores as they are encoded, the checksum left out.
+func (h HighScores) checksum() string {
+	h.Checksum = ""
+	data, err := json.Marshal(h)
+	if err != nil {
+		return ""
+	}
 
-	return nil
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 // Linear interpolation
@@ -163,7 +238,8 @@ func lerp(x, y, z int64, start, end float64) float64 {
 func (s *State) Decorate(l Liquidation) DecoratedLiquidation {
 	// Hand out medals
 	var medals []Medal
-	scores := s.HighScores.Scores[l.Symbol]
+	key := l.ScoreKey()
+	scores := s.HighScores.Scores[key]
 
 	// Expire the scores if their time has reached
 	now := time.Now()
@@ -194,15 +270,23 @@ func (s *State) Decorate(l Liquidation) DecoratedLiquidation {
 		medals = append(medals, MedalLargestMonth)
 	}
 
+	// The all-time record can only be broken once there is one
+	if l.Quantity > scores.HighestEver {
+		if scores.HighestEver > 0 {
+			medals = append(medals, MedalLargestEver)
+		}
+		scores.HighestEver = l.Quantity
+	}
+
 	// Award the 100k medals
 	for i := int64(0); i < l.Quantity/100000; i++ {
 		medals = append(medals, Medal100k)
 	}
 
-	s.HighScores.Scores[l.Symbol] = scores
+	s.HighScores.Scores[key] = scores
 
 	// Issue the streak
-	streak := s.HighScores.Kills[l.Symbol]
+	streak := s.HighScores.Kills[key]
 
 	if now.Unix()-streak.UnixTime > 60 {
 		streak.Count = 0
@@ -218,7 +302,18 @@ func (s *State) Decorate(l Liquidation) DecoratedLiquidation {
 	}
 
 	streak.UnixTime = now.Unix()
-	s.HighScores.Kills[l.Symbol] = streak
+	s.HighScores.Kills[key] = streak
+
+	// Count the side streak, high score files from before it don't have them
+	if s.HighScores.Sides == nil {
+		s.HighScores.Sides = make(map[Symbol]SideStreak)
+	}
+	sides := s.HighScores.Sides[key]
+	if sides.Side != l.Side {
+		sides = SideStreak{Side: l.Side}
+	}
+	sides.Count++
+	s.HighScores.Sides[key] = sides
 
 	// Issue the snark
 	// Because we have limited text, we will not be able to issue snark every single time.
@@ -261,11 +356,12 @@ func (s *State) Decorate(l Liquidation) DecoratedLiquidation {
 	} else {
 		streakStrRaw = s.MultiKill[streak.Count]
 	}
-	streakStr := strings.Replace(streakStrRaw, "$SYMBOL", string(l.Symbol), -1)
-	snarkStr := strings.Replace(snark, "$SYMBOL", string(l.Symbol), -1)
+	streakStr := strings.Replace(streakStrRaw, "$SYMBOL", l.DisplayName(), -1)
+	snarkStr := strings.Replace(snark, "$SYMBOL", l.DisplayName(), -1)
 
 	dl := DecoratedLiquidation{
 		Streak:      streakStr,
+		SideStreak:  sides.Count,
 		Medals:      medals,
 		Snark:       snarkStr,
 		Liquidation: l,
@@ -294,35 +390,61 @@ func (dl DecoratedLiquidation) IsSnarkTooLong() bool {
 		base += 3 + len([]rune(dl.Streak))
 	}
 
+	if side := dl.SideStreakText(); side != "" {
+		base += 3 + len([]rune(side))
+	}
+
 	return base+3+len([]rune(dl.Snark)) > 140
 }
 
 // String implements Stringer.
 func (dl DecoratedLiquidation) String() string {
-	base := dl.Liquidation.String()
+	return dl.Format(DefaultFormat)
+}
+
+// Format writes the decorated liquidation with the numbers in the given format.
+func (dl DecoratedLiquidation) Format(f NumberFormat) string {
+	buf := getBuffer()
+	defer buffers.Put(buf)
+
+	dl.Liquidation.writeTo(buf, f)
 
 	// Add medals
 	if len(dl.Medals) > 0 {
-		base += " "
+		buf.WriteByte(' ')
 		for _, medal := range dl.Medals {
-			base += medalMap[medal]
+			buf.WriteString(medalMap[medal])
 		}
 	}
 
-	// Write the streak if it exists and there is enough space
-	if dl.Streak != "" && len([]rune(base))+3+len([]rune(dl.Streak)) <= 140 {
-		base += " ~ " + dl.Streak
+	// Add the extras that fit, keeping count of the length as it goes
+	length := utf8.RuneCount(buf.Bytes())
+	extra := func(text string) {
+		if n := utf8.RuneCountInString(text); text != "" && length+3+n <= 140 {
+			buf.WriteString(" ~ ")
+			buf.WriteString(text)
+			length += 3 + n
+		}
 	}
 
-	// Write the snark if it exists and there is enough space
-	if dl.Snark != "" && len([]rune(base))+3+len([]rune(dl.Snark)) <= 140 {
-		base += " ~ " + dl.Snark
-	}
+	// The streak, the side streak when it is notable, then the snark
+	extra(dl.Streak)
+	extra(dl.SideStreakText())
+	extra(dl.Snark)
 
 	// Final safety guard
-	if len([]rune(base)) > 140 {
+	base := buf.String()
+	if length > 140 {
 		base = string([]rune(base)[:140])
 	}
 
 	return base
 }
+
+// SideStreakText mentions the side streak when it is notable: "14 long liquidations in a row on ETHUSD".
+func (dl DecoratedLiquidation) SideStreakText() string {
+	if dl.SideStreak < notableSideStreak {
+		return ""
+	}
+	return fmt.Sprintf("%v %v liquidations in a row on %v", dl.SideStreak, dl.Liquidation.Position(), dl.Liquidation.DisplayName())
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"log"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -56,7 +62,7 @@ func TestStreaks(t *testing.T) {
 			Side:     "Buy",
 		}).String()
 
-		if err := s.Save(); err != nil {
+		if err := s.Save(context.Background()); err != nil {
 			t.Fatal(err)
 		}
 
@@ -94,7 +100,7 @@ func TestStreaks(t *testing.T) {
 		verify(result, t)
 	}
 
-	if err := s.Save(); err != nil {
+	if err := s.Save(context.Background()); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -150,7 +156,7 @@ func TestSaveFile(t *testing.T) {
 			Side:     "Buy",
 		}).String()
 
-		if err := s.Save(); err != nil {
+		if err := s.Save(context.Background()); err != nil {
 			t.Fatal(err)
 		}
 
@@ -158,3 +164,111 @@ func TestSaveFile(t *testing.T) {
 		verify(result, t)
 	}
 }
+
+func TestSideStreaks(t *testing.T) {
+	s := &State{
+		HighScores: HighScores{Scores: make(map[Symbol]Scores), Kills: make(map[Symbol]Kill)},
+		Snark:      []string{"rekt"},
+		MultiKill:  []string{"Double kill"},
+	}
+
+	var dl DecoratedLiquidation
+	for i := 0; i < 14; i++ {
+		dl = s.Decorate(Liquidation{Symbol: "ETHUSD", Side: "Sell", Quantity: 1})
+	}
+	if expected := "14 long liquidations in a row on ETHUSD"; dl.SideStreak != 14 || dl.SideStreakText() != expected {
+		t.Errorf("expected %q, got %v: %q", expected, dl.SideStreak, dl.SideStreakText())
+	}
+	if !strings.Contains(dl.String(), "14 long liquidations in a row") {
+		t.Errorf("expected the streak in the message, got %q", dl.String())
+	}
+
+	dl = s.Decorate(Liquidation{Symbol: "ETHUSD", Side: "Buy", Quantity: 1})
+	if dl.SideStreak != 1 || dl.SideStreakText() != "" {
+		t.Errorf("expected a short to end the streak, got %v", dl.SideStreak)
+	}
+
+	a := &Aggregator{Interval: 5 * time.Minute}
+	a.Add(DecoratedLiquidation{SideStreak: 12, Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Buy", Quantity: 1000}})
+	if text := a.flush(); !strings.HasSuffix(text, ". 12 short liquidations in a row on XBTUSD") {
+		t.Errorf("expected the streak in the summary, got %q", text)
+	}
+}
+
+func BenchmarkDecorate(b *testing.B) {
+	s, err := NewState()
+	if err != nil {
+		b.Fatal(err)
+	}
+	l := Liquidation{Price: 9000, Quantity: 250000, Symbol: "XBTUSD", Side: "Sell"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Decorate(l)
+	}
+}
+
+func BenchmarkFormat(b *testing.B) {
+	dl := DecoratedLiquidation{
+		Liquidation: Liquidation{Price: 9000.5, Quantity: 250000, Symbol: "XBTUSD", Side: "Sell", Leverage: 25},
+		Medals:      []Medal{MedalLargestWeek, Medal100k, Medal100k, MedalStreak},
+		Streak:      "Double kill on XBTUSD",
+		Snark:       "rekt",
+	}
+	formats := map[string]NumberFormat{
+		"default": DefaultFormat,
+		"usd":     {Show: []string{ShowContracts, ShowUSD}, GroupPrices: true},
+	}
+
+	for name, f := range formats {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dl.Format(f)
+			}
+		})
+	}
+}
+
+func TestSaveAtomic(t *testing.T) {
+	s, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SaveFile = filepath.Join(t.TempDir(), "high_scores.json")
+	s.Fsync = true
+	s.Decorate(Liquidation{Price: 9000, Quantity: 250000, Symbol: "XBTUSD", Side: "Sell"})
+
+	// A longer file from before is replaced, not written over
+	if err := ioutil.WriteFile(s.SaveFile, []byte(strings.Repeat(" ", 10000)+"garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.SaveFile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("expected the temporary file to be renamed")
+	}
+
+	data, err := ioutil.ReadFile(s.SaveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved HighScores
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal("expected a complete file, got:", err)
+	}
+	if saved.Checksum == "" || saved.Checksum != saved.checksum() {
+		t.Errorf("expected a matching checksum, got %q", saved.Checksum)
+	}
+	if saved.Scores["XBTUSD"].HighestEver != 250000 {
+		t.Errorf("expected the record to be saved, got %+v", saved.Scores)
+	}
+
+	// Any change shows
+	saved.Scores["XBTUSD"] = Scores{HighestEver: 1}
+	if saved.Checksum == saved.checksum() {
+		t.Error("expected the checksum to catch the change")
+	}
+}
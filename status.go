@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// StatusWatcher posts the exchange's announcements, incidents and maintenance windows, which
+	// also tells the channel why the liquidations went quiet.
+	StatusWatcher struct {
+		Host       string // Of the API, for the announcements
+		StatusHost string // Of the status page, such as status.bitmex.com
+		Client     *http.Client
+		Interval   time.Duration
+
+		announcements map[int64]bool         // Already posted, nil until the first poll
+		events        map[string]statusEvent // Unresolved incidents and upcoming maintenance, by ID
+	}
+
+	// bitmexAnnouncement is an entry of the announcement feed.
+	// https://www.bitmex.com/api/explorer/#!/Announcement/Announcement_get
+	bitmexAnnouncement struct {
+		ID    int64  `json:"id"`
+		Link  string `json:"link"`
+		Title string `json:"title"`
+	}
+
+	// statusSummary is what matters of the status page summary.
+	// https://metastatuspage.com/api#summary
+	statusSummary struct {
+		Incidents    []statusEvent `json:"incidents"`
+		Maintenances []statusEvent `json:"scheduled_maintenances"`
+	}
+
+	// statusEvent is an incident or a maintenance window.
+	statusEvent struct {
+		ID             string    `json:"id"`
+		Name           string    `json:"name"`
+		Status         string    `json:"status"`
+		Shortlink      string    `json:"shortlink"`
+		ScheduledFor   time.Time `json:"scheduled_for"`   // Maintenance only
+		ScheduledUntil time.Time `json:"scheduled_until"` // Maintenance only
+	}
+)
+
+// Run polls every interval and announces what changed.
+func (w *StatusWatcher) Run(announce func(text string)) {
+	for ; ; time.Sleep(w.Interval) {
+		notices, err := w.poll()
+		if err != nil {
+			log.Println("Failed to check the exchange status:", err)
+			continue
+		}
+
+		for _, notice := range notices {
+			announce(notice)
+		}
+	}
+}
+
+// poll returns the notices for what changed since the previous poll. The first poll only takes note.
+func (w *StatusWatcher) poll() ([]string, error) {
+	var announcements []bitmexAnnouncement
+	if err := w.get(w.Host, "/api/v1/announcement", &announcements); err != nil {
+		return nil, errwrap.Wrapf("could not fetch the announcements: {{err}}", err)
+	}
+	var summary statusSummary
+	if err := w.get(w.StatusHost, "/api/v2/summary.json", &summary); err != nil {
+		return nil, errwrap.Wrapf("could not fetch the status: {{err}}", err)
+	}
+
+	first := w.announcements == nil
+	if first {
+		w.announcements = make(map[int64]bool)
+	}
+
+	var notices []string
+	sort.Slice(announcements, func(i, j int) bool { return announcements[i].ID < announcements[j].ID })
+	for _, a := range announcements {
+		if !w.announcements[a.ID] && !first {
+			notices = append(notices, strings.TrimSpace(fmt.Sprintf("📢 BitMex announcement: %v %v", a.Title, a.Link)))
+		}
+		w.announcements[a.ID] = true
+	}
+
+	events := make(map[string]statusEvent)
+	for _, e := range summary.Incidents {
+		events[e.ID] = e
+		if old, ok := w.events[e.ID]; !first && (!ok || old.Status != e.Status) {
+			notices = append(notices, incidentText(e))
+		}
+	}
+	for _, e := range summary.Maintenances {
+		events[e.ID] = e
+		if old, ok := w.events[e.ID]; !first && (!ok || old.Status != e.Status) {
+			notices = append(notices, maintenanceText(e))
+		}
+	}
+
+	// What left the summary is over
+	var ids []string
+	for id := range w.events {
+		if _, ok := events[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		notices = append(notices, fmt.Sprintf("✅ BitMex: %v is over", w.events[id].Name))
+	}
+	w.events = events
+
+	return notices, nil
+}
+
+func (w *StatusWatcher) get(host, path string, v interface{}) error {
+	u := url.URL{Scheme: "https", Host: host, Path: path}
+
+	resp, err := w.Client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// incidentText writes the incident: "⚠️ BitMex incident: Delayed deposits (investigating) https://stspg.io/x".
+func incidentText(e statusEvent) string {
+	return strings.TrimSpace(fmt.Sprintf("⚠️ BitMex incident: %v (%v) %v", e.Name, statusWords(e.Status), e.Shortlink))
+}
+
+// maintenanceText writes the maintenance window: "🔧 BitMex maintenance: Database upgrade, Jan 2 06:00 - 07:00 UTC (scheduled)".
+func maintenanceText(e statusEvent) string {
+	text := "🔧 BitMex maintenance: " + e.Name
+	if !e.ScheduledFor.IsZero() {
+		text += ", " + e.ScheduledFor.UTC().Format("Jan 2 15:04")
+		if !e.ScheduledUntil.IsZero() {
+			text += " - " + e.ScheduledUntil.UTC().Format("15:04")
+		}
+		text += " UTC"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v (%v) %v", text, statusWords(e.Status), e.Shortlink))
+}
+
+// statusWords turns "in_progress" into "in progress".
+func statusWords(status string) string {
+	return strings.Replace(status, "_", " ", -1)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusWatcherPoll(t *testing.T) {
+	announcements := []bitmexAnnouncement{{ID: 1, Title: "Old news"}}
+	var summary statusSummary
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/announcement":
+			json.NewEncoder(w).Encode(announcements)
+		case "/api/v2/summary.json":
+			json.NewEncoder(w).Encode(summary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	w := &StatusWatcher{Host: host, StatusHost: host, Client: server.Client()}
+
+	if notices, err := w.poll(); err != nil || len(notices) != 0 {
+		t.Fatalf("expected the first poll to only take note, got %v, %v", notices, err)
+	}
+
+	start := time.Date(2024, time.January, 2, 6, 0, 0, 0, time.UTC)
+	announcements = append(announcements, bitmexAnnouncement{ID: 2, Title: "New contracts", Link: "https://blog.bitmex.com/x"})
+	summary.Maintenances = []statusEvent{{ID: "m", Name: "Database upgrade", Status: "scheduled", ScheduledFor: start, ScheduledUntil: start.Add(time.Hour)}}
+	summary.Incidents = []statusEvent{{ID: "i", Name: "Delayed deposits", Status: "investigating"}}
+	expectNotices(t, w, []string{
+		"📢 BitMex announcement: New contracts https://blog.bitmex.com/x",
+		"⚠️ BitMex incident: Delayed deposits (investigating)",
+		"🔧 BitMex maintenance: Database upgrade, Jan 2 06:00 - 07:00 UTC (scheduled)",
+	})
+
+	summary.Maintenances[0].Status = "in_progress"
+	summary.Incidents = nil
+	expectNotices(t, w, []string{
+		"🔧 BitMex maintenance: Database upgrade, Jan 2 06:00 - 07:00 UTC (in progress)",
+		"✅ BitMex: Delayed deposits is over",
+	})
+
+	expectNotices(t, w, nil)
+}
+
+func expectNotices(t *testing.T, w *StatusWatcher, expected []string) {
+	t.Helper()
+
+	notices, err := w.poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notices) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, notices)
+	}
+	for i, notice := range notices {
+		if notice != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], notice)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+type (
+	// SymbolInfo is how people refer to a contract.
+	SymbolInfo struct {
+		Display    string `json:"display"`    // Name shown in messages, e.g. "BTC/USD"
+		Underlying string `json:"underlying"` // Asset the contract tracks, e.g. "BTC"
+		Emoji      string `json:"emoji"`      // Shown in front of the messages, e.g. "<:btc:1234>"
+	}
+
+	// SymbolMap turns exchange symbols into display names and underlying assets. Anything missing
+	// from Aliases is inferred from the symbol itself.
+	SymbolMap struct {
+		Aliases map[Symbol]SymbolInfo
+
+		// DisplayNames shows the inferred names in messages, otherwise only the aliases are used
+		DisplayNames bool
+
+		// Emoji by symbol or underlying, such as custom server emoji, falling back on fallbackEmoji.
+		// Only aliases get an emoji when nil.
+		Emoji map[string]string
+	}
+)
+
+// Quote currencies, longest first so USDT is tried before USD
+var quoteCurrencies = []string{"USDT", "USDC", "BUSD", "USD", "EUR", "JPY", "XBT", "BTC", "ETH"}
+
+// Tickers that differ from the common name of the coin
+var coinNames = map[string]string{
+	"XBT": "BTC",
+}
+
+// Unicode stand-ins for the custom emoji of the major coins
+var fallbackEmoji = map[string]string{
+	"BTC":  "\u20BF",     // ₿
+	"ETH":  "\u039E",     // Ξ
+	"LTC":  "\u0141",     // Ł
+	"SOL":  "\u25CE",     // ◎
+	"DOGE": "\U0001F415", // 🐕
+}
+
+// Futures month codes
+var monthCodes = map[byte]string{
+	'F': "Jan", 'G': "Feb", 'H': "Mar", 'J': "Apr", 'K': "May", 'M': "Jun",
+	'N': "Jul", 'Q': "Aug", 'U': "Sep", 'V': "Oct", 'X': "Nov", 'Z': "Dec",
+}
+
+// Lookup returns how to refer to the symbol.
+func (m *SymbolMap) Lookup(symbol Symbol) SymbolInfo {
+	inferred := inferSymbol(symbol)
+	if !m.DisplayNames {
+		inferred.Display = string(symbol)
+	}
+
+	alias, ok := m.Aliases[symbol]
+	if !ok {
+		alias = inferred
+	}
+	if alias.Display == "" {
+		alias.Display = inferred.Display
+	}
+	if alias.Underlying == "" {
+		alias.Underlying = inferred.Underlying
+	}
+	if alias.Emoji == "" {
+		alias.Emoji = m.emoji(symbol, alias.Underlying)
+	}
+
+	return alias
+}
+
+// emoji returns the emoji of the symbol, or else of its underlying.
+func (m *SymbolMap) emoji(symbol Symbol, underlying string) string {
+	if m.Emoji == nil {
+		return ""
+	}
+	if emoji, ok := m.Emoji[string(symbol)]; ok {
+		return emoji
+	}
+	if emoji, ok := m.Emoji[underlying]; ok {
+		return emoji
+	}
+	return fallbackEmoji[underlying]
+}
+
+// inferSymbol guesses the underlying and a display name from the usual ways exchanges name
+// contracts: XBTUSD, ETHUSDT, 1000PEPEUSDT, XBTU24.
+func inferSymbol(symbol Symbol) SymbolInfo {
+	rest := string(symbol)
+
+	// Contract multiplier, as in 1000PEPEUSDT
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	multiplier, rest := rest[:digits], rest[digits:]
+
+	var base, quote, expiry string
+
+	// Quarterly futures end with a month code and a two digit year, as in XBTU24
+	if n := len(rest); n > 3 {
+		month, isMonth := monthCodes[rest[n-3]]
+		if _, err := strconv.Atoi(rest[n-2:]); isMonth && err == nil {
+			base, expiry = rest[:n-3], month+" "+rest[n-2:]
+		}
+	}
+
+	if base == "" {
+		base = rest
+		for _, q := range quoteCurrencies {
+			if strings.HasSuffix(rest, q) && len(rest) > len(q) {
+				base, quote = strings.TrimSuffix(rest, q), q
+				break
+			}
+		}
+	}
+
+	underlying := base
+	if name, ok := coinNames[base]; ok {
+		underlying = name
+	}
+
+	display := multiplier + underlying
+	switch {
+	case expiry != "":
+		display += " " + expiry
+	case quote != "":
+		display += "/" + quote
+	}
+
+	return SymbolInfo{Display: display, Underlying: underlying}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestInferSymbol(t *testing.T) {
+	tests := map[Symbol]SymbolInfo{
+		"XBTUSD":       {Display: "BTC/USD", Underlying: "BTC"},
+		"XBTU24":       {Display: "BTC Sep 24", Underlying: "BTC"},
+		"XBTZ16":       {Display: "BTC Dec 16", Underlying: "BTC"},
+		"ETHUSDT":      {Display: "ETH/USDT", Underlying: "ETH"},
+		"1000PEPEUSDT": {Display: "1000PEPE/USDT", Underlying: "PEPE"},
+		"SOLUSDC":      {Display: "SOL/USDC", Underlying: "SOL"},
+	}
+
+	for symbol, expected := range tests {
+		if info := inferSymbol(symbol); info != expected {
+			t.Errorf("%v: expected %+v, got %+v", symbol, expected, info)
+		}
+	}
+}
+
+func TestSymbolMapAliases(t *testing.T) {
+	m := &SymbolMap{Aliases: map[Symbol]SymbolInfo{"XBTUSD": {Display: "BTC perp"}}}
+
+	if info := m.Lookup("XBTUSD"); info != (SymbolInfo{Display: "BTC perp", Underlying: "BTC"}) {
+		t.Error("unexpected alias:", info)
+	}
+
+	// Without display names, only aliases change what's shown
+	if info := m.Lookup("ETHUSDT"); info != (SymbolInfo{Display: "ETHUSDT", Underlying: "ETH"}) {
+		t.Error("unexpected lookup:", info)
+	}
+}
+
+func TestSymbolMapEmoji(t *testing.T) {
+	m := &SymbolMap{
+		Aliases: map[Symbol]SymbolInfo{"XBTUSD": {Emoji: "<:perp:1>"}},
+		Emoji:   map[string]string{"BTC": "<:btc:2>", "ETHUSDT": "<:eth:3>"},
+	}
+
+	tests := map[Symbol]string{
+		"XBTUSD":  "<:perp:1>", // From the alias
+		"XBTU24":  "<:btc:2>",  // From the underlying
+		"ETHUSDT": "<:eth:3>",  // From the symbol
+		"SOLUSDT": "◎",         // Fallback
+		"PEPEUSD": "",
+	}
+	for symbol, expected := range tests {
+		if emoji := m.Lookup(symbol).Emoji; emoji != expected {
+			t.Errorf("%v: expected %q, got %q", symbol, expected, emoji)
+		}
+	}
+
+	l := Liquidation{Symbol: "XBTU24", Emoji: "<:btc:2>", Side: "Sell", Quantity: 100, Price: 9000}
+	if text := l.String(); text != "<:btc:2> Liquidated long on XBTU24: Sell 100 @ 9000" {
+		t.Errorf("unexpected message %q", text)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+type (
+	// Target is one channel the bot posts to, with its own filters and pacing, so a single process
+	// can serve several servers.
+	Target struct {
+		Name    string       `json:"name"` // Used in the logs and metrics, the channel when empty
+		Channel string       `json:"channel"`
+		Format  NumberFormat `json:"format"`
+
+		Filter                     // Which liquidations to post about: min_usd, symbols and sides
+		SymbolCooldown    Duration `json:"symbol_cooldown"`    // Same as the top level setting, for this target
+		AggregateInterval Duration `json:"aggregate_interval"` // Same as the top level setting, for this target
+
+		Forum ForumMode `json:"forum"` // Channel is a forum: "day" for a post a day, "cascade" for a post per burst
+	}
+
+	// TargetSink applies a target's filters and pacing in front of its sink. Announcements go
+	// through unless the target is paused.
+	TargetSink struct {
+		Sink
+
+		Channel   string
+		Cooldown  *Cooldown
+		Aggregate *Aggregator
+		Prices    *PriceCache  // What the coin thresholds of the filter are converted with
+		Format    NumberFormat // Of the amounts of the bars and the catch-up after a pause
+
+		mu     sync.Mutex
+		filter Filter       // Can be changed at runtime through /rekt
+		pause  *targetPause // Set while paused through /rekt pause
+	}
+)
+
+// NewTargetSink returns the sink for the target, starting its summary bars if it has any.
+func NewTargetSink(target Target, sink Sink) *TargetSink {
+	t := &TargetSink{Sink: sink, Channel: target.Channel, Format: target.Format, filter: target.Filter}
+
+	if target.SymbolCooldown.Duration > 0 {
+		t.Cooldown = NewCooldown(target.SymbolCooldown.Duration)
+	}
+	if target.AggregateInterval.Duration > 0 {
+		t.Aggregate = &Aggregator{Interval: target.AggregateInterval.Duration, Format: target.Format}
+		go t.Aggregate.Run(t.announce)
+	}
+
+	return t
+}
+
+// Publish implements Sink. The historical liquidations are left out before the bars, cooldowns
+// and pauses, only the Discord sinks being behind the targets.
+func (t *TargetSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	l := dl.Liquidation
+	if l.Historical {
+		return nil
+	}
+	if !t.Filter().Match(l, t.Prices) || t.hold(dl) {
+		return nil
+	}
+
+	if t.Aggregate != nil {
+		t.Aggregate.Add(dl)
+		return nil
+	}
+
+	if t.Cooldown != nil && !t.Cooldown.Allow(l, t.rollUp) {
+		return nil
+	}
+
+	return t.Sink.Publish(ctx, dl)
+}
+
+// Amend implements Amender.
+func (t *TargetSink) Amend(ctx context.Context, l Liquidation) error {
+	return amend(ctx, t.Sink, l)
+}
+
+// Announce implements Sink, holding the announcement back while paused.
+func (t *TargetSink) Announce(ctx context.Context, text string) error {
+	if t.holdAnnouncement() {
+		return nil
+	}
+	return t.Sink.Announce(ctx, text)
+}
+
+// Post implements Poster, leaving out the posts about symbols the filter doesn't cover and
+// holding the others back while paused.
+func (t *TargetSink) Post(ctx context.Context, post Post) error {
+	if post.Symbol != "" && !t.Filter().Covers(post.Symbol) {
+		return nil
+	}
+	if t.holdAnnouncement() {
+		return nil
+	}
+	return sendPost(ctx, t.Sink, post)
+}
+
+// Filter returns the filter currently applied.
+func (t *TargetSink) Filter() Filter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.filter
+}
+
+// SetFilter replaces the filter.
+func (t *TargetSink) SetFilter(f Filter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.filter = f
+}
+
+// Stop ends the summary bars and the pause of a target that is no longer delivered to.
+func (t *TargetSink) Stop() {
+	if t.Aggregate != nil {
+		t.Aggregate.Stop()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pause != nil && t.pause.timer != nil {
+		t.pause.timer.Stop()
+	}
+	t.pause = nil
+}
+
+// takeOver carries over the state of the sink previously built for the channel: its pause, its
+// cooldown when the period is the same and, when how it posts is the same, its sink along with
+// the breaker and the messages that can still be amended.
+func (t *TargetSink) takeOver(prev *TargetSink) {
+	if t.Cooldown != nil && prev.Cooldown != nil && t.Cooldown.Period == prev.Cooldown.Period {
+		t.Cooldown = prev.Cooldown
+	}
+	t.takePause(prev)
+	prev.Stop()
+}
+
+func (t *TargetSink) rollUp(symbol Symbol, held []Liquidation) {
+	t.announce(rollUpText(symbol, held))
+}
+
+func (t *TargetSink) announce(text string) {
+	if err := announceLater(t.Sink, text); err != nil && err != errBreakerOpen {
+		log.Printf("Failed to send message %q: %v\n", text, err)
+	}
+}
+
+// legacyTarget is the single target described by the top level settings, for configs without targets.
+func legacyTarget(cfg BotConfig) Target {
+	return Target{
+		Name:              "discord",
+		Channel:           cfg.DiscordChannel,
+		Format:            cfg.DiscordFormat,
+		SymbolCooldown:    cfg.SymbolCooldown,
+		AggregateInterval: cfg.AggregateInterval,
+	}
+}
+
+// configTargets returns the configured targets, or the legacy one. In hosted mode the tenants
+// may bring all of them.
+func configTargets(cfg BotConfig) []Target {
+	if len(cfg.Targets) == 0 && cfg.Hosted && cfg.DiscordChannel == "" {
+		return nil
+	}
+	if len(cfg.Targets) == 0 {
+		return []Target{legacyTarget(cfg)}
+	}
+	return cfg.Targets
+}
+
+// targetSinks builds the sink of every configured target.
+func targetSinks(cfg BotConfig, newSink func(target Target) Sink) []*TargetSink {
+	targets := configTargets(cfg)
+
+	sinks := make([]*TargetSink, len(targets))
+	for i, target := range targets {
+		sinks[i] = targetSink(cfg, target, newSink)
+	}
+
+	return sinks
+}
+
+// targetSink builds the sink of a target, behind its breaker.
+func targetSink(cfg BotConfig, target Target, newSink func(target Target) Sink) *TargetSink {
+	name := target.Name
+	if name == "" {
+		name = target.Channel
+	}
+
+	breaker := newBreaker(cfg, name, newSink(target))
+	breaker.Format = target.Format
+	return NewTargetSink(target, breaker)
+}
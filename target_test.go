@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTargetSinks(t *testing.T) {
+	cfg := BotConfig{
+		BreakerFailures: 5,
+		Targets: []Target{
+			{Channel: "everything"},
+			{Channel: "btc whales", Filter: Filter{Symbols: []Symbol{"XBTUSD"}, MinUSD: 100000}},
+		},
+	}
+
+	recorders := make(map[string]*recordingSink)
+	targets := targetSinks(cfg, func(target Target) Sink {
+		recorders[target.Channel] = &recordingSink{}
+		return recorders[target.Channel]
+	})
+
+	for _, l := range []Liquidation{
+		{Symbol: "XBTUSD", Quantity: 500000, USD: 500000},
+		{Symbol: "XBTUSD", Quantity: 5000, USD: 5000},
+		{Symbol: "ETHUSD", Quantity: 500000, USD: 500000},
+	} {
+		for _, sink := range targets {
+			if err := sink.Publish(context.Background(), DecoratedLiquidation{Liquidation: l}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, sink := range targets {
+		if err := sink.Announce(context.Background(), "Hello"); err != nil {
+			t.Fatal(err)
+		}
+		for _, symbol := range []Symbol{"XBTUSD", "ETHUSD"} {
+			if err := sink.Post(context.Background(), Post{Symbol: symbol}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if n := len(recorders["everything"].published); n != 3 {
+		t.Errorf("expected the unfiltered target to get 3 liquidations, got %v", n)
+	}
+	if n := len(recorders["btc whales"].published); n != 1 {
+		t.Errorf("expected the filtered target to get 1 liquidation, got %v", n)
+	}
+	if n := len(recorders["btc whales"].announced); n != 1 {
+		t.Errorf("expected announcements to go to every target, got %v", n)
+	}
+	if n := len(recorders["btc whales"].posted); n != 1 {
+		t.Errorf("expected the filtered target to get the post about its symbol only, got %v", n)
+	}
+}
+
+func TestSettingsApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.SetFilter("whales", Filter{MinUSD: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.SetPause("whales", SavedPause{Since: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.SetPause("everything", SavedPause{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reloaded on the next start
+	settings, err = LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := targetSinks(BotConfig{Targets: []Target{{Channel: "whales"}, {Channel: "everything"}}}, func(Target) Sink {
+		return &recordingSink{}
+	})
+	settings.Apply(targets)
+
+	if f := targets[0].Filter(); f.MinUSD != 1000000 {
+		t.Errorf("expected the stored filter to apply, got %+v", f)
+	}
+	if f := targets[1].Filter(); f.MinUSD != 0 {
+		t.Errorf("expected the other target to keep its filter, got %+v", f)
+	}
+	if until, paused := targets[0].Paused(); !paused || !until.IsZero() {
+		t.Errorf("expected the stored pause to apply, got %v %v", until, paused)
+	}
+	if _, paused := targets[1].Paused(); paused {
+		t.Error("expected the pause that ran out to be forgotten")
+	}
+}
+
+func TestReloaderLoad(t *testing.T) {
+	pipeline := &Pipeline{}
+	built := 0
+	r := &Reloader{
+		Pipeline: pipeline,
+		Static:   []Sink{&recordingSink{}},
+		NewSink: func(cfg BotConfig, target Target) Sink {
+			built++
+			return &recordingSink{}
+		},
+	}
+
+	if added, removed := r.Load(BotConfig{Targets: []Target{{Channel: "a"}, {Channel: "b"}}}); added != 2 || removed != 0 {
+		t.Errorf("expected 2 targets built, got %v added and %v removed", added, removed)
+	}
+	kept := r.Targets()[0]
+
+	// a is unchanged, b goes and c comes
+	added, removed := r.Load(BotConfig{Targets: []Target{{Channel: "a"}, {Channel: "c", Filter: Filter{MinUSD: 1000}}}})
+	if added != 1 || removed != 1 || built != 3 {
+		t.Errorf("expected only c to be built and b removed, got %v added, %v removed, %v built", added, removed, built)
+	}
+	if r.Targets()[0] != kept {
+		t.Error("expected the unchanged target to be kept")
+	}
+	if n := len(pipeline.sinks()); n != 3 {
+		t.Errorf("expected the pipeline to deliver to the 2 targets and the static sink, got %v sinks", n)
+	}
+}
+
+func TestTargetPause(t *testing.T) {
+	inner := &recordingSink{}
+	target := NewTargetSink(Target{Channel: "everything"}, inner)
+
+	target.Pause(0)
+	for _, side := range []string{"Sell", "Sell", "Buy"} {
+		target.Publish(context.Background(), DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: side, Quantity: 1000000, USD: 1000000}})
+	}
+	target.Announce(context.Background(), "Recap")
+	if len(inner.published) != 0 || len(inner.announced) != 0 {
+		t.Fatalf("expected nothing posted while paused, got %v and %q", inner.published, inner.announced)
+	}
+
+	if !target.Resume() {
+		t.Fatal("expected the target to be paused")
+	}
+	if len(inner.announced) != 1 || inner.announced[0] != "Back! Last 1 min: $2.0M longs / $1.0M shorts rekt across 3 orders, 1 announcement was held back" {
+		t.Errorf("expected the catch-up summary, got %q", inner.announced)
+	}
+	if target.Resume() {
+		t.Error("expected resuming twice to do nothing")
+	}
+
+	target.Publish(context.Background(), DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Sell", Quantity: 1000000}})
+	if len(inner.published) != 1 {
+		t.Errorf("expected the liquidations to be posted again, got %v", inner.published)
+	}
+
+	// A timed pause ends by itself
+	announced := make(chan string, 1)
+	timed := NewTargetSink(Target{Channel: "everything"}, announceFunc(func(text string) { announced <- text }))
+	timed.Pause(10 * time.Millisecond)
+	select {
+	case text := <-announced:
+		if _, paused := timed.Paused(); paused || !strings.HasPrefix(text, "Back!") {
+			t.Errorf("expected the pause to run out, got %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the pause to run out")
+	}
+}
+
+func TestTargetCooldown(t *testing.T) {
+	inner := &recordingSink{}
+	target := NewTargetSink(Target{Channel: "everything", SymbolCooldown: Duration{Duration: 50 * time.Millisecond}}, inner)
+	defer target.Stop()
+
+	for _, l := range []Liquidation{
+		{Price: 9000, Quantity: 10000, Symbol: "XBTUSD", Side: "Sell"},
+		{Price: 8990, Quantity: 20000, Symbol: "XBTUSD", Side: "Sell"},
+		{Price: 9150, Quantity: 50000, Symbol: "XBTZ16", Side: "Sell"},
+		{Price: 8980, Quantity: 30000, Symbol: "XBTUSD", Side: "Buy"},
+	} {
+		target.Publish(context.Background(), DecoratedLiquidation{Liquidation: l})
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if len(inner.published) != 2 {
+		t.Fatal("expected the first liquidation of each symbol to be posted, got", inner.published)
+	}
+
+	expected := "2 more liquidations on XBTUSD: 50,000 contracts (1 longs 20,000 / 1 shorts 30,000)"
+	if len(inner.announced) != 1 || inner.announced[0] != expected {
+		t.Errorf("expected %q, got %q", expected, inner.announced)
+	}
+}
+
+func TestTargetHistorical(t *testing.T) {
+	inner := &recordingSink{}
+	target := NewTargetSink(Target{Channel: "everything", AggregateInterval: Duration{Duration: time.Hour}, SymbolCooldown: Duration{Duration: time.Hour}}, inner)
+	defer target.Stop()
+
+	old := DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Sell", Quantity: 1000000, USD: 1000000, Historical: true}}
+	target.Publish(context.Background(), old)
+	if text := target.Aggregate.flush(); text != "" {
+		t.Errorf("expected the historical liquidation to be left out of the bar, got %q", text)
+	}
+
+	target.Pause(0)
+	target.Publish(context.Background(), old)
+	target.Resume()
+	if len(inner.published) != 0 || len(inner.announced) != 1 || inner.announced[0] != "Back! Nothing got liquidated in the last 1 min" {
+		t.Errorf("expected the historical liquidation to be left out of the catch-up, got %v and %q", inner.published, inner.announced)
+	}
+}
+
+// announceFunc is a sink passing the announcements to a function.
+type announceFunc func(text string)
+
+func (f announceFunc) Publish(context.Context, DecoratedLiquidation) error { return nil }
+
+func (f announceFunc) Announce(ctx context.Context, text string) error {
+	f(text)
+	return nil
+}
+
+func TestReloaderRebuild(t *testing.T) {
+	built := 0
+	r := &Reloader{
+		Pipeline: &Pipeline{},
+		NewSink: func(cfg BotConfig, target Target) Sink {
+			built++
+			return &recordingSink{}
+		},
+	}
+
+	minute := Duration{Duration: time.Minute}
+	r.Load(BotConfig{Targets: []Target{{Channel: "a", SymbolCooldown: minute, AggregateInterval: minute}, {Channel: "b", AggregateInterval: minute}}})
+	a, b := r.Targets()[0], r.Targets()[1]
+	a.Pause(time.Hour)
+
+	// a changes its filter, b goes
+	r.Load(BotConfig{Targets: []Target{{Channel: "a", SymbolCooldown: minute, AggregateInterval: minute, Filter: Filter{MinUSD: 1000}}}})
+	rebuilt := r.Targets()[0]
+	if rebuilt == a || built != 2 || rebuilt.Sink != a.Sink {
+		t.Errorf("expected a to be rebuilt over the same sink, got %v sinks built", built)
+	}
+	if rebuilt.Cooldown != a.Cooldown {
+		t.Error("expected the cooldown to be kept")
+	}
+	if until, paused := rebuilt.Paused(); !paused || time.Until(until) < 59*time.Minute {
+		t.Errorf("expected the pause to be kept, got %v %v", until, paused)
+	}
+
+	for name, target := range map[string]*TargetSink{"the previous a": a, "b": b} {
+		select {
+		case <-target.Aggregate.stopped():
+		default:
+			t.Errorf("expected the bars of %v to be stopped", name)
+		}
+	}
+
+	// A new format needs a new sink
+	r.Load(BotConfig{Targets: []Target{{Channel: "a", Format: NumberFormat{Abbreviate: true}}}})
+	if built != 3 {
+		t.Errorf("expected the sink of a to be rebuilt, got %v sinks built", built)
+	}
+	if _, paused := r.Targets()[0].Paused(); !paused {
+		t.Error("expected the pause to be kept")
+	}
+
+	// So does a new setting of the sinks, for the unchanged targets too
+	r.Load(BotConfig{LatencyFooter: true, Targets: []Target{{Channel: "a", Format: NumberFormat{Abbreviate: true}}}})
+	if built != 4 {
+		t.Errorf("expected the sink of a to be rebuilt, got %v sinks built", built)
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Tenant is a guild served in hosted mode, with the channels it posts to.
+	Tenant struct {
+		Guild     string    `json:"guild"`
+		Name      string    `json:"name"`
+		Installer string    `json:"installer"` // User who added the bot, when the invite told
+		Joined    time.Time `json:"joined"`
+		Targets   []Target  `json:"targets"` // Edited here for the settings /rekt set doesn't cover
+
+		Setup *TenantSetup `json:"setup,omitempty"` // Choices made in the setup wizard, until it is done
+	}
+
+	// TenantSetup is what was picked so far in the setup wizard.
+	TenantSetup struct {
+		User    string   `json:"user"` // Who was DMed the wizard, empty when it was posted in the guild
+		Channel string   `json:"channel"`
+		MinUSD  float64  `json:"min_usd"`
+		Symbols []Symbol `json:"symbols"` // All of them when empty
+	}
+
+	// Tenants are the guilds of hosted mode, each adding and removing its own channels through
+	// /tenant. They are kept in their own file, apart from config.json, and every change rebuilds
+	// the targets through the function of SetOnChange.
+	Tenants struct {
+		Path        string
+		Defaults    Target // Settings of the channels the tenants add
+		MaxChannels int    // Channels each tenant may post to, 0 for no limit
+
+		// MessagesPerHour is the budget of each tenant, 0 for no limit.
+		MessagesPerHour int
+
+		// Settings are cleared of what the guilds that leave changed at runtime, when set.
+		Settings *Settings
+
+		mu       sync.Mutex
+		guilds   map[string]*Tenant
+		budgets  map[string]*Budget // By guild, kept across the rebuilds of the targets
+		onChange func()
+	}
+)
+
+// LoadTenants loads the tenants at path, starting with none when it doesn't exist yet.
+func LoadTenants(path string) (*Tenants, error) {
+	t := &Tenants{Path: path, guilds: make(map[string]*Tenant), budgets: make(map[string]*Budget)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var tenants []*Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, err
+	}
+	for _, tenant := range tenants {
+		for _, target := range tenant.Targets {
+			if err := checkForum(target.Forum); err != nil {
+				return nil, errwrap.Wrapf("invalid target "+target.Channel+" of tenant "+tenant.Guild+": {{err}}", err)
+			}
+		}
+		t.guilds[tenant.Guild] = tenant
+	}
+
+	return t, nil
+}
+
+// SetOnChange sets the function called after every change, outside the lock.
+func (t *Tenants) SetOnChange(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onChange = f
+}
+
+// Join adds the guild, or fills in what was missing about it. The installer is kept once known.
+func (t *Tenants) Join(guild, name, installer string) error {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	if !ok {
+		tenant = &Tenant{Guild: guild, Joined: time.Now().UTC()}
+		t.guilds[guild] = tenant
+		log.Printf("Tenant %v (%v) joined\n", name, guild)
+	}
+	changed := !ok
+	if name != "" && tenant.Name != name {
+		tenant.Name, changed = name, true
+	}
+	if installer != "" && tenant.Installer == "" {
+		tenant.Installer, changed = installer, true
+	}
+	return t.commit(changed)
+}
+
+// Leave removes the guild along with its channels and their settings.
+func (t *Tenants) Leave(guild string) error {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	var channels []string
+	if ok {
+		log.Printf("Tenant %v left\n", guild)
+		delete(t.guilds, guild)
+		delete(t.budgets, guild)
+		for _, target := range tenant.Targets {
+			channels = append(channels, target.Channel)
+		}
+	}
+	settings := t.Settings
+	if err := t.commit(ok); err != nil {
+		return err
+	}
+
+	if ok && settings != nil {
+		return settings.Forget(guild, channels)
+	}
+	return nil
+}
+
+// Tenant returns a copy of the guild's tenant.
+func (t *Tenants) Tenant(guild string) (Tenant, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tenant, ok := t.guilds[guild]
+	if !ok {
+		return Tenant{}, false
+	}
+	copied := *tenant
+	copied.Targets = append([]Target(nil), tenant.Targets...)
+	if tenant.Setup != nil {
+		setup := *tenant.Setup
+		copied.Setup = &setup
+	}
+	return copied, true
+}
+
+// AddChannel posts to the channel of the guild with the default settings, only the liquidations
+// of the sides and symbols given when there are any, so that a guild can have its #longs-rekt
+// and #shorts-rekt.
+func (t *Tenants) AddChannel(guild, channel string, sides []string, symbols []Symbol) error {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	if !ok {
+		t.mu.Unlock()
+		return fmt.Errorf("this server isn't a tenant")
+	}
+	target, err := t.add(tenant, channel)
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	if len(sides) > 0 {
+		target.Sides = sides
+	}
+	if len(symbols) > 0 {
+		target.Symbols = symbols
+	}
+	return t.commit(true)
+}
+
+// add adds the channel to the tenant with the default settings, unless it has it or is full.
+func (t *Tenants) add(tenant *Tenant, channel string) (*Target, error) {
+	for _, target := range tenant.Targets {
+		if target.Channel == channel {
+			return nil, fmt.Errorf("the bot already posts in this channel")
+		}
+	}
+	if t.MaxChannels > 0 && len(tenant.Targets) >= t.MaxChannels {
+		return nil, fmt.Errorf("this server already has the %v channels it may have, remove one first", t.MaxChannels)
+	}
+
+	target := t.Defaults
+	target.Name, target.Channel = tenant.Guild+"/"+channel, channel
+	tenant.Targets = append(tenant.Targets, target)
+	return &tenant.Targets[len(tenant.Targets)-1], nil
+}
+
+// StartSetup opens the setup wizard of the guild, DMed to user when set. Guilds that already
+// have one or post somewhere are left alone.
+func (t *Tenants) StartSetup(guild, user string) (setup TenantSetup, started bool, err error) {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	if !ok || tenant.Setup != nil || len(tenant.Targets) > 0 {
+		t.mu.Unlock()
+		return setup, false, nil
+	}
+
+	tenant.Setup = &TenantSetup{User: user, MinUSD: t.Defaults.MinUSD, Symbols: t.Defaults.Symbols}
+	setup = *tenant.Setup
+	return setup, true, t.commitSetup()
+}
+
+// Setup returns what was picked so far in the setup wizard of the guild.
+func (t *Tenants) Setup(guild string) (TenantSetup, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tenant, ok := t.guilds[guild]
+	if !ok || tenant.Setup == nil {
+		return TenantSetup{}, false
+	}
+	return *tenant.Setup, true
+}
+
+// ChangeSetup changes a choice of the setup wizard of the guild.
+func (t *Tenants) ChangeSetup(guild string, change func(setup *TenantSetup)) (TenantSetup, error) {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	if !ok || tenant.Setup == nil {
+		t.mu.Unlock()
+		return TenantSetup{}, fmt.Errorf("this setup is over, run /tenant add in the channel to post to")
+	}
+
+	change(tenant.Setup)
+	setup := *tenant.Setup
+	return setup, t.commitSetup()
+}
+
+// FinishSetup adds the channel picked in the setup wizard with the filters picked, and closes it.
+func (t *Tenants) FinishSetup(guild string) (Target, error) {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	if !ok || tenant.Setup == nil {
+		t.mu.Unlock()
+		return Target{}, fmt.Errorf("this setup is over, run /tenant add in the channel to post to")
+	}
+	if tenant.Setup.Channel == "" {
+		t.mu.Unlock()
+		return Target{}, fmt.Errorf("pick the channel to post to first")
+	}
+
+	target, err := t.add(tenant, tenant.Setup.Channel)
+	if err != nil {
+		t.mu.Unlock()
+		return Target{}, err
+	}
+	target.MinUSD, target.Symbols = tenant.Setup.MinUSD, tenant.Setup.Symbols
+	tenant.Setup = nil
+	added := *target
+	return added, t.commit(true)
+}
+
+// RemoveChannel stops posting to the channel of the guild.
+func (t *Tenants) RemoveChannel(guild, channel string) error {
+	t.mu.Lock()
+	tenant, ok := t.guilds[guild]
+	if !ok {
+		t.mu.Unlock()
+		return fmt.Errorf("this server isn't a tenant")
+	}
+	for i, target := range tenant.Targets {
+		if target.Channel == channel {
+			tenant.Targets = append(tenant.Targets[:i:i], tenant.Targets[i+1:]...)
+			return t.commit(true)
+		}
+	}
+	t.mu.Unlock()
+	return fmt.Errorf("the bot doesn't post in this channel")
+}
+
+// Budget returns the budget of the guild, nil when there is no limit.
+func (t *Tenants) Budget(guild string) *Budget {
+	if t.MessagesPerHour <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	budget, ok := t.budgets[guild]
+	if !ok {
+		budget = &Budget{PerHour: t.MessagesPerHour}
+		t.budgets[guild] = budget
+	}
+	return budget
+}
+
+// Budgeted puts the sink of the channel behind the budget of its tenant, if it is one's.
+func (t *Tenants) Budgeted(channel string, sink Sink) Sink {
+	for _, tenant := range t.List() {
+		for _, target := range tenant.Targets {
+			if target.Channel == channel {
+				if budget := t.Budget(tenant.Guild); budget != nil {
+					return &BudgetSink{Sink: sink, Budget: budget}
+				}
+				return sink
+			}
+		}
+	}
+	return sink
+}
+
+// Targets returns the channels of every tenant.
+func (t *Tenants) Targets() []Target {
+	var targets []Target
+	for _, tenant := range t.List() {
+		targets = append(targets, tenant.Targets...)
+	}
+	return targets
+}
+
+// List returns the tenants in the order they joined.
+func (t *Tenants) List() []Tenant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.list()
+}
+
+func (t *Tenants) list() []Tenant {
+	tenants := make([]Tenant, 0, len(t.guilds))
+	for _, tenant := range t.guilds {
+		tenants = append(tenants, *tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		if !tenants[i].Joined.Equal(tenants[j].Joined) {
+			return tenants[i].Joined.Before(tenants[j].Joined)
+		}
+		return tenants[i].Guild < tenants[j].Guild
+	})
+	return tenants
+}
+
+// commit saves the tenants when they changed and unlocks, then tells the change.
+func (t *Tenants) commit(changed bool) error {
+	if !changed {
+		t.mu.Unlock()
+		return nil
+	}
+
+	err := t.save()
+	count, onChange := len(t.guilds), t.onChange
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	metrics.Gauge("rekt_tenants").Set(float64(count))
+	if onChange != nil {
+		onChange()
+	}
+	return nil
+}
+
+// commitSetup saves the choices of a setup wizard and unlocks, without telling the change: the
+// targets only change once the setup is done.
+func (t *Tenants) commitSetup() error {
+	defer t.mu.Unlock()
+
+	return t.save()
+}
+
+func (t *Tenants) save() error {
+	data, err := json.MarshalIndent(t.list(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(t.Path, true, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// HandleGuildCreate adds the guilds the bot is added to, and those it was in already.
+func (t *Tenants) HandleGuildCreate(s *discordgo.Session, e *discordgo.GuildCreate) {
+	if err := t.Join(e.ID, e.Name, ""); err != nil {
+		log.Println("Failed to save the tenants:", err)
+	}
+}
+
+// HandleGuildDelete removes the guilds the bot is kicked from, not those merely unavailable.
+func (t *Tenants) HandleGuildDelete(s *discordgo.Session, e *discordgo.GuildDelete) {
+	if e.Unavailable {
+		return
+	}
+	if err := t.Leave(e.ID); err != nil {
+		log.Println("Failed to save the tenants:", err)
+	}
+}
+
+// tenantCommand is /tenant, with which the admins of a guild pick the channels it posts to. It
+// only ever touches the guild it is run in.
+func tenantCommand(tenants *Tenants, settings *Settings) *SlashCommand {
+	sides := []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "longs", Value: "long"},
+		{Name: "shorts", Value: "short"},
+		{Name: "both", Value: "both"},
+	}
+
+	return &SlashCommand{
+		Permission: PermissionAdmin,
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "tenant",
+			Description: "The channels of this server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "show", Description: "Show the channels the bot posts to in this server"},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "add", Description: "Post the liquidations in this channel", Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "side", Description: "Only the liquidated longs or shorts, both by default", Choices: sides},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "symbols", Description: "Only these contracts, comma separated, all of them by default"},
+				}},
+				{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "remove", Description: "Stop posting in this channel"},
+			},
+		},
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			guild, channel := req.Interaction.GuildID, req.Interaction.ChannelID
+			if guild == "" {
+				return nil, fmt.Errorf("tenants are servers, run it in one")
+			}
+
+			switch req.Subcommand {
+			case "add":
+				// The guild may have been added while the bot was offline
+				if err := tenants.Join(guild, "", ""); err != nil {
+					return nil, err
+				}
+				var sides []string
+				if side := req.String("side", "both"); side != "both" {
+					sides = []string{side}
+				}
+				var symbols []Symbol
+				for _, symbol := range splitList(req.String("symbols", "")) {
+					symbols = append(symbols, Symbol(strings.ToUpper(symbol)))
+				}
+				if err := tenants.AddChannel(guild, channel, sides, symbols); err != nil {
+					return nil, err
+				}
+				return &discordgo.InteractionResponseData{Content: "Posting the " + routeText(sides, symbols) + " here from now on, change what with /rekt set"}, nil
+			case "remove":
+				if err := tenants.RemoveChannel(guild, channel); err != nil {
+					return nil, err
+				}
+				// Added again, the channel starts over from the defaults
+				if err := settings.ClearFilter(channel); err != nil {
+					return nil, err
+				}
+				return &discordgo.InteractionResponseData{Content: "No longer posting here"}, nil
+			}
+
+			tenant, _ := tenants.Tenant(guild)
+			text := tenantText(tenant, tenants.MaxChannels)
+			if budget := tenants.Budget(guild); budget != nil {
+				text += "\n" + budgetText(budget, time.Now(), tenants.Defaults.Format)
+			}
+			return &discordgo.InteractionResponseData{Content: text}, nil
+		},
+	}
+}
+
+// routeText describes the liquidations a channel gets: "liquidated longs of XBTUSD, ETHUSD".
+func routeText(sides []string, symbols []Symbol) string {
+	text := "liquidations"
+	if len(sides) == 1 {
+		text = "liquidated " + sides[0] + "s"
+	}
+	if len(symbols) > 0 {
+		names := make([]string, len(symbols))
+		for i, symbol := range symbols {
+			names[i] = string(symbol)
+		}
+		text += " of " + strings.Join(names, ", ")
+	}
+	return text
+}
+
+// tenantText lists the channels of the tenant.
+func tenantText(tenant Tenant, max int) string {
+	if len(tenant.Targets) == 0 {
+		return "The bot doesn't post in this server yet, run /tenant add in the channel to post to"
+	}
+
+	channels := make([]string, len(tenant.Targets))
+	for i, target := range tenant.Targets {
+		channels[i] = "<#" + target.Channel + ">"
+	}
+	text := "Posting in " + strings.Join(channels, ", ")
+	if max > 0 {
+		text += fmt.Sprintf(" (%v of %v channels)", len(channels), max)
+	}
+	return text
+}
+
+// budgetText describes how much of the budget is spent and the threshold it raised.
+func budgetText(budget *Budget, now time.Time, f NumberFormat) string {
+	sent, floor := budget.Usage(now)
+	text := fmt.Sprintf("%v of the %v messages of the hour sent", sent, budget.PerHour)
+	switch {
+	case sent >= budget.PerHour:
+		text += fmt.Sprintf(", resuming at <t:%v:t>", budget.Resumes(now).Unix())
+	case floor > 0:
+		text += ", only posting the liquidations over " + f.Short(int64(floor)) + " meanwhile"
+	}
+	return text
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	tenants, err := LoadTenants(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants.Defaults = Target{Filter: Filter{MinUSD: 100000}}
+	tenants.MaxChannels = 2
+
+	changes := 0
+	tenants.SetOnChange(func() { changes++ })
+
+	if err := tenants.AddChannel("g1", "c1", nil, nil); err == nil {
+		t.Error("expected an unknown guild to be refused")
+	}
+	if err := tenants.Join("g1", "First", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.Join("g1", "First", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.Join("g1", "First", "u2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.Join("g2", "Second", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, channel := range []string{"c1", "c2"} {
+		if err := tenants.AddChannel("g1", channel, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tenants.AddChannel("g1", "c3", nil, nil); err == nil {
+		t.Error("expected the channels past the limit to be refused")
+	}
+	if err := tenants.AddChannel("g1", "c1", nil, nil); err == nil {
+		t.Error("expected a channel to be added only once")
+	}
+	if err := tenants.AddChannel("g2", "c4", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.RemoveChannel("g2", "c1"); err == nil {
+		t.Error("expected a guild not to remove the channels of another")
+	}
+	if changes != 6 {
+		t.Errorf("expected 6 changes, got %v", changes)
+	}
+
+	// The tenants and their channels survive a restart
+	loaded, err := LoadTenants(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant, ok := loaded.Tenant("g1")
+	if !ok || tenant.Name != "First" || tenant.Installer != "u1" || len(tenant.Targets) != 2 {
+		t.Fatalf("expected g1 with its installer and 2 channels, got %+v", tenant)
+	}
+	if target := tenant.Targets[0]; target.Channel != "c1" || target.Name != "g1/c1" || target.MinUSD != 100000 {
+		t.Errorf("expected the channel with the default settings, got %+v", target)
+	}
+	if targets := loaded.Targets(); len(targets) != 3 || targets[2].Channel != "c4" {
+		t.Errorf("expected the channels of both tenants, got %+v", targets)
+	}
+
+	settings, err := LoadSettings(filepath.Join(t.TempDir(), "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.SetFilter("c1", Filter{MinUSD: 1000000})
+	settings.SetFilter("c4", Filter{MinUSD: 1000000})
+	settings.SetTimezone("g1", "Europe/Paris")
+	loaded.Settings = settings
+
+	if err := loaded.Leave("g1"); err != nil {
+		t.Fatal(err)
+	}
+	if targets := loaded.Targets(); len(targets) != 1 {
+		t.Errorf("expected the channels of the guild that left to go, got %+v", targets)
+	}
+	if _, ok := settings.Filters["c1"]; ok || settings.Timezone("g1") != time.UTC {
+		t.Error("expected the settings of the guild that left to be cleared")
+	}
+	if _, ok := settings.Filters["c4"]; !ok {
+		t.Error("expected the settings of the other guild to be kept")
+	}
+}
+
+func TestReloaderTenants(t *testing.T) {
+	tenants, err := LoadTenants(filepath.Join(t.TempDir(), "tenants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Reloader{Pipeline: &Pipeline{}, Tenants: tenants, NewSink: func(cfg BotConfig, target Target) Sink { return &recordingSink{} }}
+	tenants.SetOnChange(r.Refresh)
+	r.Load(BotConfig{Hosted: true})
+	if len(r.Targets()) != 0 {
+		t.Fatalf("expected no targets before the tenants add channels, got %v", r.Targets())
+	}
+
+	if err := tenants.Join("g1", "First", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.AddChannel("g1", "c1", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if targets := r.Targets(); len(targets) != 1 || targets[0].Channel != "c1" {
+		t.Errorf("expected the channel of the tenant, got %v", targets)
+	}
+}
+
+func TestTenantSides(t *testing.T) {
+	tenants, err := LoadTenants(filepath.Join(t.TempDir(), "tenants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants.Defaults = Target{Filter: Filter{MinUSD: 100000, Symbols: []Symbol{"XBTUSD"}}}
+	if err := tenants.Join("g1", "First", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tenants.AddChannel("g1", "longs", []string{"long"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.AddChannel("g1", "shorts", []string{"short"}, []Symbol{"ETHUSD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	long, short := Liquidation{Symbol: "XBTUSD", Side: "Sell", USD: 200000}, Liquidation{Symbol: "ETHUSD", Side: "Buy", USD: 200000}
+	targets := tenants.Targets()
+	if len(targets) != 2 || !targets[0].Match(long, nil) || targets[0].Match(short, nil) || targets[1].Match(long, nil) || !targets[1].Match(short, nil) {
+		t.Errorf("expected the longs and the shorts in their own channels, got %+v", targets)
+	}
+	if targets[0].MinUSD != 100000 {
+		t.Errorf("expected the other defaults to be kept, got %+v", targets[0])
+	}
+
+	if text := routeText([]string{"short"}, []Symbol{"ETHUSD"}); text != "liquidated shorts of ETHUSD" {
+		t.Errorf("unexpected route %q", text)
+	}
+}
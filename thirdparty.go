@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// ThirdPartyTotals fetches the liquidation totals of the exchanges the bot doesn't connect to
+	// from an aggregator such as Coinglass. They only ever go in the summaries, labeled as theirs,
+	// since they can't be checked against the feeds.
+	ThirdPartyTotals struct {
+		URL     string            // {from} and {to} are replaced with the Unix times of the period
+		Name    string            // Credited in the summaries along with the label, e.g. "Coinglass"
+		Headers map[string]string // Sent along, for the API key
+		Exclude []string          // Exchanges the bot counts itself, case insensitive
+		Client  *http.Client
+	}
+
+	// thirdPartyVenue is a row of the response: a list of them, or an object with the list as its
+	// data, the way Coinglass wraps its responses.
+	thirdPartyVenue struct {
+		Exchange  string  `json:"exchange"`
+		LongsUSD  float64 `json:"longs_usd"`
+		ShortsUSD float64 `json:"shorts_usd"`
+	}
+)
+
+// Fetch returns the totals by exchange over the period, those excluded left out, the largest first.
+func (t *ThirdPartyTotals) Fetch(from, to time.Time) ([]thirdPartyVenue, error) {
+	u := strings.NewReplacer(
+		"{from}", strconv.FormatInt(from.Unix(), 10),
+		"{to}", strconv.FormatInt(to.Unix(), 10),
+	).Replace(t.URL)
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range t.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v", resp.Status)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, errwrap.Wrapf("bad third-party totals: {{err}}", err)
+	}
+	if len(raw) > 0 && raw[0] == '{' {
+		var wrapped struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, errwrap.Wrapf("bad third-party totals: {{err}}", err)
+		}
+		raw = wrapped.Data
+	}
+
+	var rows []thirdPartyVenue
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, errwrap.Wrapf("bad third-party totals: {{err}}", err)
+	}
+
+	var venues []thirdPartyVenue
+	for _, row := range rows {
+		if row.Exchange != "" && !t.excluded(row.Exchange) && row.LongsUSD+row.ShortsUSD > 0 {
+			venues = append(venues, row)
+		}
+	}
+	sort.SliceStable(venues, func(i, j int) bool {
+		return venues[i].LongsUSD+venues[i].ShortsUSD > venues[j].LongsUSD+venues[j].ShortsUSD
+	})
+	return venues, nil
+}
+
+func (t *ThirdPartyTotals) excluded(exchange string) bool {
+	for _, e := range t.Exclude {
+		if strings.EqualFold(e, exchange) {
+			return true
+		}
+	}
+	return false
+}
+
+// thirdPartyText sums up the other exchanges, labeled as third-party data and crediting the source when named:
+// "Other exchanges (third-party data, Coinglass): $310.0M rekt (longs $200.0M / shorts $110.0M) on Binance, Bybit, OKX".
+func thirdPartyText(source string, venues []thirdPartyVenue, f NumberFormat) string {
+	var longs, shorts int64
+	var names []string
+	for _, v := range venues {
+		longs += int64(v.LongsUSD)
+		shorts += int64(v.ShortsUSD)
+		names = append(names, v.Exchange)
+	}
+
+	label := "third-party data"
+	if source != "" {
+		label += ", " + source
+	}
+
+	return fmt.Sprintf("Other exchanges (%v): %v rekt (longs %v / shorts %v) on %v", label,
+		f.Short(longs+shorts), f.Short(longs), f.Short(shorts), strings.Join(names, ", "))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThirdPartyTotals(t *testing.T) {
+	var query, key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, key = r.URL.RawQuery, r.Header.Get("CG-API-KEY")
+		fmt.Fprint(w, `{"code": "0", "data": [
+			{"exchange": "Bybit", "longs_usd": 40000000, "shorts_usd": 10000000},
+			{"exchange": "BitMEX", "longs_usd": 5000000, "shorts_usd": 0},
+			{"exchange": "Binance", "longs_usd": 160000000, "shorts_usd": 100000000},
+			{"exchange": "Quiet", "longs_usd": 0, "shorts_usd": 0}
+		]}`)
+	}))
+	defer server.Close()
+
+	totals := &ThirdPartyTotals{
+		URL:     server.URL + "/liquidations?from={from}&to={to}",
+		Name:    "Coinglass",
+		Headers: map[string]string{"CG-API-KEY": "key"},
+		Exclude: []string{"BitMex"},
+		Client:  server.Client(),
+	}
+
+	from := time.Date(2024, time.March, 26, 0, 0, 0, 0, time.UTC)
+	venues, err := totals.Fetch(from, from.Add(day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "from=1711411200&to=1711497600" || key != "key" {
+		t.Errorf("unexpected request %q with key %q", query, key)
+	}
+
+	expected := "Other exchanges (third-party data, Coinglass): $310.0M rekt (longs $200.0M / shorts $110.0M) on Binance, Bybit"
+	if text := thirdPartyText(totals.Name, venues, DefaultFormat); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord allows renaming a channel twice every 10 minutes.
+const minTickerInterval = 5 * time.Minute
+
+// VoiceTicker renames a locked voice channel to the liquidations of the last 24h, so the total sits in the channel list.
+type VoiceTicker struct {
+	Session  *discordgo.Session
+	Channel  string
+	History  *History
+	Interval time.Duration
+	Format   NumberFormat
+
+	// Active tells whether this replica should rename, it always does when nil
+	Active func() bool
+}
+
+// Run renames the channel every interval, when the total changed.
+func (t *VoiceTicker) Run() {
+	interval := t.Interval
+	if interval < minTickerInterval {
+		interval = minTickerInterval
+	}
+
+	var last string
+	for ; ; time.Sleep(interval) {
+		if t.Active != nil && !t.Active() {
+			last = ""
+			continue
+		}
+
+		name := tickerName(t.History.Since(time.Now().Add(-day), nil), t.Format)
+		if name == last {
+			continue
+		}
+
+		if _, err := t.Session.ChannelEdit(t.Channel, &discordgo.ChannelEdit{Name: name}); err != nil {
+			log.Println("Failed to rename the ticker channel:", err)
+			continue
+		}
+		last = name
+	}
+}
+
+// tickerName is the channel name for the liquidations: "💀 $1.2B rekt today".
+func tickerName(liquidations []Liquidation, f NumberFormat) string {
+	var usd int64
+	for _, l := range liquidations {
+		usd += l.USDValue()
+	}
+	return "\U0001F480 " + f.Short(usd) + " rekt today"
+}
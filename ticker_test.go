@@ -0,0 +1,10 @@
+package main
+
+import "testing"
+
+func TestTickerName(t *testing.T) {
+	name := tickerName([]Liquidation{{USD: 1000000000}, {USD: 250000000}}, DefaultFormat)
+	if expected := "\U0001F480 $1.2B rekt today"; name != expected {
+		t.Errorf("expected %q, got %q", expected, name)
+	}
+}
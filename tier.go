@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Tier is a size class of liquidations with its own message: the smallest get the plain line,
+	// the largest a template and a colored embed making them stand out.
+	Tier struct {
+		Name   string  `json:"name"`    // Such as "whale", what the filters of the targets route by
+		MinUSD float64 `json:"min_usd"` // Liquidations at least this large, below the next tier
+
+		// Template of the message, in Go's text/template with the fields of tierMessage, the
+		// plain line when empty: "🚨 **{{.Text}}**".
+		Template string `json:"template"`
+
+		// Color of the embed the message is posted in, "#e74c3c", a plain message when empty.
+		Color string `json:"color"`
+
+		template *template.Template
+		color    int
+	}
+
+	// Tiers are the tiers of the liquidations, sorted by size.
+	Tiers []Tier
+
+	// tierMessage is what the templates of the tiers are executed with.
+	tierMessage struct {
+		Tier        string
+		Text        string // The plain line, with the medals and the extras
+		USD         string // Worth of the liquidation, abbreviated: $1.2M
+		Liquidation Liquidation
+	}
+)
+
+// tiers are those of config.json, which the filters route by, set by main and on every reload.
+var (
+	tiersMu sync.RWMutex
+	tiers   Tiers
+)
+
+// currentTiers returns the tiers the filters route by.
+func currentTiers() Tiers {
+	tiersMu.RLock()
+	defer tiersMu.RUnlock()
+
+	return tiers
+}
+
+// setTiers replaces the tiers the filters route by.
+func setTiers(ts Tiers) {
+	tiersMu.Lock()
+	defer tiersMu.Unlock()
+
+	tiers = ts
+}
+
+// Compile sorts the tiers and parses their templates and colors.
+func (ts Tiers) Compile() error {
+	sort.SliceStable(ts, func(i, j int) bool { return ts[i].MinUSD < ts[j].MinUSD })
+
+	for i := range ts {
+		t := &ts[i]
+		if t.Name == "" {
+			return fmt.Errorf("tier %v has no name", i+1)
+		}
+
+		if t.Template != "" {
+			tmpl, err := template.New(t.Name).Parse(t.Template)
+			if err != nil {
+				return errwrap.Wrapf("invalid template of the "+t.Name+" tier: {{err}}", err)
+			}
+			t.template = tmpl
+		}
+
+		if t.Color != "" {
+			color, err := strconv.ParseInt(strings.TrimPrefix(t.Color, "#"), 16, 32)
+			if err != nil || color < 0 || color > 0xffffff {
+				return fmt.Errorf("invalid color %q of the %v tier, expected such as #e74c3c", t.Color, t.Name)
+			}
+			t.color = int(color)
+		}
+	}
+	return nil
+}
+
+// Of returns the tier of a liquidation worth usd, the zero Tier under the smallest.
+func (ts Tiers) Of(usd float64) Tier {
+	var tier Tier
+	for _, t := range ts {
+		if usd >= t.MinUSD {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// Names returns the names of the tiers, smallest first.
+func (ts Tiers) Names() []string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Text writes the message about the liquidation, through the template of the tier when it has one.
+func (t Tier) Text(dl DecoratedLiquidation, f NumberFormat) string {
+	text := dl.Format(f)
+	if t.template == nil {
+		return text
+	}
+
+	var buf bytes.Buffer
+	message := tierMessage{Tier: t.Name, Text: text, USD: f.Short(dl.Liquidation.USDValue()), Liquidation: dl.Liquidation}
+	if err := t.template.Execute(&buf, message); err != nil {
+		log.Println("Failed to write the message of the "+t.Name+" tier:", err)
+		return text
+	}
+	return buf.String()
+}
+
+// Embed returns the embed the text is posted in, nil when the tier has no color.
+func (t Tier) Embed(text string) *discordgo.MessageEmbed {
+	if t.Color == "" {
+		return nil
+	}
+	return &discordgo.MessageEmbed{Description: text, Color: t.color}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTiers(t *testing.T) {
+	ts := Tiers{
+		{Name: "whale", MinUSD: 1000000, Template: "🐋 {{.Text}} ({{.USD}})", Color: "#3498db"},
+		{Name: "minnow"},
+	}
+	if err := ts.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if names := ts.Names(); len(names) != 2 || names[0] != "minnow" || names[1] != "whale" {
+		t.Fatalf("expected the tiers sorted by size, got %v", names)
+	}
+
+	small := DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Buy", Quantity: 1000, Price: 60000, USD: 1000}}
+	if tier := ts.Of(1000); tier.Name != "minnow" || tier.Text(small, DefaultFormat) != small.Format(DefaultFormat) || tier.Embed("") != nil {
+		t.Errorf("expected the plain message of the minnows, got %v", tier.Name)
+	}
+
+	large := DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Buy", Quantity: 2000000, Price: 60000, USD: 2000000}}
+	tier := ts.Of(2000000)
+	if text, expected := tier.Text(large, DefaultFormat), "🐋 "+large.Format(DefaultFormat)+" ($2.0M)"; text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+	if embed := tier.Embed("text"); embed == nil || embed.Color != 0x3498db || embed.Description != "text" {
+		t.Errorf("expected a blue embed, got %+v", embed)
+	}
+
+	for _, invalid := range []Tiers{
+		{{Name: "whale", Template: "{{.Text"}},
+		{{Name: "whale", Color: "blue"}},
+		{{MinUSD: 1}},
+	} {
+		if err := invalid.Compile(); err == nil {
+			t.Errorf("expected %+v to be refused", invalid[0])
+		}
+	}
+}
+
+func TestFilterTiers(t *testing.T) {
+	defer setTiers(currentTiers())
+	setTiers(Tiers{{Name: "minnow"}, {Name: "whale", MinUSD: 1000000}})
+
+	f := Filter{Tiers: []string{"whale"}}
+	if f.Match(Liquidation{Symbol: "XBTUSD", USD: 1000}, nil) {
+		t.Error("expected the minnows to be filtered out")
+	}
+	if !f.Match(Liquidation{Symbol: "XBTUSD", USD: 5000000}, nil) {
+		t.Error("expected the whales to match")
+	}
+}
+
+func TestDiscordSinkTiers(t *testing.T) {
+	defer setTiers(currentTiers())
+	s := &DiscordSink{Format: DefaultFormat}
+	dl := DecoratedLiquidation{Liquidation: Liquidation{Symbol: "XBTUSD", Side: "Buy", Quantity: 2000000, Price: 60000, USD: 2000000}}
+	if text := s.status(dl); text != dl.Format(DefaultFormat) {
+		t.Fatalf("expected the plain line without tiers, got %q", text)
+	}
+
+	// A reload changes the tiers of the sinks already built
+	ts := Tiers{{Name: "whale", Template: "🐋 {{.Text}}"}}
+	if err := ts.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	setTiers(ts)
+	if text, expected := s.status(dl), "🐋 "+dl.Format(DefaultFormat); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans waiting to be exported beyond this are dropped, so a dead collector can't eat the memory.
+const maxPendingSpans = 4096
+
+type (
+	// Tracer exports spans to an OpenTelemetry collector over OTLP/HTTP, in its JSON encoding.
+	// It does nothing until Endpoint is set.
+	Tracer struct {
+		Endpoint string // e.g. "http://localhost:4318"
+		Service  string
+		Client   *http.Client
+
+		mu      sync.Mutex
+		pending []*Span
+	}
+
+	// Span is a timed stage of the work on a liquidation. A nil span, as returned by a disabled
+	// tracer, can be used all the same.
+	Span struct {
+		tracer     *Tracer
+		traceID    [16]byte
+		spanID     [8]byte
+		parentID   [8]byte
+		name       string
+		start, end time.Time
+		attributes map[string]string
+	}
+
+	// otlpKeyValue is an attribute in the OTLP JSON encoding.
+	otlpKeyValue struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+)
+
+// traces is the tracer used throughout the bot, disabled until configured.
+var traces = &Tracer{Service: "rekt"}
+
+// Start begins a trace with a span that started at start.
+func (t *Tracer) Start(name string, start time.Time) *Span {
+	if t.Endpoint == "" {
+		return nil
+	}
+
+	s := &Span{tracer: t, name: name, start: start}
+	rand.Read(s.traceID[:])
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// Child begins a span within s.
+func (s *Span) Child(name string, start time.Time) *Span {
+	if s == nil {
+		return nil
+	}
+
+	child := &Span{tracer: s.tracer, traceID: s.traceID, parentID: s.spanID, name: name, start: start}
+	rand.Read(child.spanID[:])
+	return child
+}
+
+// SetAttribute annotates the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// Finish ends the span at end and queues it for export.
+func (s *Span) Finish(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.end = end
+
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) >= maxPendingSpans {
+		metrics.Counter("rekt_spans_dropped_total").Inc()
+		return
+	}
+	t.pending = append(t.pending, s)
+}
+
+// Run exports the finished spans every interval.
+func (t *Tracer) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := t.flush(); err != nil {
+			log.Println("Failed to export the traces:", err)
+		}
+	}
+}
+
+func (t *Tracer) flush() error {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.payload(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.Client.Post(strings.TrimSuffix(t.Endpoint, "/")+"/v1/traces", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// payload is the ExportTraceServiceRequest of the spans.
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+func (t *Tracer) payload(spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, len(spans))
+	for i, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		encoded[i] = span
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]string{"service.name": t.Service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "rekt"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keyValues := make([]otlpKeyValue, 0, len(attributes))
+	for key, value := range attributes {
+		kv := otlpKeyValue{Key: key}
+		kv.Value.StringValue = value
+		keyValues = append(keyValues, kv)
+	}
+	return keyValues
+}
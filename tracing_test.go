@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracerExport(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	tracer := &Tracer{Endpoint: server.URL, Service: "rekt", Client: server.Client()}
+	start := time.Unix(1700000000, 0)
+	root := tracer.Start("liquidation", start)
+	root.SetAttribute("symbol", "XBTUSD")
+	root.Child("decorate", start.Add(time.Millisecond)).Finish(start.Add(2 * time.Millisecond))
+	root.Finish(start.Add(5 * time.Millisecond))
+
+	if err := tracer.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Start        string `json:"startTimeUnixNano"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		t.Fatalf("bad export %q: %v", body, err)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Name != "decorate" || spans[1].Name != "liquidation" {
+		t.Fatalf("expected the child then the root span, got %+v", spans)
+	}
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Errorf("expected the child to be in the root's trace, got %+v", spans)
+	}
+	if spans[1].Start != "1700000000000000000" || !strings.Contains(body, `"service.name"`) {
+		t.Errorf("unexpected export %v", body)
+	}
+
+	// A disabled tracer hands out nil spans that can still be used
+	disabled := &Tracer{}
+	span := disabled.Start("liquidation", start)
+	span.Child("decorate", start).Finish(start)
+	span.SetAttribute("symbol", "XBTUSD")
+	span.Finish(start)
+}
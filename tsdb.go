@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// InfluxSink writes every liquidation to InfluxDB as a point, for building dashboards.
+	// Tags: exchange, symbol, side. Fields: price, qty, usd.
+	InfluxSink struct {
+		URL    string // e.g. "http://localhost:8086"
+		Token  string
+		Org    string
+		Bucket string
+		Client *http.Client
+	}
+
+	// TimescaleSink writes every liquidation as a row of a TimescaleDB hypertable.
+	TimescaleSink struct {
+		DB *sql.DB
+	}
+)
+
+// influxMeasurement is the measurement the points are written to.
+const influxMeasurement = "liquidation"
+
+// Publish implements Sink.
+func (s *InfluxSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return errwrap.Wrapf("invalid InfluxDB URL: {{err}}", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	u.RawQuery = url.Values{"org": {s.Org}, "bucket": {s.Bucket}, "precision": {"ns"}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(influxLine(dl.Liquidation)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return errwrap.Wrapf("could not write to InfluxDB: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("could not write to InfluxDB: %v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// Announce implements Sink, there is nothing to record.
+func (s *InfluxSink) Announce(ctx context.Context, text string) error {
+	return nil
+}
+
+// influxLine writes the liquidation in the line protocol:
+// liquidation,exchange=BitMex,side=Sell,symbol=XBTUSD price=9000.5,qty=20000i,usd=20000 1500000000000000000
+func influxLine(l Liquidation) string {
+	var b strings.Builder
+	b.WriteString(influxMeasurement)
+
+	// Tags sorted by key, as InfluxDB recommends, leaving out the empty ones it would reject
+	for _, tag := range [][2]string{{"exchange", l.Exchange}, {"side", l.Side}, {"symbol", string(l.Symbol)}} {
+		if tag[1] != "" {
+			b.WriteString("," + tag[0] + "=" + influxEscape(tag[1]))
+		}
+	}
+
+	fmt.Fprintf(&b, " key=\"%v\",price=%v,qty=%vi,usd=%v %v", influxEscapeString(l.IdempotencyKey(StagePosted)),
+		strconv.FormatFloat(l.Price, 'f', -1, 64), l.Quantity, l.USDValue(), liquidationTime(l).UnixNano())
+
+	return b.String()
+}
+
+// influxEscape escapes a tag value for the line protocol.
+func influxEscape(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
+
+// influxEscapeString escapes a string field value for the line protocol.
+func influxEscapeString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// liquidationTime is when the liquidation happened, as close as we know.
+func liquidationTime(l Liquidation) time.Time {
+	if l.Received.IsZero() {
+		return time.Now()
+	}
+	return l.Received
+}
+
+// NewTimescaleSink connects to the database and creates the hypertable if needed.
+func NewTimescaleSink(dsn string) (*TimescaleSink, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS liquidations (
+			time     TIMESTAMPTZ      NOT NULL,
+			exchange TEXT             NOT NULL,
+			symbol   TEXT             NOT NULL,
+			side     TEXT             NOT NULL,
+			price    DOUBLE PRECISION NOT NULL,
+			qty      BIGINT           NOT NULL,
+			usd      DOUBLE PRECISION NOT NULL,
+			idempotency_key TEXT
+		)`,
+		`SELECT create_hypertable('liquidations', 'time', if_not_exists => TRUE)`,
+		// The tables created before the keys get the column, their rows without a key
+		`ALTER TABLE liquidations ADD COLUMN IF NOT EXISTS idempotency_key TEXT`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS liquidations_idempotency_key ON liquidations (idempotency_key, time)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, errwrap.Wrapf("could not create the liquidations table: {{err}}", err)
+		}
+	}
+
+	return &TimescaleSink{DB: db}, nil
+}
+
+// Publish implements Sink. A liquidation written already, by a retry or before a restart, is skipped.
+func (s *TimescaleSink) Publish(ctx context.Context, dl DecoratedLiquidation) error {
+	l := dl.Liquidation
+	_, err := s.DB.ExecContext(ctx, `INSERT INTO liquidations (time, exchange, symbol, side, price, qty, usd, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`,
+		liquidationTime(l), l.Exchange, string(l.Symbol), l.Side, l.Price, l.Quantity, l.USDValue(), l.IdempotencyKey(StagePosted))
+	if err != nil {
+		return errwrap.Wrapf("could not write to TimescaleDB: {{err}}", err)
+	}
+
+	return nil
+}
+
+// Find implements Finder.
+func (s *TimescaleSink) Find(q FindQuery) ([]Liquidation, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = findLimit
+	}
+
+	rows, err := s.DB.Query(`SELECT time, exchange, symbol, side, price, qty, usd FROM liquidations
+		WHERE time >= $1 AND ($2 = '' OR symbol = $2) AND usd >= $3
+		ORDER BY time DESC LIMIT $4`, q.Since, string(q.Symbol), q.MinUSD, limit)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not search TimescaleDB: {{err}}", err)
+	}
+	defer rows.Close()
+
+	var found []Liquidation
+	for rows.Next() {
+		var l Liquidation
+		var symbol string
+		if err := rows.Scan(&l.Received, &l.Exchange, &symbol, &l.Side, &l.Price, &l.Quantity, &l.USD); err != nil {
+			return nil, errwrap.Wrapf("could not search TimescaleDB: {{err}}", err)
+		}
+		l.Symbol = Symbol(symbol)
+		found = append(found, l)
+	}
+
+	return found, rows.Err()
+}
+
+// Announce implements Sink, there is nothing to record.
+func (s *TimescaleSink) Announce(ctx context.Context, text string) error {
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	l := Liquidation{
+		Price:    9000.5,
+		Quantity: 20000,
+		Symbol:   "XBTUSD",
+		Side:     "Sell",
+		Exchange: "Bit Mex",
+		Received: time.Unix(1500000000, 0),
+	}
+
+	expected := `liquidation,exchange=Bit\ Mex,side=Sell,symbol=XBTUSD key="bit mex:bb4e8ce1ca42e5aa:posted",price=9000.5,qty=20000i,usd=20000 1500000000000000000`
+	if line := influxLine(l); line != expected {
+		t.Errorf("expected %v, got %v", expected, line)
+	}
+
+	l.Exchange = ""
+	l.OrderID = `a"b`
+	expected = `liquidation,side=Sell,symbol=XBTUSD key=":a\"b:posted",price=9000.5,qty=20000i,usd=20000 1500000000000000000`
+	if line := influxLine(l); line != expected {
+		t.Errorf("expected the empty tag to be left out, got %v", line)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Set when building a release:
+// go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
+// startedAt is when the process started, for the uptime.
+var startedAt = time.Now()
+
+// BuildInfo identifies the running build.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildInfo returns the version set at build time, the commit and date falling back to what
+// the Go toolchain stamped in the binary.
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+
+	return info
+}
+
+// String describes the build: "rekt 1.2.0 (3f2c1ab, built 2024-06-01T12:00:00Z, go1.22.3)".
+func (b BuildInfo) String() string {
+	details := ""
+	if b.Commit != "" {
+		details += b.Commit + ", "
+	}
+	if b.BuildDate != "" {
+		details += "built " + b.BuildDate + ", "
+	}
+	return fmt.Sprintf("rekt %v (%v%v)", b.Version, details, b.GoVersion)
+}
+
+// versionCommand prints the build: rekt version
+func versionCommand(ctx context.Context, args []string) error {
+	fmt.Println(buildInfo())
+	return nil
+}
+
+// serveHealth answers /healthz with the build and uptime, for the load balancers and bug reports.
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+		BuildInfo
+		UptimeSeconds int64 `json:"uptime_seconds"`
+	}{"ok", buildInfo(), int64(time.Since(startedAt).Seconds())})
+}
+
+// aboutCommand tells which build is running and for how long.
+func aboutCommand() *SlashCommand {
+	return &SlashCommand{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "about",
+			Description: "Version of the bot and how long it has been running",
+		},
+		Handle: func(req *CommandRequest) (*discordgo.InteractionResponseData, error) {
+			return &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("%v, up for %v", buildInfo(), durationText(time.Since(startedAt).Round(time.Minute))),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildInfoString(t *testing.T) {
+	info := BuildInfo{Version: "1.2.0", Commit: "3f2c1ab", BuildDate: "2024-06-01T12:00:00Z", GoVersion: "go1.22.3"}
+	if want := "rekt 1.2.0 (3f2c1ab, built 2024-06-01T12:00:00Z, go1.22.3)"; info.String() != want {
+		t.Errorf("expected %q, got %q", want, info.String())
+	}
+
+	if want := "rekt dev (go1.22.3)"; (BuildInfo{Version: "dev", GoVersion: "go1.22.3"}).String() != want {
+		t.Errorf("expected %q without the commit and date", want)
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	rec := httptest.NewRecorder()
+	serveHealth(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+	var health map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if health["status"] != "ok" || health["version"] != version || health["go_version"] == "" {
+		t.Errorf("expected the status and build, got %v", health)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/errwrap"
+)
+
+type (
+	// Trade is a single trade on an exchange.
+	Trade struct {
+		Exchange string
+		Symbol   string
+		Side     string // Side of the taker, "Buy" or "Sell"
+		Price    float64
+		Size     float64 // Amount of the base coin
+		USD      float64
+	}
+
+	// WhaleFeed posts the trades worth at least MinUSD, next to the liquidations but in their own channel.
+	WhaleFeed struct {
+		MinUSD   float64
+		Pipeline *Pipeline // Delivers to the whale channel
+		Format   NumberFormat
+	}
+
+	// BinanceTrades streams the aggregated trades of Binance spot symbols into a whale feed.
+	BinanceTrades struct {
+		URL     string   // The combined stream endpoint
+		Symbols []string // Lower case, such as "btcusdt"
+		Dialer  *websocket.Dialer
+		Feed    *WhaleFeed
+
+		// Quarantine keeps the frames that couldn't be decoded, they are only logged when nil.
+		Quarantine *Quarantine
+
+		// Prices get the price of every trade, when set.
+		Prices *PriceCache
+
+		mu     sync.Mutex
+		health ConnectionHealth // What /status reports
+	}
+
+	// binanceAggTrade is the payload of an aggTrade stream.
+	binanceAggTrade struct {
+		Symbol       string `json:"s"`
+		Price        string `json:"p"`
+		Quantity     string `json:"q"`
+		BuyerIsMaker bool   `json:"m"`
+	}
+)
+
+const binanceStreamURL = "wss://stream.binance.com:9443/stream"
+
+// Format writes the trade: "🐋 Binance BTCUSDT: Buy 152.3 @ 65,000.1 ($9.9M)".
+func (t Trade) Format(f NumberFormat) string {
+	return fmt.Sprintf("🐋 %v %v: %v %v @ %v (%v)",
+		t.Exchange, t.Symbol, t.Side, f.Price(t.Size), f.Price(t.Price), f.Short(int64(t.USD)))
+}
+
+// Observe posts the trade if it is large enough.
+func (w *WhaleFeed) Observe(t Trade) {
+	if t.USD < w.MinUSD {
+		return
+	}
+
+	metrics.Counter("rekt_whale_trades_total", "exchange", t.Exchange).Inc()
+	w.Pipeline.Announce(t.Format(w.Format))
+}
+
+// HandleBitMex takes the trades of the BitMex trade table, the perpetuals and futures.
+func (w *WhaleFeed) HandleBitMex(action string, rows []interface{}, received time.Time) {
+	if action != "insert" {
+		return
+	}
+
+	for _, row := range rows {
+		row, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// The foreign notional is in the quote currency, which is USD or a stable coin for the contracts worth watching
+		price, _ := row["price"].(float64)
+		size, _ := row["homeNotional"].(float64)
+		usd, _ := row["foreignNotional"].(float64)
+		symbol, _ := row["symbol"].(string)
+		side, _ := row["side"].(string)
+		if symbol == "" || side == "" {
+			continue
+		}
+		w.Observe(Trade{
+			Exchange: "BitMex",
+			Symbol:   symbol,
+			Side:     side,
+			Price:    price,
+			Size:     size,
+			USD:      usd,
+		})
+	}
+}
+
+// RunForever streams the trades, reconnecting after delay whenever the connection fails, until
+// the context is done.
+func (b *BinanceTrades) RunForever(ctx context.Context, delay time.Duration) {
+	for {
+		err := b.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.mu.Lock()
+		b.health.Connected, b.health.Since = false, time.Now()
+		b.health.Reconnects++
+		b.mu.Unlock()
+
+		log.Printf("Disconnected from the Binance trades, reconnecting in %v: %v\n", delay, err)
+		if !sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+// Health reports the connection for /status.
+func (b *BinanceTrades) Health() ConnectionHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.health
+	h.Name = "Binance trades"
+	return h
+}
+
+// Run connects to Binance and processes the trades until the connection fails or the context is done.
+func (b *BinanceTrades) Run(ctx context.Context) error {
+	endpoint, err := b.streamURL()
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := b.Dialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return errwrap.Wrapf("could not connect to Binance: {{err}}", err)
+	}
+	defer conn.Close()
+
+	// Closing the connection ends the read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			conn.Close()
+		}
+	}()
+
+	log.Println("Connected to the Binance trades:", endpoint)
+	b.mu.Lock()
+	b.health.Connected, b.health.Since = true, time.Now()
+	b.mu.Unlock()
+
+	for {
+		// Binance pings every few minutes, the default handler answers
+		conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+
+		_, msg, err := conn.ReadMessage()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+		received := time.Now()
+		b.mu.Lock()
+		b.health.LastMessage = received
+		b.mu.Unlock()
+
+		var frame struct {
+			Data json.RawMessage `json:"data"`
+		}
+		var trade binanceAggTrade
+		if err := json.Unmarshal(msg, &frame); err != nil {
+			b.Quarantine.Save("Binance", received, msg, err)
+			continue
+		}
+		if err := json.Unmarshal(frame.Data, &trade); err != nil {
+			b.Quarantine.Save("Binance", received, msg, err)
+			continue
+		}
+
+		t, err := trade.Trade()
+		if err != nil {
+			b.Quarantine.Save("Binance", received, msg, err)
+			continue
+		}
+		if b.Prices != nil {
+			b.Prices.ObserveTrade(t, received)
+		}
+		b.Feed.Observe(t)
+	}
+}
+
+// streamURL returns the endpoint with the aggregated trade streams of the symbols in the query.
+func (b *BinanceTrades) streamURL() (string, error) {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return "", errwrap.Wrapf("invalid Binance URL: {{err}}", err)
+	}
+
+	streams := make([]string, len(b.Symbols))
+	for i, symbol := range b.Symbols {
+		streams[i] = strings.ToLower(symbol) + "@aggTrade"
+	}
+	query := u.Query()
+	query.Set("streams", strings.Join(streams, "/"))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Trade converts the payload, valuing it in the quote currency.
+func (a binanceAggTrade) Trade() (Trade, error) {
+	price, err := strconv.ParseFloat(a.Price, 64)
+	if err != nil {
+		return Trade{}, err
+	}
+	size, err := strconv.ParseFloat(a.Quantity, 64)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	// The buyer being the maker means the taker sold
+	side := "Buy"
+	if a.BuyerIsMaker {
+		side = "Sell"
+	}
+
+	return Trade{Exchange: "Binance", Symbol: a.Symbol, Side: side, Price: price, Size: size, USD: price * size}, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhaleFeed(t *testing.T) {
+	sink := &recordingSink{}
+	feed := &WhaleFeed{MinUSD: 1000000, Pipeline: &Pipeline{Sinks: []Sink{sink}}, Format: DefaultFormat}
+
+	small, err := binanceAggTrade{Symbol: "BTCUSDT", Price: "65000.1", Quantity: "0.5", BuyerIsMaker: true}.Trade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Observe(small)
+
+	large, err := binanceAggTrade{Symbol: "BTCUSDT", Price: "65000.1", Quantity: "152.3"}.Trade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Observe(large)
+
+	// The malformed rows are skipped rather than taking the feed down
+	feed.HandleBitMex("insert", []interface{}{"XBTUSD", map[string]interface{}{
+		"side": "Buy", "price": 65000.5, "homeNotional": 30.0, "foreignNotional": 1950015.0,
+	}, map[string]interface{}{
+		"symbol": "XBTUSD", "side": "Sell", "price": 65000.5, "homeNotional": 30.0, "foreignNotional": 1950015.0,
+	}}, time.Now())
+
+	expected := []string{
+		"🐋 Binance BTCUSDT: Buy 152.3 @ 65000.1 ($9.9M)",
+		"🐋 BitMex XBTUSD: Sell 30 @ 65000.5 ($2.0M)",
+	}
+	if len(sink.announced) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, sink.announced)
+	}
+	for i, text := range sink.announced {
+		if text != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], text)
+		}
+	}
+}
+
+func TestBinanceStreamURL(t *testing.T) {
+	b := &BinanceTrades{URL: binanceStreamURL, Symbols: []string{"BTCUSDT", "ethusdt"}}
+	endpoint, err := b.streamURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := binanceStreamURL + "?streams=btcusdt%40aggTrade%2Fethusdt%40aggTrade"; endpoint != expected {
+		t.Errorf("expected %v, got %v", expected, endpoint)
+	}
+}